@@ -0,0 +1,219 @@
+// Package analysis builds control-flow graphs of method code: basic blocks
+// joined by normal and exceptional edges, the dominator tree and the
+// natural loops.
+package analysis
+
+import (
+	"fmt"
+	"outro/interpreter"
+	"outro/rtda"
+	"sort"
+)
+
+// EdgeKind tells how control passes along an edge.
+type EdgeKind int
+
+const (
+	// FallThrough continues with the next instruction in code order.
+	FallThrough EdgeKind = iota
+	// Jump is taken by a branch, goto, jsr or switch.
+	Jump
+	// Exception leads from a block inside a try range to its handler.
+	Exception
+)
+
+func (k EdgeKind) String() string {
+	switch k {
+	case FallThrough:
+		return "fallthrough"
+	case Jump:
+		return "jump"
+	case Exception:
+		return "exception"
+	}
+	return fmt.Sprintf("EdgeKind(%d)", int(k))
+}
+
+// Edge joins two blocks. CatchType is the class caught by an Exception
+// edge, empty for any exception.
+type Edge struct {
+	From      *Block
+	To        *Block
+	Kind      EdgeKind
+	CatchType string
+}
+
+// Block is a basic block: instructions executed in sequence, entered only
+// at the first and left only after the last.
+type Block struct {
+	// Index is the position of the block in Graph.Blocks.
+	Index int
+	// Start and End are the offsets of the first instruction and the one
+	// after the last.
+	Start        int
+	End          int
+	Instructions []interpreter.Instruction
+	Successors   []*Edge
+	Predecessors []*Edge
+	// Handler marks the entry of an exception handler.
+	Handler bool
+	// IDom is the immediate dominator, nil for the entry and for blocks
+	// not reachable from it.
+	IDom *Block
+	// Loop is the innermost loop containing the block, or nil.
+	Loop *Loop
+}
+
+func (b *Block) String() string {
+	return fmt.Sprintf("B%d", b.Index)
+}
+
+// Last returns the final instruction of the block.
+func (b *Block) Last() *interpreter.Instruction {
+	return &b.Instructions[len(b.Instructions)-1]
+}
+
+// Graph is the control-flow graph of a method. Blocks are in code order,
+// so Blocks[0] is the entry.
+type Graph struct {
+	Method *rtda.Method
+	Blocks []*Block
+	// Loops are ordered by header, outer loops before the loops they
+	// contain.
+	Loops []*Loop
+	// order holds the blocks reachable from the entry in reverse postorder.
+	order []*Block
+}
+
+// Build decodes the code of method and builds its control-flow graph.
+func Build(method *rtda.Method) (*Graph, error) {
+	if len(method.Code) == 0 {
+		return nil, fmt.Errorf("method %s%s has no code", method.Name, method.Descriptor)
+	}
+	instructions, err := interpreter.Decode(method.Code)
+	if err != nil {
+		return nil, err
+	}
+	starts := map[int]bool{}
+	for _, in := range instructions {
+		starts[in.Offset] = true
+	}
+	inCode := func(offset int) bool {
+		return starts[offset] || offset == len(method.Code)
+	}
+
+	leaders := map[int]bool{0: true}
+	for _, in := range instructions {
+		targets, ends := branchTargets(&in)
+		for _, target := range targets {
+			if !starts[target] {
+				return nil, fmt.Errorf("branch at offset %d to %d is not the start of an instruction", in.Offset, target)
+			}
+			leaders[target] = true
+		}
+		if ends {
+			leaders[in.Next()] = true
+		}
+	}
+	for _, handler := range method.ExceptionTable {
+		if !starts[handler.StartPC] || !inCode(handler.EndPC) || !starts[handler.HandlerPC] || handler.StartPC >= handler.EndPC {
+			return nil, fmt.Errorf("invalid exception handler [%d, %d) -> %d", handler.StartPC, handler.EndPC, handler.HandlerPC)
+		}
+		// Splitting at the range bounds makes each block entirely inside
+		// or outside every try range.
+		leaders[handler.StartPC] = true
+		leaders[handler.EndPC] = true
+		leaders[handler.HandlerPC] = true
+	}
+
+	g := &Graph{Method: method}
+	var block *Block
+	for _, in := range instructions {
+		if leaders[in.Offset] {
+			block = &Block{Index: len(g.Blocks), Start: in.Offset}
+			g.Blocks = append(g.Blocks, block)
+		}
+		block.Instructions = append(block.Instructions, in)
+		block.End = in.Next()
+	}
+
+	for _, b := range g.Blocks {
+		last := b.Last()
+		targets, _ := branchTargets(last)
+		for _, target := range targets {
+			g.addEdge(b, g.BlockAt(target), Jump, "")
+		}
+		if falls(last) {
+			if b.End == len(method.Code) {
+				return nil, fmt.Errorf("execution falls off the end of the code at offset %d", last.Offset)
+			}
+			g.addEdge(b, g.BlockAt(b.End), FallThrough, "")
+		}
+	}
+	for _, handler := range method.ExceptionTable {
+		target := g.BlockAt(handler.HandlerPC)
+		target.Handler = true
+		for _, b := range g.Blocks {
+			if b.Start >= handler.StartPC && b.Start < handler.EndPC {
+				g.addEdge(b, target, Exception, handler.CatchType)
+			}
+		}
+	}
+
+	g.computeDominators()
+	g.findLoops()
+	return g, nil
+}
+
+// branchTargets returns the jump targets of in, and whether in ends a
+// block: branches, switches, returns, athrow, jsr and ret.
+func branchTargets(in *interpreter.Instruction) (targets []int, ends bool) {
+	switch op := in.Opcode; {
+	case op >= interpreter.IFEQ && op <= interpreter.JSR, op == interpreter.IFNULL, op == interpreter.IFNONNULL,
+		op == interpreter.GOTO_W, op == interpreter.JSR_W:
+		return []int{in.Target}, true
+	case op == interpreter.TABLESWITCH || op == interpreter.LOOKUPSWITCH:
+		return append([]int{in.Target}, in.Targets...), true
+	case op >= interpreter.IRETURN && op <= interpreter.RETURN, op == interpreter.ATHROW, op == interpreter.RET:
+		return nil, true
+	}
+	return nil, false
+}
+
+// falls reports whether control may continue with the instruction after
+// in. A jsr does so when its subroutine returns.
+func falls(in *interpreter.Instruction) bool {
+	switch op := in.Opcode; {
+	case op == interpreter.GOTO || op == interpreter.GOTO_W,
+		op == interpreter.TABLESWITCH || op == interpreter.LOOKUPSWITCH,
+		op >= interpreter.IRETURN && op <= interpreter.RETURN, op == interpreter.ATHROW, op == interpreter.RET:
+		return false
+	}
+	return true
+}
+
+// addEdge joins from and to unless an equal edge exists.
+func (g *Graph) addEdge(from, to *Block, kind EdgeKind, catchType string) {
+	for _, e := range from.Successors {
+		if e.To == to && e.Kind == kind && e.CatchType == catchType {
+			return
+		}
+	}
+	e := &Edge{From: from, To: to, Kind: kind, CatchType: catchType}
+	from.Successors = append(from.Successors, e)
+	to.Predecessors = append(to.Predecessors, e)
+}
+
+// BlockAt returns the block containing offset, or nil.
+func (g *Graph) BlockAt(offset int) *Block {
+	i := sort.Search(len(g.Blocks), func(i int) bool { return g.Blocks[i].End > offset })
+	if i < len(g.Blocks) && g.Blocks[i].Start <= offset {
+		return g.Blocks[i]
+	}
+	return nil
+}
+
+// Reachable reports whether b can be reached from the entry.
+func (g *Graph) Reachable(b *Block) bool {
+	return b == g.Blocks[0] || b.IDom != nil
+}
@@ -0,0 +1,97 @@
+package analysis
+
+// computeDominators sets the immediate dominator of each reachable block
+// using the iterative algorithm of Cooper, Harvey and Kennedy, "A Simple,
+// Fast Dominance Algorithm". Exception edges count as control flow.
+func (g *Graph) computeDominators() {
+	g.order = g.reversePostorder()
+	position := make(map[*Block]int, len(g.order))
+	for i, b := range g.order {
+		position[b] = i
+	}
+	entry := g.Blocks[0]
+	idom := map[*Block]*Block{entry: entry}
+	intersect := func(a, b *Block) *Block {
+		for a != b {
+			for position[a] > position[b] {
+				a = idom[a]
+			}
+			for position[b] > position[a] {
+				b = idom[b]
+			}
+		}
+		return a
+	}
+	for changed := true; changed; {
+		changed = false
+		for _, b := range g.order[1:] {
+			var dominator *Block
+			for _, e := range b.Predecessors {
+				if idom[e.From] == nil {
+					continue
+				}
+				if dominator == nil {
+					dominator = e.From
+				} else {
+					dominator = intersect(e.From, dominator)
+				}
+			}
+			if idom[b] != dominator {
+				idom[b] = dominator
+				changed = true
+			}
+		}
+	}
+	for _, b := range g.order[1:] {
+		b.IDom = idom[b]
+	}
+}
+
+// reversePostorder lists the blocks reachable from the entry so that every
+// block comes before its successors, back edges aside.
+func (g *Graph) reversePostorder() []*Block {
+	visited := make([]bool, len(g.Blocks))
+	var postorder []*Block
+	var visit func(b *Block)
+	visit = func(b *Block) {
+		visited[b.Index] = true
+		for _, e := range b.Successors {
+			if !visited[e.To.Index] {
+				visit(e.To)
+			}
+		}
+		postorder = append(postorder, b)
+	}
+	visit(g.Blocks[0])
+	order := make([]*Block, len(postorder))
+	for i, b := range postorder {
+		order[len(postorder)-1-i] = b
+	}
+	return order
+}
+
+// Dominates reports whether every path from the entry to b passes through
+// a. A block dominates itself.
+func (g *Graph) Dominates(a, b *Block) bool {
+	if !g.Reachable(a) || !g.Reachable(b) {
+		return false
+	}
+	for ; b != nil; b = b.IDom {
+		if b == a {
+			return true
+		}
+	}
+	return false
+}
+
+// Dominated returns the blocks immediately dominated by b, its children in
+// the dominator tree.
+func (g *Graph) Dominated(b *Block) []*Block {
+	var children []*Block
+	for _, c := range g.Blocks {
+		if c.IDom == b {
+			children = append(children, c)
+		}
+	}
+	return children
+}
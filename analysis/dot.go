@@ -0,0 +1,146 @@
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"outro/interpreter"
+	"strings"
+)
+
+// WriteDOT writes the graph in the Graphviz DOT language. Each loop is a
+// cluster nested in the clusters of its enclosing loops; back edges are
+// bold and exception edges dashed.
+func (g *Graph) WriteDOT(out io.Writer) error {
+	var sb strings.Builder
+	name := g.Method.Name + g.Method.Descriptor
+	if g.Method.Class != nil {
+		name = g.Method.Class.Name + "." + name
+	}
+	fmt.Fprintf(&sb, "digraph %s {\n", quoteDOT(name))
+	sb.WriteString("  node [shape=box, fontname=\"monospace\"];\n")
+	sb.WriteString("  entry [shape=point];\n")
+
+	var writeLoop func(loop *Loop, indent string)
+	writeBlocks := func(loop *Loop, indent string) {
+		for _, b := range g.Blocks {
+			if b.Loop == loop {
+				fmt.Fprintf(&sb, "%s%s [label=%s];\n", indent, b, blockLabel(b))
+			}
+		}
+	}
+	writeLoop = func(loop *Loop, indent string) {
+		fmt.Fprintf(&sb, "%ssubgraph cluster_loop%d {\n", indent, loop.Header.Index)
+		fmt.Fprintf(&sb, "%s  label=%s;\n", indent, quoteDOT(fmt.Sprintf("loop %s, depth %d", loop.Header, loop.Depth)))
+		writeBlocks(loop, indent+"  ")
+		for _, inner := range g.Loops {
+			if inner.Parent == loop {
+				writeLoop(inner, indent+"  ")
+			}
+		}
+		fmt.Fprintf(&sb, "%s}\n", indent)
+	}
+	writeBlocks(nil, "  ")
+	for _, loop := range g.Loops {
+		if loop.Parent == nil {
+			writeLoop(loop, "  ")
+		}
+	}
+
+	fmt.Fprintf(&sb, "  entry -> %s;\n", g.Blocks[0])
+	for _, b := range g.Blocks {
+		for _, e := range b.Successors {
+			var attributes []string
+			switch e.Kind {
+			case Jump:
+				if last := b.Last(); last.Opcode == interpreter.TABLESWITCH || last.Opcode == interpreter.LOOKUPSWITCH {
+					attributes = append(attributes, "label="+quoteDOT(switchLabel(last, e.To.Start)))
+				}
+			case Exception:
+				catchType := e.CatchType
+				if catchType == "" {
+					catchType = "any"
+				}
+				attributes = append(attributes, "style=dashed", "label="+quoteDOT(catchType))
+			}
+			if e.To.Loop != nil && e.To.Loop.Header == e.To && g.Dominates(e.To, b) {
+				attributes = append(attributes, "style=bold", "color=red")
+			}
+			fmt.Fprintf(&sb, "  %s -> %s", b, e.To)
+			if len(attributes) > 0 {
+				fmt.Fprintf(&sb, " [%s]", strings.Join(attributes, ", "))
+			}
+			sb.WriteString(";\n")
+		}
+	}
+	sb.WriteString("}\n")
+	_, err := io.WriteString(out, sb.String())
+	return err
+}
+
+// blockLabel lists the instructions of b, left aligned.
+func blockLabel(b *Block) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s [%d, %d)", b, b.Start, b.End)
+	if b.Handler {
+		sb.WriteString(" handler")
+	}
+	sb.WriteString("\\l")
+	for i := range b.Instructions {
+		sb.WriteString(escapeDOT(instructionText(&b.Instructions[i])))
+		sb.WriteString("\\l")
+	}
+	return `"` + sb.String() + `"`
+}
+
+// switchLabel names the cases of a switch that lead to target.
+func switchLabel(in *interpreter.Instruction, target int) string {
+	var cases []string
+	for i, key := range in.Keys {
+		if in.Targets[i] == target {
+			cases = append(cases, fmt.Sprint(key))
+		}
+	}
+	if in.Target == target {
+		cases = append(cases, "default")
+	}
+	return strings.Join(cases, ", ")
+}
+
+// instructionText renders an instruction with its raw operands.
+func instructionText(in *interpreter.Instruction) string {
+	name := interpreter.InstructDisplayNameMap[in.Opcode]
+	if in.Wide {
+		name = "wide " + name
+	}
+	text := fmt.Sprintf("%4d: %s", in.Offset, name)
+	switch op := in.Opcode; {
+	case op == interpreter.BIPUSH || op == interpreter.SIPUSH:
+		text += fmt.Sprintf(" %d", in.Const)
+	case op == interpreter.NEWARRAY:
+		text += fmt.Sprintf(" %d", in.ArrayType)
+	case op == interpreter.IINC:
+		text += fmt.Sprintf(" %d %d", in.Local, in.Const)
+	case op >= interpreter.ILOAD && op <= interpreter.ALOAD, op >= interpreter.ISTORE && op <= interpreter.ASTORE,
+		op == interpreter.RET:
+		text += fmt.Sprintf(" %d", in.Local)
+	case op >= interpreter.IFEQ && op <= interpreter.JSR, op == interpreter.IFNULL, op == interpreter.IFNONNULL,
+		op == interpreter.GOTO_W, op == interpreter.JSR_W:
+		text += fmt.Sprintf(" %d", in.Target)
+	case op == interpreter.TABLESWITCH || op == interpreter.LOOKUPSWITCH:
+		text += fmt.Sprintf(" default %d", in.Target)
+	case op == interpreter.LDC, op == interpreter.LDC_W, op == interpreter.LDC2_W,
+		op >= interpreter.GETSTATIC && op <= interpreter.INVOKEDYNAMIC,
+		op == interpreter.NEW, op == interpreter.ANEWARRAY, op == interpreter.CHECKCAST,
+		op == interpreter.INSTANCEOF, op == interpreter.MULTIANEWARRAY:
+		text += fmt.Sprintf(" #%d", in.Index)
+	}
+	return text
+}
+
+func escapeDOT(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s)
+}
+
+func quoteDOT(s string) string {
+	return `"` + escapeDOT(s) + `"`
+}
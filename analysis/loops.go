@@ -0,0 +1,88 @@
+package analysis
+
+import "sort"
+
+// Loop is a natural loop: the header and every block that reaches one of
+// its back edges without passing through the header.
+type Loop struct {
+	Header *Block
+	// Blocks are the blocks of the loop in code order, including those of
+	// nested loops.
+	Blocks []*Block
+	// BackEdges are the edges from inside the loop to the header.
+	BackEdges []*Edge
+	// Parent is the innermost enclosing loop, or nil.
+	Parent *Loop
+	// Depth is 1 for an outermost loop.
+	Depth int
+}
+
+// Contains reports whether b belongs to the loop.
+func (l *Loop) Contains(b *Block) bool {
+	i := sort.Search(len(l.Blocks), func(i int) bool { return l.Blocks[i].Index >= b.Index })
+	return i < len(l.Blocks) && l.Blocks[i] == b
+}
+
+// findLoops collects the natural loops, merging those sharing a header,
+// and nests them.
+func (g *Graph) findLoops() {
+	byHeader := map[*Block]*Loop{}
+	for _, b := range g.order {
+		for _, e := range b.Successors {
+			if !g.Dominates(e.To, b) {
+				continue
+			}
+			loop := byHeader[e.To]
+			if loop == nil {
+				loop = &Loop{Header: e.To}
+				byHeader[e.To] = loop
+				g.Loops = append(g.Loops, loop)
+			}
+			loop.BackEdges = append(loop.BackEdges, e)
+		}
+	}
+	for _, loop := range g.Loops {
+		in := map[*Block]bool{loop.Header: true}
+		var work []*Block
+		for _, e := range loop.BackEdges {
+			if !in[e.From] {
+				in[e.From] = true
+				work = append(work, e.From)
+			}
+		}
+		for len(work) > 0 {
+			b := work[len(work)-1]
+			work = work[:len(work)-1]
+			for _, e := range b.Predecessors {
+				if !in[e.From] && g.Reachable(e.From) {
+					in[e.From] = true
+					work = append(work, e.From)
+				}
+			}
+		}
+		for _, b := range g.Blocks {
+			if in[b] {
+				loop.Blocks = append(loop.Blocks, b)
+			}
+		}
+	}
+
+	// An enclosing loop has more blocks than the loops inside it, so
+	// visiting the largest first sets Parent and Loop to the innermost.
+	sort.SliceStable(g.Loops, func(i, j int) bool { return len(g.Loops[i].Blocks) > len(g.Loops[j].Blocks) })
+	for i, loop := range g.Loops {
+		for _, outer := range g.Loops[:i] {
+			if outer.Contains(loop.Header) {
+				loop.Parent = outer
+			}
+		}
+		loop.Depth = 1
+		if loop.Parent != nil {
+			loop.Depth = loop.Parent.Depth + 1
+		}
+		for _, b := range loop.Blocks {
+			b.Loop = loop
+		}
+	}
+	sort.Slice(g.Loops, func(i, j int) bool { return g.Loops[i].Header.Index < g.Loops[j].Header.Index })
+}
@@ -0,0 +1,126 @@
+// Package asm converts between class files and a Jasmin-style assembly
+// text, so classes can be written and reviewed as readable source:
+//
+//	.bytecode 61.0
+//	.source Counter.java
+//	.class public super Counter
+//	.super java/lang/Object
+//
+//	.field private static count I = 0
+//
+//	.method public static next()I
+//	    .limit stack 2
+//	    .limit locals 0
+//	    getstatic Counter/count I
+//	    iconst_1
+//	    iadd
+//	    dup
+//	    putstatic Counter/count I
+//	    ireturn
+//	.end method
+//
+// Each line holds one directive or instruction; a ';' at the start of a
+// token begins a comment. Labels are written "Name:" at the start of a
+// line. Members are referenced as owner/name followed by the descriptor,
+// which for methods is attached to the name: java/io/PrintStream/println(I)V.
+//
+// Directives are .bytecode, .source, .class, .super, .implements,
+// .signature, .field, .method, .limit stack|locals, .throws,
+// .catch <class|all> from L to L using L, .line, .var n is name desc from
+// L to L and .end method. Without .limit, max_stack and max_locals are
+// computed.
+//
+// Constants for ldc, field values and bootstrap arguments are ints, floats
+// with an f suffix, longs with an L suffix, doubles, quoted strings,
+// "class Name", "methodtype desc", "methodhandle <handle>" and
+// "dynamic name desc <handle> { args }", where a handle is a reference kind
+// such as invokestatic followed by a member. invokedynamic takes
+// "name+desc <handle> { args }". tableswitch and lookupswitch are followed
+// by one target per line, "key: L" for lookupswitch, and end with
+// "default: L".
+//
+// Attributes without a directive, such as StackMapTable and InnerClasses,
+// are not carried over; the disassembly of a class re-assembles to a class
+// with the same members and code. Assemble leaves StackMapTable out, so the
+// outro asm command computes it with verifier.ComputeAllFrames for classes
+// of version 50 and later.
+package asm
+
+import (
+	"outro/constant"
+	"outro/interpreter"
+)
+
+type flagName struct {
+	flag constant.AccessFlag
+	name string
+}
+
+// The access flag keywords of classes, fields and methods, in the order
+// they are written.
+var (
+	classFlags = []flagName{
+		{constant.CLASS_ACC_PUBLIC, "public"},
+		{constant.CLASS_ACC_FINAL, "final"},
+		{constant.CLASS_ACC_SUPER, "super"},
+		{constant.CLASS_ACC_INTERFACE, "interface"},
+		{constant.CLASS_ACC_ABSTRACT, "abstract"},
+		{constant.CLASS_ACC_SYNTHETIC, "synthetic"},
+		{constant.CLASS_ACC_ANNOTATION, "annotation"},
+		{constant.CLASS_ACC_ENUM, "enum"},
+		{constant.CLASS_ACC_MODULE, "module"},
+	}
+	fieldFlags = []flagName{
+		{constant.FIELD_ACC_PUBLIC, "public"},
+		{constant.FIELD_ACC_PRIVATE, "private"},
+		{constant.FIELD_ACC_PROTECTED, "protected"},
+		{constant.FIELD_ACC_STATIC, "static"},
+		{constant.FIELD_ACC_FINAL, "final"},
+		{constant.FIELD_ACC_VOLATILE, "volatile"},
+		{constant.FIELD_ACC_TRANSIENT, "transient"},
+		{constant.FIELD_ACC_SYNTHETIC, "synthetic"},
+		{constant.FIELD_ACC_ENUM, "enum"},
+	}
+	methodFlags = []flagName{
+		{constant.METHOD_ACC_PUBLIC, "public"},
+		{constant.METHOD_ACC_PRIVATE, "private"},
+		{constant.METHOD_ACC_PROTECTED, "protected"},
+		{constant.METHOD_ACC_STATIC, "static"},
+		{constant.METHOD_ACC_FINAL, "final"},
+		{constant.METHOD_ACC_SYNCHRONIZED, "synchronized"},
+		{constant.METHOD_ACC_BRIDGE, "bridge"},
+		{constant.METHOD_ACC_VARARGS, "varargs"},
+		{constant.METHOD_ACC_NATIVE, "native"},
+		{constant.METHOD_ACC_ABSTRACT, "abstract"},
+		{constant.METHOD_ACC_STRICT, "strict"},
+		{constant.METHOD_ACC_SYNTHETIC, "synthetic"},
+	}
+)
+
+// arrayTypes names the element types of newarray.
+var arrayTypes = map[int]string{
+	4: "boolean", 5: "char", 6: "float", 7: "double",
+	8: "byte", 9: "short", 10: "int", 11: "long",
+}
+
+// handleKinds names the method handle reference kinds after the
+// instruction each one behaves like.
+var handleKinds = map[uint8]string{
+	constant.RefGetField:         "getfield",
+	constant.RefGetStatic:        "getstatic",
+	constant.RefPutField:         "putfield",
+	constant.RefPutStatic:        "putstatic",
+	constant.RefInvokeVirtual:    "invokevirtual",
+	constant.RefInvokeStatic:     "invokestatic",
+	constant.RefInvokeSpecial:    "invokespecial",
+	constant.RefNewInvokeSpecial: "newinvokespecial",
+	constant.RefInvokeInterface:  "invokeinterface",
+}
+
+var opcodes = map[string]interpreter.Instruct{}
+
+func init() {
+	for opcode, name := range interpreter.InstructDisplayNameMap {
+		opcodes[name] = opcode
+	}
+}
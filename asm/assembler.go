@@ -0,0 +1,611 @@
+package asm
+
+import (
+	"fmt"
+	"outro/builder"
+	"outro/constant"
+	"outro/interpreter"
+	"outro/model"
+	"strconv"
+	"strings"
+)
+
+type assembler struct {
+	class        *builder.ClassBuilder
+	name         string
+	major, minor uint16
+	source       string
+	method       *methodState
+	// lastField is the field declared by the previous line, which a
+	// .signature applies to.
+	lastField *builder.FieldBuilder
+}
+
+// methodState is the method between .method and .end method.
+type methodState struct {
+	builder   *builder.MethodBuilder
+	labels    map[string]*builder.Label
+	marked    map[string]bool
+	firstUse  map[string]int
+	maxStack  int
+	maxLocals int
+	limited   bool
+	// sw is the switch whose targets are being read.
+	sw *switchState
+}
+
+type switchState struct {
+	opcode        interpreter.Instruct
+	low, high     int32
+	keys          []int32
+	targets       []*builder.Label
+	defaultTarget *builder.Label
+}
+
+// Assemble translates assembly text into a class file.
+func Assemble(text string) ([]byte, error) {
+	lines, err := tokenize(text)
+	if err != nil {
+		return nil, err
+	}
+	a := &assembler{major: 61}
+	for _, l := range lines {
+		if err := a.line(l); err != nil {
+			return nil, fmt.Errorf("line %d: %v", l.number, err)
+		}
+	}
+	if a.class == nil {
+		return nil, fmt.Errorf("missing .class")
+	}
+	if a.method != nil {
+		return nil, fmt.Errorf("missing .end method")
+	}
+	return a.class.Bytes()
+}
+
+func (a *assembler) line(l line) error {
+	c := &cursor{tokens: l.tokens}
+	if a.method != nil && a.method.sw != nil {
+		return a.switchLine(c, l.number)
+	}
+	first := c.tokens[0]
+	if strings.HasPrefix(first, ".") {
+		c.pos++
+		return a.directive(first, c, l.number)
+	}
+	if a.method == nil {
+		return fmt.Errorf("%q outside of a method", first)
+	}
+	if strings.HasSuffix(first, ":") {
+		name := strings.TrimSuffix(first, ":")
+		if a.method.marked[name] {
+			return fmt.Errorf("label %s defined twice", name)
+		}
+		a.method.marked[name] = true
+		a.method.builder.Mark(a.label(name, l.number))
+		c.pos++
+		if c.done() {
+			return nil
+		}
+	}
+	return a.instruction(c, l.number)
+}
+
+func (a *assembler) directive(name string, c *cursor, number int) error {
+	lastField := a.lastField
+	a.lastField = nil
+	switch name {
+	case ".bytecode":
+		version, err := c.next("version")
+		if err != nil {
+			return err
+		}
+		major, minor, _ := strings.Cut(version, ".")
+		v, err := strconv.ParseUint(major, 10, 16)
+		if err != nil {
+			return fmt.Errorf("invalid version %q", version)
+		}
+		a.major, a.minor = uint16(v), 0
+		if minor != "" {
+			v, err := strconv.ParseUint(minor, 10, 16)
+			if err != nil {
+				return fmt.Errorf("invalid version %q", version)
+			}
+			a.minor = uint16(v)
+		}
+		return c.end()
+	case ".source":
+		source, err := a.text(c, "source file")
+		if err != nil {
+			return err
+		}
+		a.source = source
+		if a.class != nil {
+			a.class.SourceFile(source)
+		}
+		return c.end()
+	case ".class":
+		if a.class != nil {
+			return fmt.Errorf("duplicate .class")
+		}
+		if c.done() {
+			return fmt.Errorf("missing class name")
+		}
+		a.name = c.tokens[len(c.tokens)-1]
+		flags, err := parseFlags(c.tokens[1:len(c.tokens)-1], classFlags)
+		if err != nil {
+			return err
+		}
+		a.class = builder.NewClass(a.name).Version(a.major, a.minor).Access(flags)
+		if a.source != "" {
+			a.class.SourceFile(a.source)
+		}
+		if a.name == "java/lang/Object" || flags&uint16(constant.CLASS_ACC_MODULE) != 0 {
+			a.class.Super("")
+		}
+		return nil
+	}
+	if a.class == nil {
+		return fmt.Errorf("%s before .class", name)
+	}
+	switch name {
+	case ".super":
+		super, err := c.next("superclass")
+		if err != nil {
+			return err
+		}
+		a.class.Super(super)
+		return c.end()
+	case ".implements":
+		for !c.done() {
+			a.class.Implements(c.tokens[c.pos])
+			c.pos++
+		}
+		return nil
+	case ".signature":
+		signature, err := a.text(c, "signature")
+		if err != nil {
+			return err
+		}
+		attribute := signatureAttribute(a.class.Pool(), signature)
+		switch {
+		case a.method != nil:
+			a.method.builder.Attribute("Signature", attribute)
+		case lastField != nil:
+			lastField.Attribute("Signature", attribute)
+		default:
+			a.class.Attribute("Signature", attribute)
+		}
+		return c.end()
+	case ".field":
+		return a.field(c)
+	case ".method":
+		return a.beginMethod(c)
+	}
+	if a.method == nil {
+		return fmt.Errorf("%s outside of a method", name)
+	}
+	m := a.method
+	switch name {
+	case ".end":
+		if what, _ := c.next("method"); what != "method" {
+			return fmt.Errorf("expected .end method")
+		}
+		return a.endMethod()
+	case ".limit":
+		which, err := c.next("stack or locals")
+		if err != nil {
+			return err
+		}
+		n, err := a.integer(c, 0, 0xFFFF)
+		if err != nil {
+			return err
+		}
+		switch which {
+		case "stack":
+			m.maxStack = n
+		case "locals":
+			m.maxLocals = n
+		default:
+			return fmt.Errorf("unknown limit %q", which)
+		}
+		m.limited = true
+		return c.end()
+	case ".throws":
+		for !c.done() {
+			m.builder.Throws(c.tokens[c.pos])
+			c.pos++
+		}
+		return nil
+	case ".line":
+		n, err := a.integer(c, 0, 0xFFFF)
+		if err != nil {
+			return err
+		}
+		m.builder.Line(n)
+		return c.end()
+	case ".catch":
+		// .catch <class|all> from L to L using L
+		catchType, err := c.next("exception class")
+		if err != nil {
+			return err
+		}
+		if catchType == "all" {
+			catchType = ""
+		}
+		labels, err := a.keywordLabels(c, number, "from", "to", "using")
+		if err != nil {
+			return err
+		}
+		m.builder.TryCatchBlock(labels[0], labels[1], labels[2], catchType)
+		return c.end()
+	case ".var":
+		// .var n is name desc from L to L
+		index, err := a.integer(c, 0, 0xFFFF)
+		if err != nil {
+			return err
+		}
+		if is, _ := c.next("is"); is != "is" {
+			return fmt.Errorf("expected is")
+		}
+		varName, err := c.next("variable name")
+		if err != nil {
+			return err
+		}
+		descriptor, err := c.next("descriptor")
+		if err != nil {
+			return err
+		}
+		labels, err := a.keywordLabels(c, number, "from", "to")
+		if err != nil {
+			return err
+		}
+		m.builder.LocalVariable(index, varName, descriptor, labels[0], labels[1])
+		return c.end()
+	}
+	return fmt.Errorf("unknown directive %s", name)
+}
+
+// field parses ".field flags name desc [= value]".
+func (a *assembler) field(c *cursor) error {
+	if a.method != nil {
+		return fmt.Errorf(".field inside a method")
+	}
+	tokens := c.tokens[1:]
+	var value []string
+	for i, token := range tokens {
+		if token == "=" {
+			tokens, value = tokens[:i], tokens[i+1:]
+			break
+		}
+	}
+	if len(tokens) < 2 {
+		return fmt.Errorf("missing field name or descriptor")
+	}
+	flags, err := parseFlags(tokens[:len(tokens)-2], fieldFlags)
+	if err != nil {
+		return err
+	}
+	field := a.class.Field(flags, tokens[len(tokens)-2], tokens[len(tokens)-1])
+	if value != nil {
+		constantValue, err := a.constant(&cursor{tokens: value})
+		if err != nil {
+			return err
+		}
+		if len(value) != 1 {
+			return fmt.Errorf("invalid field value")
+		}
+		field.ConstantValue(constantValue)
+	}
+	a.lastField = field
+	return nil
+}
+
+// beginMethod parses ".method flags name(desc)ret".
+func (a *assembler) beginMethod(c *cursor) error {
+	if a.method != nil {
+		return fmt.Errorf("missing .end method")
+	}
+	if c.done() {
+		return fmt.Errorf("missing method name")
+	}
+	spec := c.tokens[len(c.tokens)-1]
+	paren := strings.IndexByte(spec, '(')
+	if paren <= 0 {
+		return fmt.Errorf("invalid method %q", spec)
+	}
+	flags, err := parseFlags(c.tokens[1:len(c.tokens)-1], methodFlags)
+	if err != nil {
+		return err
+	}
+	a.method = &methodState{
+		builder:   a.class.Method(flags, spec[:paren], spec[paren:]),
+		labels:    map[string]*builder.Label{},
+		marked:    map[string]bool{},
+		firstUse:  map[string]int{},
+		maxStack:  -1,
+		maxLocals: -1,
+	}
+	return nil
+}
+
+func (a *assembler) endMethod() error {
+	m := a.method
+	for name, line := range m.firstUse {
+		if !m.marked[name] {
+			return fmt.Errorf("label %s used on line %d is not defined", name, line)
+		}
+	}
+	if m.limited {
+		m.builder.Limits(m.maxStack, m.maxLocals)
+	}
+	a.method = nil
+	return nil
+}
+
+func (a *assembler) label(name string, number int) *builder.Label {
+	m := a.method
+	label, ok := m.labels[name]
+	if !ok {
+		label = m.builder.NewLabel()
+		m.labels[name] = label
+		m.firstUse[name] = number
+	}
+	return label
+}
+
+func (a *assembler) labelOperand(c *cursor, number int) (*builder.Label, error) {
+	name, err := c.next("label")
+	if err != nil {
+		return nil, err
+	}
+	return a.label(name, number), nil
+}
+
+// keywordLabels parses "keyword L" for each keyword in turn.
+func (a *assembler) keywordLabels(c *cursor, number int, keywords ...string) ([]*builder.Label, error) {
+	labels := make([]*builder.Label, len(keywords))
+	for i, keyword := range keywords {
+		if token, _ := c.next(keyword); token != keyword {
+			return nil, fmt.Errorf("expected %s", keyword)
+		}
+		label, err := a.labelOperand(c, number)
+		if err != nil {
+			return nil, err
+		}
+		labels[i] = label
+	}
+	return labels, nil
+}
+
+func (a *assembler) integer(c *cursor, min, max int64) (int, error) {
+	token, err := c.next("number")
+	if err != nil {
+		return 0, err
+	}
+	v, err := strconv.ParseInt(token, 0, 64)
+	if err != nil || v < min || v > max {
+		return 0, fmt.Errorf("invalid number %q", token)
+	}
+	return int(v), nil
+}
+
+// text parses a name that may be quoted.
+func (a *assembler) text(c *cursor, what string) (string, error) {
+	token, err := c.next(what)
+	if err != nil || !strings.HasPrefix(token, `"`) {
+		return token, err
+	}
+	s, err := strconv.Unquote(token)
+	if err != nil {
+		return "", fmt.Errorf("invalid string %s", token)
+	}
+	return s, nil
+}
+
+func signatureAttribute(pool *builder.ConstantPool, signature string) *model.SignatureAttributeInfo {
+	return &model.SignatureAttributeInfo{SignatureIndex: pool.Utf8(signature)}
+}
+
+func (a *assembler) instruction(c *cursor, number int) error {
+	if c.peek() == "wide" {
+		// The builder widens local variable instructions as needed.
+		c.pos++
+	}
+	name, err := c.next("instruction")
+	if err != nil {
+		return err
+	}
+	opcode, ok := opcodes[name]
+	if !ok {
+		return fmt.Errorf("unknown instruction %q", name)
+	}
+	m := a.method.builder
+	switch {
+	case opcode == interpreter.BIPUSH || opcode == interpreter.SIPUSH:
+		limit := int64(127)
+		if opcode == interpreter.SIPUSH {
+			limit = 32767
+		}
+		v, err := a.integer(c, -limit-1, limit)
+		if err != nil {
+			return err
+		}
+		m.IntInsn(opcode, v)
+	case opcode == interpreter.NEWARRAY:
+		elementType, err := c.next("element type")
+		if err != nil {
+			return err
+		}
+		code := 0
+		for typeCode, typeName := range arrayTypes {
+			if typeName == elementType {
+				code = typeCode
+			}
+		}
+		if code == 0 {
+			return fmt.Errorf("invalid array type %q", elementType)
+		}
+		m.IntInsn(opcode, code)
+	case opcode == interpreter.LDC || opcode == interpreter.LDC_W || opcode == interpreter.LDC2_W:
+		value, err := a.constant(c)
+		if err != nil {
+			return err
+		}
+		if wide := isTwoSlot(value); wide != (opcode == interpreter.LDC2_W) {
+			return fmt.Errorf("%s cannot load %s", name, strings.Join(c.tokens[1:], " "))
+		}
+		m.LdcInsn(value)
+	case opcode >= interpreter.ILOAD && opcode <= interpreter.ALOAD,
+		opcode >= interpreter.ISTORE && opcode <= interpreter.ASTORE,
+		opcode == interpreter.RET:
+		index, err := a.integer(c, 0, 0xFFFF)
+		if err != nil {
+			return err
+		}
+		m.VarInsn(opcode, index)
+	case opcode == interpreter.IINC:
+		index, err := a.integer(c, 0, 0xFFFF)
+		if err != nil {
+			return err
+		}
+		delta, err := a.integer(c, -32768, 32767)
+		if err != nil {
+			return err
+		}
+		m.IincInsn(index, delta)
+	case opcode >= interpreter.IFEQ && opcode <= interpreter.JSR,
+		opcode == interpreter.IFNULL || opcode == interpreter.IFNONNULL,
+		opcode == interpreter.GOTO_W || opcode == interpreter.JSR_W:
+		label, err := a.labelOperand(c, number)
+		if err != nil {
+			return err
+		}
+		m.JumpInsn(opcode, label)
+	case opcode == interpreter.TABLESWITCH:
+		low, err := a.integer(c, -1<<31, 1<<31-1)
+		if err != nil {
+			return err
+		}
+		high, err := a.integer(c, int64(low), 1<<31-1)
+		if err != nil {
+			return err
+		}
+		a.method.sw = &switchState{opcode: opcode, low: int32(low), high: int32(high)}
+	case opcode == interpreter.LOOKUPSWITCH:
+		a.method.sw = &switchState{opcode: opcode}
+	case opcode >= interpreter.GETSTATIC && opcode <= interpreter.PUTFIELD:
+		owner, fieldName, descriptor, err := fieldSpec(c)
+		if err != nil {
+			return err
+		}
+		m.FieldInsn(opcode, owner, fieldName, descriptor)
+	case opcode >= interpreter.INVOKEVIRTUAL && opcode <= interpreter.INVOKEINTERFACE:
+		isInterface := c.peek() == "interface"
+		if isInterface {
+			c.pos++
+		}
+		owner, methodName, descriptor, err := methodSpec(c)
+		if err != nil {
+			return err
+		}
+		if opcode == interpreter.INVOKEINTERFACE && !c.done() {
+			// The argument count is computed from the descriptor.
+			if _, err := a.integer(c, 1, 255); err != nil {
+				return err
+			}
+		}
+		m.MethodInsn(opcode, owner, methodName, descriptor, isInterface)
+	case opcode == interpreter.INVOKEDYNAMIC:
+		spec, err := c.next("name and descriptor")
+		if err != nil {
+			return err
+		}
+		paren := strings.IndexByte(spec, '(')
+		if paren <= 0 {
+			return fmt.Errorf("invalid call site %q", spec)
+		}
+		bootstrapMethod, err := a.bootstrapMethod(c)
+		if err != nil {
+			return err
+		}
+		m.InvokeDynamicInsn(bootstrapMethod, spec[:paren], spec[paren:])
+	case opcode == interpreter.NEW || opcode == interpreter.ANEWARRAY,
+		opcode == interpreter.CHECKCAST || opcode == interpreter.INSTANCEOF:
+		className, err := c.next("class name")
+		if err != nil {
+			return err
+		}
+		m.TypeInsn(opcode, className)
+	case opcode == interpreter.MULTIANEWARRAY:
+		descriptor, err := c.next("array descriptor")
+		if err != nil {
+			return err
+		}
+		dimensions, err := a.integer(c, 1, 255)
+		if err != nil {
+			return err
+		}
+		m.MultiANewArrayInsn(descriptor, dimensions)
+	case opcode == interpreter.WIDE:
+		return fmt.Errorf("wide must precede a local variable instruction")
+	default:
+		m.Insn(opcode)
+	}
+	return c.end()
+}
+
+func isTwoSlot(value interface{}) bool {
+	switch v := value.(type) {
+	case int64, float64:
+		return true
+	case builder.ConstantDynamic:
+		return model.FieldTypeSlots(v.Descriptor) == 2
+	}
+	return false
+}
+
+// switchLine reads a target of the pending switch: a label for
+// tableswitch, "key: L" for lookupswitch, and finally "default: L".
+func (a *assembler) switchLine(c *cursor, number int) error {
+	sw := a.method.sw
+	first, _ := c.next("target")
+	if first == "default:" {
+		label, err := a.labelOperand(c, number)
+		if err != nil {
+			return err
+		}
+		sw.defaultTarget = label
+		a.method.sw = nil
+		if sw.opcode == interpreter.TABLESWITCH {
+			if int64(len(sw.targets)) != int64(sw.high)-int64(sw.low)+1 {
+				return fmt.Errorf("tableswitch %d %d needs %d targets, found %d",
+					sw.low, sw.high, int64(sw.high)-int64(sw.low)+1, len(sw.targets))
+			}
+			a.method.builder.TableSwitchInsn(sw.low, sw.defaultTarget, sw.targets...)
+		} else {
+			for i := 1; i < len(sw.keys); i++ {
+				if sw.keys[i-1] >= sw.keys[i] {
+					return fmt.Errorf("lookupswitch keys are not in increasing order")
+				}
+			}
+			a.method.builder.LookupSwitchInsn(sw.defaultTarget, sw.keys, sw.targets)
+		}
+		return c.end()
+	}
+	if sw.opcode == interpreter.LOOKUPSWITCH {
+		key, err := strconv.ParseInt(strings.TrimSuffix(first, ":"), 0, 32)
+		if err != nil || !strings.HasSuffix(first, ":") {
+			return fmt.Errorf("expected \"key: label\" or \"default: label\"")
+		}
+		sw.keys = append(sw.keys, int32(key))
+	} else {
+		c.pos--
+	}
+	label, err := a.labelOperand(c, number)
+	if err != nil {
+		return err
+	}
+	sw.targets = append(sw.targets, label)
+	return c.end()
+}
@@ -0,0 +1,312 @@
+package asm
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"outro/constant"
+	"outro/interpreter"
+	"outro/model"
+	"strconv"
+	"strings"
+)
+
+type disassembler struct {
+	class *model.ClassFile
+	sb    strings.Builder
+	err   error
+}
+
+// Disassemble writes a class file as assembly text that Assemble turns
+// back into an equivalent class.
+func Disassemble(class *model.ClassFile) (string, error) {
+	d := &disassembler{class: class}
+	d.printf(".bytecode %d.%d\n", class.MajorVersion, class.MinorVersion)
+	if source, ok := class.Attributes.Get("SourceFile").(*model.SourceFileAttributeInfo); ok {
+		d.printf(".source %s\n", quoteName(class.Utf8(source.SourceFileIndex)))
+	}
+	d.printf(".class %s\n", strings.Join(append(formatFlags(class.AccessFlags, classFlags), class.ClassName(class.ThisClass)), " "))
+	if class.SuperClass != 0 {
+		d.printf(".super %s\n", class.ClassName(class.SuperClass))
+	}
+	for _, index := range class.Interfaces {
+		d.printf(".implements %s\n", class.ClassName(index))
+	}
+	d.signature(class.Attributes, "")
+	for _, field := range class.Fields {
+		d.field(&field)
+	}
+	for _, method := range class.Methods {
+		d.method(&method)
+	}
+	return d.sb.String(), d.err
+}
+
+func (d *disassembler) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&d.sb, format, args...)
+}
+
+func (d *disassembler) fail(format string, args ...interface{}) {
+	if d.err == nil {
+		d.err = fmt.Errorf(format, args...)
+	}
+}
+
+func (d *disassembler) signature(attributes model.Attributes, indent string) {
+	if signature, ok := attributes.Get("Signature").(*model.SignatureAttributeInfo); ok {
+		d.printf("%s.signature %s\n", indent, strconv.Quote(d.class.Utf8(signature.SignatureIndex)))
+	}
+}
+
+func (d *disassembler) field(field *model.FieldInfo) {
+	words := formatFlags(field.AccessFlags, fieldFlags)
+	words = append(words, d.class.Utf8(field.NameIndex), d.class.Utf8(field.DescriptorIndex))
+	if value, ok := field.Attributes.Get("ConstantValue").(*model.ConstantValueAttributeInfo); ok {
+		words = append(words, "=", d.constant(value.ConstantValueIndex))
+	}
+	d.printf("\n.field %s\n", strings.Join(words, " "))
+	d.signature(field.Attributes, "")
+}
+
+func (d *disassembler) method(method *model.MethodInfo) {
+	words := formatFlags(method.AccessFlags, methodFlags)
+	words = append(words, d.class.Utf8(method.NameIndex)+d.class.Utf8(method.DescriptorIndex))
+	d.printf("\n.method %s\n", strings.Join(words, " "))
+	d.signature(method.Attributes, "    ")
+	if exceptions, ok := method.Attributes.Get("Exceptions").(*model.ExceptionsAttributeInfo); ok {
+		for _, index := range exceptions.ExceptionIndexTable {
+			d.printf("    .throws %s\n", d.class.ClassName(index))
+		}
+	}
+	if code, ok := method.Attributes.Get("Code").(*model.CodeAttributeInfo); ok {
+		d.code(code)
+	}
+	d.printf(".end method\n")
+}
+
+func (d *disassembler) code(code *model.CodeAttributeInfo) {
+	instructions, err := interpreter.Decode(code.Code)
+	if err != nil {
+		d.fail("%v", err)
+		return
+	}
+	starts := map[int]bool{len(code.Code): true}
+	for _, in := range instructions {
+		starts[in.Offset] = true
+	}
+	labels := map[int]bool{}
+	label := func(offset int) string {
+		if !starts[offset] {
+			d.fail("offset %d is not the start of an instruction", offset)
+		}
+		labels[offset] = true
+		return fmt.Sprintf("L%d", offset)
+	}
+
+	d.printf("    .limit stack %d\n", code.MaxStack)
+	d.printf("    .limit locals %d\n", code.MaxLocals)
+	for _, handler := range code.ExceptionTable {
+		catchType := "all"
+		if handler.CatchType != 0 {
+			catchType = d.class.ClassName(handler.CatchType)
+		}
+		d.printf("    .catch %s from %s to %s using %s\n", catchType,
+			label(int(handler.StartPC)), label(int(handler.EndPC)), label(int(handler.HandlerPC)))
+	}
+	if locals, ok := code.Attributes.Get("LocalVariableTable").(*model.LocalVariableTableAttributeInfo); ok {
+		for _, local := range locals.LocalVariableTable {
+			d.printf("    .var %d is %s %s from %s to %s\n", local.Index,
+				d.class.Utf8(local.NameIndex), d.class.Utf8(local.DescriptorIndex),
+				label(int(local.StartPC)), label(int(local.StartPC)+int(local.Length)))
+		}
+	}
+	lines := map[int][]int{}
+	if table, ok := code.Attributes.Get("LineNumberTable").(*model.LineNumberTableAttributeInfo); ok {
+		for _, line := range table.LineNumberTable {
+			lines[int(line.StartPC)] = append(lines[int(line.StartPC)], int(line.LineNumber))
+		}
+	}
+
+	// Format the instructions first so every branch target is labelled.
+	text := make([]string, len(instructions))
+	for i, in := range instructions {
+		text[i] = d.instruction(&in, label)
+	}
+	for i, in := range instructions {
+		if labels[in.Offset] {
+			d.printf("L%d:\n", in.Offset)
+		}
+		for _, line := range lines[in.Offset] {
+			d.printf("    .line %d\n", line)
+		}
+		d.printf("    %s\n", text[i])
+	}
+	if labels[len(code.Code)] {
+		d.printf("L%d:\n", len(code.Code))
+	}
+}
+
+func (d *disassembler) instruction(in *interpreter.Instruction, label func(int) string) string {
+	name := interpreter.InstructDisplayNameMap[in.Opcode]
+	switch op := in.Opcode; {
+	case op == interpreter.BIPUSH || op == interpreter.SIPUSH:
+		return fmt.Sprintf("%s %d", name, in.Const)
+	case op == interpreter.NEWARRAY:
+		elementType, ok := arrayTypes[int(in.ArrayType)]
+		if !ok {
+			d.fail("invalid newarray type %d", in.ArrayType)
+		}
+		return name + " " + elementType
+	case op == interpreter.LDC || op == interpreter.LDC_W || op == interpreter.LDC2_W:
+		return name + " " + d.constant(uint16(in.Index))
+	case op >= interpreter.ILOAD && op <= interpreter.ALOAD,
+		op >= interpreter.ISTORE && op <= interpreter.ASTORE,
+		op == interpreter.RET:
+		return fmt.Sprintf("%s %d", name, in.Local)
+	case op == interpreter.IINC:
+		return fmt.Sprintf("%s %d %d", name, in.Local, in.Const)
+	case op >= interpreter.IFEQ && op <= interpreter.JSR,
+		op == interpreter.IFNULL || op == interpreter.IFNONNULL,
+		op == interpreter.GOTO_W || op == interpreter.JSR_W:
+		return name + " " + label(in.Target)
+	case op == interpreter.TABLESWITCH || op == interpreter.LOOKUPSWITCH:
+		var sb strings.Builder
+		sb.WriteString(name)
+		if op == interpreter.TABLESWITCH {
+			fmt.Fprintf(&sb, " %d %d", in.Keys[0], in.Keys[len(in.Keys)-1])
+		}
+		for i, target := range in.Targets {
+			if op == interpreter.TABLESWITCH {
+				fmt.Fprintf(&sb, "\n        %s", label(target))
+			} else {
+				fmt.Fprintf(&sb, "\n        %d: %s", in.Keys[i], label(target))
+			}
+		}
+		fmt.Fprintf(&sb, "\n        default: %s", label(in.Target))
+		return sb.String()
+	case op >= interpreter.GETSTATIC && op <= interpreter.INVOKEINTERFACE:
+		text := name + " " + d.member(uint16(in.Index), op != interpreter.INVOKEINTERFACE)
+		if op == interpreter.INVOKEINTERFACE {
+			text += fmt.Sprintf(" %d", in.Count)
+		}
+		return text
+	case op == interpreter.INVOKEDYNAMIC:
+		return name + " " + d.dynamic(uint16(in.Index), constant.ConstantInvokeDynamic)
+	case op == interpreter.NEW || op == interpreter.ANEWARRAY,
+		op == interpreter.CHECKCAST || op == interpreter.INSTANCEOF:
+		return name + " " + d.className(uint16(in.Index))
+	case op == interpreter.MULTIANEWARRAY:
+		return fmt.Sprintf("%s %s %d", name, d.className(uint16(in.Index)), in.Count)
+	}
+	return name
+}
+
+func (d *disassembler) entry(index uint16, tags ...uint8) *model.ConstantInfo {
+	if int(index) < len(d.class.ConstantPool) {
+		entry := &d.class.ConstantPool[index]
+		for _, tag := range tags {
+			if entry.Tag == tag {
+				return entry
+			}
+		}
+	}
+	d.fail("invalid constant pool reference %d", index)
+	return &model.ConstantInfo{Info: make([]byte, 8)}
+}
+
+func (d *disassembler) className(index uint16) string {
+	entry := d.entry(index, constant.ConstantClass)
+	return d.class.Utf8(binary.BigEndian.Uint16(entry.Info))
+}
+
+// member formats a field as "owner/name desc" and a method as
+// "owner/name(desc)ret", marking interface methods with "interface" when
+// markInterface is set.
+func (d *disassembler) member(index uint16, markInterface bool) string {
+	entry := d.entry(index, constant.ConstantFieldRef, constant.ConstantMethodRef, constant.ConstantInterfaceMethodRef)
+	owner := d.className(binary.BigEndian.Uint16(entry.Info))
+	name, descriptor := d.class.NameAndType(binary.BigEndian.Uint16(entry.Info[2:]))
+	text := owner + "/" + name
+	if entry.Tag == constant.ConstantFieldRef {
+		text += " " + descriptor
+	} else {
+		text += descriptor
+	}
+	if markInterface && entry.Tag == constant.ConstantInterfaceMethodRef {
+		text = "interface " + text
+	}
+	return text
+}
+
+func (d *disassembler) handle(index uint16) string {
+	entry := d.entry(index, constant.ConstantMethodHandle)
+	kind := entry.Info[0]
+	kindName, ok := handleKinds[kind]
+	if !ok {
+		d.fail("invalid method handle kind %d", kind)
+	}
+	return kindName + " " + d.member(binary.BigEndian.Uint16(entry.Info[1:]), kind != constant.RefInvokeInterface)
+}
+
+// dynamic formats a CONSTANT_InvokeDynamic as "name+desc <handle> { args }"
+// and a CONSTANT_Dynamic as "name desc <handle> { args }".
+func (d *disassembler) dynamic(index uint16, tag uint8) string {
+	entry := d.entry(index, tag)
+	name, descriptor := d.class.NameAndType(binary.BigEndian.Uint16(entry.Info[2:]))
+	text := name + descriptor
+	if tag == constant.ConstantDynamic {
+		text = name + " " + descriptor
+	}
+	bootstrapMethods, _ := d.class.Attributes.Get("BootstrapMethods").(*model.BootstrapMethodsAttributeInfo)
+	bootstrap := int(binary.BigEndian.Uint16(entry.Info))
+	if bootstrapMethods == nil || bootstrap >= len(bootstrapMethods.BootstrapMethods) {
+		d.fail("invalid bootstrap method %d", bootstrap)
+		return text
+	}
+	method := bootstrapMethods.BootstrapMethods[bootstrap]
+	text += " " + d.handle(method.BootstrapMethodRef)
+	if len(method.BootstrapArguments) > 0 {
+		arguments := []string{"{"}
+		for _, argument := range method.BootstrapArguments {
+			arguments = append(arguments, d.constant(argument))
+		}
+		text += " " + strings.Join(append(arguments, "}"), " ")
+	}
+	return text
+}
+
+// constant formats a loadable constant as parsed by assembler.constant.
+func (d *disassembler) constant(index uint16) string {
+	entry := d.entry(index, constant.ConstantInteger, constant.ConstantFloat, constant.ConstantLong,
+		constant.ConstantDouble, constant.ConstantString, constant.ConstantClass, constant.ConstantMethodType,
+		constant.ConstantMethodHandle, constant.ConstantDynamic)
+	switch entry.Tag {
+	case constant.ConstantInteger:
+		return strconv.Itoa(int(int32(binary.BigEndian.Uint32(entry.Info))))
+	case constant.ConstantFloat:
+		return formatFloat(float64(math.Float32frombits(binary.BigEndian.Uint32(entry.Info))), 32)
+	case constant.ConstantLong:
+		return strconv.FormatInt(int64(binary.BigEndian.Uint64(entry.Info)), 10) + "L"
+	case constant.ConstantDouble:
+		return formatFloat(math.Float64frombits(binary.BigEndian.Uint64(entry.Info)), 64)
+	case constant.ConstantString:
+		return strconv.Quote(d.class.Utf8(binary.BigEndian.Uint16(entry.Info)))
+	case constant.ConstantClass:
+		return "class " + d.className(index)
+	case constant.ConstantMethodType:
+		return "methodtype " + d.class.Utf8(binary.BigEndian.Uint16(entry.Info))
+	case constant.ConstantMethodHandle:
+		return "methodhandle " + d.handle(index)
+	case constant.ConstantDynamic:
+		return "dynamic " + d.dynamic(index, constant.ConstantDynamic)
+	}
+	return ""
+}
+
+// quoteName quotes a name only if it would not survive as a single token.
+func quoteName(name string) string {
+	if name == "" || strings.ContainsAny(name, " \t\r\n\";") {
+		return strconv.Quote(name)
+	}
+	return name
+}
@@ -0,0 +1,60 @@
+package asm
+
+import (
+	"fmt"
+	"strings"
+)
+
+// line is a source line split into tokens. Quoted strings are kept as one
+// token, quotes included.
+type line struct {
+	number int
+	tokens []string
+}
+
+func tokenize(text string) ([]line, error) {
+	var lines []line
+	for i, source := range strings.Split(text, "\n") {
+		tokens, err := splitLine(source)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", i+1, err)
+		}
+		if len(tokens) > 0 {
+			lines = append(lines, line{number: i + 1, tokens: tokens})
+		}
+	}
+	return lines, nil
+}
+
+func splitLine(source string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(source); {
+		switch c := source[i]; {
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+		case c == ';':
+			return tokens, nil
+		case c == '"':
+			end := i + 1
+			for end < len(source) && source[end] != '"' {
+				if source[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(source) {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			tokens = append(tokens, source[i:end+1])
+			i = end + 1
+		default:
+			end := i
+			for end < len(source) && !strings.ContainsRune(" \t\r", rune(source[end])) {
+				end++
+			}
+			tokens = append(tokens, source[i:end])
+			i = end
+		}
+	}
+	return tokens, nil
+}
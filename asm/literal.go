@@ -0,0 +1,252 @@
+package asm
+
+import (
+	"fmt"
+	"math"
+	"outro/builder"
+	"outro/constant"
+	"strconv"
+	"strings"
+)
+
+// cursor walks the tokens of a line.
+type cursor struct {
+	tokens []string
+	pos    int
+}
+
+func (c *cursor) done() bool {
+	return c.pos >= len(c.tokens)
+}
+
+func (c *cursor) peek() string {
+	if c.done() {
+		return ""
+	}
+	return c.tokens[c.pos]
+}
+
+func (c *cursor) next(what string) (string, error) {
+	if c.done() {
+		return "", fmt.Errorf("missing %s", what)
+	}
+	c.pos++
+	return c.tokens[c.pos-1], nil
+}
+
+func (c *cursor) end() error {
+	if !c.done() {
+		return fmt.Errorf("unexpected %q", c.peek())
+	}
+	return nil
+}
+
+// constant parses a loadable constant into the value builder.ConstantPool
+// Loadable takes.
+func (a *assembler) constant(c *cursor) (interface{}, error) {
+	token, err := c.next("constant")
+	if err != nil {
+		return nil, err
+	}
+	switch token {
+	case "class":
+		name, err := c.next("class name")
+		return builder.ClassConstant(name), err
+	case "methodtype":
+		descriptor, err := c.next("method descriptor")
+		return builder.MethodTypeConstant(descriptor), err
+	case "methodhandle":
+		return a.handle(c)
+	case "dynamic":
+		name, err := c.next("name")
+		if err != nil {
+			return nil, err
+		}
+		descriptor, err := c.next("descriptor")
+		if err != nil {
+			return nil, err
+		}
+		bootstrapMethod, err := a.bootstrapMethod(c)
+		return builder.ConstantDynamic{Name: name, Descriptor: descriptor, BootstrapMethod: bootstrapMethod}, err
+	}
+	return parseLiteral(token)
+}
+
+// bootstrapMethod parses "<handle> { args }" into a BootstrapMethods entry.
+func (a *assembler) bootstrapMethod(c *cursor) (uint16, error) {
+	handle, err := a.handle(c)
+	if err != nil {
+		return 0, err
+	}
+	pool := a.class.Pool()
+	var arguments []uint16
+	if c.peek() == "{" {
+		c.pos++
+		for c.peek() != "}" {
+			value, err := a.constant(c)
+			if err != nil {
+				return 0, err
+			}
+			index, err := pool.Loadable(value)
+			if err != nil {
+				return 0, err
+			}
+			arguments = append(arguments, index)
+		}
+		c.pos++
+	}
+	index, err := pool.Loadable(handle)
+	if err != nil {
+		return 0, err
+	}
+	return a.class.BootstrapMethod(index, arguments...), nil
+}
+
+// handle parses "kind [interface] member", where member is owner/name desc
+// for the field kinds and owner/name(desc)ret for the others.
+func (a *assembler) handle(c *cursor) (builder.Handle, error) {
+	var handle builder.Handle
+	name, err := c.next("method handle kind")
+	if err != nil {
+		return handle, err
+	}
+	for kind, kindName := range handleKinds {
+		if kindName == name {
+			handle.Kind = kind
+		}
+	}
+	if handle.Kind == 0 {
+		return handle, fmt.Errorf("unknown method handle kind %q", name)
+	}
+	if c.peek() == "interface" {
+		c.pos++
+		handle.IsInterface = true
+	}
+	if handle.Kind <= constant.RefPutStatic {
+		handle.Owner, handle.Name, handle.Descriptor, err = fieldSpec(c)
+	} else {
+		handle.Owner, handle.Name, handle.Descriptor, err = methodSpec(c)
+	}
+	return handle, err
+}
+
+// fieldSpec parses "owner/name desc".
+func fieldSpec(c *cursor) (owner, name, descriptor string, err error) {
+	member, err := c.next("field")
+	if err != nil {
+		return
+	}
+	slash := strings.LastIndexByte(member, '/')
+	if slash <= 0 || slash == len(member)-1 {
+		return "", "", "", fmt.Errorf("invalid field %q", member)
+	}
+	descriptor, err = c.next("field descriptor")
+	return member[:slash], member[slash+1:], descriptor, err
+}
+
+// methodSpec parses "owner/name(desc)ret".
+func methodSpec(c *cursor) (owner, name, descriptor string, err error) {
+	member, err := c.next("method")
+	if err != nil {
+		return
+	}
+	paren := strings.IndexByte(member, '(')
+	slash := -1
+	if paren > 0 {
+		slash = strings.LastIndexByte(member[:paren], '/')
+	}
+	if slash <= 0 || slash == paren-1 {
+		return "", "", "", fmt.Errorf("invalid method %q", member)
+	}
+	return member[:slash], member[slash+1 : paren], member[paren:], nil
+}
+
+// parseLiteral parses a number or quoted string: 1, 1L, 1.5f, 1.5 and
+// "text" are an int32, int64, float32, float64 and string.
+func parseLiteral(token string) (interface{}, error) {
+	if strings.HasPrefix(token, `"`) {
+		s, err := strconv.Unquote(token)
+		if err != nil {
+			return nil, fmt.Errorf("invalid string %s", token)
+		}
+		return s, nil
+	}
+	if v, err := strconv.ParseInt(token, 0, 64); err == nil {
+		if v < math.MinInt32 || v > math.MaxInt32 {
+			return nil, fmt.Errorf("int %s out of range", token)
+		}
+		return int32(v), nil
+	}
+	switch body := token[:len(token)-1]; token[len(token)-1] {
+	case 'L', 'l':
+		if v, err := strconv.ParseInt(body, 0, 64); err == nil {
+			return v, nil
+		}
+	case 'F', 'f':
+		if v, err := strconv.ParseFloat(body, 32); err == nil {
+			return float32(v), nil
+		}
+	}
+	if v, err := strconv.ParseFloat(token, 64); err == nil {
+		return v, nil
+	}
+	return nil, fmt.Errorf("invalid constant %q", token)
+}
+
+func formatFloat(f float64, bitSize int) string {
+	var s string
+	switch {
+	case math.IsNaN(f):
+		s = "NaN"
+	case math.IsInf(f, 1):
+		s = "Infinity"
+	case math.IsInf(f, -1):
+		s = "-Infinity"
+	default:
+		s = strconv.FormatFloat(f, 'g', -1, bitSize)
+		if !strings.ContainsAny(s, ".e") {
+			s += ".0"
+		}
+	}
+	if bitSize == 32 {
+		s += "f"
+	}
+	return s
+}
+
+// formatFlags writes the keywords of flags, and any bits without one in
+// hexadecimal.
+func formatFlags(flags uint16, names []flagName) []string {
+	var words []string
+	for _, name := range names {
+		if flags&uint16(name.flag) != 0 {
+			words = append(words, name.name)
+			flags &^= uint16(name.flag)
+		}
+	}
+	if flags != 0 {
+		words = append(words, fmt.Sprintf("0x%04x", flags))
+	}
+	return words
+}
+
+func parseFlags(tokens []string, names []flagName) (uint16, error) {
+	var flags uint16
+next:
+	for _, token := range tokens {
+		for _, name := range names {
+			if name.name == token {
+				flags |= uint16(name.flag)
+				continue next
+			}
+		}
+		if strings.HasPrefix(token, "0x") {
+			if v, err := strconv.ParseUint(token[2:], 16, 16); err == nil {
+				flags |= uint16(v)
+				continue
+			}
+		}
+		return 0, fmt.Errorf("unknown access flag %q", token)
+	}
+	return flags, nil
+}
@@ -0,0 +1,290 @@
+package builder
+
+import (
+	"encoding/binary"
+	"fmt"
+	"outro/constant"
+	"outro/interpreter"
+	"outro/model"
+)
+
+// build lays out the code, resolves labels and computes max_stack.
+func (m *MethodBuilder) build() (model.MethodInfo, error) {
+	pool := m.class.pool
+	method := model.MethodInfo{
+		AccessFlags:     m.accessFlags,
+		NameIndex:       pool.Utf8(m.name),
+		DescriptorIndex: pool.Utf8(m.descriptor),
+	}
+	if m.err != nil {
+		return method, m.err
+	}
+	abstract := m.accessFlags&uint16(constant.METHOD_ACC_ABSTRACT|constant.METHOD_ACC_NATIVE) != 0
+	if len(m.instructions) > 0 || !abstract {
+		if abstract {
+			return method, fmt.Errorf("abstract or native method has code")
+		}
+		code, err := m.assemble()
+		if err != nil {
+			return method, err
+		}
+		method.Attributes = append(method.Attributes, newAttribute(pool, "Code", code))
+	}
+	method.Attributes = append(method.Attributes, m.attributes...)
+	method.AttributesCount = uint16(len(method.Attributes))
+	return method, nil
+}
+
+func (m *MethodBuilder) assemble() (*model.CodeAttributeInfo, error) {
+	for _, label := range m.labels {
+		if !label.placed {
+			return nil, fmt.Errorf("label used but never marked")
+		}
+	}
+	offset := 0
+	for _, in := range m.instructions {
+		in.offset = offset
+		offset += in.size()
+	}
+	for _, label := range m.labels {
+		label.offset = offset
+		if label.index < len(m.instructions) {
+			label.offset = m.instructions[label.index].offset
+		}
+	}
+	if offset == 0 || offset > 65535 {
+		return nil, fmt.Errorf("invalid code length %d", offset)
+	}
+	code := make([]byte, 0, offset)
+	var err error
+	for _, in := range m.instructions {
+		if code, err = in.encode(code); err != nil {
+			return nil, err
+		}
+	}
+	handlers := make([]model.ExceptionTable, len(m.tryCatch))
+	for i, block := range m.tryCatch {
+		if block.start.offset >= block.end.offset {
+			return nil, fmt.Errorf("empty try block at offset %d", block.start.offset)
+		}
+		handlers[i] = model.ExceptionTable{
+			StartPC:   uint16(block.start.offset),
+			EndPC:     uint16(block.end.offset),
+			HandlerPC: uint16(block.handler.offset),
+			CatchType: block.catchType,
+		}
+	}
+	maxStack, maxLocals := -1, m.maxLocals
+	if m.limits != nil {
+		maxStack = m.limits[0]
+		if m.limits[1] >= 0 {
+			maxLocals = m.limits[1]
+		}
+	}
+	if maxStack < 0 {
+		if maxStack, err = m.maxStack(); err != nil {
+			return nil, err
+		}
+	}
+	return &model.CodeAttributeInfo{
+		MaxStack:             uint16(maxStack),
+		MaxLocals:            uint16(maxLocals),
+		CodeLength:           uint32(len(code)),
+		Code:                 code,
+		ExceptionTableLength: uint16(len(handlers)),
+		ExceptionTable:       handlers,
+		Attributes:           m.codeAttributes(),
+	}, nil
+}
+
+func (m *MethodBuilder) codeAttributes() model.Attributes {
+	var attributes model.Attributes
+	pool := m.class.pool
+	if len(m.lineNumbers) > 0 {
+		table := make([]model.LineNumberTable, len(m.lineNumbers))
+		for i, line := range m.lineNumbers {
+			table[i] = model.LineNumberTable{StartPC: uint16(line.start.offset), LineNumber: uint16(line.line)}
+		}
+		attributes = append(attributes, newAttribute(pool, "LineNumberTable", &model.LineNumberTableAttributeInfo{
+			LineNumberTable:      table,
+			LineNumberTableCount: uint16(len(table)),
+		}))
+	}
+	if len(m.localVariables) > 0 {
+		table := make([]model.LocalVariableTable, len(m.localVariables))
+		for i, local := range m.localVariables {
+			table[i] = model.LocalVariableTable{
+				StartPC:         uint16(local.start.offset),
+				Length:          uint16(local.end.offset - local.start.offset),
+				NameIndex:       pool.Utf8(local.name),
+				DescriptorIndex: pool.Utf8(local.descriptor),
+				Index:           uint16(local.index),
+			}
+		}
+		attributes = append(attributes, newAttribute(pool, "LocalVariableTable", &model.LocalVariableTableAttributeInfo{
+			LocalVariableTable: table,
+		}))
+	}
+	if len(m.localVariableTypes) > 0 {
+		table := make([]model.LocalVariableTypeInfo, len(m.localVariableTypes))
+		for i, local := range m.localVariableTypes {
+			table[i] = model.LocalVariableTypeInfo{
+				StartPc:        uint16(local.start.offset),
+				Length:         uint16(local.end.offset - local.start.offset),
+				NameIndex:      pool.Utf8(local.name),
+				SignatureIndex: pool.Utf8(local.descriptor),
+				Index:          uint16(local.index),
+			}
+		}
+		attributes = append(attributes, newAttribute(pool, "LocalVariableTypeTable", &model.LocalVariableTypeTableAttributeInfo{
+			LocalVariableTable: table,
+		}))
+	}
+	for _, attribute := range m.extraCodeAttributes {
+		attributes = append(attributes, newAttribute(pool, attribute.name, attribute.value()))
+	}
+	return attributes
+}
+
+// padding returns the bytes that align a switch's operands to 4 bytes.
+func (in *instruction) padding() int {
+	return (4 - (in.offset+1)%4) % 4
+}
+
+func (in *instruction) size() int {
+	switch in.opcode {
+	case interpreter.TABLESWITCH:
+		return 1 + in.padding() + 12 + 4*len(in.targets)
+	case interpreter.LOOKUPSWITCH:
+		return 1 + in.padding() + 8 + 8*len(in.targets)
+	case interpreter.GOTO_W, interpreter.JSR_W:
+		return 5
+	}
+	if in.target != nil {
+		return 3
+	}
+	return 1 + len(in.operands)
+}
+
+func (in *instruction) encode(code []byte) ([]byte, error) {
+	code = append(code, byte(in.opcode))
+	switch {
+	case in.opcode == interpreter.TABLESWITCH || in.opcode == interpreter.LOOKUPSWITCH:
+		code = append(code, make([]byte, in.padding())...)
+		code = binary.BigEndian.AppendUint32(code, uint32(in.defaultTarget.offset-in.offset))
+		if in.opcode == interpreter.TABLESWITCH {
+			low, high := int32(0), int32(-1)
+			if len(in.keys) > 0 {
+				low, high = in.keys[0], in.keys[len(in.keys)-1]
+			}
+			code = binary.BigEndian.AppendUint32(code, uint32(low))
+			code = binary.BigEndian.AppendUint32(code, uint32(high))
+		} else {
+			code = binary.BigEndian.AppendUint32(code, uint32(len(in.keys)))
+		}
+		for i, target := range in.targets {
+			if in.opcode == interpreter.LOOKUPSWITCH {
+				code = binary.BigEndian.AppendUint32(code, uint32(in.keys[i]))
+			}
+			code = binary.BigEndian.AppendUint32(code, uint32(target.offset-in.offset))
+		}
+	case in.target != nil:
+		delta := in.target.offset - in.offset
+		if in.opcode == interpreter.GOTO_W || in.opcode == interpreter.JSR_W {
+			return binary.BigEndian.AppendUint32(code, uint32(delta)), nil
+		}
+		if delta < -32768 || delta > 32767 {
+			return nil, fmt.Errorf("branch at offset %d to offset %d is out of range", in.offset, in.target.offset)
+		}
+		code = binary.BigEndian.AppendUint16(code, uint16(int16(delta)))
+	default:
+		code = append(code, in.operands...)
+	}
+	return code, nil
+}
+
+// maxStack follows every path through the code from the entry point and
+// each exception handler, checking that the stack height agrees wherever
+// paths meet.
+func (m *MethodBuilder) maxStack() (int, error) {
+	heights := make([]int, len(m.instructions)+1)
+	for i := range heights {
+		heights[i] = -1
+	}
+	var worklist []int
+	reach := func(index, height int) error {
+		if index >= len(m.instructions) {
+			return fmt.Errorf("execution falls off the end of the code")
+		}
+		switch heights[index] {
+		case -1:
+			heights[index] = height
+			worklist = append(worklist, index)
+		case height:
+		default:
+			return fmt.Errorf("inconsistent stack height %d and %d at offset %d",
+				heights[index], height, m.instructions[index].offset)
+		}
+		return nil
+	}
+	if err := reach(0, 0); err != nil {
+		return 0, err
+	}
+	for _, block := range m.tryCatch {
+		if err := reach(block.handler.index, 1); err != nil {
+			return 0, err
+		}
+	}
+	maxStack := 0
+	for len(worklist) > 0 {
+		index := worklist[len(worklist)-1]
+		worklist = worklist[:len(worklist)-1]
+		in := m.instructions[index]
+		if heights[index] > maxStack {
+			maxStack = heights[index]
+		}
+		height := heights[index] - in.pop
+		if height < 0 {
+			return 0, fmt.Errorf("stack underflow at offset %d", in.offset)
+		}
+		height += in.push
+		if height > maxStack {
+			maxStack = height
+		}
+		if height > 0xFFFF {
+			return 0, fmt.Errorf("stack overflow at offset %d", in.offset)
+		}
+		var successors []*Label
+		fallsThrough := true
+		switch in.opcode {
+		case interpreter.GOTO, interpreter.GOTO_W, interpreter.RET, interpreter.ATHROW,
+			interpreter.IRETURN, interpreter.LRETURN, interpreter.FRETURN,
+			interpreter.DRETURN, interpreter.ARETURN, interpreter.RETURN:
+			fallsThrough = false
+		case interpreter.TABLESWITCH, interpreter.LOOKUPSWITCH:
+			fallsThrough = false
+			successors = append(append(successors, in.defaultTarget), in.targets...)
+		case interpreter.JSR, interpreter.JSR_W:
+			// The subroutine returns to the next instruction without the
+			// return address it was called with.
+			if err := reach(in.target.index, height); err != nil {
+				return 0, err
+			}
+			height--
+		}
+		if in.target != nil && in.opcode != interpreter.JSR && in.opcode != interpreter.JSR_W {
+			successors = append(successors, in.target)
+		}
+		for _, target := range successors {
+			if err := reach(target.index, height); err != nil {
+				return 0, err
+			}
+		}
+		if fallsThrough {
+			if err := reach(index+1, height); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return maxStack, nil
+}
@@ -0,0 +1,236 @@
+// Package builder generates class files from Go: classes, fields and
+// methods are declared through a fluent API, the constant pool is managed
+// automatically and method bodies are written as symbolic bytecode with
+// labels.
+package builder
+
+import (
+	"fmt"
+	"outro/constant"
+	"outro/model"
+	"outro/parser"
+	"outro/writer"
+)
+
+// ClassBuilder declares a class. Methods return the builder so calls can be
+// chained; the first error is reported by Build or Bytes.
+type ClassBuilder struct {
+	pool             *ConstantPool
+	majorVersion     uint16
+	minorVersion     uint16
+	accessFlags      uint16
+	thisClass        uint16
+	superClass       uint16
+	interfaces       []uint16
+	fields           []*FieldBuilder
+	methods          []*MethodBuilder
+	attributes       model.Attributes
+	bootstrapMethods []model.BootstrapMethodInfo
+	name             string
+	err              error
+}
+
+// NewClass starts a public class extending java/lang/Object with class
+// file version 61.0 (Java 17). name is in internal form, e.g. "com/example/Foo".
+func NewClass(name string) *ClassBuilder {
+	return NewClassIn(NewConstantPool(), name)
+}
+
+// NewClassIn starts a class like NewClass whose constant pool starts as
+// pool, such as ExtendConstantPool of the class it rewrites.
+func NewClassIn(pool *ConstantPool, name string) *ClassBuilder {
+	c := &ClassBuilder{
+		pool:         pool,
+		majorVersion: 61,
+		accessFlags:  uint16(constant.CLASS_ACC_PUBLIC | constant.CLASS_ACC_SUPER),
+		name:         name,
+	}
+	c.thisClass = c.pool.Class(name)
+	c.superClass = c.pool.Class("java/lang/Object")
+	return c
+}
+
+// Pool returns the constant pool, for operands the builder has no helper for.
+func (c *ClassBuilder) Pool() *ConstantPool {
+	return c.pool
+}
+
+func (c *ClassBuilder) Version(major, minor uint16) *ClassBuilder {
+	c.majorVersion, c.minorVersion = major, minor
+	return c
+}
+
+func (c *ClassBuilder) Access(flags uint16) *ClassBuilder {
+	c.accessFlags = flags
+	return c
+}
+
+// Super sets the superclass; "" leaves it unset, as for java/lang/Object
+// and module-info.
+func (c *ClassBuilder) Super(name string) *ClassBuilder {
+	c.superClass = 0
+	if name != "" {
+		c.superClass = c.pool.Class(name)
+	}
+	return c
+}
+
+func (c *ClassBuilder) Implements(names ...string) *ClassBuilder {
+	for _, name := range names {
+		c.interfaces = append(c.interfaces, c.pool.Class(name))
+	}
+	return c
+}
+
+func (c *ClassBuilder) SourceFile(name string) *ClassBuilder {
+	return c.Attribute("SourceFile", &model.SourceFileAttributeInfo{SourceFileIndex: c.pool.Utf8(name)})
+}
+
+// Attribute adds a class attribute; value is one of the model's decoded
+// attribute types, or the raw content of the attribute as a []byte.
+func (c *ClassBuilder) Attribute(name string, value interface{}) *ClassBuilder {
+	c.attributes = append(c.attributes, newAttribute(c.pool, name, value))
+	return c
+}
+
+// BootstrapMethod adds an entry to the BootstrapMethods attribute, unless
+// an equal one exists, and returns its index for InvokeDynamic. arguments
+// are constant pool indexes.
+func (c *ClassBuilder) BootstrapMethod(handle uint16, arguments ...uint16) uint16 {
+	for i, method := range c.bootstrapMethods {
+		if method.BootstrapMethodRef == handle && equalIndexes(method.BootstrapArguments, arguments) {
+			return uint16(i)
+		}
+	}
+	c.bootstrapMethods = append(c.bootstrapMethods, model.BootstrapMethodInfo{
+		BootstrapMethodRef: handle,
+		BootstrapArguments: arguments,
+	})
+	return uint16(len(c.bootstrapMethods) - 1)
+}
+
+func equalIndexes(a, b []uint16) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// NewAttribute returns an attribute for a structure the builder has no
+// method for, such as a record component; value is as for Attribute.
+func (c *ClassBuilder) NewAttribute(name string, value interface{}) model.AttributeInfo {
+	return newAttribute(c.pool, name, value)
+}
+
+func newAttribute(pool *ConstantPool, name string, value interface{}) model.AttributeInfo {
+	if raw, ok := value.([]byte); ok {
+		return model.AttributeInfo{AttributeNameIndex: pool.Utf8(name), Name: name, Info: raw}
+	}
+	return model.AttributeInfo{AttributeNameIndex: pool.Utf8(name), Name: name, Value: value}
+}
+
+func (c *ClassBuilder) fail(format string, args ...interface{}) {
+	if c.err == nil {
+		c.err = fmt.Errorf(format, args...)
+	}
+}
+
+// FieldBuilder declares a field.
+type FieldBuilder struct {
+	class *ClassBuilder
+	info  model.FieldInfo
+}
+
+func (c *ClassBuilder) Field(accessFlags uint16, name, descriptor string) *FieldBuilder {
+	if _, err := model.ParseFieldType(descriptor); err != nil {
+		c.fail("field %s: %v", name, err)
+	}
+	f := &FieldBuilder{class: c, info: model.FieldInfo{
+		AccessFlags:     accessFlags,
+		NameIndex:       c.pool.Utf8(name),
+		DescriptorIndex: c.pool.Utf8(descriptor),
+	}}
+	c.fields = append(c.fields, f)
+	return f
+}
+
+// ConstantValue gives a static field its initial value, an int32, float32,
+// int64, float64 or string.
+func (f *FieldBuilder) ConstantValue(value interface{}) *FieldBuilder {
+	index, err := f.class.pool.Loadable(value)
+	if err != nil {
+		f.class.fail("%v", err)
+	}
+	return f.Attribute("ConstantValue", &model.ConstantValueAttributeInfo{ConstantValueIndex: index})
+}
+
+func (f *FieldBuilder) Attribute(name string, value interface{}) *FieldBuilder {
+	f.info.Attributes = append(f.info.Attributes, newAttribute(f.class.pool, name, value))
+	return f
+}
+
+// Model returns the class file as the model types, without the lengths
+// and raw bytes the parser fills in. Build returns a fully parsed model.
+func (c *ClassBuilder) Model() (*model.ClassFile, error) {
+	class := &model.ClassFile{
+		Magic:        constant.ClassFileMagic,
+		MinorVersion: c.minorVersion,
+		MajorVersion: c.majorVersion,
+		AccessFlags:  c.accessFlags,
+		ThisClass:    c.thisClass,
+		SuperClass:   c.superClass,
+		Interfaces:   c.interfaces,
+	}
+	for _, f := range c.fields {
+		class.Fields = append(class.Fields, f.info)
+	}
+	for _, m := range c.methods {
+		method, err := m.build()
+		if err != nil {
+			return nil, fmt.Errorf("method %s%s: %w", m.name, m.descriptor, err)
+		}
+		class.Methods = append(class.Methods, method)
+	}
+	class.Attributes = append(class.Attributes, c.attributes...)
+	if len(c.bootstrapMethods) > 0 {
+		class.Attributes = append(class.Attributes, newAttribute(c.pool, "BootstrapMethods",
+			&model.BootstrapMethodsAttributeInfo{BootstrapMethods: c.bootstrapMethods}))
+	}
+	if c.err != nil {
+		return nil, fmt.Errorf("class %s: %w", c.name, c.err)
+	}
+	if err := c.pool.Err(); err != nil {
+		return nil, fmt.Errorf("class %s: %w", c.name, err)
+	}
+	class.ConstantPool = c.pool.Entries()
+	class.ConstantPoolCount = uint16(len(class.ConstantPool))
+	class.InterfacesCount = uint16(len(class.Interfaces))
+	class.FieldsCount = uint16(len(class.Fields))
+	class.MethodsCount = uint16(len(class.Methods))
+	class.AttributesCount = uint16(len(class.Attributes))
+	return class, nil
+}
+
+// Bytes returns the class file.
+func (c *ClassBuilder) Bytes() ([]byte, error) {
+	class, err := c.Model()
+	if err != nil {
+		return nil, err
+	}
+	return writer.Write(class)
+}
+
+// Build returns the class file parsed back from Bytes, as the runtime and
+// the other tools expect it.
+func (c *ClassBuilder) Build() (*model.ClassFile, error) {
+	data, err := c.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	return parser.NewClassFileParser(parser.NewByteReader(data)).Parse()
+}
@@ -0,0 +1,230 @@
+package builder
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"outro/constant"
+	"outro/model"
+	"outro/parser"
+)
+
+// ConstantPool hands out constant pool indexes, adding each distinct entry
+// once. Index 0 and the second slot of every long and double stay unused.
+type ConstantPool struct {
+	entries []model.ConstantInfo
+	indexes map[string]uint16
+	err     error
+}
+
+func NewConstantPool() *ConstantPool {
+	return &ConstantPool{entries: make([]model.ConstantInfo, 1), indexes: map[string]uint16{}}
+}
+
+// ExtendConstantPool returns a pool that starts with the entries of an
+// existing class file, so that adding an entry it already has returns the
+// existing index.
+func ExtendConstantPool(entries []model.ConstantInfo) *ConstantPool {
+	p := NewConstantPool()
+	if len(entries) > 0 {
+		p.entries = append([]model.ConstantInfo(nil), entries...)
+	}
+	for i := 1; i < len(p.entries); i++ {
+		key := poolKey(p.entries[i])
+		if _, ok := p.indexes[key]; !ok && p.entries[i].Tag != 0 {
+			p.indexes[key] = uint16(i)
+		}
+	}
+	return p
+}
+
+// Entries returns the pool as it would appear in ClassFile.ConstantPool.
+func (p *ConstantPool) Entries() []model.ConstantInfo {
+	return p.entries
+}
+
+// Err reports the first failure, such as the pool overflowing 65535 slots.
+func (p *ConstantPool) Err() error {
+	return p.err
+}
+
+func (p *ConstantPool) add(info model.ConstantInfo) uint16 {
+	key := poolKey(info)
+	if index, ok := p.indexes[key]; ok {
+		return index
+	}
+	index := len(p.entries)
+	slots := 1
+	if info.Tag == constant.ConstantLong || info.Tag == constant.ConstantDouble {
+		slots = 2
+	}
+	if index+slots > 0xFFFF {
+		if p.err == nil {
+			p.err = fmt.Errorf("constant pool is full")
+		}
+		return 0
+	}
+	p.entries = append(p.entries, info)
+	if slots == 2 {
+		p.entries = append(p.entries, model.ConstantInfo{})
+	}
+	p.indexes[key] = uint16(index)
+	return uint16(index)
+}
+
+func poolKey(info model.ConstantInfo) string {
+	return string(rune(info.Tag)) + string(info.Info)
+}
+
+func u2(v ...uint16) []byte {
+	var data []byte
+	for _, x := range v {
+		data = binary.BigEndian.AppendUint16(data, x)
+	}
+	return data
+}
+
+func (p *ConstantPool) Utf8(s string) uint16 {
+	return p.add(model.ConstantInfo{Tag: constant.ConstantUtf8, Info: parser.EncodeMUTF8(s), Utf8: s})
+}
+
+// Class adds a CONSTANT_Class for an internal name or array descriptor.
+func (p *ConstantPool) Class(name string) uint16 {
+	return p.add(model.ConstantInfo{Tag: constant.ConstantClass, Info: u2(p.Utf8(name))})
+}
+
+func (p *ConstantPool) String(s string) uint16 {
+	return p.add(model.ConstantInfo{Tag: constant.ConstantString, Info: u2(p.Utf8(s))})
+}
+
+func (p *ConstantPool) Integer(v int32) uint16 {
+	return p.add(model.ConstantInfo{Tag: constant.ConstantInteger, Info: binary.BigEndian.AppendUint32(nil, uint32(v))})
+}
+
+func (p *ConstantPool) Float(v float32) uint16 {
+	return p.add(model.ConstantInfo{Tag: constant.ConstantFloat, Info: binary.BigEndian.AppendUint32(nil, math.Float32bits(v))})
+}
+
+func (p *ConstantPool) Long(v int64) uint16 {
+	return p.add(model.ConstantInfo{Tag: constant.ConstantLong, Info: binary.BigEndian.AppendUint64(nil, uint64(v))})
+}
+
+func (p *ConstantPool) Double(v float64) uint16 {
+	return p.add(model.ConstantInfo{Tag: constant.ConstantDouble, Info: binary.BigEndian.AppendUint64(nil, math.Float64bits(v))})
+}
+
+func (p *ConstantPool) NameAndType(name, descriptor string) uint16 {
+	return p.add(model.ConstantInfo{Tag: constant.ConstantNameAndType, Info: u2(p.Utf8(name), p.Utf8(descriptor))})
+}
+
+func (p *ConstantPool) FieldRef(owner, name, descriptor string) uint16 {
+	return p.memberRef(constant.ConstantFieldRef, owner, name, descriptor)
+}
+
+func (p *ConstantPool) MethodRef(owner, name, descriptor string) uint16 {
+	return p.memberRef(constant.ConstantMethodRef, owner, name, descriptor)
+}
+
+func (p *ConstantPool) InterfaceMethodRef(owner, name, descriptor string) uint16 {
+	return p.memberRef(constant.ConstantInterfaceMethodRef, owner, name, descriptor)
+}
+
+func (p *ConstantPool) memberRef(tag uint8, owner, name, descriptor string) uint16 {
+	return p.add(model.ConstantInfo{Tag: tag, Info: u2(p.Class(owner), p.NameAndType(name, descriptor))})
+}
+
+// MethodHandle adds a CONSTANT_MethodHandle; reference is the index of the
+// field or method reference it resolves.
+func (p *ConstantPool) MethodHandle(kind uint8, reference uint16) uint16 {
+	return p.add(model.ConstantInfo{Tag: constant.ConstantMethodHandle, Info: append([]byte{kind}, u2(reference)...)})
+}
+
+// Handle adds a CONSTANT_MethodHandle of the given reference kind to a
+// field or method, with an InterfaceMethodref when isInterface is set.
+func (p *ConstantPool) Handle(kind uint8, owner, name, descriptor string, isInterface bool) uint16 {
+	var reference uint16
+	switch {
+	case kind <= constant.RefPutStatic:
+		reference = p.FieldRef(owner, name, descriptor)
+	case isInterface || kind == constant.RefInvokeInterface:
+		reference = p.InterfaceMethodRef(owner, name, descriptor)
+	default:
+		reference = p.MethodRef(owner, name, descriptor)
+	}
+	return p.MethodHandle(kind, reference)
+}
+
+func (p *ConstantPool) MethodType(descriptor string) uint16 {
+	return p.add(model.ConstantInfo{Tag: constant.ConstantMethodType, Info: u2(p.Utf8(descriptor))})
+}
+
+func (p *ConstantPool) InvokeDynamic(bootstrapMethod uint16, name, descriptor string) uint16 {
+	return p.add(model.ConstantInfo{Tag: constant.ConstantInvokeDynamic, Info: u2(bootstrapMethod, p.NameAndType(name, descriptor))})
+}
+
+func (p *ConstantPool) Dynamic(bootstrapMethod uint16, name, descriptor string) uint16 {
+	return p.add(model.ConstantInfo{Tag: constant.ConstantDynamic, Info: u2(bootstrapMethod, p.NameAndType(name, descriptor))})
+}
+
+func (p *ConstantPool) Module(name string) uint16 {
+	return p.add(model.ConstantInfo{Tag: constant.ConstantModule, Info: u2(p.Utf8(name))})
+}
+
+// Package adds a CONSTANT_Package for a package name in internal form.
+func (p *ConstantPool) Package(name string) uint16 {
+	return p.add(model.ConstantInfo{Tag: constant.ConstantPackage, Info: u2(p.Utf8(name))})
+}
+
+// ClassConstant is a loadable class, by internal name or array descriptor.
+type ClassConstant string
+
+// MethodTypeConstant is a loadable method type, by method descriptor.
+type MethodTypeConstant string
+
+// Handle is a loadable method handle. Kind is one of the constant.Ref*
+// reference kinds.
+type Handle struct {
+	Kind        uint8
+	Owner       string
+	Name        string
+	Descriptor  string
+	IsInterface bool
+}
+
+// ConstantDynamic is a dynamically-computed constant; BootstrapMethod is
+// an index returned by ClassBuilder.BootstrapMethod.
+type ConstantDynamic struct {
+	Name            string
+	Descriptor      string
+	BootstrapMethod uint16
+}
+
+// Loadable adds the constant for an ldc operand or bootstrap argument: an
+// int32, float32, int64, float64, string, ClassConstant,
+// MethodTypeConstant, Handle or ConstantDynamic value.
+func (p *ConstantPool) Loadable(value interface{}) (uint16, error) {
+	switch v := value.(type) {
+	case ClassConstant:
+		return p.Class(string(v)), nil
+	case MethodTypeConstant:
+		return p.MethodType(string(v)), nil
+	case Handle:
+		if v.Kind < constant.RefGetField || v.Kind > constant.RefInvokeInterface {
+			return 0, fmt.Errorf("invalid method handle kind %d", v.Kind)
+		}
+		return p.Handle(v.Kind, v.Owner, v.Name, v.Descriptor, v.IsInterface), nil
+	case ConstantDynamic:
+		return p.Dynamic(v.BootstrapMethod, v.Name, v.Descriptor), nil
+	case int32:
+		return p.Integer(v), nil
+	case float32:
+		return p.Float(v), nil
+	case int64:
+		return p.Long(v), nil
+	case float64:
+		return p.Double(v), nil
+	case string:
+		return p.String(v), nil
+	}
+	return 0, fmt.Errorf("cannot load constant of type %T", value)
+}
@@ -0,0 +1,487 @@
+package builder
+
+import (
+	"fmt"
+	"outro/constant"
+	"outro/interpreter"
+	"outro/model"
+)
+
+// Label marks a position in a method's code. A label is created with
+// NewLabel, used as a branch target any number of times and placed once
+// with Mark.
+type Label struct {
+	index  int
+	placed bool
+	offset int
+}
+
+// instruction is an instruction whose branch offsets and padding are not
+// known until the code is laid out.
+type instruction struct {
+	opcode   interpreter.Instruct
+	operands []byte
+	// target is the branch target of a jump; switches use defaultTarget
+	// with keys and targets instead.
+	target        *Label
+	defaultTarget *Label
+	keys          []int32
+	targets       []*Label
+	pop, push     int
+	offset        int
+}
+
+type tryCatchBlock struct {
+	start, end, handler *Label
+	catchType           uint16
+}
+
+// MethodBuilder declares a method and, unless it is abstract or native,
+// its code. Instruction methods are named after the ASM MethodVisitor
+// methods they correspond to.
+type MethodBuilder struct {
+	class        *ClassBuilder
+	accessFlags  uint16
+	name         string
+	descriptor   string
+	instructions []*instruction
+	labels       []*Label
+	tryCatch     []tryCatchBlock
+	attributes   model.Attributes
+	maxLocals    int
+	// limits holds max_stack and max_locals given with Limits, which
+	// replace the computed values.
+	limits             *[2]int
+	lineNumbers        []lineNumber
+	localVariables     []localVariable
+	localVariableTypes []localVariable
+	// extraCodeAttributes are the attributes added with CodeAttribute.
+	extraCodeAttributes []codeAttribute
+	err                 error
+}
+
+type lineNumber struct {
+	start *Label
+	line  int
+}
+
+// localVariable is an entry of the LocalVariableTable or, with a signature
+// as descriptor, of the LocalVariableTypeTable.
+type localVariable struct {
+	index            int
+	name, descriptor string
+	start, end       *Label
+}
+
+type codeAttribute struct {
+	name  string
+	value func() interface{}
+}
+
+func (c *ClassBuilder) Method(accessFlags uint16, name, descriptor string) *MethodBuilder {
+	m := &MethodBuilder{class: c, accessFlags: accessFlags, name: name, descriptor: descriptor}
+	parameters, _, err := model.ParseMethodDescriptor(descriptor)
+	if err != nil {
+		m.fail("%v", err)
+	}
+	if accessFlags&uint16(constant.METHOD_ACC_STATIC) == 0 {
+		m.maxLocals = 1
+	}
+	for _, parameter := range parameters {
+		m.maxLocals += model.FieldTypeSlots(parameter)
+	}
+	c.methods = append(c.methods, m)
+	return m
+}
+
+func (m *MethodBuilder) fail(format string, args ...interface{}) {
+	if m.err == nil {
+		m.err = fmt.Errorf(format, args...)
+	}
+}
+
+// Attribute adds a method attribute; value is one of the model's decoded
+// attribute types.
+func (m *MethodBuilder) Attribute(name string, value interface{}) *MethodBuilder {
+	m.attributes = append(m.attributes, newAttribute(m.class.pool, name, value))
+	return m
+}
+
+// Throws declares the checked exceptions of the method.
+func (m *MethodBuilder) Throws(classNames ...string) *MethodBuilder {
+	indexes := make([]uint16, len(classNames))
+	for i, name := range classNames {
+		indexes[i] = m.class.pool.Class(name)
+	}
+	return m.Attribute("Exceptions", &model.ExceptionsAttributeInfo{
+		NumberOfExceptions:  uint16(len(indexes)),
+		ExceptionIndexTable: indexes,
+	})
+}
+
+// Limits sets max_stack and max_locals instead of computing them, e.g. to
+// reproduce an existing method exactly. A negative value keeps the
+// computed one.
+func (m *MethodBuilder) Limits(maxStack, maxLocals int) *MethodBuilder {
+	if maxStack > 0xFFFF || maxLocals > 0xFFFF {
+		m.fail("invalid limits %d %d", maxStack, maxLocals)
+	}
+	m.limits = &[2]int{maxStack, maxLocals}
+	return m
+}
+
+// Line records that the next instruction starts source line line, for
+// the LineNumberTable.
+func (m *MethodBuilder) Line(line int) *MethodBuilder {
+	label := m.NewLabel()
+	m.Mark(label)
+	return m.LineNumber(line, label)
+}
+
+// LineNumber records that source line line starts at label.
+func (m *MethodBuilder) LineNumber(line int, start *Label) *MethodBuilder {
+	m.lineNumbers = append(m.lineNumbers, lineNumber{start: start, line: line})
+	return m
+}
+
+// LocalVariable adds a LocalVariableTable entry for the variable in slot
+// index between start (inclusive) and end (exclusive).
+func (m *MethodBuilder) LocalVariable(index int, name, descriptor string, start, end *Label) *MethodBuilder {
+	m.localVariables = append(m.localVariables, localVariable{index: index, name: name, descriptor: descriptor, start: start, end: end})
+	return m
+}
+
+// LocalVariableType adds a LocalVariableTypeTable entry giving the generic
+// signature of the variable in slot index.
+func (m *MethodBuilder) LocalVariableType(index int, name, signature string, start, end *Label) *MethodBuilder {
+	m.localVariableTypes = append(m.localVariableTypes, localVariable{index: index, name: name, descriptor: signature, start: start, end: end})
+	return m
+}
+
+// CodeAttribute adds an attribute to the Code attribute. value is called
+// once the code is laid out, so it can use Label.Offset, and returns the
+// attribute as for Attribute.
+func (m *MethodBuilder) CodeAttribute(name string, value func() interface{}) *MethodBuilder {
+	m.extraCodeAttributes = append(m.extraCodeAttributes, codeAttribute{name: name, value: value})
+	return m
+}
+
+func (m *MethodBuilder) NewLabel() *Label {
+	label := &Label{}
+	m.labels = append(m.labels, label)
+	return label
+}
+
+// Offset returns the position of the label in the code, which is known
+// only once the code is laid out, as when a CodeAttribute is built.
+func (l *Label) Offset() int {
+	return l.offset
+}
+
+// Mark places label before the next instruction.
+func (m *MethodBuilder) Mark(label *Label) *MethodBuilder {
+	if label.placed {
+		m.fail("label marked twice")
+	}
+	label.index = len(m.instructions)
+	label.placed = true
+	return m
+}
+
+func (m *MethodBuilder) emit(in *instruction) *MethodBuilder {
+	m.instructions = append(m.instructions, in)
+	return m
+}
+
+// Insn emits an instruction without operands, such as IADD or RETURN.
+func (m *MethodBuilder) Insn(opcode interpreter.Instruct) *MethodBuilder {
+	effect, ok := stackEffects[opcode]
+	if !ok {
+		m.fail("%s takes operands", opcodeName(opcode))
+		return m
+	}
+	return m.emit(&instruction{opcode: opcode, pop: effect.pop, push: effect.push})
+}
+
+// IntInsn emits BIPUSH, SIPUSH or NEWARRAY with its operand.
+func (m *MethodBuilder) IntInsn(opcode interpreter.Instruct, operand int) *MethodBuilder {
+	switch opcode {
+	case interpreter.BIPUSH:
+		return m.emit(&instruction{opcode: opcode, operands: []byte{byte(int8(operand))}, push: 1})
+	case interpreter.SIPUSH:
+		return m.emit(&instruction{opcode: opcode, operands: u2(uint16(int16(operand))), push: 1})
+	case interpreter.NEWARRAY:
+		return m.emit(&instruction{opcode: opcode, operands: []byte{byte(operand)}, pop: 1, push: 1})
+	}
+	m.fail("%s is not an int instruction", opcodeName(opcode))
+	return m
+}
+
+// PushInt emits the shortest instruction that pushes v.
+func (m *MethodBuilder) PushInt(v int32) *MethodBuilder {
+	switch {
+	case v >= -1 && v <= 5:
+		return m.Insn(interpreter.ICONST_M1 + interpreter.Instruct(v+1))
+	case v >= -128 && v <= 127:
+		return m.IntInsn(interpreter.BIPUSH, int(v))
+	case v >= -32768 && v <= 32767:
+		return m.IntInsn(interpreter.SIPUSH, int(v))
+	}
+	return m.LdcInsn(v)
+}
+
+// LdcInsn loads a constant accepted by ConstantPool.Loadable with LDC,
+// LDC_W or LDC2_W as its type and index require.
+func (m *MethodBuilder) LdcInsn(value interface{}) *MethodBuilder {
+	index, err := m.class.pool.Loadable(value)
+	if err != nil {
+		m.fail("%v", err)
+		return m
+	}
+	switch v := value.(type) {
+	case int64, float64:
+		return m.emit(&instruction{opcode: interpreter.LDC2_W, operands: u2(index), push: 2})
+	case ConstantDynamic:
+		if model.FieldTypeSlots(v.Descriptor) == 2 {
+			return m.emit(&instruction{opcode: interpreter.LDC2_W, operands: u2(index), push: 2})
+		}
+	}
+	if index <= 0xFF {
+		return m.emit(&instruction{opcode: interpreter.LDC, operands: []byte{byte(index)}, push: 1})
+	}
+	return m.emit(&instruction{opcode: interpreter.LDC_W, operands: u2(index), push: 1})
+}
+
+// VarInsn emits a load, store or RET of a local variable, using the
+// one-byte forms such as ILOAD_1 for variables 0 to 3 and WIDE beyond 255.
+func (m *MethodBuilder) VarInsn(opcode interpreter.Instruct, index int) *MethodBuilder {
+	var slots, pop, push int
+	var short interpreter.Instruct
+	switch opcode {
+	case interpreter.ILOAD, interpreter.FLOAD, interpreter.ALOAD:
+		slots, push = 1, 1
+		short = interpreter.ILOAD_0 + (opcode-interpreter.ILOAD)*4
+	case interpreter.LLOAD, interpreter.DLOAD:
+		slots, push = 2, 2
+		short = interpreter.ILOAD_0 + (opcode-interpreter.ILOAD)*4
+	case interpreter.ISTORE, interpreter.FSTORE, interpreter.ASTORE:
+		slots, pop = 1, 1
+		short = interpreter.ISTORE_0 + (opcode-interpreter.ISTORE)*4
+	case interpreter.LSTORE, interpreter.DSTORE:
+		slots, pop = 2, 2
+		short = interpreter.ISTORE_0 + (opcode-interpreter.ISTORE)*4
+	case interpreter.RET:
+		slots = 1
+	default:
+		m.fail("%s is not a local variable instruction", opcodeName(opcode))
+		return m
+	}
+	if index < 0 || index+slots > 0xFFFF {
+		m.fail("local variable index %d out of range", index)
+		return m
+	}
+	if index+slots > m.maxLocals {
+		m.maxLocals = index + slots
+	}
+	in := &instruction{opcode: opcode, pop: pop, push: push}
+	switch {
+	case index <= 3 && opcode != interpreter.RET:
+		in.opcode = short + interpreter.Instruct(index)
+	case index <= 0xFF:
+		in.operands = []byte{byte(index)}
+	default:
+		in.opcode = interpreter.WIDE
+		in.operands = append([]byte{byte(opcode)}, u2(uint16(index))...)
+	}
+	return m.emit(in)
+}
+
+// IincInsn adds delta to int local variable index.
+func (m *MethodBuilder) IincInsn(index int, delta int) *MethodBuilder {
+	if index < 0 || index >= 0xFFFF || delta < -32768 || delta > 32767 {
+		m.fail("iinc %d %d out of range", index, delta)
+		return m
+	}
+	if index+1 > m.maxLocals {
+		m.maxLocals = index + 1
+	}
+	if index <= 0xFF && delta >= -128 && delta <= 127 {
+		return m.emit(&instruction{opcode: interpreter.IINC, operands: []byte{byte(index), byte(int8(delta))}})
+	}
+	operands := append([]byte{byte(interpreter.IINC)}, u2(uint16(index), uint16(int16(delta)))...)
+	return m.emit(&instruction{opcode: interpreter.WIDE, operands: operands})
+}
+
+// TypeInsn emits NEW, ANEWARRAY, CHECKCAST or INSTANCEOF of a class given
+// by internal name or array descriptor.
+func (m *MethodBuilder) TypeInsn(opcode interpreter.Instruct, className string) *MethodBuilder {
+	in := &instruction{opcode: opcode, operands: u2(m.class.pool.Class(className))}
+	switch opcode {
+	case interpreter.NEW:
+		in.push = 1
+	case interpreter.ANEWARRAY, interpreter.CHECKCAST, interpreter.INSTANCEOF:
+		in.pop, in.push = 1, 1
+	default:
+		m.fail("%s is not a type instruction", opcodeName(opcode))
+		return m
+	}
+	return m.emit(in)
+}
+
+// FieldInsn emits GETSTATIC, PUTSTATIC, GETFIELD or PUTFIELD.
+func (m *MethodBuilder) FieldInsn(opcode interpreter.Instruct, owner, name, descriptor string) *MethodBuilder {
+	if _, err := model.ParseFieldType(descriptor); err != nil {
+		m.fail("%v", err)
+		return m
+	}
+	size := model.FieldTypeSlots(descriptor)
+	in := &instruction{opcode: opcode, operands: u2(m.class.pool.FieldRef(owner, name, descriptor))}
+	switch opcode {
+	case interpreter.GETSTATIC:
+		in.push = size
+	case interpreter.PUTSTATIC:
+		in.pop = size
+	case interpreter.GETFIELD:
+		in.pop, in.push = 1, size
+	case interpreter.PUTFIELD:
+		in.pop = 1 + size
+	default:
+		m.fail("%s is not a field instruction", opcodeName(opcode))
+		return m
+	}
+	return m.emit(in)
+}
+
+// MethodInsn emits INVOKEVIRTUAL, INVOKESPECIAL, INVOKESTATIC or
+// INVOKEINTERFACE. isInterface selects an InterfaceMethodref, which
+// INVOKEINTERFACE always uses.
+func (m *MethodBuilder) MethodInsn(opcode interpreter.Instruct, owner, name, descriptor string, isInterface bool) *MethodBuilder {
+	argumentSlots, returnSlots, err := descriptorSlots(descriptor)
+	if err != nil {
+		m.fail("%v", err)
+		return m
+	}
+	in := &instruction{opcode: opcode, pop: argumentSlots + 1, push: returnSlots}
+	var index uint16
+	if isInterface || opcode == interpreter.INVOKEINTERFACE {
+		index = m.class.pool.InterfaceMethodRef(owner, name, descriptor)
+	} else {
+		index = m.class.pool.MethodRef(owner, name, descriptor)
+	}
+	in.operands = u2(index)
+	switch opcode {
+	case interpreter.INVOKEVIRTUAL, interpreter.INVOKESPECIAL:
+	case interpreter.INVOKESTATIC:
+		in.pop--
+	case interpreter.INVOKEINTERFACE:
+		in.operands = append(in.operands, byte(argumentSlots+1), 0)
+	default:
+		m.fail("%s is not a method instruction", opcodeName(opcode))
+		return m
+	}
+	return m.emit(in)
+}
+
+// InvokeDynamicInsn emits INVOKEDYNAMIC for the bootstrap method returned
+// by ClassBuilder.BootstrapMethod.
+func (m *MethodBuilder) InvokeDynamicInsn(bootstrapMethod uint16, name, descriptor string) *MethodBuilder {
+	argumentSlots, returnSlots, err := descriptorSlots(descriptor)
+	if err != nil {
+		m.fail("%v", err)
+		return m
+	}
+	index := m.class.pool.InvokeDynamic(bootstrapMethod, name, descriptor)
+	return m.emit(&instruction{
+		opcode:   interpreter.INVOKEDYNAMIC,
+		operands: append(u2(index), 0, 0),
+		pop:      argumentSlots,
+		push:     returnSlots,
+	})
+}
+
+// JumpInsn emits a conditional branch, GOTO, JSR or their wide forms.
+func (m *MethodBuilder) JumpInsn(opcode interpreter.Instruct, label *Label) *MethodBuilder {
+	in := &instruction{opcode: opcode, target: label}
+	switch {
+	case opcode >= interpreter.IFEQ && opcode <= interpreter.IFLE,
+		opcode == interpreter.IFNULL, opcode == interpreter.IFNONNULL:
+		in.pop = 1
+	case opcode >= interpreter.IF_ICMPEQ && opcode <= interpreter.IF_ACMPNE:
+		in.pop = 2
+	case opcode == interpreter.GOTO, opcode == interpreter.GOTO_W:
+	case opcode == interpreter.JSR, opcode == interpreter.JSR_W:
+		in.push = 1
+	default:
+		m.fail("%s is not a jump instruction", opcodeName(opcode))
+		return m
+	}
+	return m.emit(in)
+}
+
+// TableSwitchInsn emits a TABLESWITCH for the keys low to
+// low+len(targets)-1.
+func (m *MethodBuilder) TableSwitchInsn(low int32, defaultTarget *Label, targets ...*Label) *MethodBuilder {
+	keys := make([]int32, len(targets))
+	for i := range keys {
+		keys[i] = low + int32(i)
+	}
+	return m.emit(&instruction{opcode: interpreter.TABLESWITCH, defaultTarget: defaultTarget, keys: keys, targets: targets, pop: 1})
+}
+
+// LookupSwitchInsn emits a LOOKUPSWITCH; keys must be sorted ascending.
+func (m *MethodBuilder) LookupSwitchInsn(defaultTarget *Label, keys []int32, targets []*Label) *MethodBuilder {
+	if len(keys) != len(targets) {
+		m.fail("lookupswitch has %d keys but %d targets", len(keys), len(targets))
+		return m
+	}
+	for i := 1; i < len(keys); i++ {
+		if keys[i-1] >= keys[i] {
+			m.fail("lookupswitch keys are not sorted")
+			return m
+		}
+	}
+	return m.emit(&instruction{opcode: interpreter.LOOKUPSWITCH, defaultTarget: defaultTarget, keys: keys, targets: targets, pop: 1})
+}
+
+// MultiANewArrayInsn creates an array of the given array descriptor with
+// its first dimensions taken from the stack.
+func (m *MethodBuilder) MultiANewArrayInsn(descriptor string, dimensions int) *MethodBuilder {
+	if dimensions < 1 || dimensions > 255 {
+		m.fail("invalid number of dimensions %d", dimensions)
+		return m
+	}
+	operands := append(u2(m.class.pool.Class(descriptor)), byte(dimensions))
+	return m.emit(&instruction{opcode: interpreter.MULTIANEWARRAY, operands: operands, pop: dimensions, push: 1})
+}
+
+// TryCatchBlock adds an exception handler for start (inclusive) to end
+// (exclusive). catchType "" catches everything, as for finally.
+func (m *MethodBuilder) TryCatchBlock(start, end, handler *Label, catchType string) *MethodBuilder {
+	var index uint16
+	if catchType != "" {
+		index = m.class.pool.Class(catchType)
+	}
+	m.tryCatch = append(m.tryCatch, tryCatchBlock{start: start, end: end, handler: handler, catchType: index})
+	return m
+}
+
+func descriptorSlots(descriptor string) (argumentSlots int, returnSlots int, err error) {
+	parameters, returnType, err := model.ParseMethodDescriptor(descriptor)
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, parameter := range parameters {
+		argumentSlots += model.FieldTypeSlots(parameter)
+	}
+	if returnType != "V" {
+		returnSlots = model.FieldTypeSlots(returnType)
+	}
+	return argumentSlots, returnSlots, nil
+}
+
+func opcodeName(opcode interpreter.Instruct) string {
+	if name, ok := interpreter.InstructDisplayNameMap[opcode]; ok {
+		return name
+	}
+	return fmt.Sprintf("opcode %#x", uint8(opcode))
+}
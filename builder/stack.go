@@ -0,0 +1,46 @@
+package builder
+
+import (
+	. "outro/interpreter"
+)
+
+type stackEffect struct {
+	pop, push int
+}
+
+// stackEffects gives the operand stack slots popped and pushed by every
+// instruction that takes no operands; long and double values take two.
+var stackEffects = map[Instruct]stackEffect{
+	NOP: {0, 0}, ACONST_NULL: {0, 1},
+	ICONST_M1: {0, 1}, ICONST_0: {0, 1}, ICONST_1: {0, 1}, ICONST_2: {0, 1}, ICONST_3: {0, 1}, ICONST_4: {0, 1}, ICONST_5: {0, 1},
+	LCONST_0: {0, 2}, LCONST_1: {0, 2}, FCONST_0: {0, 1}, FCONST_1: {0, 1}, FCONST_2: {0, 1}, DCONST_0: {0, 2}, DCONST_1: {0, 2},
+	ILOAD_0: {0, 1}, ILOAD_1: {0, 1}, ILOAD_2: {0, 1}, ILOAD_3: {0, 1},
+	LLOAD_0: {0, 2}, LLOAD_1: {0, 2}, LLOAD_2: {0, 2}, LLOAD_3: {0, 2},
+	FLOAD_0: {0, 1}, FLOAD_1: {0, 1}, FLOAD_2: {0, 1}, FLOAD_3: {0, 1},
+	DLOAD_0: {0, 2}, DLOAD_1: {0, 2}, DLOAD_2: {0, 2}, DLOAD_3: {0, 2},
+	ALOAD_0: {0, 1}, ALOAD_1: {0, 1}, ALOAD_2: {0, 1}, ALOAD_3: {0, 1},
+	IALOAD: {2, 1}, LALOAD: {2, 2}, FALOAD: {2, 1}, DALOAD: {2, 2}, AALOAD: {2, 1}, BALOAD: {2, 1}, CALOAD: {2, 1}, SALOAD: {2, 1},
+	ISTORE_0: {1, 0}, ISTORE_1: {1, 0}, ISTORE_2: {1, 0}, ISTORE_3: {1, 0},
+	LSTORE_0: {2, 0}, LSTORE_1: {2, 0}, LSTORE_2: {2, 0}, LSTORE_3: {2, 0},
+	FSTORE_0: {1, 0}, FSTORE_1: {1, 0}, FSTORE_2: {1, 0}, FSTORE_3: {1, 0},
+	DSTORE_0: {2, 0}, DSTORE_1: {2, 0}, DSTORE_2: {2, 0}, DSTORE_3: {2, 0},
+	ASTORE_0: {1, 0}, ASTORE_1: {1, 0}, ASTORE_2: {1, 0}, ASTORE_3: {1, 0},
+	IASTORE: {3, 0}, LASTORE: {4, 0}, FASTORE: {3, 0}, DASTORE: {4, 0}, AASTORE: {3, 0}, BASTORE: {3, 0}, CASTORE: {3, 0}, SASTORE: {3, 0},
+	POP: {1, 0}, POP2: {2, 0}, DUP: {1, 2}, DUP_X1: {2, 3}, DUP_X2: {3, 4}, DUP2: {2, 4}, DUP2_X1: {3, 5}, DUP2_X2: {4, 6}, SWAP: {2, 2},
+	IADD: {2, 1}, LADD: {4, 2}, FADD: {2, 1}, DADD: {4, 2},
+	ISUB: {2, 1}, LSUB: {4, 2}, FSUB: {2, 1}, DSUB: {4, 2},
+	IMUL: {2, 1}, LMUL: {4, 2}, FMUL: {2, 1}, DMUL: {4, 2},
+	IDIV: {2, 1}, LDIV: {4, 2}, FDIV: {2, 1}, DDIV: {4, 2},
+	IREM: {2, 1}, LREM: {4, 2}, FREM: {2, 1}, DREM: {4, 2},
+	INEG: {1, 1}, LNEG: {2, 2}, FNEG: {1, 1}, DNEG: {2, 2},
+	ISHL: {2, 1}, LSHL: {3, 2}, ISHR: {2, 1}, LSHR: {3, 2}, IUSHR: {2, 1}, LUSHR: {3, 2},
+	IAND: {2, 1}, LAND: {4, 2}, IOR: {2, 1}, LOR: {4, 2}, IXOR: {2, 1}, LXOR: {4, 2},
+	I2L: {1, 2}, I2F: {1, 1}, I2D: {1, 2}, L2I: {2, 1}, L2F: {2, 1}, L2D: {2, 2},
+	F2I: {1, 1}, F2L: {1, 2}, F2D: {1, 2}, D2I: {2, 1}, D2L: {2, 2}, D2F: {2, 1},
+	I2B: {1, 1}, I2C: {1, 1}, I2S: {1, 1},
+	LCMP: {4, 1}, FCMPL: {2, 1}, FCMPG: {2, 1}, DCMPL: {4, 1}, DCMPG: {4, 1},
+	IRETURN: {1, 0}, LRETURN: {2, 0}, FRETURN: {1, 0}, DRETURN: {2, 0}, ARETURN: {1, 0}, RETURN: {0, 0},
+	ARRAYLENGTH: {1, 1}, ATHROW: {1, 0}, MONITORENTER: {1, 0}, MONITOREXIT: {1, 0},
+	// Reserved for debuggers and the JVM itself; never valid in a class file.
+	BREAKPOINT: {0, 0}, IMPDEP1: {0, 0}, IMPDEP2: {0, 0},
+}
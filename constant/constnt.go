@@ -1,5 +1,14 @@
 package constant
 
+// https://docs.oracle.com/javase/specs/jvms/se8/html/jvms-4.html#jvms-4.1
+const (
+	ClassFileMagic  uint32 = 0xCAFEBABE
+	MinMajorVersion uint16 = 45 // JDK 1.0.2
+	MaxMajorVersion uint16 = 69 // Java SE 25
+	// PreviewMinorVersion marks a class file that depends on preview features.
+	PreviewMinorVersion uint16 = 0xFFFF
+)
+
 const (
 	// https://docs.oracle.com/javase/specs/jvms/se8/html/jvms-4.html#jvms-4.4
 	ConstantClass              uint8 = 7
@@ -16,8 +25,23 @@ const (
 	ConstantMethodHandle       uint8 = 15
 	ConstantMethodType         uint8 = 16
 	ConstantInvokeDynamic      uint8 = 18
+	ConstantDynamic            uint8 = 17
+	ConstantModule             uint8 = 19
+	ConstantPackage            uint8 = 20
 )
 
+// ConstantMinMajorVersion is the first class file version in which each of the
+// newer constant pool tags may appear (JVMS Table 4.4-B). Older versions treat
+// them as unknown tags.
+var ConstantMinMajorVersion = map[uint8]uint16{
+	ConstantMethodHandle:  51,
+	ConstantMethodType:    51,
+	ConstantInvokeDynamic: 51,
+	ConstantModule:        53,
+	ConstantPackage:       53,
+	ConstantDynamic:       55,
+}
+
 type AccessFlag uint16
 
 // Field access and property flags
@@ -65,3 +89,97 @@ const (
 	METHOD_ACC_STRICT       AccessFlag = 0x0800 //In a class file whose major version number is at least 46 and at most 60: Declared strictfp.
 	METHOD_ACC_SYNTHETIC    AccessFlag = 0x1000 //Declared synthetic; not present in the source code.
 )
+
+// Verification type tags of a StackMapTable
+// https://docs.oracle.com/javase/specs/jvms/se8/html/jvms-4.html#jvms-4.7.4
+
+const (
+	ItemTop               uint8 = 0
+	ItemInteger           uint8 = 1
+	ItemFloat             uint8 = 2
+	ItemDouble            uint8 = 3
+	ItemLong              uint8 = 4
+	ItemNull              uint8 = 5
+	ItemUninitializedThis uint8 = 6
+	ItemObject            uint8 = 7
+	ItemUninitialized     uint8 = 8
+)
+
+// Stack map frame types; each kind spans the range up to the next constant.
+
+const (
+	SameFrame                         uint8 = 0   // 0-63
+	SameLocals1StackItemFrame         uint8 = 64  // 64-127
+	SameLocals1StackItemFrameExtended uint8 = 247 // 128-246 are reserved
+	ChopFrame                         uint8 = 248 // 248-250
+	SameFrameExtended                 uint8 = 251
+	AppendFrame                       uint8 = 252 // 252-254
+	FullFrame                         uint8 = 255
+)
+
+// Type annotation target types
+// https://docs.oracle.com/javase/specs/jvms/se8/html/jvms-4.html#jvms-4.7.20
+
+const (
+	TargetClassTypeParameter                uint8 = 0x00
+	TargetMethodTypeParameter               uint8 = 0x01
+	TargetClassExtends                      uint8 = 0x10
+	TargetClassTypeParameterBound           uint8 = 0x11
+	TargetMethodTypeParameterBound          uint8 = 0x12
+	TargetField                             uint8 = 0x13
+	TargetMethodReturn                      uint8 = 0x14
+	TargetMethodReceiver                    uint8 = 0x15
+	TargetMethodFormalParameter             uint8 = 0x16
+	TargetThrows                            uint8 = 0x17
+	TargetLocalVariable                     uint8 = 0x40
+	TargetResourceVariable                  uint8 = 0x41
+	TargetExceptionParameter                uint8 = 0x42
+	TargetInstanceof                        uint8 = 0x43
+	TargetNew                               uint8 = 0x44
+	TargetConstructorReference              uint8 = 0x45
+	TargetMethodReference                   uint8 = 0x46
+	TargetCast                              uint8 = 0x47
+	TargetConstructorInvocationTypeArgument uint8 = 0x48
+	TargetMethodInvocationTypeArgument      uint8 = 0x49
+	TargetConstructorReferenceTypeArgument  uint8 = 0x4A
+	TargetMethodReferenceTypeArgument       uint8 = 0x4B
+)
+
+// Type path kinds
+
+const (
+	TypePathArray         uint8 = 0 // deeper in an array type
+	TypePathNested        uint8 = 1 // deeper in a nested type
+	TypePathWildcardBound uint8 = 2 // on the bound of a wildcard type argument
+	TypePathTypeArgument  uint8 = 3 // on a type argument of a parameterized type
+)
+
+// Module, requires, exports and opens flags
+// https://docs.oracle.com/javase/specs/jvms/se9/html/jvms-4.html#jvms-4.7.25
+
+const (
+	MODULE_ACC_OPEN             AccessFlag = 0x0020 //Indicates that this module is open.
+	MODULE_ACC_SYNTHETIC        AccessFlag = 0x1000 //Indicates that this module was not explicitly or implicitly declared.
+	MODULE_ACC_MANDATED         AccessFlag = 0x8000 //Indicates that this module was implicitly declared.
+	REQUIRES_ACC_TRANSITIVE     AccessFlag = 0x0020 //Any module which depends on the current module implicitly reads the required module.
+	REQUIRES_ACC_STATIC_PHASE   AccessFlag = 0x0040 //The dependence is mandatory at compile time but optional at run time.
+	REQUIRES_ACC_SYNTHETIC      AccessFlag = 0x1000 //The dependence was not explicitly or implicitly declared.
+	REQUIRES_ACC_MANDATED       AccessFlag = 0x8000 //The dependence was implicitly declared.
+	EXPORTS_OPENS_ACC_SYNTHETIC AccessFlag = 0x1000 //The export or open was not explicitly or implicitly declared.
+	EXPORTS_OPENS_ACC_MANDATED  AccessFlag = 0x8000 //The export or open was implicitly declared.
+)
+
+// Method handle reference kinds
+// https://docs.oracle.com/javase/specs/jvms/se8/html/jvms-5.html#jvms-5.4.3.5
+
+const (
+	RefGetField         uint8 = 1
+	RefGetStatic        uint8 = 2
+	RefPutField         uint8 = 3
+	RefPutStatic        uint8 = 4
+	RefInvokeVirtual    uint8 = 5
+	RefInvokeStatic     uint8 = 6
+	RefInvokeSpecial    uint8 = 7
+	RefNewInvokeSpecial uint8 = 8
+	RefInvokeInterface  uint8 = 9
+)
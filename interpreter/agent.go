@@ -0,0 +1,110 @@
+package interpreter
+
+import (
+	"fmt"
+	"outro/rtda"
+)
+
+// Instrumentation is the java.lang.instrument.Instrumentation handed to
+// agents. Go agents call it directly; the interpreter cannot invoke methods
+// yet, so a Java premain receives it but cannot call it.
+type Instrumentation struct {
+	loader *rtda.ApplicationClassLoader
+}
+
+func NewInstrumentation(loader *rtda.ApplicationClassLoader) *Instrumentation {
+	return &Instrumentation{loader: loader}
+}
+
+// AddTransformer registers a transformer for the classes loaded from now on.
+func (i *Instrumentation) AddTransformer(transformer rtda.ClassFileTransformer) {
+	i.loader.AddTransformer(transformer)
+}
+
+func (i *Instrumentation) RemoveTransformer(transformer rtda.ClassFileTransformer) bool {
+	return i.loader.RemoveTransformer(transformer)
+}
+
+func (i *Instrumentation) AllLoadedClasses() []*rtda.Class {
+	return i.loader.LoadedClasses()
+}
+
+func (i *Instrumentation) IsRedefineClassesSupported() bool {
+	return true
+}
+
+func (i *Instrumentation) IsRetransformClassesSupported() bool {
+	return true
+}
+
+// IsModifiableClass reports whether class can be redefined: it must have
+// been defined from a class file by the loader of the JVM.
+func (i *Instrumentation) IsModifiableClass(class *rtda.Class) bool {
+	return class.Loader == i.loader
+}
+
+// RedefineClasses gives loaded classes new code; see
+// rtda.ApplicationClassLoader.RedefineClasses for what may change.
+func (i *Instrumentation) RedefineClasses(definitions ...rtda.ClassDefinition) error {
+	return i.loader.RedefineClasses(definitions...)
+}
+
+// RetransformClasses runs loaded classes through the transformers again.
+func (i *Instrumentation) RetransformClasses(classes ...*rtda.Class) error {
+	return i.loader.RetransformClasses(classes...)
+}
+
+// Instrumentation returns the instrumentation of the loader of the JVM.
+func (jvm *JVM) Instrumentation() *Instrumentation {
+	if jvm.instrumentation == nil {
+		jvm.instrumentation = NewInstrumentation(jvm.Loader)
+	}
+	return jvm.instrumentation
+}
+
+// AddTransformer registers a transformer for the classes loaded from now on.
+func (jvm *JVM) AddTransformer(transformer rtda.ClassFileTransformer) {
+	jvm.Instrumentation().AddTransformer(transformer)
+}
+
+// RunPremain runs the premain method of an agent class on the thread of
+// the JVM, passing options, or null if they are empty, and the
+// instrumentation. Like the JDK it looks for premain(String,
+// Instrumentation) and then premain(String). The interpreter cannot invoke
+// methods or create objects yet, so a premain using such instructions is
+// refused before it runs.
+func (jvm *JVM) RunPremain(agent *rtda.Class, options string) (err error) {
+	method, err := agent.GetStaticMethod("premain", "(Ljava/lang/String;Ljava/lang/instrument/Instrumentation;)V")
+	withInstrumentation := err == nil
+	if err != nil {
+		if method, err = agent.GetStaticMethod("premain", "(Ljava/lang/String;)V"); err != nil {
+			return fmt.Errorf("java.lang.NoSuchMethodException: %s.premain(java.lang.String, java.lang.instrument.Instrumentation)", agent.Name)
+		}
+	}
+	if err := checkRunnable(method); err != nil {
+		return fmt.Errorf("%s.premain %w", agent.Name, err)
+	}
+	depth := jvm.Thread.StackDepth()
+	defer func() {
+		if r := recover(); r != nil {
+			for jvm.Thread.StackDepth() > depth {
+				jvm.Thread.PopFrame()
+			}
+			err = fmt.Errorf("%s.premain: %v", agent.Name, r)
+		}
+		if flushErr := jvm.flushTrace(); err == nil {
+			err = flushErr
+		}
+	}()
+	jvm.Thread.NewFrame(method)
+	frame := jvm.Thread.CurrentFrame()
+	if options != "" {
+		frame.SetLocalVariableRef(0, rtda.NewJString(jvm.Loader, options))
+	}
+	if withInstrumentation {
+		frame.SetLocalVariableRef(1, jvm.Instrumentation())
+	}
+	jvm.startThread(jvm.Thread)
+	jvm.run(frame)
+	return nil
+}
@@ -0,0 +1,188 @@
+package interpreter
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Instruction is a decoded instruction with its operands.
+// https://docs.oracle.com/javase/specs/jvms/se8/html/jvms-6.html
+type Instruction struct {
+	// Offset is the position of the opcode in the code array and Length the
+	// number of bytes of the instruction, including any wide prefix and
+	// switch padding.
+	Offset int
+	Length int
+	Opcode Instruct
+	// Wide marks a load, store, iinc or ret prefixed by wide. Opcode is the
+	// modified instruction.
+	Wide bool
+	// Local is the local variable of loads, stores, iinc and ret, also
+	// for the implicit forms such as iload_1.
+	Local int
+	// Index is the constant pool index of ldc, field, method and type
+	// instructions.
+	Index int
+	// Const is the immediate value of bipush, sipush and iinc.
+	Const int32
+	// Target is the absolute branch target, or the default target of a
+	// switch.
+	Target int
+	// Count is the argument count of invokeinterface or the dimensions of
+	// multianewarray.
+	Count int
+	// ArrayType is the element type code of newarray, T_BOOLEAN (4) to
+	// T_LONG (11).
+	ArrayType uint8
+	// Keys and Targets are the cases of tableswitch and lookupswitch.
+	Keys    []int32
+	Targets []int
+}
+
+// Next returns the offset of the instruction that follows in.
+func (in *Instruction) Next() int {
+	return in.Offset + in.Length
+}
+
+// Decode splits code into instructions.
+func Decode(code []byte) ([]Instruction, error) {
+	var instructions []Instruction
+	for pc := 0; pc < len(code); {
+		in, err := DecodeAt(code, pc)
+		if err != nil {
+			return nil, err
+		}
+		instructions = append(instructions, in)
+		pc = in.Next()
+	}
+	return instructions, nil
+}
+
+// DecodeAt decodes the instruction at offset pc of code.
+func DecodeAt(code []byte, pc int) (Instruction, error) {
+	if pc < 0 || pc >= len(code) {
+		return Instruction{}, fmt.Errorf("offset %d outside of code of length %d", pc, len(code))
+	}
+	in := Instruction{Offset: pc, Opcode: Instruct(code[pc]), Length: 1}
+	if _, ok := InstructDisplayNameMap[in.Opcode]; !ok {
+		return in, fmt.Errorf("invalid opcode %#x at offset %d", code[pc], pc)
+	}
+	operands := code[pc+1:]
+	need := func(n int) bool { return len(code)-pc-1 >= n }
+	s2 := func(i int) int { return int(int16(binary.BigEndian.Uint16(operands[i:]))) }
+	u2 := func(i int) int { return int(binary.BigEndian.Uint16(operands[i:])) }
+	s4 := func(i int) int { return int(int32(binary.BigEndian.Uint32(operands[i:]))) }
+	truncated := false
+	size := func(n int) bool {
+		in.Length = n
+		truncated = !need(n - 1)
+		return !truncated
+	}
+	switch op := in.Opcode; {
+	case op == BIPUSH:
+		if size(2) {
+			in.Const = int32(int8(operands[0]))
+		}
+	case op == SIPUSH:
+		if size(3) {
+			in.Const = int32(s2(0))
+		}
+	case op == LDC:
+		if size(2) {
+			in.Index = int(operands[0])
+		}
+	case op == NEWARRAY:
+		if size(2) {
+			in.ArrayType = operands[0]
+		}
+	case op >= ILOAD && op <= ALOAD, op >= ISTORE && op <= ASTORE, op == RET:
+		if size(2) {
+			in.Local = int(operands[0])
+		}
+	case op >= ILOAD_0 && op <= ALOAD_3:
+		in.Local = int(op-ILOAD_0) % 4
+	case op >= ISTORE_0 && op <= ASTORE_3:
+		in.Local = int(op-ISTORE_0) % 4
+	case op == IINC:
+		if size(3) {
+			in.Local, in.Const = int(operands[0]), int32(int8(operands[1]))
+		}
+	case op >= IFEQ && op <= JSR, op == IFNULL, op == IFNONNULL:
+		if size(3) {
+			in.Target = pc + s2(0)
+		}
+	case op == GOTO_W || op == JSR_W:
+		if size(5) {
+			in.Target = pc + s4(0)
+		}
+	case op == LDC_W || op == LDC2_W, op >= GETSTATIC && op <= INVOKESTATIC,
+		op == NEW, op == ANEWARRAY, op == CHECKCAST, op == INSTANCEOF:
+		if size(3) {
+			in.Index = u2(0)
+		}
+	case op == INVOKEINTERFACE || op == INVOKEDYNAMIC:
+		if size(5) {
+			in.Index, in.Count = u2(0), int(operands[2])
+		}
+	case op == MULTIANEWARRAY:
+		if size(4) {
+			in.Index, in.Count = u2(0), int(operands[2])
+		}
+	case op == WIDE:
+		if !size(4) {
+			break
+		}
+		in.Wide = true
+		in.Opcode = Instruct(operands[0])
+		in.Local = u2(1)
+		switch {
+		case in.Opcode == IINC:
+			if size(6) {
+				in.Const = int32(s2(3))
+			}
+		case in.Opcode >= ILOAD && in.Opcode <= ALOAD, in.Opcode >= ISTORE && in.Opcode <= ASTORE, in.Opcode == RET:
+		default:
+			return in, fmt.Errorf("invalid wide opcode %#x at offset %d", operands[0], pc)
+		}
+	case op == TABLESWITCH || op == LOOKUPSWITCH:
+		padding := (4 - (pc+1)%4) % 4
+		if !size(1 + padding + 8) {
+			break
+		}
+		operands = operands[padding:]
+		in.Target = pc + s4(0)
+		if op == TABLESWITCH {
+			if !size(1 + padding + 12) {
+				break
+			}
+			low, high := int64(s4(4)), int64(s4(8))
+			if high < low || high-low >= int64(len(code)) {
+				return in, fmt.Errorf("invalid tableswitch bounds at offset %d", pc)
+			}
+			count := int(high - low + 1)
+			if !size(1 + padding + 12 + 4*count) {
+				break
+			}
+			for i := 0; i < count; i++ {
+				in.Keys = append(in.Keys, int32(low+int64(i)))
+				in.Targets = append(in.Targets, pc+s4(12+4*i))
+			}
+		} else {
+			count := s4(4)
+			if count < 0 || count > len(code) {
+				return in, fmt.Errorf("invalid lookupswitch count at offset %d", pc)
+			}
+			if !size(1 + padding + 8 + 8*count) {
+				break
+			}
+			for i := 0; i < count; i++ {
+				in.Keys = append(in.Keys, int32(s4(8+8*i)))
+				in.Targets = append(in.Targets, pc+s4(12+8*i))
+			}
+		}
+	}
+	if truncated {
+		return in, fmt.Errorf("truncated %s at offset %d", InstructDisplayNameMap[Instruct(code[pc])], pc)
+	}
+	return in, nil
+}
@@ -0,0 +1,296 @@
+package interpreter
+
+import (
+	"fmt"
+	"outro/rtda"
+)
+
+// Capabilities are the optional features a tool must add, with
+// JVM.AddCapabilities, before it uses them, like jvmtiCapabilities.
+type Capabilities struct {
+	CanGenerateMethodEntryEvents       bool
+	CanGenerateMethodExitEvents        bool
+	CanGenerateExceptionEvents         bool
+	CanGenerateFieldAccessEvents       bool
+	CanGenerateFieldModificationEvents bool
+	CanGenerateMonitorEvents           bool
+	CanAccessLocalVariables            bool
+}
+
+// Event is a kind of event a tool can be notified of.
+type Event int
+
+const (
+	ClassLoad Event = iota
+	ClassPrepare
+	MethodEntry
+	MethodExit
+	Exception
+	// ExceptionCatch, FieldAccess, FieldModification and
+	// MonitorContendedEnter can be enabled but are not posted yet: the
+	// interpreter has no exception handlers, field instructions or monitors.
+	ExceptionCatch
+	FieldAccess
+	FieldModification
+	ThreadStart
+	ThreadEnd
+	MonitorContendedEnter
+	eventCount
+)
+
+var eventNames = [eventCount]string{
+	"ClassLoad", "ClassPrepare", "MethodEntry", "MethodExit", "Exception", "ExceptionCatch",
+	"FieldAccess", "FieldModification", "ThreadStart", "ThreadEnd", "MonitorContendedEnter",
+}
+
+func (e Event) String() string {
+	if e < 0 || e >= eventCount {
+		return fmt.Sprintf("Event(%d)", int(e))
+	}
+	return eventNames[e]
+}
+
+// eventCapabilities name the capability each event needs; the others need
+// none.
+var eventCapabilities = map[Event]struct {
+	name string
+	has  func(*Capabilities) bool
+}{
+	MethodEntry:           {"CanGenerateMethodEntryEvents", func(c *Capabilities) bool { return c.CanGenerateMethodEntryEvents }},
+	MethodExit:            {"CanGenerateMethodExitEvents", func(c *Capabilities) bool { return c.CanGenerateMethodExitEvents }},
+	Exception:             {"CanGenerateExceptionEvents", func(c *Capabilities) bool { return c.CanGenerateExceptionEvents }},
+	ExceptionCatch:        {"CanGenerateExceptionEvents", func(c *Capabilities) bool { return c.CanGenerateExceptionEvents }},
+	FieldAccess:           {"CanGenerateFieldAccessEvents", func(c *Capabilities) bool { return c.CanGenerateFieldAccessEvents }},
+	FieldModification:     {"CanGenerateFieldModificationEvents", func(c *Capabilities) bool { return c.CanGenerateFieldModificationEvents }},
+	MonitorContendedEnter: {"CanGenerateMonitorEvents", func(c *Capabilities) bool { return c.CanGenerateMonitorEvents }},
+}
+
+// EventCallbacks are the functions events are posted to, like
+// jvmtiEventCallbacks. A location is a code offset in method. Exceptions
+// are the errors instructions raise; the interpreter has no exception
+// handlers, field instructions or monitors yet, so they are all uncaught
+// and ExceptionCatch, FieldAccess, FieldModification and
+// MonitorContendedEnter are not posted.
+type EventCallbacks struct {
+	ClassLoad    func(thread *rtda.Thread, class *rtda.Class)
+	ClassPrepare func(thread *rtda.Thread, class *rtda.Class)
+	MethodEntry  func(thread *rtda.Thread, method *rtda.Method)
+	// MethodExit gets the returned value, or nil for void methods and
+	// methods popped by an exception.
+	MethodExit func(thread *rtda.Thread, method *rtda.Method, poppedByException bool, returnValue interface{})
+	// Exception gets the method and location of the handler, or nil and -1
+	// if the exception is uncaught.
+	Exception             func(thread *rtda.Thread, method *rtda.Method, location int, exception error, catchMethod *rtda.Method, catchLocation int)
+	ExceptionCatch        func(thread *rtda.Thread, method *rtda.Method, location int, exception error)
+	FieldAccess           func(thread *rtda.Thread, method *rtda.Method, location int, field *rtda.Field, object interface{})
+	FieldModification     func(thread *rtda.Thread, method *rtda.Method, location int, field *rtda.Field, object interface{}, newValue interface{})
+	ThreadStart           func(thread *rtda.Thread)
+	ThreadEnd             func(thread *rtda.Thread)
+	MonitorContendedEnter func(thread *rtda.Thread, object interface{})
+}
+
+// tooling is the state of the tools attached to a JVM.
+type tooling struct {
+	capabilities        Capabilities
+	callbacks           EventCallbacks
+	enabled             [eventCount]bool
+	accessWatches       map[*rtda.Field]bool
+	modificationWatches map[*rtda.Field]bool
+	started             map[*rtda.Thread]bool
+}
+
+// AddCapabilities adds capabilities to those the tool has; every
+// capability is available.
+func (jvm *JVM) AddCapabilities(capabilities Capabilities) {
+	c := &jvm.tools.capabilities
+	c.CanGenerateMethodEntryEvents = c.CanGenerateMethodEntryEvents || capabilities.CanGenerateMethodEntryEvents
+	c.CanGenerateMethodExitEvents = c.CanGenerateMethodExitEvents || capabilities.CanGenerateMethodExitEvents
+	c.CanGenerateExceptionEvents = c.CanGenerateExceptionEvents || capabilities.CanGenerateExceptionEvents
+	c.CanGenerateFieldAccessEvents = c.CanGenerateFieldAccessEvents || capabilities.CanGenerateFieldAccessEvents
+	c.CanGenerateFieldModificationEvents = c.CanGenerateFieldModificationEvents || capabilities.CanGenerateFieldModificationEvents
+	c.CanGenerateMonitorEvents = c.CanGenerateMonitorEvents || capabilities.CanGenerateMonitorEvents
+	c.CanAccessLocalVariables = c.CanAccessLocalVariables || capabilities.CanAccessLocalVariables
+}
+
+func (jvm *JVM) Capabilities() Capabilities {
+	return jvm.tools.capabilities
+}
+
+// SetEventCallbacks replaces the callbacks events are posted to. Events are
+// posted only once enabled with SetEventNotificationMode.
+func (jvm *JVM) SetEventCallbacks(callbacks EventCallbacks) {
+	jvm.tools.callbacks = callbacks
+	jvm.listen()
+}
+
+// SetEventNotificationMode enables or disables events, failing without
+// changing any if an event needs a capability the tool has not added.
+func (jvm *JVM) SetEventNotificationMode(enable bool, events ...Event) error {
+	for _, event := range events {
+		if event < 0 || event >= eventCount {
+			return fmt.Errorf("invalid event %s", event)
+		}
+		if required, ok := eventCapabilities[event]; ok && enable && !required.has(&jvm.tools.capabilities) {
+			return fmt.Errorf("%s events need the %s capability", event, required.name)
+		}
+	}
+	for _, event := range events {
+		jvm.tools.enabled[event] = enable
+	}
+	jvm.listen()
+	return nil
+}
+
+// listen makes the loader report classes to the JVM while class events
+// are enabled.
+func (jvm *JVM) listen() {
+	if jvm.Loader == nil {
+		return
+	}
+	if jvm.tools.enabled[ClassLoad] || jvm.tools.enabled[ClassPrepare] {
+		jvm.Loader.SetClassListener(classEvents{jvm})
+	} else {
+		jvm.Loader.SetClassListener(nil)
+	}
+}
+
+type classEvents struct {
+	jvm *JVM
+}
+
+func (c classEvents) ClassLoad(class *rtda.Class) {
+	if callback := c.jvm.tools.callbacks.ClassLoad; callback != nil && c.jvm.tools.enabled[ClassLoad] {
+		callback(c.jvm.Thread, class)
+	}
+}
+
+func (c classEvents) ClassPrepare(class *rtda.Class) {
+	if callback := c.jvm.tools.callbacks.ClassPrepare; callback != nil && c.jvm.tools.enabled[ClassPrepare] {
+		callback(c.jvm.Thread, class)
+	}
+}
+
+// SetFieldAccessWatch asks for FieldAccess events on field, which are not
+// posted until the interpreter has field instructions.
+func (jvm *JVM) SetFieldAccessWatch(field *rtda.Field) error {
+	if !jvm.tools.capabilities.CanGenerateFieldAccessEvents {
+		return fmt.Errorf("field access watches need the CanGenerateFieldAccessEvents capability")
+	}
+	if jvm.tools.accessWatches == nil {
+		jvm.tools.accessWatches = make(map[*rtda.Field]bool)
+	}
+	jvm.tools.accessWatches[field] = true
+	return nil
+}
+
+func (jvm *JVM) ClearFieldAccessWatch(field *rtda.Field) {
+	delete(jvm.tools.accessWatches, field)
+}
+
+// SetFieldModificationWatch asks for FieldModification events on field,
+// which are not posted until the interpreter has field instructions.
+func (jvm *JVM) SetFieldModificationWatch(field *rtda.Field) error {
+	if !jvm.tools.capabilities.CanGenerateFieldModificationEvents {
+		return fmt.Errorf("field modification watches need the CanGenerateFieldModificationEvents capability")
+	}
+	if jvm.tools.modificationWatches == nil {
+		jvm.tools.modificationWatches = make(map[*rtda.Field]bool)
+	}
+	jvm.tools.modificationWatches[field] = true
+	return nil
+}
+
+func (jvm *JVM) ClearFieldModificationWatch(field *rtda.Field) {
+	delete(jvm.tools.modificationWatches, field)
+}
+
+// StackFrame is a method and the location it is executing.
+type StackFrame struct {
+	Method   *rtda.Method
+	Location int
+}
+
+// GetStackTrace returns the frames of thread, the current one first.
+func (jvm *JVM) GetStackTrace(thread *rtda.Thread) []StackFrame {
+	trace := make([]StackFrame, thread.StackDepth())
+	for depth := range trace {
+		frame := thread.Frame(depth)
+		trace[depth] = StackFrame{Method: frame.Method, Location: frame.PC}
+	}
+	return trace
+}
+
+// GetLocalVariables returns the local variables of the frame at depth in
+// thread, 0 being the current frame.
+func (jvm *JVM) GetLocalVariables(thread *rtda.Thread, depth int) ([]interface{}, error) {
+	frame, err := jvm.inspect(thread, depth)
+	if err != nil {
+		return nil, err
+	}
+	return frame.LocalVariables(), nil
+}
+
+// GetOperandStack returns the operand stack, bottom first, of the frame at
+// depth in thread.
+func (jvm *JVM) GetOperandStack(thread *rtda.Thread, depth int) ([]interface{}, error) {
+	frame, err := jvm.inspect(thread, depth)
+	if err != nil {
+		return nil, err
+	}
+	return frame.OperandStack(), nil
+}
+
+func (jvm *JVM) inspect(thread *rtda.Thread, depth int) (*rtda.Frame, error) {
+	if !jvm.tools.capabilities.CanAccessLocalVariables {
+		return nil, fmt.Errorf("inspecting frames needs the CanAccessLocalVariables capability")
+	}
+	frame := thread.Frame(depth)
+	if frame == nil {
+		return nil, fmt.Errorf("no frame at depth %d", depth)
+	}
+	return frame, nil
+}
+
+// startThread posts ThreadStart the first time code runs on thread, and
+// again once it has ended.
+func (jvm *JVM) startThread(thread *rtda.Thread) {
+	if jvm.tools.started[thread] {
+		return
+	}
+	if jvm.tools.started == nil {
+		jvm.tools.started = make(map[*rtda.Thread]bool)
+	}
+	jvm.tools.started[thread] = true
+	if callback := jvm.tools.callbacks.ThreadStart; callback != nil && jvm.tools.enabled[ThreadStart] {
+		callback(thread)
+	}
+}
+
+// endThread posts ThreadEnd once for each start of thread.
+func (jvm *JVM) endThread(thread *rtda.Thread) {
+	if !jvm.tools.started[thread] {
+		return
+	}
+	delete(jvm.tools.started, thread)
+	if callback := jvm.tools.callbacks.ThreadEnd; callback != nil && jvm.tools.enabled[ThreadEnd] {
+		callback(thread)
+	}
+}
+
+func (jvm *JVM) methodEntry(frame *rtda.Frame) {
+	if callback := jvm.tools.callbacks.MethodEntry; callback != nil && jvm.tools.enabled[MethodEntry] {
+		callback(frame.Thread, frame.Method)
+	}
+}
+
+func (jvm *JVM) methodExit(frame *rtda.Frame, poppedByException bool, returnValue interface{}) {
+	if callback := jvm.tools.callbacks.MethodExit; callback != nil && jvm.tools.enabled[MethodExit] {
+		callback(frame.Thread, frame.Method, poppedByException, returnValue)
+	}
+}
+
+func (jvm *JVM) exception(frame *rtda.Frame, location int, exception error) {
+	if callback := jvm.tools.callbacks.Exception; callback != nil && jvm.tools.enabled[Exception] {
+		callback(frame.Thread, frame.Method, location, exception, nil, -1)
+	}
+}
@@ -2,6 +2,7 @@ package interpreter
 
 import (
 	"errors"
+	"fmt"
 	"math"
 	"outro/rtda"
 )
@@ -425,83 +426,84 @@ var InstructDisplayNameMap = map[Instruct]string{
 	0xff: "impdep2",
 }
 
-var InstructFuncMap = map[Instruct]func(frame *rtda.Frame) (pc int, err error){
-	NOP: func(frame *rtda.Frame) (int, error) {
-		return 1 + frame.Thread.PC, nil
+// InstructFuncMap holds the handler of each opcode. A handler executes in
+// for frame and returns the offset of the next instruction.
+var InstructFuncMap = map[Instruct]func(frame *rtda.Frame, in *Instruction) (pc int, err error){
+	NOP: func(frame *rtda.Frame, in *Instruction) (int, error) {
+		return in.Next(), nil
 	},
-	ACONST_NULL: func(frame *rtda.Frame) (int, error) {
+	ACONST_NULL: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		frame.Push(nil)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	ICONST_M1: func(frame *rtda.Frame) (int, error) {
+	ICONST_M1: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		frame.PushInt(-1)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	ICONST_0: func(frame *rtda.Frame) (int, error) {
+	ICONST_0: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		frame.PushInt(0)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	ICONST_1: func(frame *rtda.Frame) (int, error) {
+	ICONST_1: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		frame.PushInt(1)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	ICONST_2: func(frame *rtda.Frame) (int, error) {
+	ICONST_2: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		frame.PushInt(2)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	ICONST_3: func(frame *rtda.Frame) (int, error) {
+	ICONST_3: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		frame.PushInt(3)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	ICONST_4: func(frame *rtda.Frame) (int, error) {
+	ICONST_4: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		frame.PushInt(4)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	ICONST_5: func(frame *rtda.Frame) (int, error) {
+	ICONST_5: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		frame.PushInt(5)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	LCONST_0: func(frame *rtda.Frame) (int, error) {
+	LCONST_0: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		frame.PushLong(0)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	LCONST_1: func(frame *rtda.Frame) (int, error) {
+	LCONST_1: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		frame.PushLong(1)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	FCONST_0: func(frame *rtda.Frame) (int, error) {
+	FCONST_0: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		frame.PushFloat(0)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	FCONST_1: func(frame *rtda.Frame) (int, error) {
+	FCONST_1: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		frame.PushFloat(1)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	FCONST_2: func(frame *rtda.Frame) (int, error) {
+	FCONST_2: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		frame.PushFloat(2)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	DCONST_0: func(frame *rtda.Frame) (int, error) {
+	DCONST_0: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		frame.PushDouble(0)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	DCONST_1: func(frame *rtda.Frame) (int, error) {
+	DCONST_1: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		frame.PushDouble(1)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	BIPUSH: func(frame *rtda.Frame) (int, error) {
-		i := int32(frame.NextByte())
+	BIPUSH: func(frame *rtda.Frame, in *Instruction) (int, error) {
+		i := in.Const
 		frame.PushInt(i)
-		return 2 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	SIPUSH: func(frame *rtda.Frame) (int, error) {
-		i := int32(frame.NextShort())
+	SIPUSH: func(frame *rtda.Frame, in *Instruction) (int, error) {
+		i := in.Const
 		frame.PushInt(i)
-		return 3 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	LDC: func(frame *rtda.Frame) (int, error) {
-		index := uint(frame.NextByte())
-		c := frame.Method.Class.GetConstant(uint16(index))
+	LDC: func(frame *rtda.Frame, in *Instruction) (int, error) {
+		c := frame.Method.GetConstant(uint16(in.Index))
 		switch c.(type) {
 		case int32:
 			frame.PushInt(c.(int32))
@@ -512,11 +514,10 @@ var InstructFuncMap = map[Instruct]func(frame *rtda.Frame) (pc int, err error){
 		default:
 			panic("todo: ldc!")
 		}
-		return 2 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	LDC_W: func(frame *rtda.Frame) (int, error) {
-		index := frame.NextShort()
-		c := frame.Method.Class.GetConstant(uint16(index))
+	LDC_W: func(frame *rtda.Frame, in *Instruction) (int, error) {
+		c := frame.Method.GetConstant(uint16(in.Index))
 		switch c.(type) {
 		case int32:
 			frame.PushInt(c.(int32))
@@ -527,11 +528,10 @@ var InstructFuncMap = map[Instruct]func(frame *rtda.Frame) (pc int, err error){
 		default:
 			panic("todo: ldc_w!")
 		}
-		return 3 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	LDC2_W: func(frame *rtda.Frame) (int, error) {
-		index := frame.NextShort()
-		c := frame.Method.Class.GetConstant(uint16(index))
+	LDC2_W: func(frame *rtda.Frame, in *Instruction) (int, error) {
+		c := frame.Method.GetConstant(uint16(in.Index))
 		switch c.(type) {
 		case int64:
 			frame.PushLong(c.(int64))
@@ -540,139 +540,139 @@ var InstructFuncMap = map[Instruct]func(frame *rtda.Frame) (pc int, err error){
 		default:
 			panic("todo: ldc2_w!")
 		}
-		return 3 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	ILOAD: func(frame *rtda.Frame) (int, error) {
-		index := uint16(frame.NextByte())
+	ILOAD: func(frame *rtda.Frame, in *Instruction) (int, error) {
+		index := uint16(in.Local)
 		val := frame.LocalVariableInt(index)
 		frame.PushInt(val)
-		return 2 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	LLOAD: func(frame *rtda.Frame) (int, error) {
-		index := uint16(frame.NextByte())
+	LLOAD: func(frame *rtda.Frame, in *Instruction) (int, error) {
+		index := uint16(in.Local)
 		val := frame.LocalVariableLong(index)
 		frame.PushLong(val)
-		return 2 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	FLOAD: func(frame *rtda.Frame) (int, error) {
-		index := uint16(frame.NextByte())
+	FLOAD: func(frame *rtda.Frame, in *Instruction) (int, error) {
+		index := uint16(in.Local)
 		val := frame.LocalVariableFloat(index)
 		frame.PushFloat(val)
-		return 2 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	DLOAD: func(frame *rtda.Frame) (int, error) {
-		index := uint16(frame.NextByte())
+	DLOAD: func(frame *rtda.Frame, in *Instruction) (int, error) {
+		index := uint16(in.Local)
 		val := frame.LocalVariableDouble(index)
 		frame.PushDouble(val)
-		return 2 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	ALOAD: func(frame *rtda.Frame) (int, error) {
-		index := uint16(frame.NextByte())
+	ALOAD: func(frame *rtda.Frame, in *Instruction) (int, error) {
+		index := uint16(in.Local)
 		val := frame.LocalVariableRef(index)
 		frame.Push(val)
-		return 2 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	ILOAD_0: func(frame *rtda.Frame) (int, error) {
+	ILOAD_0: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		val := frame.LocalVariableInt(0)
 		frame.PushInt(val)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	ILOAD_1: func(frame *rtda.Frame) (int, error) {
+	ILOAD_1: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		val := frame.LocalVariableInt(1)
 		frame.PushInt(val)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	ILOAD_2: func(frame *rtda.Frame) (int, error) {
+	ILOAD_2: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		val := frame.LocalVariableInt(2)
 		frame.PushInt(val)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	ILOAD_3: func(frame *rtda.Frame) (int, error) {
+	ILOAD_3: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		val := frame.LocalVariableInt(3)
 		frame.PushInt(val)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	LLOAD_0: func(frame *rtda.Frame) (int, error) {
+	LLOAD_0: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		val := frame.LocalVariableLong(0)
 		frame.PushLong(val)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	LLOAD_1: func(frame *rtda.Frame) (int, error) {
+	LLOAD_1: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		val := frame.LocalVariableLong(1)
 		frame.PushLong(val)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	LLOAD_2: func(frame *rtda.Frame) (int, error) {
+	LLOAD_2: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		val := frame.LocalVariableLong(2)
 		frame.PushLong(val)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	LLOAD_3: func(frame *rtda.Frame) (int, error) {
+	LLOAD_3: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		val := frame.LocalVariableLong(3)
 		frame.PushLong(val)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	FLOAD_0: func(frame *rtda.Frame) (int, error) {
+	FLOAD_0: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		val := frame.LocalVariableFloat(0)
 		frame.PushFloat(val)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	FLOAD_1: func(frame *rtda.Frame) (int, error) {
+	FLOAD_1: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		val := frame.LocalVariableFloat(1)
 		frame.PushFloat(val)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	FLOAD_2: func(frame *rtda.Frame) (int, error) {
+	FLOAD_2: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		val := frame.LocalVariableFloat(2)
 		frame.PushFloat(val)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	FLOAD_3: func(frame *rtda.Frame) (int, error) {
+	FLOAD_3: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		val := frame.LocalVariableFloat(3)
 		frame.PushFloat(val)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	DLOAD_0: func(frame *rtda.Frame) (int, error) {
+	DLOAD_0: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		val := frame.LocalVariableDouble(0)
 		frame.PushDouble(val)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	DLOAD_1: func(frame *rtda.Frame) (int, error) {
+	DLOAD_1: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		val := frame.LocalVariableDouble(1)
 		frame.PushDouble(val)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	DLOAD_2: func(frame *rtda.Frame) (int, error) {
+	DLOAD_2: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		val := frame.LocalVariableDouble(2)
 		frame.PushDouble(val)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	DLOAD_3: func(frame *rtda.Frame) (int, error) {
+	DLOAD_3: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		val := frame.LocalVariableDouble(3)
 		frame.PushDouble(val)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	ALOAD_0: func(frame *rtda.Frame) (int, error) {
+	ALOAD_0: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		val := frame.LocalVariableRef(0)
 		frame.Push(val)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	ALOAD_1: func(frame *rtda.Frame) (int, error) {
+	ALOAD_1: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		val := frame.LocalVariableRef(1)
 		frame.Push(val)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	ALOAD_2: func(frame *rtda.Frame) (int, error) {
+	ALOAD_2: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		val := frame.LocalVariableRef(2)
 		frame.Push(val)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	ALOAD_3: func(frame *rtda.Frame) (int, error) {
+	ALOAD_3: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		val := frame.LocalVariableRef(3)
 		frame.Push(val)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	IALOAD: func(frame *rtda.Frame) (int, error) {
+	IALOAD: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		index := frame.PopInt()
 		arr := frame.PopIntArr()
 		if arr == nil {
@@ -680,9 +680,9 @@ var InstructFuncMap = map[Instruct]func(frame *rtda.Frame) (pc int, err error){
 		}
 		checkIndex(len(arr), index)
 		frame.PushInt(arr[index])
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	LALOAD: func(frame *rtda.Frame) (int, error) {
+	LALOAD: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		index := frame.PopInt()
 		arr := frame.PopLongArr()
 		if arr == nil {
@@ -690,9 +690,9 @@ var InstructFuncMap = map[Instruct]func(frame *rtda.Frame) (pc int, err error){
 		}
 		checkIndex(len(arr), index)
 		frame.PushLong(arr[index])
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	FALOAD: func(frame *rtda.Frame) (int, error) {
+	FALOAD: func(frame *rtda.Frame, in *Instruction) (int, error) {
 
 		index := frame.PopInt()
 		arr := frame.PopFloatArr()
@@ -701,9 +701,9 @@ var InstructFuncMap = map[Instruct]func(frame *rtda.Frame) (pc int, err error){
 		}
 		checkIndex(len(arr), index)
 		frame.PushFloat(arr[index])
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	DALOAD: func(frame *rtda.Frame) (int, error) {
+	DALOAD: func(frame *rtda.Frame, in *Instruction) (int, error) {
 
 		index := frame.PopInt()
 		arr := frame.PopDoubleArr()
@@ -712,9 +712,9 @@ var InstructFuncMap = map[Instruct]func(frame *rtda.Frame) (pc int, err error){
 		}
 		checkIndex(len(arr), index)
 		frame.PushDouble(arr[index])
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	AALOAD: func(frame *rtda.Frame) (int, error) {
+	AALOAD: func(frame *rtda.Frame, in *Instruction) (int, error) {
 
 		index := frame.PopInt()
 		arr := frame.PopRefArr()
@@ -723,9 +723,9 @@ var InstructFuncMap = map[Instruct]func(frame *rtda.Frame) (pc int, err error){
 		}
 		checkIndex(len(arr), index)
 		frame.Push(arr[index])
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	BALOAD: func(frame *rtda.Frame) (int, error) {
+	BALOAD: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		index := frame.PopInt()
 		arr := frame.PopByteArr()
 		if arr == nil {
@@ -733,9 +733,9 @@ var InstructFuncMap = map[Instruct]func(frame *rtda.Frame) (pc int, err error){
 		}
 		checkIndex(len(arr), index)
 		frame.PushInt(int32(arr[index]))
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	CALOAD: func(frame *rtda.Frame) (int, error) {
+	CALOAD: func(frame *rtda.Frame, in *Instruction) (int, error) {
 
 		index := frame.PopInt()
 		arr := frame.PopCharArr()
@@ -744,9 +744,9 @@ var InstructFuncMap = map[Instruct]func(frame *rtda.Frame) (pc int, err error){
 		}
 		checkIndex(len(arr), index)
 		frame.PushInt(int32(arr[index]))
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	SALOAD: func(frame *rtda.Frame) (int, error) {
+	SALOAD: func(frame *rtda.Frame, in *Instruction) (int, error) {
 
 		index := frame.PopInt()
 		arr := frame.PopShortArr()
@@ -755,139 +755,139 @@ var InstructFuncMap = map[Instruct]func(frame *rtda.Frame) (pc int, err error){
 		}
 		checkIndex(len(arr), index)
 		frame.PushInt(int32(arr[index]))
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	ISTORE: func(frame *rtda.Frame) (int, error) {
+	ISTORE: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		val := frame.PopInt()
-		index := uint16(frame.NextByte())
+		index := uint16(in.Local)
 		frame.SetLocalVariableInt(index, val)
-		return 2 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	LSTORE: func(frame *rtda.Frame) (int, error) {
+	LSTORE: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		val := frame.PopLong()
-		index := uint16(frame.NextByte())
+		index := uint16(in.Local)
 		frame.SetLocalVariableLong(index, val)
-		return 2 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	FSTORE: func(frame *rtda.Frame) (int, error) {
+	FSTORE: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		val := frame.PopFloat()
-		index := uint16(frame.NextByte())
+		index := uint16(in.Local)
 		frame.SetLocalVariableFloat(index, val)
-		return 2 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	DSTORE: func(frame *rtda.Frame) (int, error) {
+	DSTORE: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		val := frame.PopDouble()
-		index := uint16(frame.NextByte())
+		index := uint16(in.Local)
 		frame.SetLocalVariableDouble(index, val)
-		return 2 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	ASTORE: func(frame *rtda.Frame) (int, error) {
+	ASTORE: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		val := frame.Pop()
-		index := uint16(frame.NextByte())
+		index := uint16(in.Local)
 		frame.SetLocalVariableRef(index, val)
-		return 2 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	ISTORE_0: func(frame *rtda.Frame) (int, error) {
+	ISTORE_0: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		val := frame.PopInt()
 		frame.SetLocalVariableInt(0, val)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	ISTORE_1: func(frame *rtda.Frame) (int, error) {
+	ISTORE_1: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		val := frame.PopInt()
 		frame.SetLocalVariableInt(1, val)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	ISTORE_2: func(frame *rtda.Frame) (int, error) {
+	ISTORE_2: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		val := frame.PopInt()
 		frame.SetLocalVariableInt(2, val)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	ISTORE_3: func(frame *rtda.Frame) (int, error) {
+	ISTORE_3: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		val := frame.PopInt()
 		frame.SetLocalVariableInt(3, val)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	LSTORE_0: func(frame *rtda.Frame) (int, error) {
+	LSTORE_0: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		val := frame.PopLong()
 		frame.SetLocalVariableLong(0, val)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	LSTORE_1: func(frame *rtda.Frame) (int, error) {
+	LSTORE_1: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		val := frame.PopLong()
 		frame.SetLocalVariableLong(1, val)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	LSTORE_2: func(frame *rtda.Frame) (int, error) {
+	LSTORE_2: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		val := frame.PopLong()
 		frame.SetLocalVariableLong(2, val)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	LSTORE_3: func(frame *rtda.Frame) (int, error) {
+	LSTORE_3: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		val := frame.PopLong()
 		frame.SetLocalVariableLong(3, val)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	FSTORE_0: func(frame *rtda.Frame) (int, error) {
+	FSTORE_0: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		val := frame.PopFloat()
 		frame.SetLocalVariableFloat(0, val)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	FSTORE_1: func(frame *rtda.Frame) (int, error) {
+	FSTORE_1: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		val := frame.PopFloat()
 		frame.SetLocalVariableFloat(1, val)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	FSTORE_2: func(frame *rtda.Frame) (int, error) {
+	FSTORE_2: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		val := frame.PopFloat()
 		frame.SetLocalVariableFloat(2, val)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	FSTORE_3: func(frame *rtda.Frame) (int, error) {
+	FSTORE_3: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		val := frame.PopFloat()
 		frame.SetLocalVariableFloat(3, val)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	DSTORE_0: func(frame *rtda.Frame) (int, error) {
+	DSTORE_0: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		val := frame.PopDouble()
 		frame.SetLocalVariableDouble(0, val)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	DSTORE_1: func(frame *rtda.Frame) (int, error) {
+	DSTORE_1: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		val := frame.PopDouble()
 		frame.SetLocalVariableDouble(1, val)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	DSTORE_2: func(frame *rtda.Frame) (int, error) {
+	DSTORE_2: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		val := frame.PopDouble()
 		frame.SetLocalVariableDouble(2, val)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	DSTORE_3: func(frame *rtda.Frame) (int, error) {
+	DSTORE_3: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		val := frame.PopDouble()
 		frame.SetLocalVariableDouble(3, val)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	ASTORE_0: func(frame *rtda.Frame) (int, error) {
+	ASTORE_0: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		val := frame.Pop()
 		frame.SetLocalVariableRef(0, val)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	ASTORE_1: func(frame *rtda.Frame) (int, error) {
+	ASTORE_1: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		val := frame.Pop()
 		frame.SetLocalVariableRef(1, val)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	ASTORE_2: func(frame *rtda.Frame) (int, error) {
+	ASTORE_2: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		val := frame.Pop()
 		frame.SetLocalVariableRef(2, val)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	ASTORE_3: func(frame *rtda.Frame) (int, error) {
+	ASTORE_3: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		val := frame.Pop()
 		frame.SetLocalVariableRef(3, val)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	IASTORE: func(frame *rtda.Frame) (int, error) {
+	IASTORE: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		val := frame.PopInt()
 		index := frame.PopInt()
 		ints := frame.PopIntArr()
@@ -898,9 +898,9 @@ var InstructFuncMap = map[Instruct]func(frame *rtda.Frame) (pc int, err error){
 			return 0, errors.New("ArrayIndexOutOfBoundsException")
 		}
 		ints[index] = val
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	LASTORE: func(frame *rtda.Frame) (int, error) {
+	LASTORE: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		val := frame.PopLong()
 		index := frame.PopInt()
 		longs := frame.PopLongArr()
@@ -911,9 +911,9 @@ var InstructFuncMap = map[Instruct]func(frame *rtda.Frame) (pc int, err error){
 			return 0, errors.New("ArrayIndexOutOfBoundsException")
 		}
 		longs[index] = val
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	FASTORE: func(frame *rtda.Frame) (int, error) {
+	FASTORE: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		val := frame.PopFloat()
 		index := frame.PopInt()
 		floats := frame.PopFloatArr()
@@ -924,9 +924,9 @@ var InstructFuncMap = map[Instruct]func(frame *rtda.Frame) (pc int, err error){
 			return 0, errors.New("ArrayIndexOutOfBoundsException")
 		}
 		floats[index] = val
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	DASTORE: func(frame *rtda.Frame) (int, error) {
+	DASTORE: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		val := frame.PopDouble()
 		index := frame.PopInt()
 		doubles := frame.PopDoubleArr()
@@ -937,9 +937,9 @@ var InstructFuncMap = map[Instruct]func(frame *rtda.Frame) (pc int, err error){
 			return 0, errors.New("ArrayIndexOutOfBoundsException")
 		}
 		doubles[index] = val
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	AASTORE: func(frame *rtda.Frame) (int, error) {
+	AASTORE: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		val := frame.Pop()
 		index := frame.PopInt()
 		refs := frame.PopRefArr()
@@ -950,9 +950,9 @@ var InstructFuncMap = map[Instruct]func(frame *rtda.Frame) (pc int, err error){
 			return 0, errors.New("ArrayIndexOutOfBoundsException")
 		}
 		refs[index] = val
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	BASTORE: func(frame *rtda.Frame) (int, error) {
+	BASTORE: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		val := frame.PopInt()
 		index := frame.PopInt()
 		bytes := frame.PopByteArr()
@@ -963,9 +963,9 @@ var InstructFuncMap = map[Instruct]func(frame *rtda.Frame) (pc int, err error){
 			return 0, errors.New("ArrayIndexOutOfBoundsException")
 		}
 		bytes[index] = int8(val)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	CASTORE: func(frame *rtda.Frame) (int, error) {
+	CASTORE: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		val := frame.PopInt()
 		index := frame.PopInt()
 		chars := frame.PopCharArr()
@@ -976,9 +976,9 @@ var InstructFuncMap = map[Instruct]func(frame *rtda.Frame) (pc int, err error){
 			return 0, errors.New("ArrayIndexOutOfBoundsException")
 		}
 		chars[index] = uint16(val)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	SASTORE: func(frame *rtda.Frame) (int, error) {
+	SASTORE: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		val := frame.PopInt()
 		index := frame.PopInt()
 		shorts := frame.PopShortArr()
@@ -989,34 +989,34 @@ var InstructFuncMap = map[Instruct]func(frame *rtda.Frame) (pc int, err error){
 			return 0, errors.New("ArrayIndexOutOfBoundsException")
 		}
 		shorts[index] = int16(val)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	POP: func(frame *rtda.Frame) (int, error) {
+	POP: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		frame.Pop()
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	POP2: func(frame *rtda.Frame) (int, error) {
+	POP2: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		frame.Pop()
 		frame.Pop()
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	DUP: func(frame *rtda.Frame) (int, error) {
+	DUP: func(frame *rtda.Frame, in *Instruction) (int, error) {
 
 		val := frame.Pop()
 		frame.Push(val)
 		frame.Push(val)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	DUP_X1: func(frame *rtda.Frame) (int, error) {
+	DUP_X1: func(frame *rtda.Frame, in *Instruction) (int, error) {
 
 		val1 := frame.Pop()
 		val2 := frame.Pop()
 		frame.Push(val1)
 		frame.Push(val2)
 		frame.Push(val1)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	DUP_X2: func(frame *rtda.Frame) (int, error) {
+	DUP_X2: func(frame *rtda.Frame, in *Instruction) (int, error) {
 
 		val1 := frame.Pop()
 		val2 := frame.Pop()
@@ -1025,9 +1025,9 @@ var InstructFuncMap = map[Instruct]func(frame *rtda.Frame) (pc int, err error){
 		frame.Push(val3)
 		frame.Push(val2)
 		frame.Push(val1)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	DUP2: func(frame *rtda.Frame) (int, error) {
+	DUP2: func(frame *rtda.Frame, in *Instruction) (int, error) {
 
 		val1 := frame.Pop()
 		val2 := frame.Pop()
@@ -1035,9 +1035,9 @@ var InstructFuncMap = map[Instruct]func(frame *rtda.Frame) (pc int, err error){
 		frame.Push(val1)
 		frame.Push(val2)
 		frame.Push(val1)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	DUP2_X1: func(frame *rtda.Frame) (int, error) {
+	DUP2_X1: func(frame *rtda.Frame, in *Instruction) (int, error) {
 
 		val1 := frame.Pop()
 		val2 := frame.Pop()
@@ -1047,9 +1047,9 @@ var InstructFuncMap = map[Instruct]func(frame *rtda.Frame) (pc int, err error){
 		frame.Push(val3)
 		frame.Push(val2)
 		frame.Push(val1)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	DUP2_X2: func(frame *rtda.Frame) (int, error) {
+	DUP2_X2: func(frame *rtda.Frame, in *Instruction) (int, error) {
 
 		val1 := frame.Pop()
 		val2 := frame.Pop()
@@ -1061,101 +1061,101 @@ var InstructFuncMap = map[Instruct]func(frame *rtda.Frame) (pc int, err error){
 		frame.Push(val3)
 		frame.Push(val2)
 		frame.Push(val1)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	SWAP: func(frame *rtda.Frame) (int, error) {
+	SWAP: func(frame *rtda.Frame, in *Instruction) (int, error) {
 
 		val1 := frame.Pop()
 		val2 := frame.Pop()
 		frame.Push(val1)
 		frame.Push(val2)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	IADD: func(frame *rtda.Frame) (int, error) {
+	IADD: func(frame *rtda.Frame, in *Instruction) (int, error) {
 
 		val1 := frame.PopInt()
 		val2 := frame.PopInt()
 		frame.PushInt(val1 + val2)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	LADD: func(frame *rtda.Frame) (int, error) {
+	LADD: func(frame *rtda.Frame, in *Instruction) (int, error) {
 
 		val1 := frame.PopLong()
 		val2 := frame.PopLong()
 		frame.PushLong(val1 + val2)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	FADD: func(frame *rtda.Frame) (int, error) {
+	FADD: func(frame *rtda.Frame, in *Instruction) (int, error) {
 
 		val1 := frame.PopFloat()
 		val2 := frame.PopFloat()
 		frame.PushFloat(val1 + val2)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	DADD: func(frame *rtda.Frame) (int, error) {
+	DADD: func(frame *rtda.Frame, in *Instruction) (int, error) {
 
 		val1 := frame.PopDouble()
 		val2 := frame.PopDouble()
 		frame.PushDouble(val1 + val2)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	ISUB: func(frame *rtda.Frame) (int, error) {
+	ISUB: func(frame *rtda.Frame, in *Instruction) (int, error) {
 
 		val1 := frame.PopInt()
 		val2 := frame.PopInt()
 		frame.PushInt(val2 - val1)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	LSUB: func(frame *rtda.Frame) (int, error) {
+	LSUB: func(frame *rtda.Frame, in *Instruction) (int, error) {
 
 		val1 := frame.PopLong()
 		val2 := frame.PopLong()
 		frame.PushLong(val2 - val1)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	FSUB: func(frame *rtda.Frame) (int, error) {
+	FSUB: func(frame *rtda.Frame, in *Instruction) (int, error) {
 
 		val1 := frame.PopFloat()
 		val2 := frame.PopFloat()
 		frame.PushFloat(val2 - val1)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	DSUB: func(frame *rtda.Frame) (int, error) {
+	DSUB: func(frame *rtda.Frame, in *Instruction) (int, error) {
 
 		val1 := frame.PopDouble()
 		val2 := frame.PopDouble()
 		frame.PushDouble(val2 - val1)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	IMUL: func(frame *rtda.Frame) (int, error) {
+	IMUL: func(frame *rtda.Frame, in *Instruction) (int, error) {
 
 		val1 := frame.PopInt()
 		val2 := frame.PopInt()
 		frame.PushInt(val1 * val2)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	LMUL: func(frame *rtda.Frame) (int, error) {
+	LMUL: func(frame *rtda.Frame, in *Instruction) (int, error) {
 
 		val1 := frame.PopLong()
 		val2 := frame.PopLong()
 		frame.PushLong(val1 * val2)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	FMUL: func(frame *rtda.Frame) (int, error) {
+	FMUL: func(frame *rtda.Frame, in *Instruction) (int, error) {
 
 		val1 := frame.PopFloat()
 		val2 := frame.PopFloat()
 		frame.PushFloat(val1 * val2)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	DMUL: func(frame *rtda.Frame) (int, error) {
+	DMUL: func(frame *rtda.Frame, in *Instruction) (int, error) {
 
 		val1 := frame.PopDouble()
 		val2 := frame.PopDouble()
 		frame.PushDouble(val1 * val2)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	IDIV: func(frame *rtda.Frame) (int, error) {
+	IDIV: func(frame *rtda.Frame, in *Instruction) (int, error) {
 
 		val1 := frame.PopInt()
 		val2 := frame.PopInt()
@@ -1163,9 +1163,9 @@ var InstructFuncMap = map[Instruct]func(frame *rtda.Frame) (pc int, err error){
 			return 0, errors.New("java.lang.ArithmeticException: / by zero")
 		}
 		frame.PushInt(val2 / val1)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	LDIV: func(frame *rtda.Frame) (int, error) {
+	LDIV: func(frame *rtda.Frame, in *Instruction) (int, error) {
 
 		val1 := frame.PopLong()
 		val2 := frame.PopLong()
@@ -1173,23 +1173,23 @@ var InstructFuncMap = map[Instruct]func(frame *rtda.Frame) (pc int, err error){
 			return 0, errors.New("java.lang.ArithmeticException: / by zero")
 		}
 		frame.PushLong(val2 / val1)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	FDIV: func(frame *rtda.Frame) (int, error) {
+	FDIV: func(frame *rtda.Frame, in *Instruction) (int, error) {
 
 		val1 := frame.PopFloat()
 		val2 := frame.PopFloat()
 		frame.PushFloat(val2 / val1)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	DDIV: func(frame *rtda.Frame) (int, error) {
+	DDIV: func(frame *rtda.Frame, in *Instruction) (int, error) {
 
 		val1 := frame.PopDouble()
 		val2 := frame.PopDouble()
 		frame.PushDouble(val2 / val1)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	IREM: func(frame *rtda.Frame) (int, error) {
+	IREM: func(frame *rtda.Frame, in *Instruction) (int, error) {
 
 		val1 := frame.PopInt()
 		val2 := frame.PopInt()
@@ -1197,9 +1197,9 @@ var InstructFuncMap = map[Instruct]func(frame *rtda.Frame) (pc int, err error){
 			return 0, errors.New("java.lang.ArithmeticException: / by zero")
 		}
 		frame.PushInt(val2 % val1)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	LREM: func(frame *rtda.Frame) (int, error) {
+	LREM: func(frame *rtda.Frame, in *Instruction) (int, error) {
 
 		val1 := frame.PopLong()
 		val2 := frame.PopLong()
@@ -1207,210 +1207,215 @@ var InstructFuncMap = map[Instruct]func(frame *rtda.Frame) (pc int, err error){
 			return 0, errors.New("java.lang.ArithmeticException: / by zero")
 		}
 		frame.PushLong(val2 % val1)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	FREM: func(frame *rtda.Frame) (int, error) {
+	FREM: func(frame *rtda.Frame, in *Instruction) (int, error) {
 
 		val1 := frame.PopFloat()
 		val2 := frame.PopFloat()
 		frame.PushFloat(float32(math.Mod(float64(val2), float64(val1))))
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	DREM: func(frame *rtda.Frame) (int, error) {
+	DREM: func(frame *rtda.Frame, in *Instruction) (int, error) {
 
 		val1 := frame.PopDouble()
 		val2 := frame.PopDouble()
 		frame.PushDouble(math.Mod(val2, val1))
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	INEG: func(frame *rtda.Frame) (int, error) {
+	INEG: func(frame *rtda.Frame, in *Instruction) (int, error) {
 
 		val := frame.PopInt()
 		frame.PushInt(-val)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	LNEG: func(frame *rtda.Frame) (int, error) {
+	LNEG: func(frame *rtda.Frame, in *Instruction) (int, error) {
 
 		val := frame.PopLong()
 		frame.PushLong(-val)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	FNEG: func(frame *rtda.Frame) (int, error) {
+	FNEG: func(frame *rtda.Frame, in *Instruction) (int, error) {
 
 		val := frame.PopFloat()
 		frame.PushFloat(-val)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	DNEG: func(frame *rtda.Frame) (int, error) {
+	DNEG: func(frame *rtda.Frame, in *Instruction) (int, error) {
 
 		val := frame.PopDouble()
 		frame.PushDouble(-val)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	ISHL: func(frame *rtda.Frame) (int, error) {
+	ISHL: func(frame *rtda.Frame, in *Instruction) (int, error) {
 
 		s := frame.PopInt()
 		val := frame.PopInt()
 		frame.PushInt(val << uint(s))
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	LSHL: func(frame *rtda.Frame) (int, error) {
+	LSHL: func(frame *rtda.Frame, in *Instruction) (int, error) {
 
 		s := frame.PopInt()
 		val := frame.PopLong()
 		frame.PushLong(val << uint(s))
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	ISHR: func(frame *rtda.Frame) (int, error) {
+	ISHR: func(frame *rtda.Frame, in *Instruction) (int, error) {
 
 		s := frame.PopInt()
 		val := frame.PopInt()
 		frame.PushInt(val >> uint(s))
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	LSHR: func(frame *rtda.Frame) (int, error) {
+	LSHR: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		s := frame.PopInt()
 		val := frame.PopLong()
 		frame.PushLong(val >> uint(s))
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	IUSHR: func(frame *rtda.Frame) (int, error) {
+	IUSHR: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		s := frame.PopInt()
 		val := frame.PopInt()
 		frame.PushInt(int32(uint32(val) >> uint(s)))
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	LUSHR: func(frame *rtda.Frame) (int, error) {
+	LUSHR: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		s := frame.PopInt()
 		val := frame.PopLong()
 		frame.PushLong(int64(uint64(val) >> uint(s)))
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	IAND: func(frame *rtda.Frame) (int, error) {
+	IAND: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		val1 := frame.PopInt()
 		val2 := frame.PopInt()
 		frame.PushInt(val1 & val2)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	LAND: func(frame *rtda.Frame) (int, error) {
+	LAND: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		val1 := frame.PopLong()
 		val2 := frame.PopLong()
 		frame.PushLong(val1 & val2)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	IOR: func(frame *rtda.Frame) (int, error) {
+	IOR: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		val1 := frame.PopInt()
 		val2 := frame.PopInt()
 		frame.PushInt(val1 | val2)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	LOR: func(frame *rtda.Frame) (int, error) {
+	LOR: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		val1 := frame.PopLong()
 		val2 := frame.PopLong()
 		frame.PushLong(val1 | val2)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	IXOR: func(frame *rtda.Frame) (int, error) {
+	IXOR: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		val1 := frame.PopInt()
 		val2 := frame.PopInt()
 		frame.PushInt(val1 ^ val2)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	LXOR: func(frame *rtda.Frame) (int, error) {
+	LXOR: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		val1 := frame.PopLong()
 		val2 := frame.PopLong()
 		frame.PushLong(val1 ^ val2)
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	I2L: func(frame *rtda.Frame) (int, error) {
+	IINC: func(frame *rtda.Frame, in *Instruction) (int, error) {
+		index := uint16(in.Local)
+		frame.SetLocalVariableInt(index, frame.LocalVariableInt(index)+in.Const)
+		return in.Next(), nil
+	},
+	I2L: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		val := frame.PopInt()
 		frame.PushLong(int64(val))
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	I2F: func(frame *rtda.Frame) (int, error) {
+	I2F: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		val := frame.PopInt()
 		frame.PushFloat(float32(val))
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	I2D: func(frame *rtda.Frame) (int, error) {
+	I2D: func(frame *rtda.Frame, in *Instruction) (int, error) {
 
 		val := frame.PopInt()
 		frame.PushDouble(float64(val))
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	L2I: func(frame *rtda.Frame) (int, error) {
+	L2I: func(frame *rtda.Frame, in *Instruction) (int, error) {
 
 		val := frame.PopLong()
 		frame.PushInt(int32(val))
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	L2F: func(frame *rtda.Frame) (int, error) {
+	L2F: func(frame *rtda.Frame, in *Instruction) (int, error) {
 
 		val := frame.PopLong()
 		frame.PushFloat(float32(val))
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	L2D: func(frame *rtda.Frame) (int, error) {
+	L2D: func(frame *rtda.Frame, in *Instruction) (int, error) {
 
 		val := frame.PopLong()
 		frame.PushDouble(float64(val))
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	F2I: func(frame *rtda.Frame) (int, error) {
+	F2I: func(frame *rtda.Frame, in *Instruction) (int, error) {
 
 		val := frame.PopFloat()
 		frame.PushInt(int32(val))
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	F2L: func(frame *rtda.Frame) (int, error) {
+	F2L: func(frame *rtda.Frame, in *Instruction) (int, error) {
 
 		val := frame.PopFloat()
 		frame.PushLong(int64(val))
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	F2D: func(frame *rtda.Frame) (int, error) {
+	F2D: func(frame *rtda.Frame, in *Instruction) (int, error) {
 
 		val := frame.PopFloat()
 		frame.PushDouble(float64(val))
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	D2I: func(frame *rtda.Frame) (int, error) {
+	D2I: func(frame *rtda.Frame, in *Instruction) (int, error) {
 
 		val := frame.PopDouble()
 		frame.PushInt(int32(val))
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	D2L: func(frame *rtda.Frame) (int, error) {
+	D2L: func(frame *rtda.Frame, in *Instruction) (int, error) {
 
 		val := frame.PopDouble()
 		frame.PushLong(int64(val))
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	D2F: func(frame *rtda.Frame) (int, error) {
+	D2F: func(frame *rtda.Frame, in *Instruction) (int, error) {
 
 		val := frame.PopDouble()
 		frame.PushFloat(float32(val))
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	I2B: func(frame *rtda.Frame) (int, error) {
+	I2B: func(frame *rtda.Frame, in *Instruction) (int, error) {
 
 		val := frame.PopInt()
 		frame.PushInt(int32(int8(val)))
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	I2C: func(frame *rtda.Frame) (int, error) {
+	I2C: func(frame *rtda.Frame, in *Instruction) (int, error) {
 
 		val := frame.PopInt()
 		frame.PushInt(int32(uint16(val)))
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	I2S: func(frame *rtda.Frame) (int, error) {
+	I2S: func(frame *rtda.Frame, in *Instruction) (int, error) {
 
 		val := frame.PopInt()
 		frame.PushInt(int32(int16(val)))
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	LCMP: func(frame *rtda.Frame) (int, error) {
+	LCMP: func(frame *rtda.Frame, in *Instruction) (int, error) {
 
 		val2 := frame.PopLong()
 		val1 := frame.PopLong()
@@ -1421,9 +1426,9 @@ var InstructFuncMap = map[Instruct]func(frame *rtda.Frame) (pc int, err error){
 		} else {
 			frame.PushInt(-1)
 		}
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	FCMPL: func(frame *rtda.Frame) (int, error) {
+	FCMPL: func(frame *rtda.Frame, in *Instruction) (int, error) {
 
 		val2 := frame.PopFloat()
 		val1 := frame.PopFloat()
@@ -1434,9 +1439,9 @@ var InstructFuncMap = map[Instruct]func(frame *rtda.Frame) (pc int, err error){
 		} else if val1 < val2 || math.IsNaN(float64(val1)) || math.IsNaN(float64(val2)) {
 			frame.PushInt(-1)
 		}
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	FCMPG: func(frame *rtda.Frame) (int, error) {
+	FCMPG: func(frame *rtda.Frame, in *Instruction) (int, error) {
 
 		val2 := frame.PopFloat()
 		val1 := frame.PopFloat()
@@ -1447,9 +1452,9 @@ var InstructFuncMap = map[Instruct]func(frame *rtda.Frame) (pc int, err error){
 		} else if val1 < val2 || math.IsNaN(float64(val1)) || math.IsNaN(float64(val2)) {
 			frame.PushInt(-1)
 		}
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	DCMPL: func(frame *rtda.Frame) (int, error) {
+	DCMPL: func(frame *rtda.Frame, in *Instruction) (int, error) {
 
 		val2 := frame.PopDouble()
 		val1 := frame.PopDouble()
@@ -1460,9 +1465,9 @@ var InstructFuncMap = map[Instruct]func(frame *rtda.Frame) (pc int, err error){
 		} else if val1 < val2 || math.IsNaN(val1) || math.IsNaN(val2) {
 			frame.PushInt(-1)
 		}
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	DCMPG: func(frame *rtda.Frame) (int, error) {
+	DCMPG: func(frame *rtda.Frame, in *Instruction) (int, error) {
 
 		val2 := frame.PopDouble()
 		val1 := frame.PopDouble()
@@ -1473,145 +1478,152 @@ var InstructFuncMap = map[Instruct]func(frame *rtda.Frame) (pc int, err error){
 		} else if val1 < val2 || math.IsNaN(val1) || math.IsNaN(val2) {
 			frame.PushInt(-1)
 		}
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	IFEQ: func(frame *rtda.Frame) (int, error) {
+	IFEQ: func(frame *rtda.Frame, in *Instruction) (int, error) {
 
 		val := frame.PopInt()
 		if val == 0 {
-			offset := int(frame.NextByte())
-			return frame.Thread.PC + int(offset), nil
+			return in.Target, nil
 		}
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	IFNE: func(frame *rtda.Frame) (int, error) {
+	IFNE: func(frame *rtda.Frame, in *Instruction) (int, error) {
 
 		val := frame.PopInt()
 		if val != 0 {
-			offset := int(frame.NextByte())
-			return frame.Thread.PC + int(offset), nil
+			return in.Target, nil
 		}
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	IFLT: func(frame *rtda.Frame) (int, error) {
+	IFLT: func(frame *rtda.Frame, in *Instruction) (int, error) {
 
 		val := frame.PopInt()
 		if val < 0 {
-			offset := int(frame.ReadOffset())
-			return frame.Thread.PC + int(offset), nil
+			return in.Target, nil
 		}
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	IFGE: func(frame *rtda.Frame) (int, error) {
+	IFGE: func(frame *rtda.Frame, in *Instruction) (int, error) {
 
 		val := frame.PopInt()
 		if val >= 0 {
-			offset := int(frame.ReadOffset())
-			return frame.Thread.PC + int(offset), nil
+			return in.Target, nil
 		}
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	IFGT: func(frame *rtda.Frame) (int, error) {
+	IFGT: func(frame *rtda.Frame, in *Instruction) (int, error) {
 
 		val := frame.PopInt()
 		if val > 0 {
-			offset := int(frame.ReadOffset())
-			return frame.Thread.PC + int(offset), nil
+			return in.Target, nil
 		}
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	IFLE: func(frame *rtda.Frame) (int, error) {
+	IFLE: func(frame *rtda.Frame, in *Instruction) (int, error) {
 
 		val := frame.PopInt()
 		if val <= 0 {
-			offset := int(frame.ReadOffset())
-			return frame.Thread.PC + int(offset), nil
+			return in.Target, nil
 		}
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	IF_ICMPEQ: func(frame *rtda.Frame) (int, error) {
+	IF_ICMPEQ: func(frame *rtda.Frame, in *Instruction) (int, error) {
 
 		val2 := frame.PopInt()
 		val1 := frame.PopInt()
 		if val1 == val2 {
-			offset := int(frame.ReadOffset())
-			return frame.Thread.PC + int(offset), nil
+			return in.Target, nil
 		}
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	IF_ICMPNE: func(frame *rtda.Frame) (int, error) {
+	IF_ICMPNE: func(frame *rtda.Frame, in *Instruction) (int, error) {
 
 		val2 := frame.PopInt()
 		val1 := frame.PopInt()
 		if val1 != val2 {
-			offset := int(frame.ReadOffset())
-			return frame.Thread.PC + int(offset), nil
+			return in.Target, nil
 		}
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	IF_ICMPLT: func(frame *rtda.Frame) (int, error) {
+	IF_ICMPLT: func(frame *rtda.Frame, in *Instruction) (int, error) {
 
 		val2 := frame.PopInt()
 		val1 := frame.PopInt()
 		if val1 < val2 {
-			offset := int(frame.ReadOffset())
-			return frame.Thread.PC + int(offset), nil
+			return in.Target, nil
 		}
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	IF_ICMPGE: func(frame *rtda.Frame) (int, error) {
+	IF_ICMPGE: func(frame *rtda.Frame, in *Instruction) (int, error) {
 
 		val2 := frame.PopInt()
 		val1 := frame.PopInt()
 		if val1 >= val2 {
-			offset := int(frame.ReadOffset())
-			return frame.Thread.PC + int(offset), nil
+			return in.Target, nil
 		}
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	IF_ICMPGT: func(frame *rtda.Frame) (int, error) {
+	IF_ICMPGT: func(frame *rtda.Frame, in *Instruction) (int, error) {
 
 		val2 := frame.PopInt()
 		val1 := frame.PopInt()
 		if val1 > val2 {
-			offset := int(frame.ReadOffset())
-			return frame.Thread.PC + int(offset), nil
+			return in.Target, nil
 		}
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	IF_ICMPLE: func(frame *rtda.Frame) (int, error) {
+	IF_ICMPLE: func(frame *rtda.Frame, in *Instruction) (int, error) {
 
 		val2 := frame.PopInt()
 		val1 := frame.PopInt()
 		if val1 <= val2 {
-			offset := int(frame.ReadOffset())
-			return frame.Thread.PC + int(offset), nil
+			return in.Target, nil
 		}
-		return 1 + frame.Thread.PC, nil
+		return in.Next(), nil
 	},
-	IF_ACMPEQ: func(frame *rtda.Frame) (int, error) {
-		panic("todo: if_acmpeq")
+	IF_ACMPEQ: func(frame *rtda.Frame, in *Instruction) (int, error) {
+		val2 := frame.Pop()
+		val1 := frame.Pop()
+		if val1 == val2 {
+			return in.Target, nil
+		}
+		return in.Next(), nil
 	},
-	IF_ACMPNE: func(frame *rtda.Frame) (int, error) {
-		panic("todo: if_acmpne")
+	IF_ACMPNE: func(frame *rtda.Frame, in *Instruction) (int, error) {
+		val2 := frame.Pop()
+		val1 := frame.Pop()
+		if val1 != val2 {
+			return in.Target, nil
+		}
+		return in.Next(), nil
 	},
-	GOTO: func(frame *rtda.Frame) (int, error) {
-		offset := int(frame.ReadOffset())
-		return frame.Thread.PC + int(offset), nil
+	GOTO: func(frame *rtda.Frame, in *Instruction) (int, error) {
+		return in.Target, nil
 	},
-	JSR: func(frame *rtda.Frame) (int, error) {
+	JSR: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		panic("todo: jsr")
 	},
-	RET: func(frame *rtda.Frame) (int, error) {
+	RET: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		panic("todo: ret")
 	},
-	TABLESWITCH: func(frame *rtda.Frame) (int, error) {
-		panic("todo: tableswitch")
-	},
-	LOOKUPSWITCH: func(frame *rtda.Frame) (int, error) {
-		panic("todo: lookupswitch")
+	TABLESWITCH: func(frame *rtda.Frame, in *Instruction) (int, error) {
+		index := frame.PopInt()
+		if low := in.Keys[0]; index >= low && int(index-low) < len(in.Targets) {
+			return in.Targets[index-low], nil
+		}
+		return in.Target, nil
+	},
+	LOOKUPSWITCH: func(frame *rtda.Frame, in *Instruction) (int, error) {
+		key := frame.PopInt()
+		for i, match := range in.Keys {
+			if match == key {
+				return in.Targets[i], nil
+			}
+		}
+		return in.Target, nil
 	},
-	IRETURN: func(frame *rtda.Frame) (int, error) {
+	IRETURN: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		thread := frame.Thread
 		currentFrame := thread.PopFrame()
 		invokerFrame := thread.TopFrame()
@@ -1619,7 +1631,7 @@ var InstructFuncMap = map[Instruct]func(frame *rtda.Frame) (pc int, err error){
 		invokerFrame.PushInt(val)
 		return 0, nil
 	},
-	LRETURN: func(frame *rtda.Frame) (int, error) {
+	LRETURN: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		thread := frame.Thread
 		currentFrame := thread.PopFrame()
 		invokerFrame := thread.TopFrame()
@@ -1627,7 +1639,7 @@ var InstructFuncMap = map[Instruct]func(frame *rtda.Frame) (pc int, err error){
 		invokerFrame.PushLong(val)
 		return 0, nil
 	},
-	FRETURN: func(frame *rtda.Frame) (int, error) {
+	FRETURN: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		thread := frame.Thread
 		currentFrame := thread.PopFrame()
 		invokerFrame := thread.TopFrame()
@@ -1635,7 +1647,7 @@ var InstructFuncMap = map[Instruct]func(frame *rtda.Frame) (pc int, err error){
 		invokerFrame.PushFloat(val)
 		return 0, nil
 	},
-	DRETURN: func(frame *rtda.Frame) (int, error) {
+	DRETURN: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		thread := frame.Thread
 		currentFrame := thread.PopFrame()
 		invokerFrame := thread.TopFrame()
@@ -1643,7 +1655,7 @@ var InstructFuncMap = map[Instruct]func(frame *rtda.Frame) (pc int, err error){
 		invokerFrame.PushDouble(val)
 		return 0, nil
 	},
-	ARETURN: func(frame *rtda.Frame) (int, error) {
+	ARETURN: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		thread := frame.Thread
 		currentFrame := thread.PopFrame()
 		invokerFrame := thread.TopFrame()
@@ -1651,85 +1663,122 @@ var InstructFuncMap = map[Instruct]func(frame *rtda.Frame) (pc int, err error){
 		invokerFrame.Push(val)
 		return 0, nil
 	},
-	RETURN: func(frame *rtda.Frame) (int, error) {
+	RETURN: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		thread := frame.Thread
 		thread.PopFrame()
 		return 0, nil
 	},
-	GETSTATIC: func(frame *rtda.Frame) (int, error) {
+	GETSTATIC: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		panic("todo: getstatic")
 	},
-	PUTSTATIC: func(frame *rtda.Frame) (int, error) {
+	PUTSTATIC: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		panic("todo: putstatic")
 	},
-	GETFIELD: func(frame *rtda.Frame) (int, error) {
+	GETFIELD: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		panic("todo: getfield")
 	},
-	PUTFIELD: func(frame *rtda.Frame) (int, error) {
+	PUTFIELD: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		panic("todo: putfield")
 	},
-	INVOKEVIRTUAL: func(frame *rtda.Frame) (int, error) {
+	INVOKEVIRTUAL: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		panic("todo: invokevirtual")
 	},
-	INVOKESPECIAL: func(frame *rtda.Frame) (int, error) {
+	INVOKESPECIAL: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		panic("todo: invokespecial")
 	},
-	INVOKESTATIC: func(frame *rtda.Frame) (int, error) {
+	INVOKESTATIC: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		panic("todo: invokestatic")
 	},
-	INVOKEINTERFACE: func(frame *rtda.Frame) (int, error) {
+	INVOKEINTERFACE: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		panic("todo: invokeinterface")
 	},
-	INVOKEDYNAMIC: func(frame *rtda.Frame) (int, error) {
+	INVOKEDYNAMIC: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		panic("todo: invokedynamic")
 	},
-	NEW: func(frame *rtda.Frame) (int, error) {
+	NEW: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		panic("todo: new")
 	},
-	NEWARRAY: func(frame *rtda.Frame) (int, error) {
+	NEWARRAY: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		panic("todo: newarray")
 	},
-	ANEWARRAY: func(frame *rtda.Frame) (int, error) {
+	ANEWARRAY: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		panic("todo: anewarray")
 	},
-	ARRAYLENGTH: func(frame *rtda.Frame) (int, error) {
+	ARRAYLENGTH: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		panic("todo: arraylength")
 	},
-	ATHROW: func(frame *rtda.Frame) (int, error) {
+	ATHROW: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		panic("todo: athrow")
 	},
-	CHECKCAST: func(frame *rtda.Frame) (int, error) {
+	CHECKCAST: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		panic("todo: checkcast")
 	},
-	INSTANCEOF: func(frame *rtda.Frame) (int, error) {
+	INSTANCEOF: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		panic("todo: instanceof")
 	},
-	MONITORENTER: func(frame *rtda.Frame) (int, error) {
+	MONITORENTER: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		panic("todo: monitorenter")
 	},
-	MONITOREXIT: func(frame *rtda.Frame) (int, error) {
+	MONITOREXIT: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		panic("todo: monitorexit")
 	},
-	WIDE: func(frame *rtda.Frame) (int, error) {
-		panic("todo: wide")
+	WIDE: func(frame *rtda.Frame, in *Instruction) (int, error) {
+		return 0, errors.New("wide is decoded together with the instruction it modifies")
 	},
-	MULTIANEWARRAY: func(frame *rtda.Frame) (int, error) {
+	MULTIANEWARRAY: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		panic("todo: multianewarray")
 	},
-	IFNULL: func(frame *rtda.Frame) (int, error) {
-		panic("todo: ifnull")
+	IFNULL: func(frame *rtda.Frame, in *Instruction) (int, error) {
+		if frame.Pop() == nil {
+			return in.Target, nil
+		}
+		return in.Next(), nil
 	},
-	IFNONNULL: func(frame *rtda.Frame) (int, error) {
-		panic("todo: ifnonnull")
+	IFNONNULL: func(frame *rtda.Frame, in *Instruction) (int, error) {
+		if frame.Pop() != nil {
+			return in.Target, nil
+		}
+		return in.Next(), nil
 	},
-	GOTO_W: func(frame *rtda.Frame) (int, error) {
-		panic("todo: goto_w")
+	GOTO_W: func(frame *rtda.Frame, in *Instruction) (int, error) {
+		return in.Target, nil
 	},
-	JSR_W: func(frame *rtda.Frame) (int, error) {
+	JSR_W: func(frame *rtda.Frame, in *Instruction) (int, error) {
 		panic("todo: jsr_w")
 	},
 }
 
+// unimplemented are the instructions InstructFuncMap cannot run yet.
+var unimplemented = map[Instruct]bool{
+	JSR: true, RET: true, JSR_W: true,
+	GETSTATIC: true, PUTSTATIC: true, GETFIELD: true, PUTFIELD: true,
+	INVOKEVIRTUAL: true, INVOKESPECIAL: true, INVOKESTATIC: true, INVOKEINTERFACE: true, INVOKEDYNAMIC: true,
+	NEW: true, NEWARRAY: true, ANEWARRAY: true, ARRAYLENGTH: true, MULTIANEWARRAY: true,
+	ATHROW: true, CHECKCAST: true, INSTANCEOF: true, MONITORENTER: true, MONITOREXIT: true,
+}
+
+// checkRunnable fails if the code of method uses an instruction, or loads
+// a constant, the interpreter cannot run yet.
+func checkRunnable(method *rtda.Method) error {
+	instructions, err := Decode(method.Code)
+	if err != nil {
+		return err
+	}
+	for _, in := range instructions {
+		if unimplemented[in.Opcode] {
+			return fmt.Errorf("uses %s at offset %d, which outro cannot run yet", InstructDisplayNameMap[in.Opcode], in.Offset)
+		}
+		if in.Opcode == LDC || in.Opcode == LDC_W || in.Opcode == LDC2_W {
+			switch method.GetConstant(uint16(in.Index)).(type) {
+			case int32, float32, string, int64, float64:
+			default:
+				return fmt.Errorf("loads a constant at offset %d, which outro cannot load yet", in.Offset)
+			}
+		}
+	}
+	return nil
+}
+
 func checkIndex(i int, index int32) {
 	if i < 0 || i >= int(index) {
 		panic("ArrayIndexOutOfBoundsException")
@@ -1,25 +1,115 @@
 package interpreter
 
-import "outro/rtda"
+import (
+	"fmt"
+	"outro/rtda"
+)
 
 type JVM struct {
 	Thread *rtda.Thread
+	// Loader is the loader agents instrument.
+	Loader *rtda.ApplicationClassLoader
+	// Tracer is told of every instruction run.
+	Tracer Tracer
+
+	instrumentation *Instrumentation
+	tools           tooling
 }
 
+// Execute runs the current frame of the thread, the main method, after
+// which the thread ends and the trace is flushed.
 func (jvm *JVM) Execute() {
 	frame := jvm.Thread.CurrentFrame()
-	run(frame)
+	jvm.startThread(jvm.Thread)
+	defer jvm.endThread(jvm.Thread)
+	returned := false
+	defer func() {
+		// A failed flush is reported only if the method returned, rather
+		// than hiding the panic it raised.
+		if err := jvm.flushTrace(); err != nil && returned {
+			panic(err)
+		}
+	}()
+	jvm.run(frame)
+	returned = true
 }
 
-func run(frame *rtda.Frame) {
-	opcodes := frame.Method.Code
-	for {
-		println(InstructDisplayNameMap[Instruct(opcodes[frame.Thread.PC])])
-		opcode := Instruct(opcodes[frame.Thread.PC])
-		pc, err := InstructFuncMap[opcode](frame)
+func (jvm *JVM) flushTrace() error {
+	if jvm.Tracer == nil {
+		return nil
+	}
+	if err := jvm.Tracer.Flush(); err != nil {
+		return fmt.Errorf("writing the trace: %w", err)
+	}
+	return nil
+}
+
+// run executes frame until it returns, that is until it is popped off its
+// thread, posting the events of the method to the tools.
+func (jvm *JVM) run(frame *rtda.Frame) {
+	instructions, err := Decode(frame.Method.Code)
+	if err != nil {
+		panic(fmt.Errorf("%s.%s%s: %w", frame.Method.Class.Name, frame.Method.Name, frame.Method.Descriptor, err))
+	}
+	// byOffset maps code offsets to instructions; offsets inside an
+	// instruction are left nil.
+	byOffset := make([]*Instruction, len(frame.Method.Code))
+	for i := range instructions {
+		byOffset[instructions[i].Offset] = &instructions[i]
+	}
+	thread := frame.Thread
+	depth := thread.StackDepth()
+	jvm.methodEntry(frame)
+	returned := false
+	defer func() {
+		if !returned {
+			jvm.methodExit(frame, true, nil)
+		}
+	}()
+	// handling is the instruction whose handler is running; a Go panic
+	// in it is posted as an exception before the method exits.
+	var handling *Instruction
+	defer func() {
+		if r := recover(); r != nil {
+			if handling != nil {
+				jvm.exception(frame, handling.Offset, panicError(r))
+			}
+			panic(r)
+		}
+	}()
+	for thread.StackDepth() >= depth {
+		if thread.PC < 0 || thread.PC >= len(byOffset) || byOffset[thread.PC] == nil {
+			panic(fmt.Errorf("java.lang.VerifyError: no instruction at offset %d", thread.PC))
+		}
+		in := byOffset[thread.PC]
+		frame.PC = thread.PC
+		if jvm.Tracer != nil {
+			jvm.Tracer.Trace(frame, in)
+		}
+		if in.Opcode >= IRETURN && in.Opcode <= RETURN {
+			// The method exits with the frame still on the stack.
+			var value interface{}
+			if stack := frame.OperandStack(); in.Opcode != RETURN && len(stack) > 0 {
+				value = stack[len(stack)-1]
+			}
+			returned = true
+			jvm.methodExit(frame, false, value)
+		}
+		handling = in
+		pc, err := InstructFuncMap[in.Opcode](frame, in)
+		handling = nil
 		if err != nil {
+			jvm.exception(frame, in.Offset, err)
 			panic(err)
 		}
-		frame.Thread.PC = pc
+		thread.PC = pc
+	}
+}
+
+// panicError returns the value of a panic as an error.
+func panicError(r interface{}) error {
+	if err, ok := r.(error); ok {
+		return err
 	}
+	return fmt.Errorf("%v", r)
 }
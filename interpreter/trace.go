@@ -0,0 +1,256 @@
+package interpreter
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"outro/rtda"
+	"path"
+	"strings"
+)
+
+// Tracer is told of every instruction before it executes. JVM.Tracer is
+// nil, tracing nothing, unless one is set. Tracers may buffer what they
+// write until Flush, which the JVM calls when it stops running code.
+type Tracer interface {
+	Trace(frame *rtda.Frame, in *Instruction)
+	// Flush writes out what the tracer buffers, returning the first error
+	// writing the trace met.
+	Flush() error
+}
+
+// traceWriter buffers the writes of a tracer, keeping the first error and
+// dropping the writes after it.
+type traceWriter struct {
+	w   *bufio.Writer
+	err error
+}
+
+func newTraceWriter(w io.Writer) *traceWriter {
+	return &traceWriter{w: bufio.NewWriter(w)}
+}
+
+func (t *traceWriter) Write(p []byte) (int, error) {
+	if t.err != nil {
+		return 0, t.err
+	}
+	n, err := t.w.Write(p)
+	t.err = err
+	return n, err
+}
+
+func (t *traceWriter) Flush() error {
+	if t.err == nil {
+		t.err = t.w.Flush()
+	}
+	return t.err
+}
+
+// operand is a named operand of an instruction.
+type operand struct {
+	name  string
+	value interface{}
+}
+
+// operands returns the decoded operands of in, in the order the
+// instruction holds them.
+func operands(in *Instruction) []operand {
+	switch op := in.Opcode; {
+	case op == BIPUSH || op == SIPUSH:
+		return []operand{{"const", in.Const}}
+	case op == NEWARRAY:
+		return []operand{{"atype", in.ArrayType}}
+	case op == IINC:
+		return []operand{{"local", in.Local}, {"const", in.Const}}
+	case op >= ILOAD && op <= ALOAD, op >= ISTORE && op <= ASTORE, op == RET:
+		return []operand{{"local", in.Local}}
+	case op >= IFEQ && op <= JSR, op == IFNULL, op == IFNONNULL, op == GOTO_W, op == JSR_W:
+		return []operand{{"target", in.Target}}
+	case op == INVOKEINTERFACE || op == MULTIANEWARRAY:
+		return []operand{{"index", in.Index}, {"count", in.Count}}
+	case op == LDC, op == LDC_W, op == LDC2_W, op >= GETSTATIC && op <= INVOKESTATIC, op == INVOKEDYNAMIC,
+		op == NEW, op == ANEWARRAY, op == CHECKCAST, op == INSTANCEOF:
+		return []operand{{"index", in.Index}}
+	case op == TABLESWITCH || op == LOOKUPSWITCH:
+		return []operand{{"keys", in.Keys}, {"targets", in.Targets}, {"default", in.Target}}
+	}
+	return nil
+}
+
+type textTracer struct {
+	w *traceWriter
+}
+
+// NewTextTracer writes a line to w for every instruction: the method, the
+// offset, the mnemonic and operands, then the operand stack and the local
+// variables.
+//
+//	gen/Sum.add(II)I 2 iadd stack=[1 2] locals=[1 2]
+func NewTextTracer(w io.Writer) Tracer {
+	return &textTracer{w: newTraceWriter(w)}
+}
+
+func (t *textTracer) Trace(frame *rtda.Frame, in *Instruction) {
+	var b strings.Builder
+	method := frame.Method
+	fmt.Fprintf(&b, "%s.%s%s %d %s", method.Class.Name, method.Name, method.Descriptor, in.Offset, InstructDisplayNameMap[in.Opcode])
+	for _, o := range operands(in) {
+		fmt.Fprintf(&b, " %s=%v", o.name, o.value)
+	}
+	b.WriteString(" stack=")
+	writeValues(&b, frame.OperandStack())
+	b.WriteString(" locals=")
+	writeValues(&b, frame.LocalVariables())
+	b.WriteByte('\n')
+	io.WriteString(t.w, b.String())
+}
+
+func (t *textTracer) Flush() error {
+	return t.w.Flush()
+}
+
+func writeValues(b *strings.Builder, values []interface{}) {
+	b.WriteByte('[')
+	for i, value := range values {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		switch v := value.(type) {
+		case nil:
+			b.WriteString("null")
+		case int32, int64, float32, float64:
+			fmt.Fprint(b, v)
+		case fmt.Stringer:
+			fmt.Fprintf(b, "%q", v.String())
+		default:
+			fmt.Fprintf(b, "%T", v)
+		}
+	}
+	b.WriteByte(']')
+}
+
+type jsonTracer struct {
+	w       *traceWriter
+	encoder *json.Encoder
+}
+
+// NewJSONTracer writes every instruction to w as a JSON object on a line
+// of its own, with the fields class, method, descriptor, pc, opcode,
+// operands, stack and locals.
+func NewJSONTracer(w io.Writer) Tracer {
+	buffered := newTraceWriter(w)
+	return &jsonTracer{w: buffered, encoder: json.NewEncoder(buffered)}
+}
+
+type traceRecord struct {
+	Class      string                 `json:"class"`
+	Method     string                 `json:"method"`
+	Descriptor string                 `json:"descriptor"`
+	PC         int                    `json:"pc"`
+	Opcode     string                 `json:"opcode"`
+	Operands   map[string]interface{} `json:"operands,omitempty"`
+	Stack      []interface{}          `json:"stack"`
+	Locals     []interface{}          `json:"locals"`
+}
+
+func (t *jsonTracer) Trace(frame *rtda.Frame, in *Instruction) {
+	record := traceRecord{
+		Class:      frame.Method.Class.Name,
+		Method:     frame.Method.Name,
+		Descriptor: frame.Method.Descriptor,
+		PC:         in.Offset,
+		Opcode:     InstructDisplayNameMap[in.Opcode],
+		Stack:      jsonValues(frame.OperandStack()),
+		Locals:     jsonValues(frame.LocalVariables()),
+	}
+	if ops := operands(in); len(ops) > 0 {
+		record.Operands = make(map[string]interface{}, len(ops))
+		for _, o := range ops {
+			record.Operands[o.name] = o.value
+		}
+	}
+	t.encoder.Encode(record)
+}
+
+func (t *jsonTracer) Flush() error {
+	return t.w.Flush()
+}
+
+// jsonValues converts values to ones JSON can hold: numbers stay numbers,
+// except NaN and the infinities, which become strings like strings do, and
+// other references become their Go type.
+func jsonValues(values []interface{}) []interface{} {
+	converted := make([]interface{}, len(values))
+	for i, value := range values {
+		switch v := value.(type) {
+		case nil, int32, int64:
+			converted[i] = v
+		case float32:
+			converted[i] = jsonFloat(float64(v))
+		case float64:
+			converted[i] = jsonFloat(v)
+		case fmt.Stringer:
+			converted[i] = v.String()
+		default:
+			converted[i] = fmt.Sprintf("%T", v)
+		}
+	}
+	return converted
+}
+
+func jsonFloat(f float64) interface{} {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return fmt.Sprint(f)
+	}
+	return f
+}
+
+type filterTracer struct {
+	tracer                      Tracer
+	classPattern, methodPattern string
+	matches                     map[*rtda.Method]bool
+}
+
+// FilterTracer passes to tracer only the instructions of the methods
+// pattern matches. The pattern is a class name pattern, optionally followed
+// by '#' and a method name pattern, with the syntax of path.Match: "gen/*"
+// matches the methods of the classes in package gen and "gen/Sum#add*" the
+// methods of gen/Sum whose names start with add. The class name may be in
+// binary form, as in "org.example.Sum".
+func FilterTracer(tracer Tracer, pattern string) (Tracer, error) {
+	classPattern, methodPattern, ok := strings.Cut(pattern, "#")
+	if !ok {
+		methodPattern = "*"
+	}
+	classPattern = strings.ReplaceAll(classPattern, ".", "/")
+	for _, p := range []string{classPattern, methodPattern} {
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("invalid trace pattern %s: %w", pattern, err)
+		}
+	}
+	return &filterTracer{
+		tracer:        tracer,
+		classPattern:  classPattern,
+		methodPattern: methodPattern,
+		matches:       make(map[*rtda.Method]bool),
+	}, nil
+}
+
+func (f *filterTracer) Trace(frame *rtda.Frame, in *Instruction) {
+	match, ok := f.matches[frame.Method]
+	if !ok {
+		classMatch, _ := path.Match(f.classPattern, frame.Method.Class.Name)
+		methodMatch, _ := path.Match(f.methodPattern, frame.Method.Name)
+		match = classMatch && methodMatch
+		f.matches[frame.Method] = match
+	}
+	if match {
+		f.tracer.Trace(frame, in)
+	}
+}
+
+func (f *filterTracer) Flush() error {
+	return f.tracer.Flush()
+}
@@ -0,0 +1,291 @@
+package javap
+
+import (
+	"fmt"
+	"outro/constant"
+	"outro/model"
+	"strings"
+)
+
+var frameTypeNames = []struct {
+	last uint8
+	name string
+}{
+	{constant.SameLocals1StackItemFrame - 1, "same"},
+	{constant.SameLocals1StackItemFrameExtended - 1, "same_locals_1_stack_item"},
+	{constant.SameLocals1StackItemFrameExtended, "same_locals_1_stack_item_frame_extended"},
+	{constant.SameFrameExtended - 1, "chop"},
+	{constant.SameFrameExtended, "same_frame_extended"},
+	{constant.FullFrame - 1, "append"},
+	{constant.FullFrame, "full_frame"},
+}
+
+var verificationTypeNames = map[uint8]string{
+	constant.ItemTop:               "top",
+	constant.ItemInteger:           "int",
+	constant.ItemFloat:             "float",
+	constant.ItemDouble:            "double",
+	constant.ItemLong:              "long",
+	constant.ItemNull:              "null",
+	constant.ItemUninitializedThis: "this",
+}
+
+var parameterFlagNames = []modifier{
+	{constant.FIELD_ACC_FINAL, "final"},
+	{constant.FIELD_ACC_SYNTHETIC, "synthetic"},
+	{0x8000, "mandated"},
+}
+
+// writeAttributes prints an attribute table. method is the method owning
+// the attributes, or nil for class and field attributes.
+func (w *classWriter) writeAttributes(attributes model.Attributes, method *model.MethodInfo) {
+	for _, attribute := range attributes {
+		w.writeAttribute(attribute, method)
+	}
+}
+
+func (w *classWriter) writeAttribute(attribute model.AttributeInfo, method *model.MethodInfo) {
+	c := w.class
+	switch value := attribute.Value.(type) {
+	case *model.CodeAttributeInfo:
+		w.println("Code:")
+		w.indent(+1)
+		args := 0
+		if method != nil {
+			args = w.argsSize(method)
+		}
+		w.println(fmt.Sprintf("stack=%d, locals=%d, args_size=%d", value.MaxStack, value.MaxLocals, args))
+		w.writeInstructions(value)
+		w.writeExceptionTable(value)
+		w.writeAttributes(value.Attributes, nil)
+		w.indent(-1)
+	case *model.LineNumberTableAttributeInfo:
+		w.println("LineNumberTable:")
+		w.indent(+1)
+		for _, entry := range value.LineNumberTable {
+			w.println(fmt.Sprintf("line %d: %d", entry.LineNumber, entry.StartPC))
+		}
+		w.indent(-1)
+	case *model.LocalVariableTableAttributeInfo:
+		w.println("LocalVariableTable:")
+		w.indent(+1)
+		w.println("Start  Length  Slot  Name   Signature")
+		for _, entry := range value.LocalVariableTable {
+			w.println(fmt.Sprintf("%5d %7d %5d %5s   %s", entry.StartPC, entry.Length, entry.Index,
+				c.Utf8(entry.NameIndex), c.Utf8(entry.DescriptorIndex)))
+		}
+		w.indent(-1)
+	case *model.LocalVariableTypeTableAttributeInfo:
+		w.println("LocalVariableTypeTable:")
+		w.indent(+1)
+		w.println("Start  Length  Slot  Name   Signature")
+		for _, entry := range value.LocalVariableTable {
+			w.println(fmt.Sprintf("%5d %7d %5d %5s   %s", entry.StartPc, entry.Length, entry.Index,
+				c.Utf8(entry.NameIndex), c.Utf8(entry.SignatureIndex)))
+		}
+		w.indent(-1)
+	case *model.StackMapTableAttributeInfo:
+		w.writeStackMapTable(value)
+	case *model.SignatureAttributeInfo:
+		w.print(fmt.Sprintf("Signature: #%d", value.SignatureIndex))
+		w.tab()
+		w.println("// " + w.stringValue(value.SignatureIndex))
+	case *model.ExceptionsAttributeInfo:
+		w.println("Exceptions:")
+		w.indent(+1)
+		var names []string
+		for _, index := range value.ExceptionIndexTable {
+			names = append(names, javaName(c.ClassName(index)))
+		}
+		w.println("throws " + strings.Join(names, ", "))
+		w.indent(-1)
+	case *model.ConstantValueAttributeInfo:
+		w.print("ConstantValue: ")
+		w.writeConstant(value.ConstantValueIndex)
+		w.println()
+	case *model.SourceFileAttributeInfo:
+		w.println(`SourceFile: "` + c.Utf8(value.SourceFileIndex) + `"`)
+	case *model.DeprecatedAttributeInfo:
+		w.println("Deprecated: true")
+	case *model.SyntheticAttributeInfo:
+		w.println("Synthetic: true")
+	case *model.EnclosingMethodAttributeInfo:
+		w.print(fmt.Sprintf("EnclosingMethod: #%d.#%d", value.ClassIndex, value.MethodIndex))
+		w.tab()
+		w.print("// " + w.stringValue(value.ClassIndex))
+		if value.MethodIndex != 0 {
+			w.print("." + w.stringValue(value.MethodIndex))
+		}
+		w.println()
+	case *model.NestHostAttributeInfo:
+		w.print("NestHost: ")
+		w.writeConstant(value.ClassIndex)
+		w.println()
+	case *model.NestMembersAttributeInfo:
+		w.writeClassList("NestMembers:", value.Classes)
+	case *model.PermittedSubclassesAttributeInfo:
+		w.writeClassList("PermittedSubclasses:", value.Classes)
+	case *model.InnerClassesAttributeInfo:
+		w.writeInnerClasses(value)
+	case *model.BootstrapMethodsAttributeInfo:
+		w.println("BootstrapMethods:")
+		for i, method := range value.BootstrapMethods {
+			w.indent(+1)
+			w.print(fmt.Sprintf("%d: #%d ", i, method.BootstrapMethodRef))
+			w.println(w.stringValue(method.BootstrapMethodRef))
+			w.indent(+1)
+			if len(method.BootstrapArguments) > 0 {
+				w.println("Method arguments:")
+			}
+			w.indent(+1)
+			for _, argument := range method.BootstrapArguments {
+				w.print(fmt.Sprintf("#%d ", argument))
+				w.println(w.stringValue(argument))
+			}
+			w.indent(-3)
+		}
+	case *model.MethodParametersAttributeInfo:
+		w.println("MethodParameters:")
+		w.indent(+1)
+		w.println(fmt.Sprintf("%-31s%s", "Name", "Flags"))
+		for _, parameter := range value.Parameters {
+			name := "<no name>"
+			if parameter.NameIndex != 0 {
+				name = c.Utf8(parameter.NameIndex)
+			}
+			flags := strings.Join(modifierNames(parameter.AccessFlags, parameterFlagNames), " ")
+			w.println(fmt.Sprintf("%-31s%s", name, flags))
+		}
+		w.indent(-1)
+	default:
+		w.writeUnknownAttribute(attribute)
+	}
+}
+
+// writeUnknownAttribute dumps the bytes of an attribute javap has no
+// format for.
+func (w *classWriter) writeUnknownAttribute(attribute model.AttributeInfo) {
+	name := attribute.Name
+	if name == "" {
+		name = w.stringValue(attribute.AttributeNameIndex)
+	}
+	w.print(fmt.Sprintf("%s: length = 0x%x", name, len(attribute.Info)))
+	if attribute.Value == nil {
+		w.print(" (unknown attribute)")
+	}
+	w.println()
+	for start := 0; start < len(attribute.Info); start += 16 {
+		end := start + 16
+		if end > len(attribute.Info) {
+			end = len(attribute.Info)
+		}
+		w.print("  ")
+		for _, b := range attribute.Info[start:end] {
+			w.print(fmt.Sprintf(" %02x", b))
+		}
+		w.println()
+	}
+}
+
+func (w *classWriter) writeClassList(header string, classes []uint16) {
+	w.println(header)
+	w.indent(+1)
+	for _, index := range classes {
+		w.println(w.stringValue(index))
+	}
+	w.indent(-1)
+}
+
+func (w *classWriter) writeInnerClasses(value *model.InnerClassesAttributeInfo) {
+	c := w.class
+	w.println("InnerClasses:")
+	w.indent(+1)
+	for _, inner := range value.Classes {
+		flags := inner.InnerClassAccessFlagsInfo
+		if flags&uint16(constant.CLASS_ACC_INTERFACE) != 0 {
+			flags &^= uint16(constant.CLASS_ACC_ABSTRACT)
+		}
+		w.writeModifiers(modifierNames(flags, innerClassModifiers))
+		if inner.InnerNameIndex != 0 {
+			w.print(fmt.Sprintf("#%d= ", inner.InnerNameIndex))
+		}
+		w.print(fmt.Sprintf("#%d", inner.InnerClassInfoIndex))
+		if inner.OuterClassInfoIndex != 0 {
+			w.print(fmt.Sprintf(" of #%d", inner.OuterClassInfoIndex))
+		}
+		w.print(";")
+		w.tab()
+		w.print("// ")
+		if inner.InnerNameIndex != 0 {
+			w.print(c.Utf8(inner.InnerNameIndex) + "=")
+		}
+		w.writeConstant(inner.InnerClassInfoIndex)
+		if inner.OuterClassInfoIndex != 0 {
+			w.print(" of ")
+			w.writeConstant(inner.OuterClassInfoIndex)
+		}
+		w.println()
+	}
+	w.indent(-1)
+}
+
+func (w *classWriter) writeStackMapTable(value *model.StackMapTableAttributeInfo) {
+	w.println(fmt.Sprintf("StackMapTable: number_of_entries = %d", len(value.Entries)))
+	w.indent(+1)
+	for _, frame := range value.Entries {
+		name := "unknown"
+		for _, kind := range frameTypeNames {
+			if frame.FrameType <= kind.last {
+				name = kind.name
+				break
+			}
+		}
+		w.println(fmt.Sprintf("frame_type = %d /* %s */", frame.FrameType, name))
+		w.indent(+1)
+		switch t := frame.FrameType; {
+		case t < constant.SameLocals1StackItemFrame:
+		case t < constant.SameLocals1StackItemFrameExtended:
+			w.writeVerificationTypes("stack", frame.Stack)
+		case t == constant.SameLocals1StackItemFrameExtended:
+			w.println(fmt.Sprintf("offset_delta = %d", frame.OffsetDelta))
+			w.writeVerificationTypes("stack", frame.Stack)
+		case t <= constant.SameFrameExtended:
+			w.println(fmt.Sprintf("offset_delta = %d", frame.OffsetDelta))
+		case t < constant.FullFrame:
+			w.println(fmt.Sprintf("offset_delta = %d", frame.OffsetDelta))
+			w.writeVerificationTypes("locals", frame.Locals)
+		default:
+			w.println(fmt.Sprintf("offset_delta = %d", frame.OffsetDelta))
+			w.writeVerificationTypes("locals", frame.Locals)
+			w.writeVerificationTypes("stack", frame.Stack)
+		}
+		w.indent(-1)
+	}
+	w.indent(-1)
+}
+
+// writeVerificationTypes prints "locals = [ int, class java/lang/String ]".
+func (w *classWriter) writeVerificationTypes(name string, types []model.VerificationTypeInfo) {
+	w.print(name + " = [")
+	for i, t := range types {
+		switch t.Tag {
+		case constant.ItemObject:
+			w.print(" ")
+			if t.CpoolIndex != 0 {
+				w.writeConstant(t.CpoolIndex)
+			} else {
+				w.print("class " + checkName(t.ClassName))
+			}
+		case constant.ItemUninitialized:
+			w.print(fmt.Sprintf(" uninitialized %d", t.Offset))
+		default:
+			w.print(" " + verificationTypeNames[t.Tag])
+		}
+		if i == len(types)-1 {
+			w.print(" ")
+		} else {
+			w.print(",")
+		}
+	}
+	w.println("]")
+}
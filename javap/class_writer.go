@@ -0,0 +1,370 @@
+package javap
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"outro/constant"
+	"outro/model"
+	"path/filepath"
+	"strings"
+)
+
+type classWriter struct {
+	*printer
+	class   *model.ClassFile
+	file    *File
+	options Options
+	// pendingNewline separates a member from the next one when the member
+	// printed more than its declaration.
+	pendingNewline bool
+}
+
+type modifier struct {
+	flag constant.AccessFlag
+	name string
+}
+
+var (
+	classModifiers = []modifier{
+		{constant.CLASS_ACC_PUBLIC, "public"},
+		{constant.CLASS_ACC_FINAL, "final"},
+		{constant.CLASS_ACC_ABSTRACT, "abstract"},
+	}
+	innerClassModifiers = []modifier{
+		{constant.CLASS_ACC_PUBLIC, "public"},
+		{constant.FIELD_ACC_PRIVATE, "private"},
+		{constant.FIELD_ACC_PROTECTED, "protected"},
+		{constant.FIELD_ACC_STATIC, "static"},
+		{constant.CLASS_ACC_FINAL, "final"},
+		{constant.CLASS_ACC_ABSTRACT, "abstract"},
+	}
+	fieldModifiers = []modifier{
+		{constant.FIELD_ACC_PUBLIC, "public"},
+		{constant.FIELD_ACC_PRIVATE, "private"},
+		{constant.FIELD_ACC_PROTECTED, "protected"},
+		{constant.FIELD_ACC_STATIC, "static"},
+		{constant.FIELD_ACC_FINAL, "final"},
+		{constant.FIELD_ACC_VOLATILE, "volatile"},
+		{constant.FIELD_ACC_TRANSIENT, "transient"},
+	}
+	methodModifiers = []modifier{
+		{constant.METHOD_ACC_PUBLIC, "public"},
+		{constant.METHOD_ACC_PRIVATE, "private"},
+		{constant.METHOD_ACC_PROTECTED, "protected"},
+		{constant.METHOD_ACC_STATIC, "static"},
+		{constant.METHOD_ACC_FINAL, "final"},
+		{constant.METHOD_ACC_SYNCHRONIZED, "synchronized"},
+		{constant.METHOD_ACC_NATIVE, "native"},
+		{constant.METHOD_ACC_ABSTRACT, "abstract"},
+		{constant.METHOD_ACC_STRICT, "strictfp"},
+	}
+)
+
+// The flag names of verbose output, in bit order.
+var (
+	classFlagNames = []modifier{
+		{constant.CLASS_ACC_PUBLIC, "ACC_PUBLIC"},
+		{constant.CLASS_ACC_FINAL, "ACC_FINAL"},
+		{constant.CLASS_ACC_SUPER, "ACC_SUPER"},
+		{constant.CLASS_ACC_INTERFACE, "ACC_INTERFACE"},
+		{constant.CLASS_ACC_ABSTRACT, "ACC_ABSTRACT"},
+		{constant.CLASS_ACC_SYNTHETIC, "ACC_SYNTHETIC"},
+		{constant.CLASS_ACC_ANNOTATION, "ACC_ANNOTATION"},
+		{constant.CLASS_ACC_ENUM, "ACC_ENUM"},
+		{constant.CLASS_ACC_MODULE, "ACC_MODULE"},
+	}
+	fieldFlagNames = []modifier{
+		{constant.FIELD_ACC_PUBLIC, "ACC_PUBLIC"},
+		{constant.FIELD_ACC_PRIVATE, "ACC_PRIVATE"},
+		{constant.FIELD_ACC_PROTECTED, "ACC_PROTECTED"},
+		{constant.FIELD_ACC_STATIC, "ACC_STATIC"},
+		{constant.FIELD_ACC_FINAL, "ACC_FINAL"},
+		{constant.FIELD_ACC_VOLATILE, "ACC_VOLATILE"},
+		{constant.FIELD_ACC_TRANSIENT, "ACC_TRANSIENT"},
+		{constant.FIELD_ACC_SYNTHETIC, "ACC_SYNTHETIC"},
+		{constant.FIELD_ACC_ENUM, "ACC_ENUM"},
+	}
+	methodFlagNames = []modifier{
+		{constant.METHOD_ACC_PUBLIC, "ACC_PUBLIC"},
+		{constant.METHOD_ACC_PRIVATE, "ACC_PRIVATE"},
+		{constant.METHOD_ACC_PROTECTED, "ACC_PROTECTED"},
+		{constant.METHOD_ACC_STATIC, "ACC_STATIC"},
+		{constant.METHOD_ACC_FINAL, "ACC_FINAL"},
+		{constant.METHOD_ACC_SYNCHRONIZED, "ACC_SYNCHRONIZED"},
+		{constant.METHOD_ACC_BRIDGE, "ACC_BRIDGE"},
+		{constant.METHOD_ACC_VARARGS, "ACC_VARARGS"},
+		{constant.METHOD_ACC_NATIVE, "ACC_NATIVE"},
+		{constant.METHOD_ACC_ABSTRACT, "ACC_ABSTRACT"},
+		{constant.METHOD_ACC_STRICT, "ACC_STRICT"},
+		{constant.METHOD_ACC_SYNTHETIC, "ACC_SYNTHETIC"},
+	}
+)
+
+func modifierNames(flags uint16, modifiers []modifier) []string {
+	var names []string
+	for _, m := range modifiers {
+		if flags&uint16(m.flag) != 0 {
+			names = append(names, m.name)
+		}
+	}
+	return names
+}
+
+func (w *classWriter) writeModifiers(names []string) {
+	for _, name := range names {
+		w.print(name + " ")
+	}
+}
+
+// writeFlags prints "flags: (0x0021) ACC_PUBLIC, ACC_SUPER".
+func (w *classWriter) writeFlags(flags uint16, names []modifier) {
+	list := modifierNames(flags, names)
+	rest := flags
+	for _, name := range names {
+		rest &^= uint16(name.flag)
+	}
+	if rest != 0 {
+		list = append(list, fmt.Sprintf("0x%x", rest))
+	}
+	w.println(fmt.Sprintf("flags: (0x%04x) ", flags) + strings.Join(list, ", "))
+}
+
+func (w *classWriter) isInterface() bool {
+	return w.class.AccessFlags&uint16(constant.CLASS_ACC_INTERFACE) != 0
+}
+
+// visible reports whether a member is shown: private members only with -p.
+func (w *classWriter) visible(flags uint16) bool {
+	return w.options.Private || flags&uint16(constant.METHOD_ACC_PRIVATE) == 0
+}
+
+func javaName(internalName string) string {
+	return strings.ReplaceAll(internalName, "/", ".")
+}
+
+func (w *classWriter) write() {
+	c := w.class
+	if w.options.Verbose {
+		if w.file != nil {
+			path, err := filepath.Abs(w.file.Path)
+			if err != nil {
+				path = w.file.Path
+			}
+			w.println("Classfile " + filepath.ToSlash(path))
+		}
+		w.indent(+1)
+		if w.file != nil {
+			w.println(fmt.Sprintf("Last modified %s; size %d bytes", w.file.Modified.Format("Jan 2, 2006"), len(w.file.Data)))
+			w.println(fmt.Sprintf("SHA-256 checksum %x", sha256.Sum256(w.file.Data)))
+		}
+	}
+	if source, ok := c.Attributes.Get("SourceFile").(*model.SourceFileAttributeInfo); ok {
+		w.println(`Compiled from "` + c.Utf8(source.SourceFileIndex) + `"`)
+	}
+	if w.options.Verbose {
+		w.indent(-1)
+	}
+
+	w.writeHeader()
+	if w.options.Verbose {
+		w.println()
+		w.indent(+1)
+		w.println(fmt.Sprintf("minor version: %d", c.MinorVersion))
+		w.println(fmt.Sprintf("major version: %d", c.MajorVersion))
+		w.writeFlags(c.AccessFlags, classFlagNames)
+		w.print(fmt.Sprintf("this_class: #%d", c.ThisClass))
+		if c.ThisClass != 0 {
+			w.tab()
+			w.print("// " + w.stringValue(c.ThisClass))
+		}
+		w.println()
+		w.print(fmt.Sprintf("super_class: #%d", c.SuperClass))
+		if c.SuperClass != 0 {
+			w.tab()
+			w.print("// " + w.stringValue(c.SuperClass))
+		}
+		w.println()
+		w.println(fmt.Sprintf("interfaces: %d, fields: %d, methods: %d, attributes: %d",
+			len(c.Interfaces), len(c.Fields), len(c.Methods), len(c.Attributes)))
+		w.indent(-1)
+		w.writeConstantPool()
+	} else {
+		w.print(" ")
+	}
+	w.println("{")
+	w.indent(+1)
+	for i := range c.Fields {
+		w.writeField(&c.Fields[i])
+	}
+	for i := range c.Methods {
+		w.writeMethod(&c.Methods[i])
+	}
+	w.indent(-1)
+	w.println("}")
+	if w.options.Verbose {
+		w.writeAttributes(c.Attributes, nil)
+	}
+}
+
+// writeHeader prints the class declaration, using the generic signature
+// when there is one.
+func (w *classWriter) writeHeader() {
+	c := w.class
+	flags := c.AccessFlags
+	if w.isInterface() {
+		flags &^= uint16(constant.CLASS_ACC_ABSTRACT)
+	}
+	w.writeModifiers(modifierNames(flags, classModifiers))
+	switch {
+	case c.AccessFlags&uint16(constant.CLASS_ACC_MODULE) != 0:
+		w.print("module ")
+	case w.isInterface():
+		w.print("interface ")
+	default:
+		w.print("class ")
+	}
+	w.print(javaName(c.ClassName(c.ThisClass)))
+	if signature, ok := c.Attributes.Get("Signature").(*model.SignatureAttributeInfo); ok {
+		if declaration, err := w.classSignature(c.Utf8(signature.SignatureIndex)); err == nil {
+			w.print(declaration)
+			return
+		}
+	}
+	if !w.isInterface() && c.SuperClass != 0 {
+		if super := javaName(c.ClassName(c.SuperClass)); super != "java.lang.Object" {
+			w.print(" extends " + super)
+		}
+	}
+	for i, index := range c.Interfaces {
+		switch {
+		case i > 0:
+			w.print(",")
+		case w.isInterface():
+			w.print(" extends ")
+		default:
+			w.print(" implements ")
+		}
+		w.print(javaName(c.ClassName(index)))
+	}
+}
+
+func (w *classWriter) separateMember() {
+	if w.pendingNewline {
+		w.println()
+		w.pendingNewline = false
+	}
+}
+
+func (w *classWriter) writeField(field *model.FieldInfo) {
+	if !w.visible(field.AccessFlags) {
+		return
+	}
+	c := w.class
+	w.separateMember()
+	w.writeModifiers(modifierNames(field.AccessFlags, fieldModifiers))
+	descriptor := c.Utf8(field.DescriptorIndex)
+	fieldType := model.JavaTypeName(descriptor)
+	if signature, ok := field.Attributes.Get("Signature").(*model.SignatureAttributeInfo); ok {
+		if t, err := w.fieldSignature(c.Utf8(signature.SignatureIndex)); err == nil {
+			fieldType = t
+		}
+	}
+	w.println(fieldType + " " + c.Utf8(field.NameIndex) + ";")
+	w.indent(+1)
+	if w.options.Signatures {
+		w.println("descriptor: " + descriptor)
+	}
+	if w.options.Verbose {
+		w.writeFlags(field.AccessFlags, fieldFlagNames)
+		w.writeAttributes(field.Attributes, nil)
+	}
+	w.indent(-1)
+	w.pendingNewline = w.options.Signatures || w.options.Verbose
+}
+
+func (w *classWriter) writeMethod(method *model.MethodInfo) {
+	if !w.visible(method.AccessFlags) {
+		return
+	}
+	c := w.class
+	w.separateMember()
+	name := c.Utf8(method.NameIndex)
+	descriptor := c.Utf8(method.DescriptorIndex)
+	flags := method.AccessFlags
+
+	modifiers := modifierNames(flags, methodModifiers)
+	if w.isInterface() && flags&uint16(constant.METHOD_ACC_ABSTRACT) == 0 && name != "<clinit>" &&
+		c.MajorVersion >= 52 && flags&uint16(constant.METHOD_ACC_STATIC|constant.METHOD_ACC_PRIVATE) == 0 {
+		modifiers = append(modifiers, "default")
+	}
+	w.writeModifiers(modifiers)
+
+	var typeParameters, returnType string
+	var parameters, throws []string
+	if signature, ok := method.Attributes.Get("Signature").(*model.SignatureAttributeInfo); ok {
+		m, err := w.methodSignature(c.Utf8(signature.SignatureIndex))
+		if err == nil {
+			typeParameters, parameters, returnType, throws = m.typeParameters, m.parameters, m.returnType, m.throws
+		}
+	}
+	if returnType == "" {
+		descriptorParameters, descriptorReturn, _ := model.ParseMethodDescriptor(descriptor)
+		parameters = nil
+		for _, parameter := range descriptorParameters {
+			parameters = append(parameters, model.JavaTypeName(parameter))
+		}
+		returnType = model.JavaTypeName(descriptorReturn)
+	}
+	if flags&uint16(constant.METHOD_ACC_VARARGS) != 0 && len(parameters) > 0 {
+		last := parameters[len(parameters)-1]
+		if strings.HasSuffix(last, "[]") {
+			parameters[len(parameters)-1] = strings.TrimSuffix(last, "[]") + "..."
+		}
+	}
+	if typeParameters != "" {
+		w.print(typeParameters + " ")
+	}
+	switch name {
+	case "<init>":
+		w.print(javaName(c.ClassName(c.ThisClass)) + "(" + strings.Join(parameters, ", ") + ")")
+	case "<clinit>":
+		w.print("{}")
+	default:
+		w.print(returnType + " " + name + "(" + strings.Join(parameters, ", ") + ")")
+	}
+	if exceptions, ok := method.Attributes.Get("Exceptions").(*model.ExceptionsAttributeInfo); ok {
+		if throws == nil {
+			for _, index := range exceptions.ExceptionIndexTable {
+				throws = append(throws, javaName(c.ClassName(index)))
+			}
+		}
+		w.print(" throws " + strings.Join(throws, ", "))
+	}
+	w.println(";")
+
+	w.indent(+1)
+	if w.options.Signatures {
+		w.println("descriptor: " + descriptor)
+	}
+	if w.options.Verbose {
+		w.writeFlags(flags, methodFlagNames)
+		w.writeAttributes(method.Attributes, method)
+	} else if code, ok := method.Attributes.Get("Code").(*model.CodeAttributeInfo); ok {
+		if w.options.Code {
+			w.println("Code:")
+			w.writeInstructions(code)
+			w.writeExceptionTable(code)
+		}
+		if w.options.Lines {
+			for _, name := range []string{"LineNumberTable", "LocalVariableTable"} {
+				for _, attribute := range code.Attributes {
+					if attribute.Name == name {
+						w.writeAttribute(attribute, nil)
+					}
+				}
+			}
+		}
+	}
+	w.indent(-1)
+	w.pendingNewline = w.options.Code || w.options.Verbose || w.options.Signatures || w.options.Lines
+}
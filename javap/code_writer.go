@@ -0,0 +1,110 @@
+package javap
+
+import (
+	"fmt"
+	"outro/constant"
+	"outro/interpreter"
+	"outro/model"
+)
+
+var arrayTypeNames = map[uint8]string{
+	4: "boolean", 5: "char", 6: "float", 7: "double",
+	8: "byte", 9: "short", 10: "int", 11: "long",
+}
+
+// writeInstructions prints the code of a method, one instruction a line
+// with constant pool operands resolved in comments.
+func (w *classWriter) writeInstructions(code *model.CodeAttributeInfo) {
+	instructions, err := interpreter.Decode(code.Code)
+	for i := range instructions {
+		w.writeInstruction(&instructions[i])
+	}
+	if err != nil {
+		w.println("Error: " + err.Error())
+	}
+}
+
+func (w *classWriter) writeInstruction(in *interpreter.Instruction) {
+	name := interpreter.InstructDisplayNameMap[in.Opcode]
+	if in.Wide {
+		name += "_w"
+	}
+	w.print(fmt.Sprintf("%4d: %-13s ", in.Offset, name))
+	switch op := in.Opcode; {
+	case op == interpreter.BIPUSH || op == interpreter.SIPUSH:
+		w.print(fmt.Sprint(in.Const))
+	case op == interpreter.NEWARRAY:
+		w.print(" " + arrayTypeNames[in.ArrayType])
+	case op == interpreter.IINC:
+		w.print(fmt.Sprintf("%d, %d", in.Local, in.Const))
+	case op >= interpreter.ILOAD && op <= interpreter.ALOAD,
+		op >= interpreter.ISTORE && op <= interpreter.ASTORE,
+		op == interpreter.RET:
+		w.print(fmt.Sprint(in.Local))
+	case op >= interpreter.IFEQ && op <= interpreter.JSR, op == interpreter.IFNULL, op == interpreter.IFNONNULL,
+		op == interpreter.GOTO_W, op == interpreter.JSR_W:
+		w.print(fmt.Sprint(in.Target))
+	case op == interpreter.INVOKEINTERFACE || op == interpreter.INVOKEDYNAMIC || op == interpreter.MULTIANEWARRAY:
+		w.print(fmt.Sprintf("#%d,  %d", in.Index, in.Count))
+		w.tab()
+		w.print("// ")
+		w.writeConstant(uint16(in.Index))
+	case op == interpreter.LDC, op == interpreter.LDC_W, op == interpreter.LDC2_W,
+		op >= interpreter.GETSTATIC && op <= interpreter.INVOKESTATIC,
+		op == interpreter.NEW, op == interpreter.ANEWARRAY, op == interpreter.CHECKCAST, op == interpreter.INSTANCEOF:
+		w.print(fmt.Sprintf("#%d", in.Index))
+		w.tab()
+		w.print("// ")
+		w.writeConstant(uint16(in.Index))
+	case op == interpreter.TABLESWITCH || op == interpreter.LOOKUPSWITCH:
+		if op == interpreter.TABLESWITCH {
+			low, high := 0, -1
+			if len(in.Keys) > 0 {
+				low, high = int(in.Keys[0]), int(in.Keys[len(in.Keys)-1])
+			}
+			w.print(fmt.Sprintf("{ // %d to %d", low, high))
+		} else {
+			w.print(fmt.Sprintf("{ // %d", len(in.Keys)))
+		}
+		w.indent(+3)
+		for i, key := range in.Keys {
+			w.print(fmt.Sprintf("\n%12d: %d", key, in.Targets[i]))
+		}
+		w.print(fmt.Sprintf("\n     default: %d\n}", in.Target))
+		w.indent(-3)
+	}
+	w.println()
+}
+
+func (w *classWriter) writeExceptionTable(code *model.CodeAttributeInfo) {
+	if len(code.ExceptionTable) == 0 {
+		return
+	}
+	w.println("Exception table:")
+	w.indent(+1)
+	w.println(" from    to  target type")
+	for _, handler := range code.ExceptionTable {
+		w.print(fmt.Sprintf(" %5d %5d %5d", handler.StartPC, handler.EndPC, handler.HandlerPC))
+		w.print("   ")
+		if handler.CatchType == 0 {
+			w.println("any")
+		} else {
+			w.println("Class " + w.stringValue(handler.CatchType))
+		}
+	}
+	w.indent(-1)
+}
+
+// argsSize is the number of local variable slots taken by the receiver and
+// parameters of method.
+func (w *classWriter) argsSize(method *model.MethodInfo) int {
+	size := 0
+	if method.AccessFlags&uint16(constant.METHOD_ACC_STATIC) == 0 {
+		size++
+	}
+	parameters, _, _ := model.ParseMethodDescriptor(w.class.Utf8(method.DescriptorIndex))
+	for _, parameter := range parameters {
+		size += model.FieldTypeSlots(parameter)
+	}
+	return size
+}
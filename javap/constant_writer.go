@@ -0,0 +1,252 @@
+package javap
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"outro/constant"
+	"outro/model"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+var poolTagNames = map[uint8]string{
+	constant.ConstantUtf8:               "Utf8",
+	constant.ConstantInteger:            "Integer",
+	constant.ConstantFloat:              "Float",
+	constant.ConstantLong:               "Long",
+	constant.ConstantDouble:             "Double",
+	constant.ConstantClass:              "Class",
+	constant.ConstantString:             "String",
+	constant.ConstantFieldRef:           "Fieldref",
+	constant.ConstantMethodRef:          "Methodref",
+	constant.ConstantInterfaceMethodRef: "InterfaceMethodref",
+	constant.ConstantNameAndType:        "NameAndType",
+	constant.ConstantMethodHandle:       "MethodHandle",
+	constant.ConstantMethodType:         "MethodType",
+	constant.ConstantDynamic:            "Dynamic",
+	constant.ConstantInvokeDynamic:      "InvokeDynamic",
+	constant.ConstantModule:             "Module",
+	constant.ConstantPackage:            "Package",
+}
+
+// commentTagNames are the names used for constants in comments.
+var commentTagNames = map[uint8]string{
+	constant.ConstantUtf8:               "Utf8",
+	constant.ConstantInteger:            "int",
+	constant.ConstantFloat:              "float",
+	constant.ConstantLong:               "long",
+	constant.ConstantDouble:             "double",
+	constant.ConstantClass:              "class",
+	constant.ConstantString:             "String",
+	constant.ConstantFieldRef:           "Field",
+	constant.ConstantMethodRef:          "Method",
+	constant.ConstantInterfaceMethodRef: "InterfaceMethod",
+	constant.ConstantNameAndType:        "NameAndType",
+	constant.ConstantMethodHandle:       "MethodHandle",
+	constant.ConstantMethodType:         "MethodType",
+	constant.ConstantDynamic:            "Dynamic",
+	constant.ConstantInvokeDynamic:      "InvokeDynamic",
+	constant.ConstantModule:             "Module",
+	constant.ConstantPackage:            "Package",
+}
+
+var referenceKindNames = map[uint8]string{
+	constant.RefGetField:         "REF_getField",
+	constant.RefGetStatic:        "REF_getStatic",
+	constant.RefPutField:         "REF_putField",
+	constant.RefPutStatic:        "REF_putStatic",
+	constant.RefInvokeVirtual:    "REF_invokeVirtual",
+	constant.RefInvokeStatic:     "REF_invokeStatic",
+	constant.RefInvokeSpecial:    "REF_invokeSpecial",
+	constant.RefNewInvokeSpecial: "REF_newInvokeSpecial",
+	constant.RefInvokeInterface:  "REF_invokeInterface",
+}
+
+func (w *classWriter) entry(index uint16) (*model.ConstantInfo, bool) {
+	if index == 0 || int(index) >= len(w.class.ConstantPool) || w.class.ConstantPool[index].Tag == 0 {
+		return nil, false
+	}
+	return &w.class.ConstantPool[index], true
+}
+
+// u2 returns the i-th two-byte index of the entry's body.
+func u2(entry *model.ConstantInfo, i int) uint16 {
+	if len(entry.Info) < 2*i+2 {
+		return 0
+	}
+	return binary.BigEndian.Uint16(entry.Info[2*i:])
+}
+
+func (w *classWriter) writeConstantPool() {
+	w.println("Constant pool:")
+	w.indent(+1)
+	pool := w.class.ConstantPool
+	width := len(strconv.Itoa(len(pool))) + 1
+	for i := 1; i < len(pool); i++ {
+		entry := &pool[i]
+		if entry.Tag == 0 {
+			// the unusable slot after a long or double
+			continue
+		}
+		w.print(fmt.Sprintf("%*s = %-18s ", width, fmt.Sprintf("#%d", i), poolTagNames[entry.Tag]))
+		switch entry.Tag {
+		case constant.ConstantUtf8, constant.ConstantInteger, constant.ConstantFloat, constant.ConstantLong, constant.ConstantDouble:
+			w.println(w.stringValue(uint16(i)))
+			continue
+		case constant.ConstantClass, constant.ConstantString, constant.ConstantModule, constant.ConstantPackage:
+			w.print(fmt.Sprintf("#%d", u2(entry, 0)))
+		case constant.ConstantFieldRef, constant.ConstantMethodRef, constant.ConstantInterfaceMethodRef:
+			w.print(fmt.Sprintf("#%d.#%d", u2(entry, 0), u2(entry, 1)))
+		case constant.ConstantNameAndType, constant.ConstantDynamic, constant.ConstantInvokeDynamic:
+			w.print(fmt.Sprintf("#%d:#%d", u2(entry, 0), u2(entry, 1)))
+		case constant.ConstantMethodHandle:
+			w.print(fmt.Sprintf("%d:#%d", entry.Info[0], binary.BigEndian.Uint16(entry.Info[1:])))
+		case constant.ConstantMethodType:
+			w.print(fmt.Sprintf("#%d", u2(entry, 0)))
+			w.tab()
+			// javap puts two spaces after the slashes of method types.
+			w.println("//  " + w.stringValue(uint16(i)))
+			continue
+		}
+		w.tab()
+		w.println("// " + w.stringValue(uint16(i)))
+	}
+	w.indent(-1)
+}
+
+// writeConstant prints a constant as in a comment, "Method add:(II)I",
+// leaving out the class of members of this class.
+func (w *classWriter) writeConstant(index uint16) {
+	entry, ok := w.entry(index)
+	if !ok {
+		w.print(fmt.Sprintf("#%d", index))
+		return
+	}
+	value := w.stringValue(index)
+	switch entry.Tag {
+	case constant.ConstantFieldRef, constant.ConstantMethodRef, constant.ConstantInterfaceMethodRef:
+		if u2(entry, 0) == w.class.ThisClass {
+			value = w.stringValue(u2(entry, 1))
+		}
+	}
+	w.print(commentTagNames[entry.Tag] + " " + value)
+}
+
+// stringValue renders the constant at index the way javap does in the
+// constant pool listing.
+func (w *classWriter) stringValue(index uint16) string {
+	entry, ok := w.entry(index)
+	if !ok {
+		return fmt.Sprintf("#%d", index)
+	}
+	switch entry.Tag {
+	case constant.ConstantUtf8:
+		return escape(entry.Utf8)
+	case constant.ConstantInteger:
+		return strconv.Itoa(int(int32(binary.BigEndian.Uint32(entry.Info))))
+	case constant.ConstantFloat:
+		return javaFloat(float64(math.Float32frombits(binary.BigEndian.Uint32(entry.Info))), 32) + "f"
+	case constant.ConstantLong:
+		return strconv.FormatInt(int64(binary.BigEndian.Uint64(entry.Info)), 10) + "l"
+	case constant.ConstantDouble:
+		return javaFloat(math.Float64frombits(binary.BigEndian.Uint64(entry.Info)), 64) + "d"
+	case constant.ConstantClass, constant.ConstantModule, constant.ConstantPackage:
+		return checkName(w.class.Utf8(u2(entry, 0)))
+	case constant.ConstantString:
+		return escape(w.class.Utf8(u2(entry, 0)))
+	case constant.ConstantFieldRef, constant.ConstantMethodRef, constant.ConstantInterfaceMethodRef:
+		return w.stringValue(u2(entry, 0)) + "." + w.stringValue(u2(entry, 1))
+	case constant.ConstantNameAndType:
+		return checkName(w.class.Utf8(u2(entry, 0))) + ":" + escape(w.class.Utf8(u2(entry, 1)))
+	case constant.ConstantMethodHandle:
+		return referenceKindNames[entry.Info[0]] + " " + w.stringValue(binary.BigEndian.Uint16(entry.Info[1:]))
+	case constant.ConstantMethodType:
+		return escape(w.class.Utf8(u2(entry, 0)))
+	case constant.ConstantDynamic, constant.ConstantInvokeDynamic:
+		return fmt.Sprintf("#%d:%s", u2(entry, 0), w.stringValue(u2(entry, 1)))
+	}
+	return fmt.Sprintf("(unknown tag %d)", entry.Tag)
+}
+
+// escape writes control characters, quotes and backslashes as Java escapes.
+func escape(s string) string {
+	var sb strings.Builder
+	for _, c := range s {
+		switch c {
+		case '\t':
+			sb.WriteString(`\t`)
+		case '\n':
+			sb.WriteString(`\n`)
+		case '\r':
+			sb.WriteString(`\r`)
+		case '\b':
+			sb.WriteString(`\b`)
+		case '\f':
+			sb.WriteString(`\f`)
+		case '"':
+			sb.WriteString(`\"`)
+		case '\'':
+			sb.WriteString(`\'`)
+		case '\\':
+			sb.WriteString(`\\`)
+		default:
+			if unicode.IsControl(c) {
+				fmt.Fprintf(&sb, `\u%04x`, c)
+			} else {
+				sb.WriteRune(c)
+			}
+		}
+	}
+	return sb.String()
+}
+
+// checkName quotes names that are not slash-separated Java identifiers,
+// such as "<init>" and array descriptors.
+func checkName(name string) string {
+	if name == "" {
+		return `""`
+	}
+	previous := '/'
+	for _, c := range name {
+		start := unicode.IsLetter(c) || c == '$' || c == '_'
+		part := start || unicode.IsDigit(c)
+		if (previous == '/' && !start) || (c != '/' && !part) {
+			return `"` + escape(name) + `"`
+		}
+		previous = c
+	}
+	return name
+}
+
+// javaFloat formats f like Java's Double.toString and Float.toString.
+func javaFloat(f float64, bitSize int) string {
+	switch {
+	case math.IsNaN(f):
+		return "NaN"
+	case math.IsInf(f, 1):
+		return "Infinity"
+	case math.IsInf(f, -1):
+		return "-Infinity"
+	case f == 0:
+		if math.Signbit(f) {
+			return "-0.0"
+		}
+		return "0.0"
+	}
+	if abs := math.Abs(f); abs >= 1e-3 && abs < 1e7 {
+		s := strconv.FormatFloat(f, 'f', -1, bitSize)
+		if !strings.Contains(s, ".") {
+			s += ".0"
+		}
+		return s
+	}
+	s := strconv.FormatFloat(f, 'e', -1, bitSize)
+	mantissa, exponent, _ := strings.Cut(s, "e")
+	if !strings.Contains(mantissa, ".") {
+		mantissa += ".0"
+	}
+	exp, _ := strconv.Atoi(exponent)
+	return mantissa + "E" + strconv.Itoa(exp)
+}
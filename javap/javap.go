@@ -0,0 +1,105 @@
+// Package javap prints class files in the format of the JDK's javap, so the
+// output of the two can be diffed.
+package javap
+
+import (
+	"io"
+	"outro/model"
+	"strings"
+	"time"
+)
+
+// Options selects what is printed, after the javap options of the same
+// letter.
+type Options struct {
+	// Code (-c) disassembles the code of each method.
+	Code bool
+	// Verbose (-v) prints the constant pool, flags and all attributes.
+	Verbose bool
+	// Private (-p) includes private members.
+	Private bool
+	// Lines (-l) prints line number and local variable tables.
+	Lines bool
+	// Signatures (-s) prints internal type signatures.
+	Signatures bool
+}
+
+// File describes the class file for the header of verbose output.
+type File struct {
+	Path     string
+	Modified time.Time
+	Data     []byte
+}
+
+// Write prints class as javap would. file may be nil when the class was
+// not read from a file.
+func Write(out io.Writer, class *model.ClassFile, file *File, options Options) error {
+	if options.Verbose {
+		options.Code, options.Lines, options.Signatures = true, true, true
+	}
+	w := &classWriter{printer: &printer{}, class: class, file: file, options: options}
+	w.write()
+	_, err := io.WriteString(out, w.printer.String())
+	return err
+}
+
+const (
+	indentWidth = 2
+	tabColumn   = 40
+)
+
+// printer writes indented lines like javap's LineWriter: spaces are held
+// back until something follows them on the line, so lines never end in
+// spaces, and tab pads to a column relative to the indentation.
+type printer struct {
+	out           strings.Builder
+	line          strings.Builder
+	indentCount   int
+	pendingSpaces int
+}
+
+func (p *printer) print(s string) {
+	for _, c := range s {
+		switch c {
+		case ' ':
+			p.pendingSpaces++
+		case '\n':
+			p.println()
+		default:
+			if p.line.Len() == 0 {
+				p.line.WriteString(strings.Repeat(" ", p.indentCount*indentWidth))
+			}
+			p.line.WriteString(strings.Repeat(" ", p.pendingSpaces))
+			p.pendingSpaces = 0
+			p.line.WriteRune(c)
+		}
+	}
+}
+
+func (p *printer) println(s ...string) {
+	for _, part := range s {
+		p.print(part)
+	}
+	p.pendingSpaces = 0
+	p.out.WriteString(p.line.String())
+	p.out.WriteByte('\n')
+	p.line.Reset()
+}
+
+func (p *printer) indent(delta int) {
+	p.indentCount += delta
+}
+
+// tab moves to the comment column, leaving at least one space.
+func (p *printer) tab() {
+	column := p.indentCount*indentWidth + tabColumn
+	if column <= p.line.Len() {
+		p.pendingSpaces++
+	} else {
+		p.pendingSpaces += column - p.line.Len()
+	}
+}
+
+func (p *printer) String() string {
+	return p.out.String()
+}
@@ -0,0 +1,209 @@
+package javap
+
+import (
+	"fmt"
+	"outro/model"
+	"strings"
+)
+
+// signatureReader renders generic signatures (JVMS 4.7.9.1) as Java
+// source types.
+type signatureReader struct {
+	s       string
+	pos     int
+	verbose bool
+	err     error
+}
+
+type methodSignature struct {
+	typeParameters string
+	parameters     []string
+	returnType     string
+	throws         []string
+}
+
+// classSignature renders the type parameters, superclass and interfaces of
+// a class signature, as they follow the class name.
+func (w *classWriter) classSignature(signature string) (string, error) {
+	r := &signatureReader{s: signature, verbose: w.options.Verbose}
+	declaration := r.typeParameters()
+	super := r.javaType()
+	var interfaces []string
+	for r.pos < len(r.s) {
+		interfaces = append(interfaces, r.javaType())
+	}
+	if r.err != nil {
+		return "", r.err
+	}
+	if w.isInterface() {
+		if len(interfaces) > 0 {
+			declaration += " extends " + strings.Join(interfaces, ", ")
+		}
+		return declaration, nil
+	}
+	if w.options.Verbose || super != "java.lang.Object" {
+		declaration += " extends " + super
+	}
+	if len(interfaces) > 0 {
+		declaration += " implements " + strings.Join(interfaces, ", ")
+	}
+	return declaration, nil
+}
+
+func (w *classWriter) methodSignature(signature string) (*methodSignature, error) {
+	r := &signatureReader{s: signature, verbose: w.options.Verbose}
+	m := &methodSignature{typeParameters: r.typeParameters()}
+	r.expect('(')
+	for r.err == nil && r.peek() != ')' {
+		m.parameters = append(m.parameters, r.javaType())
+	}
+	r.expect(')')
+	m.returnType = r.javaType()
+	for r.peek() == '^' {
+		r.pos++
+		m.throws = append(m.throws, r.javaType())
+	}
+	r.end()
+	if r.err != nil {
+		return nil, r.err
+	}
+	return m, nil
+}
+
+func (w *classWriter) fieldSignature(signature string) (string, error) {
+	r := &signatureReader{s: signature, verbose: w.options.Verbose}
+	t := r.javaType()
+	r.end()
+	return t, r.err
+}
+
+func (r *signatureReader) fail() {
+	if r.err == nil {
+		r.err = fmt.Errorf("invalid signature %q at offset %d", r.s, r.pos)
+	}
+	r.pos = len(r.s)
+}
+
+func (r *signatureReader) peek() byte {
+	if r.pos < len(r.s) {
+		return r.s[r.pos]
+	}
+	return 0
+}
+
+func (r *signatureReader) expect(c byte) {
+	if r.peek() != c {
+		r.fail()
+		return
+	}
+	r.pos++
+}
+
+func (r *signatureReader) end() {
+	if r.pos != len(r.s) {
+		r.fail()
+	}
+}
+
+// identifier reads up to the next of the stop characters.
+func (r *signatureReader) identifier(stops string) string {
+	start := r.pos
+	for r.pos < len(r.s) && !strings.ContainsRune(stops, rune(r.s[r.pos])) {
+		r.pos++
+	}
+	if r.pos == start {
+		r.fail()
+	}
+	return r.s[start:r.pos]
+}
+
+// typeParameters renders "<T extends java.lang.Number, U>", leaving out
+// Object bounds unless verbose.
+func (r *signatureReader) typeParameters() string {
+	if r.peek() != '<' {
+		return ""
+	}
+	r.pos++
+	var parameters []string
+	for r.err == nil && r.peek() != '>' {
+		parameter := r.identifier(":>")
+		r.expect(':')
+		separator := " extends "
+		if c := r.peek(); c == 'L' || c == 'T' || c == '[' {
+			if bound := r.javaType(); r.verbose || bound != "java.lang.Object" {
+				parameter += separator + bound
+				separator = " & "
+			}
+		}
+		for r.peek() == ':' {
+			r.pos++
+			parameter += separator + r.javaType()
+			separator = " & "
+		}
+		parameters = append(parameters, parameter)
+	}
+	r.expect('>')
+	return "<" + strings.Join(parameters, ", ") + ">"
+}
+
+func (r *signatureReader) javaType() string {
+	switch c := r.peek(); c {
+	case 'B', 'C', 'D', 'F', 'I', 'J', 'S', 'Z', 'V':
+		r.pos++
+		return model.JavaTypeName(string(c))
+	case 'L':
+		return r.classType()
+	case 'T':
+		r.pos++
+		name := r.identifier(";")
+		r.expect(';')
+		return name
+	case '[':
+		r.pos++
+		return r.javaType() + "[]"
+	}
+	r.fail()
+	return ""
+}
+
+// classType renders a class type with its type arguments, including those
+// of enclosing classes: "java.util.Map$Entry" or "Outer<T>.Inner".
+func (r *signatureReader) classType() string {
+	r.expect('L')
+	var sb strings.Builder
+	for r.err == nil {
+		sb.WriteString(javaName(r.identifier(".;<")))
+		if r.peek() == '<' {
+			sb.WriteString(r.typeArguments())
+		}
+		if r.peek() != '.' {
+			break
+		}
+		r.pos++
+		sb.WriteByte('.')
+	}
+	r.expect(';')
+	return sb.String()
+}
+
+func (r *signatureReader) typeArguments() string {
+	r.expect('<')
+	var arguments []string
+	for r.err == nil && r.peek() != '>' {
+		switch r.peek() {
+		case '*':
+			r.pos++
+			arguments = append(arguments, "?")
+		case '+':
+			r.pos++
+			arguments = append(arguments, "? extends "+r.javaType())
+		case '-':
+			r.pos++
+			arguments = append(arguments, "? super "+r.javaType())
+		default:
+			arguments = append(arguments, r.javaType())
+		}
+	}
+	r.expect('>')
+	return "<" + strings.Join(arguments, ", ") + ">"
+}
@@ -0,0 +1,271 @@
+// Package launcher parses the java-style command line of outro and sets up
+// the class loader and main class it describes.
+package launcher
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"outro/interpreter"
+	"outro/rtda"
+	"outro/verifier"
+	"sort"
+	"strings"
+)
+
+// Options are the launcher options of the java command that outro
+// understands.
+type Options struct {
+	ClassPath  string
+	ModulePath string
+	// Module is the value of --module, <module>[/<mainclass>].
+	Module     string
+	MainClass  string
+	AddModules []string
+	AddExports []string
+	AddOpens   []string
+	// Verify is the -Xverify mode: none, remote or all. The JDK leaves
+	// classes of the boot class path unverified under remote, the default;
+	// outro loads every class through the application class loader, so
+	// remote verifies as much as all.
+	Verify string
+	// Trace is the -Xtrace setting, <format>[:<pattern>]: off, text or
+	// json, for the methods interpreter.FilterTracer matches with pattern.
+	Trace string
+	// JavaAgents are the values of -javaagent, <jarpath>[=<options>].
+	JavaAgents []string
+	Args       []string
+}
+
+// Agent is a Java agent given by -javaagent.
+type Agent struct {
+	// Class is the Premain-Class of the agent jar.
+	Class   *rtda.Class
+	Options string
+}
+
+// verifyModes are the values -Xverify takes.
+var verifyModes = map[string]bool{"none": true, "remote": true, "all": true}
+
+// traceFormats are the formats -Xtrace takes.
+var traceFormats = map[string]bool{"off": true, "text": true, "json": true}
+
+// ParseOptions parses the command line up to the main class or module;
+// everything after it is passed to the application.
+func ParseOptions(args []string) (*Options, error) {
+	options := &Options{Verify: "remote", Trace: "off"}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if !strings.HasPrefix(arg, "-") {
+			options.MainClass = arg
+			options.Args = args[i+1:]
+			return options, nil
+		}
+		if strings.HasPrefix(arg, "-Xverify:") {
+			mode := strings.TrimPrefix(arg, "-Xverify:")
+			if !verifyModes[mode] {
+				return nil, fmt.Errorf("invalid -Xverify mode: %s", mode)
+			}
+			options.Verify = mode
+			continue
+		}
+		if arg == "-Xtrace" || strings.HasPrefix(arg, "-Xtrace:") {
+			options.Trace = "text"
+			if arg != "-Xtrace" {
+				options.Trace = strings.TrimPrefix(arg, "-Xtrace:")
+			}
+			if _, err := options.NewTracer(io.Discard); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if strings.HasPrefix(arg, "-javaagent:") {
+			options.JavaAgents = append(options.JavaAgents, strings.TrimPrefix(arg, "-javaagent:"))
+			continue
+		}
+		name, value, hasValue := strings.Cut(arg, "=")
+		if !strings.HasPrefix(name, "--") {
+			name, value, hasValue = arg, "", false
+		}
+		target := options.option(name)
+		if target == nil {
+			return nil, fmt.Errorf("unrecognized option: %s", arg)
+		}
+		if !hasValue {
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("%s requires an argument", name)
+			}
+			i++
+			value = args[i]
+		}
+		target(value)
+		if options.Module != "" {
+			options.Args = args[i+1:]
+			return options, nil
+		}
+	}
+	return options, nil
+}
+
+// option returns the setter of a named option that takes a value.
+func (o *Options) option(name string) func(value string) {
+	switch name {
+	case "-cp", "-classpath", "--class-path":
+		return func(value string) { o.ClassPath = value }
+	case "-p", "--module-path":
+		return func(value string) { o.ModulePath = value }
+	case "-m", "--module":
+		return func(value string) { o.Module = value }
+	case "--add-modules":
+		return func(value string) { o.AddModules = append(o.AddModules, strings.Split(value, ",")...) }
+	case "--add-exports":
+		return func(value string) { o.AddExports = append(o.AddExports, value) }
+	case "--add-opens":
+		return func(value string) { o.AddOpens = append(o.AddOpens, value) }
+	}
+	return nil
+}
+
+// NewClassLoader resolves the module graph from the root modules and
+// returns a loader over it and the class path that verifies the classes
+// it loads unless -Xverify:none was given.
+func (o *Options) NewClassLoader() (*rtda.ApplicationClassLoader, error) {
+	classPath := o.ClassPath
+	if classPath == "" && o.Module == "" {
+		classPath = "."
+	}
+	entries, err := rtda.ParseClassPath(classPath)
+	if err != nil {
+		return nil, err
+	}
+	graph := rtda.NewModuleGraph()
+	roots := o.rootModules()
+	if o.ModulePath != "" || len(roots) > 0 {
+		observable, err := rtda.FindModules(o.ModulePath)
+		if err != nil {
+			return nil, err
+		}
+		roots = expandAllModulePath(roots, observable)
+		if graph, err = rtda.ResolveModules(observable, roots); err != nil {
+			return nil, err
+		}
+	}
+	for _, value := range o.AddExports {
+		if err := graph.AddExports(value, false); err != nil {
+			return nil, err
+		}
+	}
+	for _, value := range o.AddOpens {
+		if err := graph.AddExports(value, true); err != nil {
+			return nil, err
+		}
+	}
+	loader := rtda.NewModularClassLoader(entries, graph)
+	if o.Verify != "none" {
+		loader.SetVerifier(verifier.New(loader))
+	}
+	return loader, nil
+}
+
+func (o *Options) rootModules() []string {
+	var roots []string
+	if o.Module != "" {
+		name, _, _ := strings.Cut(o.Module, "/")
+		roots = append(roots, name)
+	}
+	return append(roots, o.AddModules...)
+}
+
+func expandAllModulePath(roots []string, observable map[string]*rtda.Module) []string {
+	var expanded []string
+	for _, root := range roots {
+		if root != "ALL-MODULE-PATH" {
+			expanded = append(expanded, root)
+			continue
+		}
+		var names []string
+		for name := range observable {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		expanded = append(expanded, names...)
+	}
+	return expanded
+}
+
+// NewTracer returns the tracer -Xtrace asks for, writing to w, or nil if
+// tracing is off.
+func (o *Options) NewTracer(w io.Writer) (interpreter.Tracer, error) {
+	format, pattern, filtered := strings.Cut(o.Trace, ":")
+	if !traceFormats[format] {
+		return nil, fmt.Errorf("invalid -Xtrace format: %s", format)
+	}
+	var tracer interpreter.Tracer
+	switch format {
+	case "off":
+		return nil, nil
+	case "text":
+		tracer = interpreter.NewTextTracer(w)
+	case "json":
+		tracer = interpreter.NewJSONTracer(w)
+	}
+	if filtered {
+		return interpreter.FilterTracer(tracer, pattern)
+	}
+	return tracer, nil
+}
+
+// LoadAgents appends the jar of every -javaagent to the class path and
+// loads its Premain-Class.
+func (o *Options) LoadAgents(loader *rtda.ApplicationClassLoader) ([]Agent, error) {
+	var agents []Agent
+	for _, value := range o.JavaAgents {
+		path, options, _ := strings.Cut(value, "=")
+		entry, err := rtda.NewClassPathEntry(path)
+		if err != nil {
+			return nil, err
+		}
+		premainClass := rtda.ManifestAttribute(entry, "Premain-Class")
+		if premainClass == "" {
+			return nil, fmt.Errorf("failed to find Premain-Class manifest attribute in %s", path)
+		}
+		loader.AppendClassPath(entry)
+		class, err := loader.LoadClass(strings.ReplaceAll(premainClass, ".", "/"))
+		if err != nil {
+			return nil, err
+		}
+		agents = append(agents, Agent{Class: class, Options: options})
+	}
+	return agents, nil
+}
+
+// LoadMainClass loads the main class named on the command line, or the
+// main class of the --module module.
+func (o *Options) LoadMainClass(loader *rtda.ApplicationClassLoader) (*rtda.Class, error) {
+	if o.Module == "" {
+		if o.MainClass == "" {
+			return nil, errors.New("no main class given")
+		}
+		name := o.MainClass
+		if !strings.HasSuffix(name, ".class") {
+			name = strings.ReplaceAll(name, ".", "/")
+		}
+		return loader.LoadClass(name)
+	}
+	moduleName, mainClass, _ := strings.Cut(o.Module, "/")
+	module := loader.Modules().Modules[moduleName]
+	if mainClass == "" {
+		if module.Descriptor == nil || module.Descriptor.MainClass == "" {
+			return nil, fmt.Errorf("module %s does not have a ModuleMainClass attribute, use -m <module>/<main-class>", moduleName)
+		}
+		mainClass = module.Descriptor.MainClass
+	}
+	class, err := loader.LoadClass(strings.ReplaceAll(mainClass, ".", "/"))
+	if err != nil {
+		return nil, err
+	}
+	if class.Module != module {
+		return nil, fmt.Errorf("java.lang.module.FindException: Class %s not found in module %s", mainClass, moduleName)
+	}
+	return class, nil
+}
@@ -1,26 +1,51 @@
 package main
 
 import (
+	"fmt"
+	"os"
 	"outro/interpreter"
+	"outro/launcher"
 	"outro/rtda"
+	"outro/tool"
 )
 
 func main() {
-	// read class file from java/Main.class
-	// parse class file
+	if len(os.Args) > 1 {
+		if command, ok := tool.Commands[os.Args[1]]; ok {
+			if err := command(os.Args[2:], os.Stdout); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+	options, err := launcher.ParseOptions(os.Args[1:])
+	checkErr(err)
+	if options.MainClass == "" && options.Module == "" {
+		options.MainClass = "java/classes/HelloWorld.class"
+	}
+	// resolve modules and the class path
+	// run the premain of every agent
+	// load the main class
 	// create a new thread
 	// create a new frame
 	// push the frame to the thread
 	// execute the frame
-	loader := rtda.NewApplicationClassLoader()
-	class, err := loader.LoadClass("java/classes/HelloWorld.class")
+	loader, err := options.NewClassLoader()
+	checkErr(err)
+	tracer, err := options.NewTracer(os.Stderr)
+	checkErr(err)
+	jvm := interpreter.JVM{Thread: rtda.NewThread(), Loader: loader, Tracer: tracer}
+	agents, err := options.LoadAgents(loader)
+	checkErr(err)
+	for _, agent := range agents {
+		checkErr(jvm.RunPremain(agent.Class, agent.Options))
+	}
+	class, err := options.LoadMainClass(loader)
 	checkErr(err)
 	mainMethod, err := class.GetMainMethod()
 	checkErr(err)
-	thread := rtda.NewThread()
-	thread.NewFrame(mainMethod)
-	jvm := interpreter.JVM{}
-	jvm.Thread = thread
+	jvm.Thread.NewFrame(mainMethod)
 	jvm.Execute()
 }
 
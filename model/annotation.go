@@ -0,0 +1,171 @@
+package model
+
+import (
+	"encoding/binary"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// AnnotationString renders an annotation as it would be written in Java
+// source, e.g. @java.lang.Deprecated(since="9", forRemoval=true).
+func (c *ClassFile) AnnotationString(annotation *AnnotationInfo) string {
+	var sb strings.Builder
+	sb.WriteByte('@')
+	sb.WriteString(JavaTypeName(c.Utf8(annotation.TypeIndex)))
+	pairs := annotation.ElementValuePairs
+	if len(pairs) == 0 {
+		return sb.String()
+	}
+	sb.WriteByte('(')
+	if len(pairs) == 1 && c.Utf8(pairs[0].ElementNameIndex) == "value" {
+		sb.WriteString(c.ElementValueString(&pairs[0].Value))
+	} else {
+		for i := range pairs {
+			if i > 0 {
+				sb.WriteString(", ")
+			}
+			sb.WriteString(c.Utf8(pairs[i].ElementNameIndex))
+			sb.WriteByte('=')
+			sb.WriteString(c.ElementValueString(&pairs[i].Value))
+		}
+	}
+	sb.WriteByte(')')
+	return sb.String()
+}
+
+// ElementValueString renders an annotation element value as a Java
+// expression.
+func (c *ClassFile) ElementValueString(value *ElementValue) string {
+	switch value.Tag {
+	case 'B':
+		return "(byte)" + strconv.Itoa(int(int8(c.integerConstant(value.ConstValueIndex))))
+	case 'S':
+		return "(short)" + strconv.Itoa(int(int16(c.integerConstant(value.ConstValueIndex))))
+	case 'C':
+		return quoteJava(string(rune(uint16(c.integerConstant(value.ConstValueIndex)))), '\'')
+	case 'I':
+		return strconv.Itoa(int(int32(c.integerConstant(value.ConstValueIndex))))
+	case 'Z':
+		return strconv.FormatBool(c.integerConstant(value.ConstValueIndex) != 0)
+	case 'J':
+		return strconv.FormatInt(int64(c.longConstant(value.ConstValueIndex)), 10) + "L"
+	case 'F':
+		return floatString(float64(math.Float32frombits(c.integerConstant(value.ConstValueIndex))), "Float", 32)
+	case 'D':
+		return floatString(math.Float64frombits(c.longConstant(value.ConstValueIndex)), "Double", 64)
+	case 's':
+		return quoteJava(c.Utf8(value.ConstValueIndex), '"')
+	case 'e':
+		return JavaTypeName(c.Utf8(value.TypeNameIndex)) + "." + c.Utf8(value.ConstNameIndex)
+	case 'c':
+		return JavaTypeName(c.Utf8(value.ClassInfoIndex)) + ".class"
+	case '@':
+		return c.AnnotationString(value.AnnotationValue)
+	case '[':
+		elements := make([]string, len(value.ArrayValue))
+		for i := range value.ArrayValue {
+			elements[i] = c.ElementValueString(&value.ArrayValue[i])
+		}
+		return "{" + strings.Join(elements, ", ") + "}"
+	}
+	return "?"
+}
+
+// JavaTypeName converts a field or return descriptor to Java source syntax:
+// "Ljava/lang/String;" becomes "java.lang.String" and "[I" becomes "int[]".
+func JavaTypeName(descriptor string) string {
+	dimensions := 0
+	for dimensions < len(descriptor) && descriptor[dimensions] == '[' {
+		dimensions++
+	}
+	name := descriptor[dimensions:]
+	switch name {
+	case "B":
+		name = "byte"
+	case "C":
+		name = "char"
+	case "D":
+		name = "double"
+	case "F":
+		name = "float"
+	case "I":
+		name = "int"
+	case "J":
+		name = "long"
+	case "S":
+		name = "short"
+	case "Z":
+		name = "boolean"
+	case "V":
+		name = "void"
+	default:
+		name = strings.ReplaceAll(strings.TrimSuffix(strings.TrimPrefix(name, "L"), ";"), "/", ".")
+	}
+	return name + strings.Repeat("[]", dimensions)
+}
+
+func (c *ClassFile) integerConstant(index uint16) uint32 {
+	if int(index) >= len(c.ConstantPool) || len(c.ConstantPool[index].Info) != 4 {
+		return 0
+	}
+	return binary.BigEndian.Uint32(c.ConstantPool[index].Info)
+}
+
+func (c *ClassFile) longConstant(index uint16) uint64 {
+	if int(index) >= len(c.ConstantPool) || len(c.ConstantPool[index].Info) != 8 {
+		return 0
+	}
+	return binary.BigEndian.Uint64(c.ConstantPool[index].Info)
+}
+
+func floatString(f float64, class string, bitSize int) string {
+	switch {
+	case math.IsNaN(f):
+		return class + ".NaN"
+	case math.IsInf(f, 1):
+		return class + ".POSITIVE_INFINITY"
+	case math.IsInf(f, -1):
+		return class + ".NEGATIVE_INFINITY"
+	}
+	s := strconv.FormatFloat(f, 'g', -1, bitSize)
+	if !strings.ContainsAny(s, ".e") {
+		s += ".0"
+	}
+	if bitSize == 32 {
+		s += "f"
+	}
+	return s
+}
+
+func quoteJava(s string, quote byte) string {
+	var sb strings.Builder
+	sb.WriteByte(quote)
+	for _, r := range s {
+		switch r {
+		case '\\':
+			sb.WriteString(`\\`)
+		case '\n':
+			sb.WriteString(`\n`)
+		case '\t':
+			sb.WriteString(`\t`)
+		case '\r':
+			sb.WriteString(`\r`)
+		case '\b':
+			sb.WriteString(`\b`)
+		case '\f':
+			sb.WriteString(`\f`)
+		case rune(quote):
+			sb.WriteByte('\\')
+			sb.WriteByte(quote)
+		default:
+			if r < 0x20 || r == 0x7f {
+				sb.WriteString(`\u` + strconv.FormatInt(int64(r)|0x10000, 16)[1:])
+			} else {
+				sb.WriteRune(r)
+			}
+		}
+	}
+	sb.WriteByte(quote)
+	return sb.String()
+}
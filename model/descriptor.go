@@ -0,0 +1,72 @@
+package model
+
+import "fmt"
+
+// https://docs.oracle.com/javase/specs/jvms/se8/html/jvms-4.html#jvms-4.3
+
+// ParseFieldType returns the length of the field descriptor at the start of s.
+func ParseFieldType(s string) (int, error) {
+	dimensions := 0
+	for dimensions < len(s) && s[dimensions] == '[' {
+		dimensions++
+	}
+	if dimensions > 255 {
+		return 0, fmt.Errorf("array type %q has more than 255 dimensions", s)
+	}
+	if dimensions == len(s) {
+		return 0, fmt.Errorf("invalid field descriptor %q", s)
+	}
+	switch s[dimensions] {
+	case 'B', 'C', 'D', 'F', 'I', 'J', 'S', 'Z':
+		return dimensions + 1, nil
+	case 'L':
+		for i := dimensions + 1; i < len(s); i++ {
+			switch s[i] {
+			case ';':
+				if i == dimensions+1 {
+					return 0, fmt.Errorf("empty class name in field descriptor %q", s)
+				}
+				return i + 1, nil
+			case '.', '[':
+				return 0, fmt.Errorf("invalid class name in field descriptor %q", s)
+			}
+		}
+	}
+	return 0, fmt.Errorf("invalid field descriptor %q", s)
+}
+
+// ParseMethodDescriptor splits a method descriptor into its parameter field
+// descriptors and its return descriptor, which is "V" for void methods.
+func ParseMethodDescriptor(descriptor string) (parameters []string, returnType string, err error) {
+	if len(descriptor) == 0 || descriptor[0] != '(' {
+		return nil, "", fmt.Errorf("invalid method descriptor %q", descriptor)
+	}
+	i := 1
+	for i < len(descriptor) && descriptor[i] != ')' {
+		n, err := ParseFieldType(descriptor[i:])
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid method descriptor %q", descriptor)
+		}
+		parameters = append(parameters, descriptor[i:i+n])
+		i += n
+	}
+	if i >= len(descriptor) {
+		return nil, "", fmt.Errorf("invalid method descriptor %q", descriptor)
+	}
+	returnType = descriptor[i+1:]
+	if returnType != "V" {
+		if n, err := ParseFieldType(returnType); err != nil || n != len(returnType) {
+			return nil, "", fmt.Errorf("invalid method descriptor %q", descriptor)
+		}
+	}
+	return parameters, returnType, nil
+}
+
+// FieldTypeSlots returns the number of local variable or operand stack slots
+// taken by a value of the given field type: 2 for long and double, else 1.
+func FieldTypeSlots(fieldType string) int {
+	if fieldType == "J" || fieldType == "D" {
+		return 2
+	}
+	return 1
+}
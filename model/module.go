@@ -0,0 +1,119 @@
+package model
+
+import (
+	"errors"
+	"outro/constant"
+	"strings"
+)
+
+// ModuleDescriptor is the Module, ModulePackages and ModuleMainClass
+// attributes of a module-info class with every constant pool reference
+// resolved. Package and class names use the binary (dotted) form.
+type ModuleDescriptor struct {
+	Name      string
+	Flags     uint16
+	Version   string
+	Requires  []ModuleRequires
+	Exports   []ModuleExports
+	Opens     []ModuleExports
+	Uses      []string
+	Provides  []ModuleProvides
+	Packages  []string
+	MainClass string
+}
+
+type ModuleRequires struct {
+	Name    string
+	Flags   uint16
+	Version string
+}
+
+// ModuleExports is an exports or opens directive. To is empty for an
+// unqualified directive.
+type ModuleExports struct {
+	Package string
+	Flags   uint16
+	To      []string
+}
+
+type ModuleProvides struct {
+	Service string
+	With    []string
+}
+
+// IsOpen reports whether the module is declared as an open module.
+func (m *ModuleDescriptor) IsOpen() bool {
+	return m.Flags&uint16(constant.MODULE_ACC_OPEN) != 0
+}
+
+// ModuleDescriptor resolves the module attributes of a module-info class.
+func (c *ClassFile) ModuleDescriptor() (*ModuleDescriptor, error) {
+	attribute, ok := c.Attributes.Get("Module").(*ModuleAttributeInfo)
+	if !ok {
+		return nil, errors.New("java.lang.module.InvalidModuleDescriptorException: Module attribute not found")
+	}
+	module := &attribute.ModuleInfo
+	descriptor := &ModuleDescriptor{
+		Name:    c.ModuleName(module.ModuleNameIndex),
+		Flags:   module.ModuleFlags,
+		Version: c.Utf8(module.ModuleVersionIndex),
+	}
+	for _, requires := range module.Requires {
+		descriptor.Requires = append(descriptor.Requires, ModuleRequires{
+			Name:    c.ModuleName(requires.RequiresIndex),
+			Flags:   requires.RequiresFlags,
+			Version: c.Utf8(requires.RequiresVersion),
+		})
+	}
+	for _, exports := range module.Exports {
+		descriptor.Exports = append(descriptor.Exports, ModuleExports{
+			Package: binaryName(c.PackageName(exports.ExportsIndex)),
+			Flags:   exports.ExportsFlags,
+			To:      c.moduleNames(exports.ExportsToIndex),
+		})
+	}
+	for _, opens := range module.Opens {
+		descriptor.Opens = append(descriptor.Opens, ModuleExports{
+			Package: binaryName(c.PackageName(opens.OpensIndex)),
+			Flags:   opens.OpensFlags,
+			To:      c.moduleNames(opens.OpensToIndex),
+		})
+	}
+	for _, uses := range module.Uses {
+		descriptor.Uses = append(descriptor.Uses, binaryName(c.ClassName(uses.UsesIndex)))
+	}
+	for _, provides := range module.Provides {
+		with := make([]string, len(provides.ProvidesWithIndex))
+		for i, index := range provides.ProvidesWithIndex {
+			with[i] = binaryName(c.ClassName(index))
+		}
+		descriptor.Provides = append(descriptor.Provides, ModuleProvides{
+			Service: binaryName(c.ClassName(provides.ProvidesIndex)),
+			With:    with,
+		})
+	}
+	if packages, ok := c.Attributes.Get("ModulePackages").(*ModulePackagesAttributeInfo); ok {
+		for _, index := range packages.PackageIndex {
+			descriptor.Packages = append(descriptor.Packages, binaryName(c.PackageName(index)))
+		}
+	}
+	if mainClass, ok := c.Attributes.Get("ModuleMainClass").(*ModuleMainClassAttributeInfo); ok {
+		descriptor.MainClass = binaryName(c.ClassName(mainClass.MainClassIndex))
+	}
+	return descriptor, nil
+}
+
+func (c *ClassFile) moduleNames(indexes []uint16) []string {
+	if len(indexes) == 0 {
+		return nil
+	}
+	names := make([]string, len(indexes))
+	for i, index := range indexes {
+		names[i] = c.ModuleName(index)
+	}
+	return names
+}
+
+func binaryName(internalName string) string {
+	return strings.ReplaceAll(internalName, "/", ".")
+}
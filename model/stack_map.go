@@ -0,0 +1,127 @@
+package model
+
+import (
+	"fmt"
+	"outro/constant"
+)
+
+// https://docs.oracle.com/javase/specs/jvms/se8/html/jvms-4.html#jvms-4.7.4
+
+// VerificationTypeInfo is one entry of a stack map frame. Long and Double
+// entries stand for two local variable or operand stack slots.
+type VerificationTypeInfo struct {
+	Tag uint8
+	// CpoolIndex is the CONSTANT_Class entry of an Object type and ClassName
+	// its resolved name. Types derived from a method descriptor have a
+	// ClassName but no CpoolIndex.
+	CpoolIndex uint16
+	ClassName  string
+	// Offset is the offset of the new instruction that created an
+	// Uninitialized value.
+	Offset uint16
+}
+
+// StackMapFrame is a frame as encoded in the attribute. For append frames
+// Locals holds the appended locals; for full frames it holds all of them.
+type StackMapFrame struct {
+	FrameType   uint8
+	OffsetDelta uint16
+	Locals      []VerificationTypeInfo
+	Stack       []VerificationTypeInfo
+}
+
+// StackMapFrameState is a frame expanded against the frames before it: the
+// complete locals and operand stack at bytecode offset Offset.
+type StackMapFrameState struct {
+	Offset uint16
+	Locals []VerificationTypeInfo
+	Stack  []VerificationTypeInfo
+}
+
+type StackMapTableAttributeInfo struct {
+	AttributeNameIndex uint16
+	AttributeLength    uint32
+	NumberOfEntries    uint16
+	Entries            []StackMapFrame
+	// Frames holds Entries expanded into absolute offsets.
+	Frames []StackMapFrameState
+}
+
+// ChopCount returns how many locals a chop frame removes.
+func (f StackMapFrame) ChopCount() int {
+	return int(constant.SameFrameExtended - f.FrameType)
+}
+
+// InitialFrameLocals returns the implicit frame at offset 0 of a method: the
+// receiver, if any, followed by the parameter types of the descriptor.
+func InitialFrameLocals(className, methodName, descriptor string, static bool) ([]VerificationTypeInfo, error) {
+	parameters, _, err := ParseMethodDescriptor(descriptor)
+	if err != nil {
+		return nil, err
+	}
+	var locals []VerificationTypeInfo
+	if !static {
+		if methodName == "<init>" && className != "java/lang/Object" {
+			locals = append(locals, VerificationTypeInfo{Tag: constant.ItemUninitializedThis})
+		} else {
+			locals = append(locals, VerificationTypeInfo{Tag: constant.ItemObject, ClassName: className})
+		}
+	}
+	for _, parameter := range parameters {
+		locals = append(locals, FieldTypeVerificationType(parameter))
+	}
+	return locals, nil
+}
+
+// FieldTypeVerificationType returns the verification type of a value of the
+// given field type.
+func FieldTypeVerificationType(fieldType string) VerificationTypeInfo {
+	switch fieldType[0] {
+	case 'B', 'C', 'I', 'S', 'Z':
+		return VerificationTypeInfo{Tag: constant.ItemInteger}
+	case 'F':
+		return VerificationTypeInfo{Tag: constant.ItemFloat}
+	case 'J':
+		return VerificationTypeInfo{Tag: constant.ItemLong}
+	case 'D':
+		return VerificationTypeInfo{Tag: constant.ItemDouble}
+	case 'L':
+		return VerificationTypeInfo{Tag: constant.ItemObject, ClassName: fieldType[1 : len(fieldType)-1]}
+	default:
+		return VerificationTypeInfo{Tag: constant.ItemObject, ClassName: fieldType}
+	}
+}
+
+// ExpandStackMapFrames resolves each entry against the previous frame,
+// starting from the method's initial locals, and computes absolute offsets.
+func ExpandStackMapFrames(initialLocals []VerificationTypeInfo, entries []StackMapFrame) ([]StackMapFrameState, error) {
+	frames := make([]StackMapFrameState, len(entries))
+	locals := initialLocals
+	offset := -1
+	for i, entry := range entries {
+		offset += int(entry.OffsetDelta) + 1
+		if offset > 0xFFFF {
+			return nil, fmt.Errorf("stack map frame %d has offset %d beyond the code", i, offset)
+		}
+		switch {
+		case entry.FrameType < constant.SameLocals1StackItemFrame,
+			entry.FrameType == constant.SameFrameExtended:
+		case entry.FrameType < 128,
+			entry.FrameType == constant.SameLocals1StackItemFrameExtended:
+		case entry.FrameType >= constant.ChopFrame && entry.FrameType < constant.SameFrameExtended:
+			k := entry.ChopCount()
+			if k > len(locals) {
+				return nil, fmt.Errorf("stack map frame %d chops %d of %d locals", i, k, len(locals))
+			}
+			locals = locals[:len(locals)-k]
+		case entry.FrameType >= constant.AppendFrame && entry.FrameType < constant.FullFrame:
+			locals = append(append([]VerificationTypeInfo{}, locals...), entry.Locals...)
+		case entry.FrameType == constant.FullFrame:
+			locals = entry.Locals
+		default:
+			return nil, fmt.Errorf("stack map frame %d has reserved frame type %d", i, entry.FrameType)
+		}
+		frames[i] = StackMapFrameState{Offset: uint16(offset), Locals: locals, Stack: entry.Stack}
+	}
+	return frames, nil
+}
@@ -0,0 +1,167 @@
+package parser
+
+import (
+	"outro/constant"
+	"outro/model"
+)
+
+// https://docs.oracle.com/javase/specs/jvms/se8/html/jvms-4.html#jvms-4.7.16
+
+func (p *ClassFileParser) parseAnnotations() []model.AnnotationInfo {
+	numAnnotations := p.reader.ReadUint16()
+	annotations := make([]model.AnnotationInfo, numAnnotations)
+	for i := range annotations {
+		annotations[i] = p.parseAnnotation()
+	}
+	return annotations
+}
+
+func (p *ClassFileParser) parseParameterAnnotations() []model.ParameterAnnotationInfo {
+	numParameters := p.reader.ReadUint8()
+	parameterAnnotations := make([]model.ParameterAnnotationInfo, numParameters)
+	for i := range parameterAnnotations {
+		parameterAnnotations[i] = model.ParameterAnnotationInfo{Annotations: p.parseAnnotations()}
+	}
+	return parameterAnnotations
+}
+
+func (p *ClassFileParser) parseAnnotation() model.AnnotationInfo {
+	typeIndex := p.reader.ReadUint16()
+	numElementValuePairs := p.reader.ReadUint16()
+	return model.AnnotationInfo{
+		TypeIndex:            typeIndex,
+		NumElementValuePairs: numElementValuePairs,
+		ElementValuePairs:    p.parseElementValuePairs(numElementValuePairs),
+	}
+}
+
+func (p *ClassFileParser) parseElementValuePairs(count uint16) []model.ElementValuePair {
+	pairs := make([]model.ElementValuePair, count)
+	for i := range pairs {
+		pairs[i] = model.ElementValuePair{
+			ElementNameIndex: p.reader.ReadUint16(),
+			Value:            p.parseElementValue(),
+		}
+	}
+	return pairs
+}
+
+// maxElementValueDepth bounds the nesting of arrays and annotations in
+// element values, so crafted input cannot exhaust the stack.
+const maxElementValueDepth = 256
+
+func (p *ClassFileParser) parseElementValue() model.ElementValue {
+	offset := p.reader.Offset()
+	value := model.ElementValue{Tag: p.reader.ReadUint8()}
+	if p.elementValueDepth >= maxElementValueDepth {
+		p.reader.Fail(offset, "element values nested deeper than %d", maxElementValueDepth)
+		return value
+	}
+	p.elementValueDepth++
+	defer func() { p.elementValueDepth-- }()
+	switch value.Tag {
+	case 'B', 'C', 'D', 'F', 'I', 'J', 'S', 'Z', 's':
+		value.ConstValueIndex = p.reader.ReadUint16()
+	case 'e':
+		value.TypeNameIndex = p.reader.ReadUint16()
+		value.ConstNameIndex = p.reader.ReadUint16()
+	case 'c':
+		value.ClassInfoIndex = p.reader.ReadUint16()
+	case '@':
+		annotation := p.parseAnnotation()
+		value.AnnotationValue = &annotation
+	case '[':
+		numValues := p.reader.ReadUint16()
+		value.ArrayValue = make([]model.ElementValue, numValues)
+		for i := range value.ArrayValue {
+			value.ArrayValue[i] = p.parseElementValue()
+		}
+	default:
+		p.reader.Fail(offset, "invalid element value tag %q", value.Tag)
+	}
+	return value
+}
+
+// https://docs.oracle.com/javase/specs/jvms/se8/html/jvms-4.html#jvms-4.7.20
+
+func (p *ClassFileParser) parseTypeAnnotations() []model.TypeAnnotationInfo {
+	numAnnotations := p.reader.ReadUint16()
+	annotations := make([]model.TypeAnnotationInfo, numAnnotations)
+	for i := range annotations {
+		annotations[i] = p.parseTypeAnnotation()
+	}
+	return annotations
+}
+
+func (p *ClassFileParser) parseTypeAnnotation() model.TypeAnnotationInfo {
+	targetType := p.reader.ReadUint8()
+	targetInfo := p.parseTargetInfo(targetType)
+	targetPath := p.parseTypePath()
+	typeIndex := p.reader.ReadUint16()
+	numElementValuePairs := p.reader.ReadUint16()
+	return model.TypeAnnotationInfo{
+		TargetType:           targetType,
+		TargetInfo:           targetInfo,
+		TargetPath:           targetPath,
+		TypeIndex:            typeIndex,
+		NumElementValuePairs: numElementValuePairs,
+		ElementValuePairs:    p.parseElementValuePairs(numElementValuePairs),
+	}
+}
+
+func (p *ClassFileParser) parseTargetInfo(targetType uint8) model.TargetInfo {
+	var info model.TargetInfo
+	switch targetType {
+	case constant.TargetClassTypeParameter, constant.TargetMethodTypeParameter:
+		info.TypeParameterIndex = p.reader.ReadUint8()
+	case constant.TargetClassExtends:
+		info.SupertypeIndex = p.reader.ReadUint16()
+	case constant.TargetClassTypeParameterBound, constant.TargetMethodTypeParameterBound:
+		info.TypeParameterIndex = p.reader.ReadUint8()
+		info.BoundIndex = p.reader.ReadUint8()
+	case constant.TargetField, constant.TargetMethodReturn, constant.TargetMethodReceiver:
+	case constant.TargetMethodFormalParameter:
+		info.FormalParameterIndex = p.reader.ReadUint8()
+	case constant.TargetThrows:
+		info.ThrowsTypeIndex = p.reader.ReadUint16()
+	case constant.TargetLocalVariable, constant.TargetResourceVariable:
+		tableLength := p.reader.ReadUint16()
+		info.Table = make([]model.LocalVarTargetInfo, tableLength)
+		for i := range info.Table {
+			info.Table[i] = model.LocalVarTargetInfo{
+				StartPC: p.reader.ReadUint16(),
+				Length:  p.reader.ReadUint16(),
+				Index:   p.reader.ReadUint16(),
+			}
+		}
+	case constant.TargetExceptionParameter:
+		info.ExceptionTableIndex = p.reader.ReadUint16()
+	case constant.TargetInstanceof, constant.TargetNew,
+		constant.TargetConstructorReference, constant.TargetMethodReference:
+		info.Offset = p.reader.ReadUint16()
+	case constant.TargetCast,
+		constant.TargetConstructorInvocationTypeArgument, constant.TargetMethodInvocationTypeArgument,
+		constant.TargetConstructorReferenceTypeArgument, constant.TargetMethodReferenceTypeArgument:
+		info.Offset = p.reader.ReadUint16()
+		info.TypeArgumentIndex = p.reader.ReadUint8()
+	default:
+		p.reader.Fail(p.reader.Offset()-1, "invalid type annotation target type %#x", targetType)
+	}
+	return info
+}
+
+func (p *ClassFileParser) parseTypePath() []model.TypePathEntry {
+	pathLength := p.reader.ReadUint8()
+	path := make([]model.TypePathEntry, pathLength)
+	for i := range path {
+		offset := p.reader.Offset()
+		path[i] = model.TypePathEntry{
+			TypePathKind:      p.reader.ReadUint8(),
+			TypeArgumentIndex: p.reader.ReadUint8(),
+		}
+		if path[i].TypePathKind > constant.TypePathTypeArgument {
+			p.reader.Fail(offset, "invalid type path kind %d", path[i].TypePathKind)
+		}
+	}
+	return path
+}
@@ -0,0 +1,473 @@
+package parser
+
+import (
+	"outro/constant"
+	"outro/model"
+)
+
+// https://docs.oracle.com/javase/specs/jvms/se8/html/jvms-4.html#jvms-4.7
+
+// parseAttributeValue decodes the body of the attribute called name into its
+// typed model. Unknown attributes are skipped and yield nil; their bytes are
+// kept in AttributeInfo.Info.
+func (p *ClassFileParser) parseAttributeValue(name string, attributeNameIndex uint16, attributeLength uint32) interface{} {
+	switch name {
+	case "ConstantValue":
+		return &model.ConstantValueAttributeInfo{
+			AttributeNameIndex: attributeNameIndex,
+			AttributeLength:    attributeLength,
+			ConstantValueIndex: p.reader.ReadUint16(),
+		}
+	case "Code":
+		return p.parseCodeAttributeInfo(attributeNameIndex, attributeLength)
+	case "Exceptions":
+		numberOfExceptions := p.reader.ReadUint16()
+		return &model.ExceptionsAttributeInfo{
+			AttributeNameIndex:  attributeNameIndex,
+			AttributeLength:     attributeLength,
+			NumberOfExceptions:  numberOfExceptions,
+			ExceptionIndexTable: p.parseIndexes(numberOfExceptions),
+		}
+	case "InnerClasses":
+		return p.parseInnerClassesAttributeInfo(attributeNameIndex, attributeLength)
+	case "EnclosingMethod":
+		return &model.EnclosingMethodAttributeInfo{
+			AttributeNameIndex: attributeNameIndex,
+			AttributeLength:    attributeLength,
+			ClassIndex:         p.reader.ReadUint16(),
+			MethodIndex:        p.reader.ReadUint16(),
+		}
+	case "Synthetic":
+		return &model.SyntheticAttributeInfo{
+			AttributeNameIndex: attributeNameIndex,
+			AttributeLength:    attributeLength,
+		}
+	case "Signature":
+		return &model.SignatureAttributeInfo{
+			AttributeNameIndex: attributeNameIndex,
+			AttributeLength:    attributeLength,
+			SignatureIndex:     p.reader.ReadUint16(),
+		}
+	case "SourceFile":
+		return &model.SourceFileAttributeInfo{
+			AttributeNameIndex: attributeNameIndex,
+			AttributeLength:    attributeLength,
+			SourceFileIndex:    p.reader.ReadUint16(),
+		}
+	case "SourceDebugExtension":
+		return &model.SourceDebugExtensionAttributeInfo{
+			AttributeNameIndex: attributeNameIndex,
+			AttributeLength:    attributeLength,
+			DebugExtension:     p.reader.ReadBytes(attributeLength),
+		}
+	case "LineNumberTable":
+		return p.parseLineNumberTableAttributeInfo(attributeNameIndex, attributeLength)
+	case "LocalVariableTable":
+		return p.parseLocalVariableAttributeInfo(attributeNameIndex, attributeLength)
+	case "LocalVariableTypeTable":
+		return p.parseLocalVariableTypeTableAttributeInfo(attributeNameIndex, attributeLength)
+	case "Deprecated":
+		return &model.DeprecatedAttributeInfo{
+			AttributeNameIndex: attributeNameIndex,
+			AttributeLength:    attributeLength,
+		}
+	case "BootstrapMethods":
+		return p.parseBootstrapMethodsAttributeInfo(attributeNameIndex, attributeLength)
+	case "MethodParameters":
+		return p.parseMethodParametersAttributeInfo(attributeNameIndex, attributeLength)
+	case "Module":
+		return &model.ModuleAttributeInfo{
+			AttributeNameIndex: attributeNameIndex,
+			AttributeLength:    attributeLength,
+			ModuleInfo:         p.parseModuleInfo(),
+		}
+	case "ModulePackages":
+		packageCount := p.reader.ReadUint16()
+		return &model.ModulePackagesAttributeInfo{
+			AttributeNameIndex: attributeNameIndex,
+			AttributeLength:    attributeLength,
+			PackageCount:       packageCount,
+			PackageIndex:       p.parseIndexes(packageCount),
+		}
+	case "ModuleMainClass":
+		return &model.ModuleMainClassAttributeInfo{
+			AttributeNameIndex: attributeNameIndex,
+			AttributeLength:    attributeLength,
+			MainClassIndex:     p.reader.ReadUint16(),
+		}
+	case "NestHost":
+		return &model.NestHostAttributeInfo{
+			AttributeNameIndex: attributeNameIndex,
+			AttributeLength:    attributeLength,
+			ClassIndex:         p.reader.ReadUint16(),
+		}
+	case "NestMembers":
+		numberOfClasses := p.reader.ReadUint16()
+		return &model.NestMembersAttributeInfo{
+			AttributeNameIndex: attributeNameIndex,
+			AttributeLength:    attributeLength,
+			NumberOfClasses:    numberOfClasses,
+			Classes:            p.parseIndexes(numberOfClasses),
+		}
+	case "PermittedSubclasses":
+		numberOfClasses := p.reader.ReadUint16()
+		return &model.PermittedSubclassesAttributeInfo{
+			AttributeNameIndex: attributeNameIndex,
+			AttributeLength:    attributeLength,
+			NumberOfClasses:    numberOfClasses,
+			Classes:            p.parseIndexes(numberOfClasses),
+		}
+	case "Record":
+		return p.parseRecordAttributeInfo(attributeNameIndex, attributeLength)
+	case "StackMapTable":
+		return p.parseStackMapTableAttributeInfo(attributeNameIndex, attributeLength)
+	case "RuntimeVisibleAnnotations":
+		return &model.RuntimeVisibleAnnotationsAttributeInfo{
+			AttributeNameIndex: attributeNameIndex,
+			AttributeLength:    attributeLength,
+			Annotations:        p.parseAnnotations(),
+		}
+	case "RuntimeInvisibleAnnotations":
+		return &model.RuntimeInvisibleAnnotationsAttributeInfo{
+			AttributeNameIndex: attributeNameIndex,
+			AttributeLength:    attributeLength,
+			Annotations:        p.parseAnnotations(),
+		}
+	case "RuntimeVisibleParameterAnnotations":
+		return &model.RuntimeVisibleParameterAnnotationsAttributeInfo{
+			AttributeNameIndex:   attributeNameIndex,
+			AttributeLength:      attributeLength,
+			ParameterAnnotations: p.parseParameterAnnotations(),
+		}
+	case "RuntimeInvisibleParameterAnnotations":
+		return &model.RuntimeInvisibleParameterAnnotationsAttributeInfo{
+			AttributeNameIndex:   attributeNameIndex,
+			AttributeLength:      attributeLength,
+			ParameterAnnotations: p.parseParameterAnnotations(),
+		}
+	case "RuntimeVisibleTypeAnnotations":
+		return &model.RuntimeVisibleTypeAnnotationsAttributeInfo{
+			AttributeNameIndex: attributeNameIndex,
+			AttributeLength:    attributeLength,
+			Annotations:        p.parseTypeAnnotations(),
+		}
+	case "RuntimeInvisibleTypeAnnotations":
+		return &model.RuntimeInvisibleTypeAnnotationsAttributeInfo{
+			AttributeNameIndex: attributeNameIndex,
+			AttributeLength:    attributeLength,
+			Annotations:        p.parseTypeAnnotations(),
+		}
+	case "AnnotationDefault":
+		return &model.AnnotationDefaultAttributeInfo{
+			AttributeNameIndex: attributeNameIndex,
+			AttributeLength:    attributeLength,
+			Default:            p.parseElementValue(),
+		}
+	default:
+		p.reader.ReadBytes(uint32(p.reader.Remaining()))
+		return nil
+	}
+}
+
+func (p *ClassFileParser) parseIndexes(count uint16) []uint16 {
+	indexes := make([]uint16, count)
+	for i := range indexes {
+		indexes[i] = p.reader.ReadUint16()
+	}
+	return indexes
+}
+
+func (p *ClassFileParser) parseCodeAttributeInfo(attributeNameIndex uint16, attributeLength uint32) *model.CodeAttributeInfo {
+	maxStack := p.reader.ReadUint16()
+	maxLocals := p.reader.ReadUint16()
+	offset := p.reader.Offset()
+	codeLength := p.reader.ReadUint32()
+	if p.reader.Err() == nil && (codeLength == 0 || codeLength > 65535) {
+		p.reader.Fail(offset, "invalid code length %d", codeLength)
+	}
+	code := p.reader.ReadBytes(codeLength)
+	exceptionTableLength := p.reader.ReadUint16()
+	exceptionTable := make([]model.ExceptionTable, exceptionTableLength)
+	for i := range exceptionTable {
+		exceptionTable[i] = p.parseExceptionTable()
+	}
+	attributesCount := p.reader.ReadUint16()
+	return &model.CodeAttributeInfo{
+		AttributeNameIndex:   attributeNameIndex,
+		AttributeLength:      attributeLength,
+		MaxStack:             maxStack,
+		MaxLocals:            maxLocals,
+		CodeLength:           codeLength,
+		Code:                 code,
+		ExceptionTableLength: exceptionTableLength,
+		ExceptionTable:       exceptionTable,
+		AttributesCount:      attributesCount,
+		Attributes:           p.parseAttributes(attributesCount),
+	}
+}
+
+func (p *ClassFileParser) parseExceptionTable() model.ExceptionTable {
+	return model.ExceptionTable{
+		StartPC:   p.reader.ReadUint16(),
+		EndPC:     p.reader.ReadUint16(),
+		HandlerPC: p.reader.ReadUint16(),
+		CatchType: p.reader.ReadUint16(),
+	}
+}
+
+func (p *ClassFileParser) parseInnerClassesAttributeInfo(attributeNameIndex uint16, attributeLength uint32) *model.InnerClassesAttributeInfo {
+	numberOfClasses := p.reader.ReadUint16()
+	classes := make([]model.InnerClassInfo, numberOfClasses)
+	for i := range classes {
+		classes[i] = model.InnerClassInfo{
+			InnerClassInfoIndex:       p.reader.ReadUint16(),
+			OuterClassInfoIndex:       p.reader.ReadUint16(),
+			InnerNameIndex:            p.reader.ReadUint16(),
+			InnerClassAccessFlagsInfo: p.reader.ReadUint16(),
+		}
+	}
+	return &model.InnerClassesAttributeInfo{
+		AttributeNameIndex: attributeNameIndex,
+		AttributeLength:    attributeLength,
+		NumberOfClasses:    numberOfClasses,
+		Classes:            classes,
+	}
+}
+
+func (p *ClassFileParser) parseLineNumberTableAttributeInfo(attributeNameIndex uint16, attributeLength uint32) *model.LineNumberTableAttributeInfo {
+	lineNumberTableLength := p.reader.ReadUint16()
+	lineNumberTable := make([]model.LineNumberTable, lineNumberTableLength)
+	for i := range lineNumberTable {
+		lineNumberTable[i] = model.LineNumberTable{
+			StartPC:    p.reader.ReadUint16(),
+			LineNumber: p.reader.ReadUint16(),
+		}
+	}
+	return &model.LineNumberTableAttributeInfo{
+		AttributeNameIndex:   attributeNameIndex,
+		AttributeLength:      attributeLength,
+		LineNumberTable:      lineNumberTable,
+		LineNumberTableCount: lineNumberTableLength,
+	}
+}
+
+func (p *ClassFileParser) parseLocalVariableAttributeInfo(attributeNameIndex uint16, attributeLength uint32) *model.LocalVariableTableAttributeInfo {
+	localVariableTableLength := p.reader.ReadUint16()
+	localVariableTable := make([]model.LocalVariableTable, localVariableTableLength)
+	for i := range localVariableTable {
+		localVariableTable[i] = p.parseLocalVariableTable()
+	}
+	return &model.LocalVariableTableAttributeInfo{
+		AttributeNameIndex: attributeNameIndex,
+		AttributeLength:    attributeLength,
+		LocalVariableTable: localVariableTable,
+	}
+}
+
+func (p *ClassFileParser) parseLocalVariableTable() model.LocalVariableTable {
+	startPC := p.reader.ReadUint16()
+	length := p.reader.ReadUint16()
+	nameIndex := p.reader.ReadUint16()
+	descriptorIndex := p.reader.ReadUint16()
+	index := p.reader.ReadUint16()
+	return model.LocalVariableTable{
+		StartPC:         startPC,
+		Length:          length,
+		NameIndex:       nameIndex,
+		DescriptorIndex: descriptorIndex,
+		Index:           index,
+	}
+}
+
+func (p *ClassFileParser) parseLocalVariableTypeTableAttributeInfo(attributeNameIndex uint16, attributeLength uint32) *model.LocalVariableTypeTableAttributeInfo {
+	localVariableTableLength := p.reader.ReadUint16()
+	localVariableTable := make([]model.LocalVariableTypeInfo, localVariableTableLength)
+	for i := range localVariableTable {
+		localVariableTable[i] = model.LocalVariableTypeInfo{
+			StartPc:        p.reader.ReadUint16(),
+			Length:         p.reader.ReadUint16(),
+			NameIndex:      p.reader.ReadUint16(),
+			SignatureIndex: p.reader.ReadUint16(),
+			Index:          p.reader.ReadUint16(),
+		}
+	}
+	return &model.LocalVariableTypeTableAttributeInfo{
+		AttributeNameIndex: attributeNameIndex,
+		AttributeLength:    attributeLength,
+		LocalVariableTable: localVariableTable,
+	}
+}
+
+func (p *ClassFileParser) parseBootstrapMethodsAttributeInfo(attributeNameIndex uint16, attributeLength uint32) *model.BootstrapMethodsAttributeInfo {
+	numBootstrapMethods := p.reader.ReadUint16()
+	bootstrapMethods := make([]model.BootstrapMethodInfo, numBootstrapMethods)
+	for i := range bootstrapMethods {
+		bootstrapMethodRef := p.reader.ReadUint16()
+		numBootstrapArguments := p.reader.ReadUint16()
+		bootstrapMethods[i] = model.BootstrapMethodInfo{
+			BootstrapMethodRef: bootstrapMethodRef,
+			BootstrapArguments: p.parseIndexes(numBootstrapArguments),
+		}
+	}
+	return &model.BootstrapMethodsAttributeInfo{
+		AttributeNameIndex: attributeNameIndex,
+		AttributeLength:    attributeLength,
+		BootstrapMethods:   bootstrapMethods,
+	}
+}
+
+func (p *ClassFileParser) parseMethodParametersAttributeInfo(attributeNameIndex uint16, attributeLength uint32) *model.MethodParametersAttributeInfo {
+	parametersCount := p.reader.ReadUint8()
+	parameters := make([]model.ParameterInfo, parametersCount)
+	for i := range parameters {
+		parameters[i] = model.ParameterInfo{
+			NameIndex:   p.reader.ReadUint16(),
+			AccessFlags: p.reader.ReadUint16(),
+		}
+	}
+	return &model.MethodParametersAttributeInfo{
+		AttributeNameIndex: attributeNameIndex,
+		AttributeLength:    attributeLength,
+		Parameters:         parameters,
+	}
+}
+
+func (p *ClassFileParser) parseModuleInfo() model.ModuleInfo {
+	module := model.ModuleInfo{
+		ModuleNameIndex:    p.reader.ReadUint16(),
+		ModuleFlags:        p.reader.ReadUint16(),
+		ModuleVersionIndex: p.reader.ReadUint16(),
+	}
+	module.Requires = make([]model.RequiresInfo, p.reader.ReadUint16())
+	for i := range module.Requires {
+		module.Requires[i] = model.RequiresInfo{
+			RequiresIndex:   p.reader.ReadUint16(),
+			RequiresFlags:   p.reader.ReadUint16(),
+			RequiresVersion: p.reader.ReadUint16(),
+		}
+	}
+	module.Exports = make([]model.ExportsInfo, p.reader.ReadUint16())
+	for i := range module.Exports {
+		exports := &module.Exports[i]
+		exports.ExportsIndex = p.reader.ReadUint16()
+		exports.ExportsFlags = p.reader.ReadUint16()
+		exports.ExportsToCount = p.reader.ReadUint16()
+		exports.ExportsToIndex = p.parseIndexes(exports.ExportsToCount)
+	}
+	module.Opens = make([]model.OpensInfo, p.reader.ReadUint16())
+	for i := range module.Opens {
+		opens := &module.Opens[i]
+		opens.OpensIndex = p.reader.ReadUint16()
+		opens.OpensFlags = p.reader.ReadUint16()
+		opens.OpensToCount = p.reader.ReadUint16()
+		opens.OpensToIndex = p.parseIndexes(opens.OpensToCount)
+	}
+	module.Uses = make([]model.UsesInfo, p.reader.ReadUint16())
+	for i := range module.Uses {
+		module.Uses[i].UsesIndex = p.reader.ReadUint16()
+	}
+	module.Provides = make([]model.ProvidesInfo, p.reader.ReadUint16())
+	for i := range module.Provides {
+		provides := &module.Provides[i]
+		provides.ProvidesIndex = p.reader.ReadUint16()
+		provides.ProvidesWithCount = p.reader.ReadUint16()
+		provides.ProvidesWithIndex = p.parseIndexes(provides.ProvidesWithCount)
+	}
+	return module
+}
+
+func (p *ClassFileParser) parseRecordAttributeInfo(attributeNameIndex uint16, attributeLength uint32) *model.RecordAttributeInfo {
+	numberOfComponents := p.reader.ReadUint16()
+	components := make([]model.RecordComponentInfo, numberOfComponents)
+	for i := range components {
+		nameIndex := p.reader.ReadUint16()
+		descriptorIndex := p.reader.ReadUint16()
+		attributesCount := p.reader.ReadUint16()
+		components[i] = model.RecordComponentInfo{
+			ComponentNameIndex:       nameIndex,
+			ComponentDescriptorIndex: descriptorIndex,
+			ComponentAttributesCount: attributesCount,
+			Attributes:               p.parseAttributes(attributesCount),
+		}
+	}
+	return &model.RecordAttributeInfo{
+		AttributeNameIndex: attributeNameIndex,
+		AttributeLength:    attributeLength,
+		NumberOfComponents: numberOfComponents,
+		Components:         components,
+	}
+}
+
+func (p *ClassFileParser) parseStackMapTableAttributeInfo(attributeNameIndex uint16, attributeLength uint32) *model.StackMapTableAttributeInfo {
+	numberOfEntries := p.reader.ReadUint16()
+	entries := make([]model.StackMapFrame, numberOfEntries)
+	for i := range entries {
+		entries[i] = p.parseStackMapFrame()
+	}
+	attr := &model.StackMapTableAttributeInfo{
+		AttributeNameIndex: attributeNameIndex,
+		AttributeLength:    attributeLength,
+		NumberOfEntries:    numberOfEntries,
+		Entries:            entries,
+	}
+	if p.method == nil || p.reader.Err() != nil {
+		return attr
+	}
+	offset := p.reader.Offset()
+	static := p.method.AccessFlags&uint16(constant.METHOD_ACC_STATIC) != 0
+	locals, err := model.InitialFrameLocals(p.className(p.thisClass), p.utf8(p.method.NameIndex), p.utf8(p.method.DescriptorIndex), static)
+	if err == nil {
+		attr.Frames, err = model.ExpandStackMapFrames(locals, entries)
+	}
+	if err != nil {
+		p.reader.Fail(offset, "invalid StackMapTable: %v", err)
+	}
+	return attr
+}
+
+func (p *ClassFileParser) parseStackMapFrame() model.StackMapFrame {
+	offset := p.reader.Offset()
+	frame := model.StackMapFrame{FrameType: p.reader.ReadUint8()}
+	switch {
+	case frame.FrameType < constant.SameLocals1StackItemFrame:
+		frame.OffsetDelta = uint16(frame.FrameType)
+	case frame.FrameType < 128:
+		frame.OffsetDelta = uint16(frame.FrameType - constant.SameLocals1StackItemFrame)
+		frame.Stack = p.parseVerificationTypeInfos(1)
+	case frame.FrameType < constant.SameLocals1StackItemFrameExtended:
+		p.reader.Fail(offset, "reserved stack map frame type %d", frame.FrameType)
+	case frame.FrameType == constant.SameLocals1StackItemFrameExtended:
+		frame.OffsetDelta = p.reader.ReadUint16()
+		frame.Stack = p.parseVerificationTypeInfos(1)
+	case frame.FrameType <= constant.SameFrameExtended:
+		frame.OffsetDelta = p.reader.ReadUint16()
+	case frame.FrameType < constant.FullFrame:
+		frame.OffsetDelta = p.reader.ReadUint16()
+		frame.Locals = p.parseVerificationTypeInfos(uint16(frame.FrameType - constant.SameFrameExtended))
+	default:
+		frame.OffsetDelta = p.reader.ReadUint16()
+		frame.Locals = p.parseVerificationTypeInfos(p.reader.ReadUint16())
+		frame.Stack = p.parseVerificationTypeInfos(p.reader.ReadUint16())
+	}
+	return frame
+}
+
+func (p *ClassFileParser) parseVerificationTypeInfos(count uint16) []model.VerificationTypeInfo {
+	infos := make([]model.VerificationTypeInfo, count)
+	for i := range infos {
+		offset := p.reader.Offset()
+		infos[i].Tag = p.reader.ReadUint8()
+		switch infos[i].Tag {
+		case constant.ItemObject:
+			infos[i].CpoolIndex = p.reader.ReadUint16()
+			infos[i].ClassName = p.className(infos[i].CpoolIndex)
+		case constant.ItemUninitialized:
+			infos[i].Offset = p.reader.ReadUint16()
+		default:
+			if infos[i].Tag > constant.ItemUninitialized {
+				p.reader.Fail(offset, "invalid verification type tag %d", infos[i].Tag)
+			}
+		}
+	}
+	return infos
+}
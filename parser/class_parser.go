@@ -7,7 +7,17 @@ import (
 )
 
 type ClassFileParser struct {
-	reader *ByteReader
+	reader       *ByteReader
+	majorVersion uint16
+	constantPool []model.ConstantInfo
+	thisClass    uint16
+	// method is the method whose attributes are being parsed, if any.
+	method *model.MethodInfo
+	// moduleConstantOffset is the offset of the first CONSTANT_Module or
+	// CONSTANT_Package entry, or 0 if there is none.
+	moduleConstantOffset int
+	// elementValueDepth is the nesting of the element value being parsed.
+	elementValueDepth int
 }
 
 func (p *ClassFileParser) parseMagic() uint32 {
@@ -27,11 +37,19 @@ func (p *ClassFileParser) parseConstantPoolCount() uint16 {
 }
 
 func (p *ClassFileParser) parseConstantPool(count uint16) []model.ConstantInfo {
+	if count == 0 {
+		p.reader.Fail(p.reader.Offset(), "constant pool count must be at least 1")
+		return nil
+	}
 	constantPool := make([]model.ConstantInfo, count)
-	for i := 1; i < int(count); i++ {
+	for i := 1; i < int(count) && p.reader.Err() == nil; i++ {
+		offset := p.reader.Offset()
 		constantPool[i] = p.parseConstantInfo()
 		switch constantPool[i].Tag {
 		case constant.ConstantLong, constant.ConstantDouble:
+			if i+1 >= int(count) {
+				p.reader.Fail(offset, "8-byte constant at index %d has no room for its second slot", i)
+			}
 			i++
 		}
 	}
@@ -99,7 +117,15 @@ func (p *ClassFileParser) parseInterfaces(count uint16) []uint16 {
 }
 
 func (p *ClassFileParser) parseConstantInfo() model.ConstantInfo {
+	offset := p.reader.Offset()
 	tag := p.reader.ReadUint8()
+	if minMajor, ok := constant.ConstantMinMajorVersion[tag]; ok && p.majorVersion < minMajor {
+		p.reader.Fail(offset, "constant pool tag %d requires class file version %d, got %d", tag, minMajor, p.majorVersion)
+		return model.ConstantInfo{}
+	}
+	if (tag == constant.ConstantModule || tag == constant.ConstantPackage) && p.moduleConstantOffset == 0 {
+		p.moduleConstantOffset = offset
+	}
 	switch tag {
 	case constant.ConstantClass:
 		return p.parseConstantClassInfo()
@@ -129,8 +155,15 @@ func (p *ClassFileParser) parseConstantInfo() model.ConstantInfo {
 		return p.parseConstantMethodTypeInfo()
 	case constant.ConstantInvokeDynamic:
 		return p.parseConstantInvokeDynamicInfo()
+	case constant.ConstantDynamic:
+		return p.parseConstantDynamicInfo()
+	case constant.ConstantModule:
+		return p.parseConstantModuleInfo()
+	case constant.ConstantPackage:
+		return p.parseConstantPackageInfo()
 	default:
-		panic("java.lang.ClassFormatError: constant pool tag!")
+		p.reader.Fail(offset, "invalid constant pool tag %d", tag)
+		return model.ConstantInfo{}
 	}
 }
 
@@ -210,8 +243,13 @@ func (p *ClassFileParser) parseConstantNameAndTypeInfo() model.ConstantInfo {
 
 func (p *ClassFileParser) parseConstantUtf8Info() model.ConstantInfo {
 	length := p.reader.ReadUint16()
+	offset := p.reader.Offset()
 	bytes := p.reader.ReadBytes(uint32(length))
-	return model.ConstantInfo{Tag: constant.ConstantUtf8, Info: bytes}
+	utf8, err := DecodeMUTF8(bytes)
+	if err != nil {
+		p.reader.Fail(offset, "illegal modified UTF-8 in constant pool: %v", err)
+	}
+	return model.ConstantInfo{Tag: constant.ConstantUtf8, Info: bytes, Utf8: utf8}
 }
 
 func (p *ClassFileParser) parseConstantMethodHandleInfo() model.ConstantInfo {
@@ -236,6 +274,28 @@ func (p *ClassFileParser) parseConstantInvokeDynamicInfo() model.ConstantInfo {
 	return model.ConstantInfo{Tag: constant.ConstantInvokeDynamic, Info: info}
 }
 
+func (p *ClassFileParser) parseConstantDynamicInfo() model.ConstantInfo {
+	readUint16 := p.reader.ReadUint16()
+	info := make([]uint8, 4)
+	binary.BigEndian.PutUint16(info, readUint16)
+	binary.BigEndian.PutUint16(info[2:], p.reader.ReadUint16())
+	return model.ConstantInfo{Tag: constant.ConstantDynamic, Info: info}
+}
+
+func (p *ClassFileParser) parseConstantModuleInfo() model.ConstantInfo {
+	readUint16 := p.reader.ReadUint16()
+	info := make([]uint8, 2)
+	binary.BigEndian.PutUint16(info, readUint16)
+	return model.ConstantInfo{Tag: constant.ConstantModule, Info: info}
+}
+
+func (p *ClassFileParser) parseConstantPackageInfo() model.ConstantInfo {
+	readUint16 := p.reader.ReadUint16()
+	info := make([]uint8, 2)
+	binary.BigEndian.PutUint16(info, readUint16)
+	return model.ConstantInfo{Tag: constant.ConstantPackage, Info: info}
+}
+
 func (p *ClassFileParser) parseFieldInfo() model.FieldInfo {
 	accessFlags := p.reader.ReadUint16()
 	nameIndex := p.reader.ReadUint16()
@@ -257,12 +317,53 @@ func (p *ClassFileParser) parseFieldInfo() model.FieldInfo {
 func (p *ClassFileParser) parseAttributeInfo() model.AttributeInfo {
 	attributeNameIndex := p.reader.ReadUint16()
 	attributeLength := p.reader.ReadUint32()
-	attributeInfo := p.reader.ReadBytes(attributeLength)
+	offset := p.reader.Offset()
+	body := p.reader.Sub(attributeLength)
+	name := p.utf8(attributeNameIndex)
+	if name == "" && p.reader.Err() == nil {
+		p.reader.Fail(offset-6, "invalid attribute name index %d", attributeNameIndex)
+	}
+	var value interface{}
+	p.within(body, func() {
+		value = p.parseAttributeValue(name, attributeNameIndex, attributeLength)
+	})
 	return model.AttributeInfo{
 		AttributeNameIndex: attributeNameIndex,
 		AttributeLength:    attributeLength,
-		Info:               attributeInfo,
+		Info:               body.data,
+		Name:               name,
+		Value:              value,
+	}
+}
+
+// within runs parse with p reading from r, the body of an enclosing
+// structure, and fails if parse leaves any of the body unread.
+func (p *ClassFileParser) within(r *ByteReader, parse func()) {
+	parent := p.reader
+	p.reader = r
+	parse()
+	p.reader = parent
+	if r.Err() == nil && r.Remaining() > 0 {
+		r.Fail(r.Offset(), "%d unexpected bytes at the end of attribute", r.Remaining())
+	}
+}
+
+// className returns the name of the CONSTANT_Class entry at index, or "" if
+// index does not refer to one.
+func (p *ClassFileParser) className(index uint16) string {
+	if int(index) >= len(p.constantPool) || p.constantPool[index].Tag != constant.ConstantClass {
+		return ""
+	}
+	return p.utf8(binary.BigEndian.Uint16(p.constantPool[index].Info))
+}
+
+// utf8 returns the CONSTANT_Utf8 entry at index, or "" if index does not
+// refer to one.
+func (p *ClassFileParser) utf8(index uint16) string {
+	if int(index) >= len(p.constantPool) || p.constantPool[index].Tag != constant.ConstantUtf8 {
+		return ""
 	}
+	return p.constantPool[index].Utf8
 }
 
 func (p *ClassFileParser) parseMethodInfo() model.MethodInfo {
@@ -270,109 +371,116 @@ func (p *ClassFileParser) parseMethodInfo() model.MethodInfo {
 	nameIndex := p.reader.ReadUint16()
 	descriptorIndex := p.reader.ReadUint16()
 	attributesCount := p.reader.ReadUint16()
-	attributes := make([]model.AttributeInfo, attributesCount)
-	for i := range attributes {
-		attributes[i] = p.parseAttributeInfo()
-	}
-	return model.MethodInfo{
+	method := model.MethodInfo{
 		AccessFlags:     accessFlags,
 		NameIndex:       nameIndex,
 		DescriptorIndex: descriptorIndex,
 		AttributesCount: attributesCount,
-		Attributes:      attributes,
 	}
+	p.method = &method
+	method.Attributes = make([]model.AttributeInfo, attributesCount)
+	for i := range method.Attributes {
+		method.Attributes[i] = p.parseAttributeInfo()
+	}
+	p.method = nil
+	return method
+}
+
+// Parse reads a class file. Malformed input is reported as a
+// *ClassFormatError rather than a panic, so untrusted bytes can be parsed.
+func (p *ClassFileParser) Parse() (*model.ClassFile, error) {
+	class, err := p.ParseHeader()
+	if err != nil {
+		return nil, err
+	}
+	class.FieldsCount = p.parseFieldsCount()
+	class.Fields = p.parseFields(class.FieldsCount)
+	class.MethodsCount = p.parseMethodsCount()
+	class.Methods = p.parseMethods(class.MethodsCount)
+	class.AttributesCount = p.parseAttributesCount()
+	class.Attributes = p.parseAttributes(class.AttributesCount)
+	if err := p.ParseEnd(); err != nil {
+		return nil, err
+	}
+	return class, nil
 }
 
-func (p *ClassFileParser) Parse() *model.ClassFile {
+// ParseHeader reads the class file up to its fields: the version, constant
+// pool, access flags, class names and interfaces. The rest can then be read
+// one structure at a time with SkipMember, ParseField, ParseMethod and
+// ParseAttribute, ending with ParseEnd.
+func (p *ClassFileParser) ParseHeader() (*model.ClassFile, error) {
 	class := model.ClassFile{}
 	class.Magic = p.parseMagic()
+	if p.reader.Err() == nil && class.Magic != constant.ClassFileMagic {
+		p.reader.Fail(0, "incompatible magic value %#x", class.Magic)
+	}
 	class.MinorVersion = p.parseMinorVersion()
 	class.MajorVersion = p.parseMajorVersion()
+	p.majorVersion = class.MajorVersion
+	if p.reader.Err() == nil {
+		p.checkVersion(class.MajorVersion, class.MinorVersion)
+	}
 	class.ConstantPoolCount = p.parseConstantPoolCount()
 	class.ConstantPool = p.parseConstantPool(class.ConstantPoolCount)
+	p.constantPool = class.ConstantPool
 	class.AccessFlags = p.parseAccessFlags()
+	// CONSTANT_Module and CONSTANT_Package are only legal in module-info.
+	if p.moduleConstantOffset != 0 && class.AccessFlags&uint16(constant.CLASS_ACC_MODULE) == 0 {
+		p.reader.Fail(p.moduleConstantOffset, "CONSTANT_Module or CONSTANT_Package in a class that is not a module")
+	}
 	class.ThisClass = p.parseThisClass()
+	p.thisClass = class.ThisClass
 	class.SuperClass = p.parseSuperClass()
 	class.InterfacesCount = p.parseInterfacesCount()
 	class.Interfaces = p.parseInterfaces(class.InterfacesCount)
-	class.FieldsCount = p.parseFieldsCount()
-	class.Fields = p.parseFields(class.FieldsCount)
-	class.MethodsCount = p.parseMethodsCount()
-	class.Methods = p.parseMethods(class.MethodsCount)
-	class.AttributesCount = p.parseAttributesCount()
-	class.Attributes = p.parseAttributes(class.AttributesCount)
-	return &class
-
+	if err := p.reader.Err(); err != nil {
+		return nil, err
+	}
+	return &class, nil
 }
 
-func (p *ClassFileParser) parseCodeAttributeInfo() model.CodeAttributeInfo {
-	attributeNameIndex := p.reader.ReadUint16()
-	attributeLength := p.reader.ReadUint32()
-	maxStack := p.reader.ReadUint16()
-	maxLocals := p.reader.ReadUint16()
-	codeLength := p.reader.ReadUint32()
-	code := p.reader.ReadBytes(codeLength)
-	exceptionTableLength := p.reader.ReadUint16()
-	exceptionTable := make([]model.ExceptionTable, exceptionTableLength)
-	for i := range exceptionTable {
-		exceptionTable[i] = p.parseExceptionTable()
-	}
-	attributesCount := p.reader.ReadUint16()
-	attributes := make([]model.AttributeInfo, attributesCount)
-	for i := range attributes {
-		attributes[i] = p.parseAttributeInfo()
-	}
-	return model.CodeAttributeInfo{
-		AttributeNameIndex:   attributeNameIndex,
-		AttributeLength:      attributeLength,
-		MaxStack:             maxStack,
-		MaxLocals:            maxLocals,
-		CodeLength:           codeLength,
-		Code:                 code,
-		ExceptionTableLength: exceptionTableLength,
-		ExceptionTable:       exceptionTable,
-		AttributesCount:      attributesCount,
-		Attributes:           attributes,
+// SkipMember reads past a field or method, checking only that its
+// attributes fit in the class file.
+func (p *ClassFileParser) SkipMember() {
+	p.reader.ReadBytes(6)
+	count := p.reader.ReadUint16()
+	for i := 0; i < int(count) && p.reader.Err() == nil; i++ {
+		p.reader.ReadUint16()
+		p.reader.ReadBytes(p.reader.ReadUint32())
 	}
+}
 
+func (p *ClassFileParser) ParseField() model.FieldInfo {
+	return p.parseFieldInfo()
 }
 
-func (p *ClassFileParser) parseExceptionTable() model.ExceptionTable {
-	return model.ExceptionTable{
-		StartPC:   p.reader.ReadUint16(),
-		EndPC:     p.reader.ReadUint16(),
-		HandlerPC: p.reader.ReadUint16(),
-		CatchType: p.reader.ReadUint16(),
-	}
+func (p *ClassFileParser) ParseMethod() model.MethodInfo {
+	return p.parseMethodInfo()
 }
 
-func (p *ClassFileParser) parseLocalVariableAttributeInfo() model.LocalVariableTableAttributeInfo {
-	attributeNameIndex := p.reader.ReadUint16()
-	attributeLength := p.reader.ReadUint32()
-	localVariableTableLength := p.reader.ReadUint16()
-	localVariableTable := make([]model.LocalVariableTable, localVariableTableLength)
-	for i := range localVariableTable {
-		localVariableTable[i] = p.parseLocalVariableTable()
-	}
-	return model.LocalVariableTableAttributeInfo{
-		AttributeNameIndex: attributeNameIndex,
-		AttributeLength:    attributeLength,
-		LocalVariableTable: localVariableTable,
+// ParseAttribute reads a class attribute.
+func (p *ClassFileParser) ParseAttribute() model.AttributeInfo {
+	return p.parseAttributeInfo()
+}
+
+// ParseEnd fails unless the whole class file has been read, and returns the
+// first error of the parse.
+func (p *ClassFileParser) ParseEnd() error {
+	if p.reader.Err() == nil && p.reader.Remaining() > 0 {
+		p.reader.Fail(p.reader.Offset(), "%d extra bytes at the end of class file", p.reader.Remaining())
 	}
+	return p.reader.Err()
 }
 
-func (p *ClassFileParser) parseLocalVariableTable() model.LocalVariableTable {
-	startPC := p.reader.ReadUint16()
-	length := p.reader.ReadUint16()
-	nameIndex := p.reader.ReadUint16()
-	descriptorIndex := p.reader.ReadUint16()
-	index := p.reader.ReadUint16()
-	return model.LocalVariableTable{
-		StartPC:         startPC,
-		Length:          length,
-		NameIndex:       nameIndex,
-		DescriptorIndex: descriptorIndex,
-		Index:           index,
+func (p *ClassFileParser) checkVersion(major, minor uint16) {
+	if major < constant.MinMajorVersion || major > constant.MaxMajorVersion {
+		p.reader.Fail(4, "unsupported major version %d", major)
+		return
+	}
+	// Since Java SE 12 the minor version is either 0 or marks a preview class.
+	if major >= 56 && minor != 0 && minor != constant.PreviewMinorVersion {
+		p.reader.Fail(4, "invalid minor version %d for major version %d", minor, major)
 	}
 }
 
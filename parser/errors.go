@@ -0,0 +1,23 @@
+package parser
+
+import "fmt"
+
+// ClassFormatError reports a class file that does not conform to the format
+// described in JVMS §4, mirroring java.lang.ClassFormatError. Offset is the
+// byte position in the class file at which the problem was detected, or -1
+// for problems found by CheckFormat in the parsed class.
+type ClassFormatError struct {
+	Offset int
+	Reason string
+}
+
+func (e *ClassFormatError) Error() string {
+	if e.Offset < 0 {
+		return fmt.Sprintf("java.lang.ClassFormatError: %s", e.Reason)
+	}
+	return fmt.Sprintf("java.lang.ClassFormatError: %s (offset %d)", e.Reason, e.Offset)
+}
+
+func newClassFormatError(offset int, format string, args ...interface{}) *ClassFormatError {
+	return &ClassFormatError{Offset: offset, Reason: fmt.Sprintf(format, args...)}
+}
@@ -0,0 +1,425 @@
+package parser
+
+import (
+	"encoding/binary"
+	"outro/constant"
+	"outro/model"
+	"strings"
+)
+
+// https://docs.oracle.com/javase/specs/jvms/se8/html/jvms-4.html#jvms-4.8
+
+// CheckFormat checks the static constraints of a parsed class file that
+// parsing alone does not: that constant pool entries refer to entries of the
+// right kind, that names and descriptors are well formed, that no field or
+// method is declared twice and that access flags are combined legally.
+func CheckFormat(cf *model.ClassFile) error {
+	c := &formatChecker{cf: cf}
+	if err := c.checkConstantPool(); err != nil {
+		return err
+	}
+	if err := c.checkClass(); err != nil {
+		return err
+	}
+	if err := c.checkFields(); err != nil {
+		return err
+	}
+	return c.checkMethods()
+}
+
+type formatChecker struct {
+	cf *model.ClassFile
+}
+
+func (c *formatChecker) errorf(format string, args ...interface{}) error {
+	return newClassFormatError(-1, format, args...)
+}
+
+func (c *formatChecker) isInterface() bool {
+	return c.cf.AccessFlags&uint16(constant.CLASS_ACC_INTERFACE) != 0
+}
+
+// tagAt returns the tag of the constant pool entry at index, or 0 if there
+// is none.
+func (c *formatChecker) tagAt(index uint16) uint8 {
+	if index == 0 || int(index) >= len(c.cf.ConstantPool) {
+		return 0
+	}
+	return c.cf.ConstantPool[index].Tag
+}
+
+// ref checks that index refers to an entry tagged with one of tags.
+func (c *formatChecker) ref(from int, index uint16, tags ...uint8) error {
+	tag := c.tagAt(index)
+	for _, want := range tags {
+		if tag == want {
+			return nil
+		}
+	}
+	return c.errorf("constant pool entry #%d refers to invalid entry #%d", from, index)
+}
+
+func (c *formatChecker) checkConstantPool() error {
+	pool := c.cf.ConstantPool
+	for i := 1; i < len(pool); i++ {
+		info := pool[i].Info
+		var err error
+		switch pool[i].Tag {
+		case constant.ConstantClass:
+			if err = c.ref(i, u2(info), constant.ConstantUtf8); err == nil {
+				if name := c.cf.ClassName(uint16(i)); !isClassName(name) {
+					err = c.errorf("illegal class name %q at constant pool entry #%d", name, i)
+				}
+			}
+		case constant.ConstantString, constant.ConstantModule, constant.ConstantPackage:
+			err = c.ref(i, u2(info), constant.ConstantUtf8)
+		case constant.ConstantNameAndType:
+			if err = c.ref(i, u2(info), constant.ConstantUtf8); err == nil {
+				err = c.ref(i, u2(info[2:]), constant.ConstantUtf8)
+			}
+		case constant.ConstantFieldRef, constant.ConstantMethodRef, constant.ConstantInterfaceMethodRef:
+			err = c.checkMemberRef(i)
+		case constant.ConstantMethodType:
+			if err = c.ref(i, u2(info), constant.ConstantUtf8); err == nil {
+				if descriptor := c.cf.Utf8(u2(info)); !isMethodDescriptor(descriptor) {
+					err = c.errorf("illegal method descriptor %q at constant pool entry #%d", descriptor, i)
+				}
+			}
+		case constant.ConstantMethodHandle:
+			err = c.checkMethodHandle(i)
+		case constant.ConstantInvokeDynamic, constant.ConstantDynamic:
+			if err = c.ref(i, u2(info[2:]), constant.ConstantNameAndType); err == nil {
+				name, descriptor := c.cf.NameAndType(u2(info[2:]))
+				switch {
+				case !isUnqualifiedName(name):
+					err = c.errorf("illegal name %q at constant pool entry #%d", name, i)
+				case pool[i].Tag == constant.ConstantInvokeDynamic && !isMethodDescriptor(descriptor):
+					err = c.errorf("illegal method descriptor %q at constant pool entry #%d", descriptor, i)
+				case pool[i].Tag == constant.ConstantDynamic && !isFieldDescriptor(descriptor):
+					err = c.errorf("illegal field descriptor %q at constant pool entry #%d", descriptor, i)
+				}
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkMemberRef checks a field, method or interface method reference and
+// the name and descriptor it refers to.
+func (c *formatChecker) checkMemberRef(i int) error {
+	entry := c.cf.ConstantPool[i]
+	if err := c.ref(i, u2(entry.Info), constant.ConstantClass); err != nil {
+		return err
+	}
+	if err := c.ref(i, u2(entry.Info[2:]), constant.ConstantNameAndType); err != nil {
+		return err
+	}
+	name, descriptor := c.cf.NameAndType(u2(entry.Info[2:]))
+	if entry.Tag == constant.ConstantFieldRef {
+		if !isUnqualifiedName(name) {
+			return c.errorf("illegal field name %q at constant pool entry #%d", name, i)
+		}
+		if !isFieldDescriptor(descriptor) {
+			return c.errorf("illegal field descriptor %q at constant pool entry #%d", descriptor, i)
+		}
+		return nil
+	}
+	if !isMethodName(name) || name == "<clinit>" {
+		return c.errorf("illegal method name %q at constant pool entry #%d", name, i)
+	}
+	if !isMethodDescriptor(descriptor) {
+		return c.errorf("illegal method descriptor %q at constant pool entry #%d", descriptor, i)
+	}
+	if name == "<init>" && !strings.HasSuffix(descriptor, ")V") {
+		return c.errorf("method <init> must return void at constant pool entry #%d", i)
+	}
+	return nil
+}
+
+// checkMethodHandle checks that a method handle refers to the kind of member
+// its reference kind accesses.
+// https://docs.oracle.com/javase/specs/jvms/se8/html/jvms-4.html#jvms-4.4.8
+func (c *formatChecker) checkMethodHandle(i int) error {
+	info := c.cf.ConstantPool[i].Info
+	kind, index := info[0], u2(info[1:])
+	var err error
+	switch kind {
+	case constant.RefGetField, constant.RefGetStatic, constant.RefPutField, constant.RefPutStatic:
+		err = c.ref(i, index, constant.ConstantFieldRef)
+	case constant.RefInvokeVirtual, constant.RefNewInvokeSpecial:
+		err = c.ref(i, index, constant.ConstantMethodRef)
+	case constant.RefInvokeStatic, constant.RefInvokeSpecial:
+		if c.cf.MajorVersion < 52 {
+			err = c.ref(i, index, constant.ConstantMethodRef)
+		} else {
+			err = c.ref(i, index, constant.ConstantMethodRef, constant.ConstantInterfaceMethodRef)
+		}
+	case constant.RefInvokeInterface:
+		err = c.ref(i, index, constant.ConstantInterfaceMethodRef)
+	default:
+		return c.errorf("illegal reference kind %d at constant pool entry #%d", kind, i)
+	}
+	if err != nil || kind < constant.RefInvokeVirtual {
+		return err
+	}
+	name, _ := c.cf.NameAndType(u2(c.cf.ConstantPool[index].Info[2:]))
+	if (kind == constant.RefNewInvokeSpecial) != (name == "<init>") {
+		return c.errorf("illegal method name %q for reference kind %d at constant pool entry #%d", name, kind, i)
+	}
+	return nil
+}
+
+// checkClass checks the class access flags and the superclass and
+// interfaces.
+// https://docs.oracle.com/javase/specs/jvms/se8/html/jvms-4.html#jvms-4.1
+func (c *formatChecker) checkClass() error {
+	cf := c.cf
+	access := cf.AccessFlags
+	if c.tagAt(cf.ThisClass) != constant.ConstantClass {
+		return c.errorf("invalid this_class #%d", cf.ThisClass)
+	}
+	name := cf.ClassName(cf.ThisClass)
+	if access&uint16(constant.CLASS_ACC_MODULE) != 0 {
+		if cf.SuperClass != 0 || len(cf.Interfaces) > 0 || len(cf.Fields) > 0 || len(cf.Methods) > 0 {
+			return c.errorf("module %s declares a superclass, interfaces, fields or methods", name)
+		}
+		return nil
+	}
+	if strings.HasPrefix(name, "[") {
+		return c.errorf("illegal class name %q for this_class", name)
+	}
+	if c.isInterface() {
+		// Compilers before Java 6 did not always mark interfaces abstract.
+		if access&uint16(constant.CLASS_ACC_ABSTRACT) == 0 && cf.MajorVersion >= 50 ||
+			access&uint16(constant.CLASS_ACC_FINAL|constant.CLASS_ACC_SUPER|constant.CLASS_ACC_ENUM) != 0 {
+			return c.errorf("illegal class modifiers in interface %s: %#04x", name, access)
+		}
+	} else if access&uint16(constant.CLASS_ACC_ANNOTATION) != 0 ||
+		access&uint16(constant.CLASS_ACC_FINAL|constant.CLASS_ACC_ABSTRACT) == uint16(constant.CLASS_ACC_FINAL|constant.CLASS_ACC_ABSTRACT) {
+		return c.errorf("illegal class modifiers in class %s: %#04x", name, access)
+	}
+	if cf.SuperClass == 0 {
+		if name != "java/lang/Object" {
+			return c.errorf("class %s has no superclass", name)
+		}
+	} else {
+		if c.tagAt(cf.SuperClass) != constant.ConstantClass {
+			return c.errorf("invalid superclass #%d in class %s", cf.SuperClass, name)
+		}
+		superName := cf.ClassName(cf.SuperClass)
+		if strings.HasPrefix(superName, "[") {
+			return c.errorf("class %s has array class %s as its superclass", name, superName)
+		}
+		if c.isInterface() && superName != "java/lang/Object" {
+			return c.errorf("interface %s must have java/lang/Object as its superclass", name)
+		}
+	}
+	seen := map[string]bool{}
+	for _, index := range cf.Interfaces {
+		if c.tagAt(index) != constant.ConstantClass {
+			return c.errorf("invalid interface #%d in class %s", index, name)
+		}
+		interfaceName := cf.ClassName(index)
+		if strings.HasPrefix(interfaceName, "[") {
+			return c.errorf("class %s implements array class %s", name, interfaceName)
+		}
+		if seen[interfaceName] {
+			return c.errorf("duplicate interface %s in class %s", interfaceName, name)
+		}
+		seen[interfaceName] = true
+	}
+	return nil
+}
+
+// checkFields checks the names, descriptors and access flags of the fields.
+// https://docs.oracle.com/javase/specs/jvms/se8/html/jvms-4.html#jvms-4.5
+func (c *formatChecker) checkFields() error {
+	seen := map[string]bool{}
+	for _, field := range c.cf.Fields {
+		name, descriptor, err := c.member("field", field.NameIndex, field.DescriptorIndex)
+		if err != nil {
+			return err
+		}
+		if !isUnqualifiedName(name) {
+			return c.errorf("illegal field name %q", name)
+		}
+		if !isFieldDescriptor(descriptor) {
+			return c.errorf("illegal field descriptor %q for field %s", descriptor, name)
+		}
+		if seen[name+" "+descriptor] {
+			return c.errorf("duplicate field %s %s", name, descriptor)
+		}
+		seen[name+" "+descriptor] = true
+
+		access := field.AccessFlags
+		legal := visibilityCount(access) <= 1 &&
+			access&uint16(constant.FIELD_ACC_FINAL|constant.FIELD_ACC_VOLATILE) != uint16(constant.FIELD_ACC_FINAL|constant.FIELD_ACC_VOLATILE)
+		if c.isInterface() {
+			required := uint16(constant.FIELD_ACC_PUBLIC | constant.FIELD_ACC_STATIC | constant.FIELD_ACC_FINAL)
+			legal = access&required == required && access&^(required|uint16(constant.FIELD_ACC_SYNTHETIC)) == 0
+		}
+		if !legal {
+			return c.errorf("illegal field modifiers in field %s: %#04x", name, access)
+		}
+	}
+	return nil
+}
+
+// checkMethods checks the names, descriptors and access flags of the
+// methods, and that <init> and <clinit> are declared as the JVM calls them.
+// https://docs.oracle.com/javase/specs/jvms/se8/html/jvms-4.html#jvms-4.6
+func (c *formatChecker) checkMethods() error {
+	seen := map[string]bool{}
+	for _, method := range c.cf.Methods {
+		name, descriptor, err := c.member("method", method.NameIndex, method.DescriptorIndex)
+		if err != nil {
+			return err
+		}
+		if !isMethodName(name) {
+			return c.errorf("illegal method name %q", name)
+		}
+		if !isMethodDescriptor(descriptor) {
+			return c.errorf("illegal method descriptor %q for method %s", descriptor, name)
+		}
+		if seen[name+descriptor] {
+			return c.errorf("duplicate method %s%s", name, descriptor)
+		}
+		seen[name+descriptor] = true
+
+		access := method.AccessFlags
+		if name == "<clinit>" {
+			if descriptor != "()V" {
+				return c.errorf("method <clinit> has illegal descriptor %s", descriptor)
+			}
+			if c.cf.MajorVersion >= 51 && access&uint16(constant.METHOD_ACC_STATIC) == 0 {
+				return c.errorf("method <clinit> is not static")
+			}
+			// The other flags of <clinit> are ignored.
+			continue
+		}
+		if !c.legalMethodFlags(name, access) {
+			return c.errorf("illegal method modifiers in method %s%s: %#04x", name, descriptor, access)
+		}
+		if name == "<init>" && !strings.HasSuffix(descriptor, ")V") {
+			return c.errorf("method <init> has illegal descriptor %s", descriptor)
+		}
+		hasCode := method.Attributes.Get("Code") != nil
+		if bodiless := access&uint16(constant.METHOD_ACC_ABSTRACT|constant.METHOD_ACC_NATIVE) != 0; hasCode == bodiless {
+			return c.errorf("method %s%s must have a Code attribute if and only if it is neither abstract nor native", name, descriptor)
+		}
+	}
+	return nil
+}
+
+// legalMethodFlags reports whether a method other than <clinit> may be
+// declared with the given access flags.
+func (c *formatChecker) legalMethodFlags(name string, access uint16) bool {
+	has := func(flags constant.AccessFlag) bool { return access&uint16(flags) != 0 }
+	if visibilityCount(access) > 1 {
+		return false
+	}
+	if c.isInterface() {
+		if name == "<init>" {
+			return false
+		}
+		if c.cf.MajorVersion < 52 {
+			return has(constant.METHOD_ACC_PUBLIC) && has(constant.METHOD_ACC_ABSTRACT) &&
+				!has(constant.METHOD_ACC_STATIC|constant.METHOD_ACC_FINAL|constant.METHOD_ACC_SYNCHRONIZED|
+					constant.METHOD_ACC_NATIVE|constant.METHOD_ACC_STRICT)
+		}
+		// Java 8 added private, static and default methods to interfaces.
+		if has(constant.METHOD_ACC_PUBLIC) == has(constant.METHOD_ACC_PRIVATE) ||
+			has(constant.METHOD_ACC_PROTECTED|constant.METHOD_ACC_FINAL|constant.METHOD_ACC_SYNCHRONIZED|constant.METHOD_ACC_NATIVE) {
+			return false
+		}
+	}
+	if has(constant.METHOD_ACC_ABSTRACT) {
+		forbidden := constant.METHOD_ACC_PRIVATE | constant.METHOD_ACC_STATIC | constant.METHOD_ACC_FINAL |
+			constant.METHOD_ACC_SYNCHRONIZED | constant.METHOD_ACC_NATIVE
+		// ACC_STRICT has no meaning from Java 17 on.
+		if c.cf.MajorVersion >= 46 && c.cf.MajorVersion < 61 {
+			forbidden |= constant.METHOD_ACC_STRICT
+		}
+		if has(forbidden) {
+			return false
+		}
+	}
+	if name == "<init>" {
+		return !has(constant.METHOD_ACC_STATIC | constant.METHOD_ACC_FINAL | constant.METHOD_ACC_SYNCHRONIZED |
+			constant.METHOD_ACC_BRIDGE | constant.METHOD_ACC_NATIVE | constant.METHOD_ACC_ABSTRACT)
+	}
+	return true
+}
+
+// member returns the name and descriptor of a field or method.
+func (c *formatChecker) member(kind string, nameIndex, descriptorIndex uint16) (name, descriptor string, err error) {
+	if c.tagAt(nameIndex) != constant.ConstantUtf8 {
+		return "", "", c.errorf("invalid %s name index #%d", kind, nameIndex)
+	}
+	if c.tagAt(descriptorIndex) != constant.ConstantUtf8 {
+		return "", "", c.errorf("invalid %s descriptor index #%d", kind, descriptorIndex)
+	}
+	return c.cf.Utf8(nameIndex), c.cf.Utf8(descriptorIndex), nil
+}
+
+// visibilityCount counts the public, private and protected flags set, which
+// are the same bits for fields and methods.
+func visibilityCount(access uint16) int {
+	count := 0
+	for _, flag := range []constant.AccessFlag{constant.METHOD_ACC_PUBLIC, constant.METHOD_ACC_PRIVATE, constant.METHOD_ACC_PROTECTED} {
+		if access&uint16(flag) != 0 {
+			count++
+		}
+	}
+	return count
+}
+
+// https://docs.oracle.com/javase/specs/jvms/se8/html/jvms-4.html#jvms-4.2.2
+
+func isUnqualifiedName(name string) bool {
+	return name != "" && !strings.ContainsAny(name, ".;[/")
+}
+
+func isMethodName(name string) bool {
+	return name == "<init>" || name == "<clinit>" || isUnqualifiedName(name) && !strings.ContainsAny(name, "<>")
+}
+
+// isClassName reports whether name is a binary class name in internal form
+// or an array class descriptor.
+func isClassName(name string) bool {
+	if strings.HasPrefix(name, "[") {
+		return isFieldDescriptor(name)
+	}
+	for _, identifier := range strings.Split(name, "/") {
+		if !isUnqualifiedName(identifier) {
+			return false
+		}
+	}
+	return true
+}
+
+func isFieldDescriptor(descriptor string) bool {
+	n, err := model.ParseFieldType(descriptor)
+	return err == nil && n == len(descriptor)
+}
+
+// isMethodDescriptor also checks that the parameters fit in the 255 local
+// variables a method can be passed.
+func isMethodDescriptor(descriptor string) bool {
+	parameters, _, err := model.ParseMethodDescriptor(descriptor)
+	if err != nil {
+		return false
+	}
+	slots := 0
+	for _, parameter := range parameters {
+		slots += model.FieldTypeSlots(parameter)
+	}
+	return slots <= 255
+}
+
+func u2(b []byte) uint16 {
+	return binary.BigEndian.Uint16(b)
+}
@@ -0,0 +1,94 @@
+package parser
+
+import (
+	"fmt"
+	"unicode/utf16"
+)
+
+// https://docs.oracle.com/javase/specs/jvms/se8/html/jvms-4.html#jvms-4.4.7
+//
+// CONSTANT_Utf8 entries use modified UTF-8: U+0000 is written as the two bytes
+// C0 80 so that no entry contains a zero byte, and supplementary characters are
+// written as the two UTF-16 surrogates of the character, each encoded in three
+// bytes, instead of as a single four-byte sequence.
+
+// DecodeMUTF8ToUTF16 decodes modified UTF-8 into UTF-16 code units, the
+// representation of a java.lang.String. Unpaired surrogates are preserved.
+func DecodeMUTF8ToUTF16(data []byte) ([]uint16, error) {
+	chars := make([]uint16, 0, len(data))
+	for i := 0; i < len(data); {
+		b := data[i]
+		switch {
+		case b == 0:
+			return nil, fmt.Errorf("zero byte at %d", i)
+		case b < 0x80:
+			chars = append(chars, uint16(b))
+			i++
+		case b&0xE0 == 0xC0:
+			if i+1 >= len(data) || data[i+1]&0xC0 != 0x80 {
+				return nil, fmt.Errorf("truncated 2-byte sequence at %d", i)
+			}
+			c := uint16(b&0x1F)<<6 | uint16(data[i+1]&0x3F)
+			if c != 0 && c < 0x80 {
+				return nil, fmt.Errorf("overlong 2-byte sequence at %d", i)
+			}
+			chars = append(chars, c)
+			i += 2
+		case b&0xF0 == 0xE0:
+			if i+2 >= len(data) || data[i+1]&0xC0 != 0x80 || data[i+2]&0xC0 != 0x80 {
+				return nil, fmt.Errorf("truncated 3-byte sequence at %d", i)
+			}
+			c := uint16(b&0x0F)<<12 | uint16(data[i+1]&0x3F)<<6 | uint16(data[i+2]&0x3F)
+			if c < 0x800 {
+				return nil, fmt.Errorf("overlong 3-byte sequence at %d", i)
+			}
+			chars = append(chars, c)
+			i += 3
+		default:
+			return nil, fmt.Errorf("invalid byte %#x at %d", b, i)
+		}
+	}
+	return chars, nil
+}
+
+// DecodeMUTF8 decodes modified UTF-8 into a Go string. Surrogate pairs are
+// combined into their supplementary character; unpaired surrogates become
+// U+FFFD, as Go strings cannot represent them.
+func DecodeMUTF8(data []byte) (string, error) {
+	ascii := true
+	for _, b := range data {
+		if b == 0 || b >= 0x80 {
+			ascii = false
+			break
+		}
+	}
+	if ascii {
+		return string(data), nil
+	}
+	chars, err := DecodeMUTF8ToUTF16(data)
+	if err != nil {
+		return "", err
+	}
+	return string(utf16.Decode(chars)), nil
+}
+
+// EncodeUTF16ToMUTF8 encodes UTF-16 code units as modified UTF-8.
+func EncodeUTF16ToMUTF8(chars []uint16) []byte {
+	data := make([]byte, 0, len(chars))
+	for _, c := range chars {
+		switch {
+		case c != 0 && c < 0x80:
+			data = append(data, byte(c))
+		case c < 0x800:
+			data = append(data, byte(0xC0|c>>6), byte(0x80|c&0x3F))
+		default:
+			data = append(data, byte(0xE0|c>>12), byte(0x80|c>>6&0x3F), byte(0x80|c&0x3F))
+		}
+	}
+	return data
+}
+
+// EncodeMUTF8 encodes a Go string as modified UTF-8.
+func EncodeMUTF8(s string) []byte {
+	return EncodeUTF16ToMUTF8(utf16.Encode([]rune(s)))
+}
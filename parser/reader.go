@@ -26,37 +26,110 @@ type Class struct {
 
 */
 
+// ByteReader reads big-endian values from a class file. Reads past the end of
+// the data do not panic: the first failure is recorded as a ClassFormatError,
+// returned by Err, and every later read yields zero values.
 type ByteReader struct {
 	data     []byte
 	position int
+	base     int
+	err      *error
 }
 
 func NewByteReader(data []byte) *ByteReader {
-	return &ByteReader{data: data, position: 0}
+	return &ByteReader{data: data, position: 0, err: new(error)}
+}
+
+// Sub returns a reader over the next length bytes and advances r past them. Offsets
+// reported by the sub reader stay relative to the start of the class file and
+// both readers share the same error, so a structure that overruns its parent
+// fails the whole parse.
+func (r *ByteReader) Sub(length uint32) *ByteReader {
+	offset := r.Offset()
+	return &ByteReader{data: r.ReadBytes(length), base: offset, err: r.err}
+}
+
+// Offset returns the current position relative to the start of the class file.
+func (r *ByteReader) Offset() int {
+	return r.base + r.position
+}
+
+// Seek moves r back or forward to offset, relative to the start of the
+// class file, so a structure skipped once can be read later.
+func (r *ByteReader) Seek(offset int) {
+	if offset < r.base || offset > r.base+len(r.data) {
+		r.Fail(r.Offset(), "seek to offset %d outside the data", offset)
+		return
+	}
+	r.position = offset - r.base
+}
+
+// Remaining returns the number of unread bytes.
+func (r *ByteReader) Remaining() int {
+	return len(r.data) - r.position
+}
+
+// Err returns the first error encountered by the reader.
+func (r *ByteReader) Err() error {
+	return *r.err
+}
+
+// Fail records a ClassFormatError at offset unless an earlier error exists.
+func (r *ByteReader) Fail(offset int, format string, args ...interface{}) {
+	if *r.err == nil {
+		*r.err = newClassFormatError(offset, format, args...)
+	}
 }
 
 func (r *ByteReader) ReadUx(n int) (val []byte) {
+	if *r.err != nil {
+		return nil
+	}
+	if n < 0 || n > r.Remaining() {
+		r.Fail(r.Offset(), "truncated class file: need %d bytes, %d remaining", n, r.Remaining())
+		return nil
+	}
 	val = r.data[r.position : r.position+n]
 	r.position += n
 	return val
 }
 
 func (r *ByteReader) ReadUint8() uint8 {
-	return r.ReadUx(1)[0]
+	val := r.ReadUx(1)
+	if val == nil {
+		return 0
+	}
+	return val[0]
 }
 
 func (r *ByteReader) ReadUint16() uint16 {
-	return binary.BigEndian.Uint16(r.ReadUx(2))
+	val := r.ReadUx(2)
+	if val == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint16(val)
 }
 
 func (r *ByteReader) ReadUint32() uint32 {
-	return binary.BigEndian.Uint32(r.ReadUx(4))
+	val := r.ReadUx(4)
+	if val == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint32(val)
 }
 
 func (r *ByteReader) ReadUint64() uint64 {
-	return binary.BigEndian.Uint64(r.ReadUx(8))
+	val := r.ReadUx(8)
+	if val == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint64(val)
 }
 
 func (r *ByteReader) ReadBytes(length uint32) []byte {
+	if uint64(length) > uint64(r.Remaining()) {
+		r.Fail(r.Offset(), "truncated class file: need %d bytes, %d remaining", length, r.Remaining())
+		return nil
+	}
 	return r.ReadUx(int(length))
 }
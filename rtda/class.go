@@ -19,7 +19,27 @@ type Method struct {
 	MaxStack   uint16
 	MaxLocals  uint16
 	Code       []byte
-	Class      *Class
+	// ExceptionTable lists the handlers of Code in the order they are
+	// searched.
+	ExceptionTable []ExceptionHandler
+	Class          *Class
+	// constantPool is the pool the method was defined with, which stays
+	// with it when its class is redefined.
+	constantPool []interface{}
+}
+
+// GetConstant returns a constant of the pool the method was defined with.
+func (m *Method) GetConstant(index uint16) interface{} {
+	return m.constantPool[index]
+}
+
+// ExceptionHandler is an exception table entry with its catch type
+// resolved to a class name, empty when the handler catches any exception.
+type ExceptionHandler struct {
+	StartPC   int
+	EndPC     int
+	HandlerPC int
+	CatchType string
 }
 
 type Field struct {
@@ -38,11 +58,15 @@ type Class struct {
 	Fields            []*Field
 	Methods           []*Method
 	Loader            *ApplicationClassLoader
+	Module            *Module
 	SuperClass        *Class
 	Interfaces        []*Class
 	InstanceSlotCount uint
 	StaticSlotCount   uint
 	StaticVars        []*interface{}
+	// classfile is the class file the class was last defined or redefined
+	// with, before any transformer changed it.
+	classfile []byte
 }
 
 func (c *Class) GetMainMethod() (*Method, error) {
@@ -62,11 +86,11 @@ func (c *Class) GetStaticMethod(s string, s2 string) (*Method, error) {
 func NewClass(classFile *model.ClassFile) *Class {
 	class := &Class{}
 	class.AccessFlag = classFile.AccessFlags
-	class.Name = string(classFile.ConstantPool[classFile.ThisClass].Info)
-	class.SuperClassName = string(classFile.ConstantPool[classFile.SuperClass].Info)
+	class.Name = classFile.ClassName(classFile.ThisClass)
+	class.SuperClassName = classFile.ClassName(classFile.SuperClass)
 	class.InterfaceNames = make([]string, len(classFile.Interfaces))
 	for i, interfaceIndex := range classFile.Interfaces {
-		class.InterfaceNames[i] = string(classFile.ConstantPool[interfaceIndex].Info)
+		class.InterfaceNames[i] = classFile.ClassName(interfaceIndex)
 	}
 	class.ConstantPool = make([]interface{}, len(classFile.ConstantPool))
 	for i, constantInfo := range classFile.ConstantPool {
@@ -85,17 +109,27 @@ func NewClass(classFile *model.ClassFile) *Class {
 
 func newMethod(info model.MethodInfo, class *Class, file *model.ClassFile) *Method {
 	m := &Method{
-		AccessFlag: info.AccessFlags,
-		Name:       string(file.ConstantPool[info.NameIndex].Info),
-		Descriptor: string(file.ConstantPool[info.DescriptorIndex].Info),
-		Class:      class,
+		AccessFlag:   info.AccessFlags,
+		Name:         file.Utf8(info.NameIndex),
+		Descriptor:   file.Utf8(info.DescriptorIndex),
+		Class:        class,
+		constantPool: class.ConstantPool,
 	}
-	for _, attr := range info.Attributes {
-		if string(file.ConstantPool[attr.AttributeNameIndex].Info) == "Code" {
-			m.MaxStack = binary.BigEndian.Uint16(attr.Info[0:2])
-			m.MaxLocals = binary.BigEndian.Uint16(attr.Info[2:4])
-			m.Code = attr.Info[8:]
-			break
+	if code, ok := info.Attributes.Get("Code").(*model.CodeAttributeInfo); ok {
+		m.MaxStack = code.MaxStack
+		m.MaxLocals = code.MaxLocals
+		m.Code = code.Code
+		for _, handler := range code.ExceptionTable {
+			catchType := ""
+			if handler.CatchType != 0 {
+				catchType = file.ClassName(handler.CatchType)
+			}
+			m.ExceptionTable = append(m.ExceptionTable, ExceptionHandler{
+				StartPC:   int(handler.StartPC),
+				EndPC:     int(handler.EndPC),
+				HandlerPC: int(handler.HandlerPC),
+				CatchType: catchType,
+			})
 		}
 	}
 	return m
@@ -105,8 +139,8 @@ func newMethod(info model.MethodInfo, class *Class, file *model.ClassFile) *Meth
 func newField(info model.FieldInfo, class *Class, file *model.ClassFile) *Field {
 	return &Field{
 		AccessFlag: info.AccessFlags,
-		Name:       string(file.ConstantPool[info.NameIndex].Info),
-		Descriptor: string(file.ConstantPool[info.DescriptorIndex].Info),
+		Name:       file.Utf8(info.NameIndex),
+		Descriptor: file.Utf8(info.DescriptorIndex),
 		Class:      class,
 	}
 }
@@ -114,17 +148,17 @@ func newField(info model.FieldInfo, class *Class, file *model.ClassFile) *Field
 func newConstant(info model.ConstantInfo, class *Class, classFile *model.ClassFile) interface{} {
 	switch info.Tag {
 	case constant.ConstantInteger:
-		return binary.BigEndian.Uint32(info.Info)
+		return int32(binary.BigEndian.Uint32(info.Info))
 	case constant.ConstantFloat:
 		return math.Float32frombits(binary.BigEndian.Uint32(info.Info))
 	case constant.ConstantLong:
-		return binary.BigEndian.Uint64(info.Info)
+		return int64(binary.BigEndian.Uint64(info.Info))
 	case constant.ConstantDouble:
 		return math.Float64frombits(binary.BigEndian.Uint64(info.Info))
 	case constant.ConstantString:
-		return string(info.Info)
+		return classFile.Utf8(binary.BigEndian.Uint16(info.Info))
 	case constant.ConstantClass:
-		return string(info.Info)
+		return classFile.Utf8(binary.BigEndian.Uint16(info.Info))
 	case constant.ConstantFieldRef:
 		return newFieldRef(info, class, classFile)
 	case constant.ConstantMethodRef:
@@ -139,17 +173,63 @@ func newConstant(info model.ConstantInfo, class *Class, classFile *model.ClassFi
 		return newMethodType(info, class, classFile)
 	case constant.ConstantInvokeDynamic:
 		return newInvokeDynamic(info, class, classFile)
+	case constant.ConstantDynamic:
+		return newDynamic(info, class, classFile)
+	case constant.ConstantModule:
+		return &ModuleRef{Name: classFile.Utf8(binary.BigEndian.Uint16(info.Info))}
+	case constant.ConstantPackage:
+		return &PackageRef{Name: classFile.Utf8(binary.BigEndian.Uint16(info.Info))}
 	}
 	return nil
 
 }
 
-func newInvokeDynamic(info model.ConstantInfo, class *Class, file *model.ClassFile) interface{} {
-	return nil
+// InvokeDynamic is a call site specifier: BootstrapMethodAttrIndex selects
+// an entry of the class's BootstrapMethods attribute.
+type InvokeDynamic struct {
+	BootstrapMethodAttrIndex uint16
+	Name                     string
+	Descriptor               string
+}
+
+func newInvokeDynamic(info model.ConstantInfo, class *Class, file *model.ClassFile) *InvokeDynamic {
+	name, descriptor := file.NameAndType(binary.BigEndian.Uint16(info.Info[2:4]))
+	return &InvokeDynamic{
+		BootstrapMethodAttrIndex: binary.BigEndian.Uint16(info.Info[0:2]),
+		Name:                     name,
+		Descriptor:               descriptor,
+	}
+}
+
+// Dynamic is a dynamically-computed constant, produced by running its
+// bootstrap method the first time it is resolved.
+type Dynamic struct {
+	BootstrapMethodAttrIndex uint16
+	Name                     string
+	Descriptor               string
+}
+
+func newDynamic(info model.ConstantInfo, class *Class, file *model.ClassFile) *Dynamic {
+	name, descriptor := file.NameAndType(binary.BigEndian.Uint16(info.Info[2:4]))
+	return &Dynamic{
+		BootstrapMethodAttrIndex: binary.BigEndian.Uint16(info.Info[0:2]),
+		Name:                     name,
+		Descriptor:               descriptor,
+	}
+}
+
+// ModuleRef names a module in a module-info class.
+type ModuleRef struct {
+	Name string
+}
+
+// PackageRef names a package, in internal form, in a module-info class.
+type PackageRef struct {
+	Name string
 }
 
 func newMethodType(info model.ConstantInfo, class *Class, file *model.ClassFile) interface{} {
-	return string(file.ConstantPool[info.Info[0]].Info)
+	return file.Utf8(binary.BigEndian.Uint16(info.Info))
 
 }
 
@@ -172,20 +252,23 @@ type NameAndType struct {
 
 func newNameAndType(info model.ConstantInfo, class *Class, file *model.ClassFile) *NameAndType {
 	return &NameAndType{
-		Name:       string(file.ConstantPool[binary.BigEndian.Uint16(info.Info[0:2])].Info),
-		Descriptor: string(file.ConstantPool[binary.BigEndian.Uint16(info.Info[2:4])].Info),
+		Name:       file.Utf8(binary.BigEndian.Uint16(info.Info[0:2])),
+		Descriptor: file.Utf8(binary.BigEndian.Uint16(info.Info[2:4])),
 	}
 }
 
 type InterfaceMethodRef struct {
 	ClassName       string
 	NameAndTypeName string
+	Descriptor      string
 }
 
 func newInterfaceMethodRef(info model.ConstantInfo, class *Class, file *model.ClassFile) *InterfaceMethodRef {
+	name, descriptor := file.NameAndType(binary.BigEndian.Uint16(info.Info[2:4]))
 	return &InterfaceMethodRef{
-		ClassName:       string(file.ConstantPool[binary.BigEndian.Uint16(info.Info[0:2])].Info),
-		NameAndTypeName: string(file.ConstantPool[binary.BigEndian.Uint16(info.Info[2:4])].Info),
+		ClassName:       file.ClassName(binary.BigEndian.Uint16(info.Info[0:2])),
+		NameAndTypeName: name,
+		Descriptor:      descriptor,
 	}
 }
 
@@ -198,9 +281,11 @@ type MethodRef struct {
 }
 
 func newMethodRef(info model.ConstantInfo, class *Class, file *model.ClassFile) *MethodRef {
+	name, descriptor := file.NameAndType(binary.BigEndian.Uint16(info.Info[2:4]))
 	return &MethodRef{
-		ClassName:       string(file.ConstantPool[binary.BigEndian.Uint16(info.Info[0:2])].Info),
-		NameAndTypeName: string(file.ConstantPool[binary.BigEndian.Uint16(info.Info[2:4])].Info),
+		ClassName:       file.ClassName(binary.BigEndian.Uint16(info.Info[0:2])),
+		NameAndTypeName: name,
+		Descriptor:      descriptor,
 		Class:           class,
 	}
 }
@@ -208,14 +293,17 @@ func newMethodRef(info model.ConstantInfo, class *Class, file *model.ClassFile)
 type FieldRef struct {
 	ClassName       string
 	NameAndTypeName string
+	Descriptor      string
 	Class           *Class
 	ResolvedField   *Field
 }
 
 func newFieldRef(info model.ConstantInfo, class *Class, file *model.ClassFile) *FieldRef {
+	name, descriptor := file.NameAndType(binary.BigEndian.Uint16(info.Info[2:4]))
 	return &FieldRef{
-		ClassName:       string(file.ConstantPool[binary.BigEndian.Uint16(info.Info[0:2])].Info),
-		NameAndTypeName: string(file.ConstantPool[binary.BigEndian.Uint16(info.Info[2:4])].Info),
+		ClassName:       file.ClassName(binary.BigEndian.Uint16(info.Info[0:2])),
+		NameAndTypeName: name,
+		Descriptor:      descriptor,
 		Class:           class,
 	}
 }
@@ -1,43 +1,200 @@
 package rtda
 
 import (
+	"errors"
+	"fmt"
 	"io"
+	"io/fs"
 	"os"
+	"outro/model"
 	"outro/parser"
+	"strings"
 )
 
 type ClassLoader interface {
 	LoadClass(className string) (*Class, error)
 }
 
+// Verifier checks the code of a class file when its class is linked. The
+// class is already defined, so classes it refers to may load it back.
+type Verifier interface {
+	Verify(file *model.ClassFile) error
+}
+
 type ApplicationClassLoader struct {
-	classMap map[string]*Class
+	classMap  map[string]*Class
+	classPath []ClassPathEntry
+	modules   *ModuleGraph
+	verifier  Verifier
+	// transformers see every class file before it is parsed.
+	transformers []ClassFileTransformer
+	listener     ClassListener
+}
+
+// ClassListener is told of the classes a loader defines: ClassLoad when a
+// class is defined and ClassPrepare once it has been verified.
+type ClassListener interface {
+	ClassLoad(class *Class)
+	ClassPrepare(class *Class)
 }
 
 func NewApplicationClassLoader() *ApplicationClassLoader {
-	return &ApplicationClassLoader{classMap: make(map[string]*Class)}
+	return NewModularClassLoader(nil, NewModuleGraph())
+}
+
+// NewModularClassLoader loads classes in resolved modules from their
+// module and everything else from the class path into the unnamed module.
+func NewModularClassLoader(classPath []ClassPathEntry, modules *ModuleGraph) *ApplicationClassLoader {
+	return &ApplicationClassLoader{
+		classMap:  make(map[string]*Class),
+		classPath: classPath,
+		modules:   modules,
+	}
+}
+
+// Modules returns the module graph the loader defines classes in.
+func (a *ApplicationClassLoader) Modules() *ModuleGraph {
+	return a.modules
+}
+
+// SetVerifier makes the loader verify every class it loads from now on;
+// nil turns verification off.
+func (a *ApplicationClassLoader) SetVerifier(verifier Verifier) {
+	a.verifier = verifier
+}
+
+// AppendClassPath adds entry to the end of the class path.
+func (a *ApplicationClassLoader) AppendClassPath(entry ClassPathEntry) {
+	a.classPath = append(a.classPath, entry)
+}
+
+// SetClassListener makes the loader report the classes it defines from
+// now on to listener; nil stops it.
+func (a *ApplicationClassLoader) SetClassListener(listener ClassListener) {
+	a.listener = listener
 }
 
+// LoadClass loads a class by internal name, such as "com/example/Main".
+// A name ending in ".class" is read directly from that file into the
+// unnamed module.
 func (a *ApplicationClassLoader) LoadClass(className string) (*Class, error) {
 	class := a.classMap[className]
 	if class != nil {
 		return class, nil
 	}
-	newClass := ParseClassFile(className)
-	a.classMap[className] = newClass
-	return newClass, nil
+	if strings.HasSuffix(className, ".class") {
+		data, err := os.ReadFile(className)
+		if err != nil {
+			return nil, err
+		}
+		return a.defineClass(className, data, a.modules.Unnamed)
+	}
+	data, module, err := a.findClass(className)
+	if err != nil {
+		return nil, err
+	}
+	return a.defineClass(className, data, module)
 }
 
-func ParseClassFile(name string) *Class {
-	file, err := os.Open("java/classes/MethodInvoke.class")
+// defineClass transforms and parses a class, defines it under key and
+// links it. A class that fails verification is removed again.
+func (a *ApplicationClassLoader) defineClass(key string, data []byte, module *Module) (*Class, error) {
+	file, err := parser.NewClassFileParser(parser.NewByteReader(a.transform(key, data))).Parse()
 	if err != nil {
-		panic(err)
+		return nil, err
+	}
+	if err := parser.CheckFormat(file); err != nil {
+		return nil, err
+	}
+	class := NewClass(file)
+	class.classfile = data
+	if !strings.HasSuffix(key, ".class") && class.Name != key {
+		return nil, fmt.Errorf("java.lang.NoClassDefFoundError: %s (wrong name: %s)", key, class.Name)
+	}
+	a.define(key, class, module)
+	if a.listener != nil {
+		a.listener.ClassLoad(class)
+	}
+	if a.verifier != nil {
+		if err := a.verifier.Verify(file); err != nil {
+			delete(a.classMap, key)
+			return nil, err
+		}
+	}
+	if a.listener != nil {
+		a.listener.ClassPrepare(class)
+	}
+	return class, nil
+}
+
+// findClass reads a class from the module that owns its package, or else
+// from the first class path entry that has it.
+func (a *ApplicationClassLoader) findClass(className string) ([]byte, *Module, error) {
+	if module := a.modules.ModuleOf(packageOf(className)); module != nil {
+		if module.Entry != nil {
+			if data, err := module.Entry.ReadClass(className); err == nil {
+				return data, module, nil
+			} else if !errors.Is(err, fs.ErrNotExist) {
+				return nil, nil, err
+			}
+		}
+		return nil, nil, fmt.Errorf("java.lang.NoClassDefFoundError: %s", className)
+	}
+	for _, entry := range a.classPath {
+		data, err := entry.ReadClass(className)
+		if err == nil {
+			return data, a.modules.Unnamed, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, nil, err
+		}
+	}
+	return nil, nil, fmt.Errorf("java.lang.NoClassDefFoundError: %s", className)
+}
+
+func (a *ApplicationClassLoader) define(key string, class *Class, module *Module) {
+	class.Loader = a
+	class.Module = module
+	a.classMap[key] = class
+}
+
+// ResolveClass loads the class named by a symbolic reference in c and
+// checks that c may access it.
+func (c *Class) ResolveClass(className string) (*Class, error) {
+	if c.Loader == nil {
+		return nil, fmt.Errorf("java.lang.NoClassDefFoundError: %s", className)
+	}
+	class, err := c.Loader.LoadClass(className)
+	if err != nil {
+		return nil, err
+	}
+	if err := CheckClassAccess(c, class); err != nil {
+		return nil, err
+	}
+	return class, nil
+}
+
+func ParseClassFile(name string) (*Class, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
 	}
 	defer file.Close()
 	bytes, err := io.ReadAll(file)
-	reader := parser.NewByteReader(bytes)
-	parser := parser.NewClassFileParser(reader)
-	class := parser.Parse()
-	return NewClass(class)
+	if err != nil {
+		return nil, err
+	}
+	return parseClass(bytes)
+}
 
+func parseClass(bytes []byte) (*Class, error) {
+	reader := parser.NewByteReader(bytes)
+	class, err := parser.NewClassFileParser(reader).Parse()
+	if err != nil {
+		return nil, err
+	}
+	if err := parser.CheckFormat(class); err != nil {
+		return nil, err
+	}
+	return NewClass(class), nil
 }
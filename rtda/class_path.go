@@ -0,0 +1,191 @@
+package rtda
+
+import (
+	"archive/zip"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ClassPathEntry is a directory or jar that classes are read from.
+type ClassPathEntry interface {
+	// ReadClass returns the bytes of the class with the given internal
+	// name, or fs.ErrNotExist.
+	ReadClass(className string) ([]byte, error)
+	// ReadFile returns the bytes of the named resource, such as
+	// "module-info.class" or "META-INF/MANIFEST.MF".
+	ReadFile(name string) ([]byte, error)
+	// Packages lists the packages, in binary form, holding at least one
+	// class.
+	Packages() ([]string, error)
+	String() string
+}
+
+// NewClassPathEntry opens a directory, or a jar when path ends in ".jar".
+func NewClassPathEntry(path string) (ClassPathEntry, error) {
+	absolute, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasSuffix(path, ".jar") {
+		return &jarEntry{path: absolute}, nil
+	}
+	info, err := os.Stat(absolute)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, errors.New("not a directory or jar: " + path)
+	}
+	return &dirEntry{dir: absolute}, nil
+}
+
+// ParseClassPath splits a path list such as "a.jar:classes" into entries.
+func ParseClassPath(path string) ([]ClassPathEntry, error) {
+	var entries []ClassPathEntry
+	for _, element := range filepath.SplitList(path) {
+		if element == "" {
+			continue
+		}
+		entry, err := NewClassPathEntry(element)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+type dirEntry struct {
+	dir string
+}
+
+func (d *dirEntry) ReadClass(className string) ([]byte, error) {
+	return d.ReadFile(className + ".class")
+}
+
+func (d *dirEntry) ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(filepath.Join(d.dir, filepath.FromSlash(name)))
+}
+
+func (d *dirEntry) Packages() ([]string, error) {
+	var names []string
+	err := filepath.WalkDir(d.dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		name, err := filepath.Rel(d.dir, path)
+		if err == nil {
+			names = append(names, filepath.ToSlash(name))
+		}
+		return err
+	})
+	return classPackages(names), err
+}
+
+func (d *dirEntry) String() string {
+	return d.dir
+}
+
+type jarEntry struct {
+	path string
+}
+
+func (j *jarEntry) ReadClass(className string) ([]byte, error) {
+	return j.ReadFile(className + ".class")
+}
+
+func (j *jarEntry) ReadFile(name string) ([]byte, error) {
+	archive, err := zip.OpenReader(j.path)
+	if err != nil {
+		return nil, err
+	}
+	defer archive.Close()
+	file, err := archive.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return io.ReadAll(file)
+}
+
+func (j *jarEntry) Packages() ([]string, error) {
+	archive, err := zip.OpenReader(j.path)
+	if err != nil {
+		return nil, err
+	}
+	defer archive.Close()
+	names := make([]string, len(archive.File))
+	for i, file := range archive.File {
+		names[i] = file.Name
+	}
+	return classPackages(names), nil
+}
+
+func (j *jarEntry) String() string {
+	return j.path
+}
+
+// ManifestAttribute returns a main attribute of the META-INF/MANIFEST.MF of
+// entry, such as "Premain-Class", or "" if it has none.
+func ManifestAttribute(entry ClassPathEntry, name string) string {
+	manifest, err := entry.ReadFile("META-INF/MANIFEST.MF")
+	if err != nil {
+		return ""
+	}
+	// Join continuation lines, which start with a space, and stop at the
+	// blank line that ends the main section.
+	var lines []string
+	for _, line := range strings.Split(strings.ReplaceAll(string(manifest), "\r\n", "\n"), "\n") {
+		if line == "" {
+			break
+		}
+		if strings.HasPrefix(line, " ") && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	for _, line := range lines {
+		if key, value, ok := strings.Cut(line, ":"); ok && strings.EqualFold(key, name) {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
+
+// classPackages returns the sorted packages of the class files among
+// names, ignoring module-info and META-INF.
+func classPackages(names []string) []string {
+	set := map[string]bool{}
+	for _, name := range names {
+		if !strings.HasSuffix(name, ".class") || strings.HasPrefix(name, "META-INF/") {
+			continue
+		}
+		slash := strings.LastIndexByte(name, '/')
+		if slash < 0 {
+			continue
+		}
+		set[strings.ReplaceAll(name[:slash], "/", ".")] = true
+	}
+	packages := make([]string, 0, len(set))
+	for pkg := range set {
+		packages = append(packages, pkg)
+	}
+	sort.Strings(packages)
+	return packages
+}
+
+// packageOf returns the binary name of the package of an internal class
+// name, "" for the unnamed package.
+func packageOf(className string) string {
+	slash := strings.LastIndexByte(className, '/')
+	if slash < 0 {
+		return ""
+	}
+	return strings.ReplaceAll(className[:slash], "/", ".")
+}
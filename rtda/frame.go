@@ -11,23 +11,13 @@ type Frame struct {
 	Method         *Method
 	Thread         *Thread
 	class          *Class
+	// PC is the offset of the instruction the frame is executing.
+	PC int
 }
 
 func (f *Frame) Execute() {
 }
 
-func (f *Frame) NextByte() int32 {
-	return int32(f.Method.Code[f.Thread.PC+1])
-}
-
-func (f *Frame) ReadOffset() int32 {
-	return int32(f.Method.Code[f.Thread.PC+1])<<8 | int32(f.Method.Code[f.Thread.PC+2])
-}
-
-func (f *Frame) NextShort() int32 {
-	return int32(f.Method.Code[f.Thread.PC+1])<<8 + int32(f.Method.Code[f.Thread.PC+2])
-}
-
 func (f *Frame) LocalVariableInt(u uint16) int32 {
 	return f.localVariables[u].(int32)
 }
@@ -44,8 +34,20 @@ func (f *Frame) LocalVariableDouble(u uint16) float64 {
 	return f.localVariables[u].(float64)
 }
 
-func (f *Frame) LocalVariableRef(u uint16) *interface{} {
-	return f.localVariables[u].(*interface{})
+func (f *Frame) LocalVariableRef(u uint16) interface{} {
+	return f.localVariables[u]
+}
+
+// LocalVariables returns a copy of the local variables. A long or double
+// takes one slot followed by an unused one.
+func (f *Frame) LocalVariables() []interface{} {
+	return append([]interface{}(nil), f.localVariables...)
+}
+
+// OperandStack returns a copy of the operand stack, bottom first, with
+// one entry for every value, longs and doubles too.
+func (f *Frame) OperandStack() []interface{} {
+	return append([]interface{}(nil), f.operandStack...)
 }
 
 func (f *Frame) SetLocalVariableRef(u uint16, ref interface{}) {
@@ -157,7 +159,7 @@ func (f *Frame) PopShortArr() []int16 {
 func NewFrame(maxLocals, maxStack uint16, class *model.ClassFile) *Frame {
 	return &Frame{
 		localVariables: make([]interface{}, maxLocals),
-		operandStack:   make([]interface{}, maxStack),
+		operandStack:   make([]interface{}, 0, maxStack),
 		constantPool:   &class.ConstantPool,
 	}
 }
@@ -16,3 +16,7 @@ func NewJString(classLoader *ApplicationClassLoader, str string) *JString {
 	j.class = class
 	return j
 }
+
+func (j *JString) String() string {
+	return j.chars
+}
@@ -0,0 +1,213 @@
+package rtda
+
+import (
+	"fmt"
+	"outro/constant"
+	"outro/model"
+	"strings"
+)
+
+// Module is a run-time module: a named module from the module path, an
+// automatic module made from a plain jar, or the unnamed module holding
+// everything on the class path. System modules stand in for the JDK
+// modules and export every package.
+type Module struct {
+	Name       string
+	Descriptor *model.ModuleDescriptor
+	Automatic  bool
+	Entry      ClassPathEntry
+	Packages   map[string]bool
+	system     bool
+	reads      map[*Module]bool
+	exports    map[string]*packageAccess
+	opens      map[string]*packageAccess
+}
+
+// packageAccess records who a package is exported or opened to.
+type packageAccess struct {
+	all         bool
+	allUnnamed  bool
+	targetNames map[string]bool
+	targets     map[*Module]bool
+}
+
+func (p *packageAccess) allows(to *Module) bool {
+	if p.all || p.targets[to] || to.IsNamed() && p.targetNames[to.Name] {
+		return true
+	}
+	return p.allUnnamed && !to.IsNamed()
+}
+
+func newModule(name string, entry ClassPathEntry) *Module {
+	return &Module{
+		Name:     name,
+		Entry:    entry,
+		Packages: map[string]bool{},
+		reads:    map[*Module]bool{},
+		exports:  map[string]*packageAccess{},
+		opens:    map[string]*packageAccess{},
+	}
+}
+
+// NewUnnamedModule returns the unnamed module of the given class path.
+func NewUnnamedModule() *Module {
+	return newModule("", nil)
+}
+
+// newNamedModule applies the directives of a module descriptor.
+func newNamedModule(descriptor *model.ModuleDescriptor, entry ClassPathEntry) *Module {
+	m := newModule(descriptor.Name, entry)
+	m.Descriptor = descriptor
+	for _, pkg := range descriptor.Packages {
+		m.Packages[pkg] = true
+	}
+	for _, exports := range descriptor.Exports {
+		m.Packages[exports.Package] = true
+		m.exports[exports.Package] = newPackageAccess(exports.To)
+	}
+	for _, opens := range descriptor.Opens {
+		m.Packages[opens.Package] = true
+		m.opens[opens.Package] = newPackageAccess(opens.To)
+	}
+	return m
+}
+
+func newPackageAccess(to []string) *packageAccess {
+	access := &packageAccess{all: len(to) == 0, targetNames: map[string]bool{}, targets: map[*Module]bool{}}
+	for _, name := range to {
+		access.targetNames[name] = true
+	}
+	return access
+}
+
+// IsNamed reports whether m is a named (explicit or automatic) module.
+func (m *Module) IsNamed() bool {
+	return m.Name != ""
+}
+
+// IsOpen reports whether every package of m is open, as for open modules,
+// automatic modules and the unnamed module.
+func (m *Module) IsOpen() bool {
+	if !m.IsNamed() || m.Automatic {
+		return true
+	}
+	return m.Descriptor.Flags&uint16(constant.MODULE_ACC_OPEN) != 0
+}
+
+// CanRead reports whether m reads other. Unnamed and automatic modules
+// read every module.
+func (m *Module) CanRead(other *Module) bool {
+	if m == other || !m.IsNamed() || m.Automatic {
+		return true
+	}
+	return m.reads[other]
+}
+
+// IsExported reports whether pkg of m is exported to the module to. An
+// open package is also exported at run time.
+func (m *Module) IsExported(pkg string, to *Module) bool {
+	if m == to || !m.IsNamed() || m.Automatic || m.system {
+		return true
+	}
+	if access := m.exports[pkg]; access != nil && access.allows(to) {
+		return true
+	}
+	return m.IsOpenTo(pkg, to)
+}
+
+// IsOpenTo reports whether pkg of m is open to deep reflection by the
+// module to.
+func (m *Module) IsOpenTo(pkg string, to *Module) bool {
+	if m == to || m.IsOpen() {
+		return true
+	}
+	access := m.opens[pkg]
+	return access != nil && access.allows(to)
+}
+
+// AddReads makes m read other, as --add-reads or Module.addReads do.
+func (m *Module) AddReads(other *Module) {
+	m.reads[other] = true
+}
+
+// AddExports exports pkg of m to the module to, or to every unnamed
+// module when to is nil.
+func (m *Module) AddExports(pkg string, to *Module) {
+	addPackageAccess(m.exports, pkg, to)
+}
+
+// AddOpens opens pkg of m to the module to, or to every unnamed module
+// when to is nil.
+func (m *Module) AddOpens(pkg string, to *Module) {
+	addPackageAccess(m.opens, pkg, to)
+}
+
+func addPackageAccess(accesses map[string]*packageAccess, pkg string, to *Module) {
+	access := accesses[pkg]
+	if access == nil {
+		access = &packageAccess{targetNames: map[string]bool{}, targets: map[*Module]bool{}}
+		accesses[pkg] = access
+	}
+	if to == nil {
+		access.allUnnamed = true
+	} else {
+		access.targets[to] = true
+	}
+}
+
+func (m *Module) String() string {
+	if !m.IsNamed() {
+		return "unnamed module"
+	}
+	return "module " + m.Name
+}
+
+// CheckClassAccess implements the access check of class resolution
+// (JVMS 5.4.4): a public class is accessible from another module only if
+// that module reads its module and the package is exported to it.
+func CheckClassAccess(from *Class, to *Class) error {
+	if from.Module == nil || to.Module == nil {
+		return nil
+	}
+	pkg := packageOf(to.Name)
+	if to.AccessFlag&uint16(constant.CLASS_ACC_PUBLIC) == 0 {
+		if pkg == packageOf(from.Name) && from.Module == to.Module {
+			return nil
+		}
+		return fmt.Errorf("java.lang.IllegalAccessError: class %s (in %s) cannot access class %s (in %s)",
+			binaryClassName(from.Name), from.Module, binaryClassName(to.Name), to.Module)
+	}
+	if !from.Module.CanRead(to.Module) {
+		return fmt.Errorf("java.lang.IllegalAccessError: class %s (in %s) cannot access class %s (in %s) because %s does not read %s",
+			binaryClassName(from.Name), from.Module, binaryClassName(to.Name), to.Module, from.Module, to.Module)
+	}
+	if !to.Module.IsExported(pkg, from.Module) {
+		return fmt.Errorf("java.lang.IllegalAccessError: class %s (in %s) cannot access class %s (in %s) because %s does not export %s to %s",
+			binaryClassName(from.Name), from.Module, binaryClassName(to.Name), to.Module, to.Module, pkg, from.Module)
+	}
+	return nil
+}
+
+// CheckReflectiveAccess implements the check of AccessibleObject.setAccessible
+// for a member with the given access flags declared in target: public
+// members of public classes need the package exported to the caller,
+// anything else needs it opened.
+func CheckReflectiveAccess(caller *Class, target *Class, memberAccessFlags uint16) error {
+	if caller.Module == nil || target.Module == nil || caller.Module == target.Module {
+		return nil
+	}
+	pkg := packageOf(target.Name)
+	public := uint16(constant.CLASS_ACC_PUBLIC)
+	if target.AccessFlag&public != 0 && memberAccessFlags&public != 0 && target.Module.IsExported(pkg, caller.Module) {
+		return nil
+	}
+	if target.Module.IsOpenTo(pkg, caller.Module) {
+		return nil
+	}
+	return fmt.Errorf("java.lang.reflect.InaccessibleObjectException: Unable to make member of %s accessible: %s does not \"opens %s\" to %s",
+		binaryClassName(target.Name), target.Module, pkg, caller.Module)
+}
+
+func binaryClassName(className string) string {
+	return strings.ReplaceAll(className, "/", ".")
+}
@@ -0,0 +1,378 @@
+package rtda
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"outro/constant"
+	"outro/parser"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ModuleGraph is the set of modules resolved at startup together with the
+// unnamed module of the class path.
+type ModuleGraph struct {
+	Modules  map[string]*Module
+	Unnamed  *Module
+	packages map[string]*Module
+}
+
+// NewModuleGraph returns a graph holding only the unnamed module, as when
+// an application runs entirely from the class path.
+func NewModuleGraph() *ModuleGraph {
+	return &ModuleGraph{
+		Modules:  map[string]*Module{},
+		Unnamed:  NewUnnamedModule(),
+		packages: map[string]*Module{},
+	}
+}
+
+// FindModules lists the modules observable on a module path. Each element
+// is a modular or plain jar, an exploded module directory, or a directory
+// of those. The first module found with a given name wins.
+func FindModules(modulePath string) (map[string]*Module, error) {
+	found := map[string]*Module{}
+	for _, element := range filepath.SplitList(modulePath) {
+		if element == "" {
+			continue
+		}
+		modules, err := findModulesIn(element)
+		if err != nil {
+			return nil, err
+		}
+		for _, module := range modules {
+			if _, ok := found[module.Name]; !ok {
+				found[module.Name] = module
+			}
+		}
+	}
+	return found, nil
+}
+
+func findModulesIn(path string) ([]*Module, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	_, err = os.Stat(filepath.Join(path, "module-info.class"))
+	if !info.IsDir() || err == nil {
+		module, err := openModule(path)
+		if err != nil {
+			return nil, err
+		}
+		return []*Module{module}, nil
+	}
+	children, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	var modules []*Module
+	names := map[string]string{}
+	for _, child := range children {
+		if !child.IsDir() && !strings.HasSuffix(child.Name(), ".jar") {
+			continue
+		}
+		module, err := openModule(filepath.Join(path, child.Name()))
+		if err != nil {
+			return nil, err
+		}
+		if other, ok := names[module.Name]; ok {
+			return nil, fmt.Errorf("java.lang.module.FindException: Two versions of module %s found in %s (%s and %s)",
+				module.Name, path, other, child.Name())
+		}
+		names[module.Name] = child.Name()
+		modules = append(modules, module)
+	}
+	return modules, nil
+}
+
+// openModule reads the module-info class of a jar or directory, or makes
+// an automatic module when it has none.
+func openModule(path string) (*Module, error) {
+	entry, err := NewClassPathEntry(path)
+	if err != nil {
+		return nil, err
+	}
+	packages, err := entry.Packages()
+	if err != nil {
+		return nil, err
+	}
+	var module *Module
+	data, err := entry.ReadFile("module-info.class")
+	switch {
+	case err == nil:
+		classFile, err := parser.NewClassFileParser(parser.NewByteReader(data)).Parse()
+		if err != nil {
+			return nil, fmt.Errorf("java.lang.module.FindException: Error reading module: %s: %w", path, err)
+		}
+		descriptor, err := classFile.ModuleDescriptor()
+		if err != nil {
+			return nil, fmt.Errorf("java.lang.module.FindException: Error reading module: %s: %w", path, err)
+		}
+		module = newNamedModule(descriptor, entry)
+	case errors.Is(err, fs.ErrNotExist):
+		name, err := automaticModuleName(entry, path)
+		if err != nil {
+			return nil, err
+		}
+		module = newModule(name, entry)
+		module.Automatic = true
+	default:
+		return nil, err
+	}
+	for _, pkg := range packages {
+		module.Packages[pkg] = true
+	}
+	return module, nil
+}
+
+var (
+	jarVersion      = regexp.MustCompile(`-(\d+(\.|$))`)
+	nonAlphanumeric = regexp.MustCompile(`[^A-Za-z0-9]`)
+	repeatedDots    = regexp.MustCompile(`\.{2,}`)
+)
+
+// automaticModuleName is the Automatic-Module-Name of the jar manifest, or
+// else the name derived from the file name as ModuleFinder.of does.
+func automaticModuleName(entry ClassPathEntry, path string) (string, error) {
+	if name := ManifestAttribute(entry, "Automatic-Module-Name"); name != "" {
+		return name, nil
+	}
+	name := strings.TrimSuffix(filepath.Base(path), ".jar")
+	if location := jarVersion.FindStringIndex(name); location != nil {
+		name = name[:location[0]]
+	}
+	name = nonAlphanumeric.ReplaceAllString(name, ".")
+	name = strings.Trim(repeatedDots.ReplaceAllString(name, "."), ".")
+	if name == "" {
+		return "", errors.New("java.lang.module.FindException: Unable to derive module descriptor for " + path)
+	}
+	return name, nil
+}
+
+// ResolveModules resolves the root modules and, transitively, everything
+// they require from the observable modules, then computes readability.
+// Missing java.* and jdk.* modules resolve to placeholder system modules,
+// since outro has no runtime image of its own.
+func ResolveModules(observable map[string]*Module, roots []string) (*ModuleGraph, error) {
+	graph := NewModuleGraph()
+	queue := append([]string(nil), roots...)
+	requiredBy := map[string]string{}
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		if graph.Modules[name] != nil {
+			continue
+		}
+		module := observable[name]
+		if module == nil {
+			if !isSystemModuleName(name) {
+				if requiredBy[name] != "" {
+					return nil, fmt.Errorf("java.lang.module.FindException: Module %s not found, required by %s", name, requiredBy[name])
+				}
+				return nil, fmt.Errorf("java.lang.module.FindException: Module %s not found", name)
+			}
+			module = newModule(name, nil)
+			module.system = true
+		}
+		graph.Modules[name] = module
+		if module.Automatic {
+			for _, other := range observable {
+				if other.Automatic {
+					queue = append(queue, other.Name)
+				}
+			}
+		}
+		if module.Descriptor == nil {
+			continue
+		}
+		for _, requires := range module.Descriptor.Requires {
+			if requires.Flags&uint16(constant.REQUIRES_ACC_STATIC_PHASE) != 0 {
+				continue
+			}
+			if requiredBy[requires.Name] == "" {
+				requiredBy[requires.Name] = name
+			}
+			queue = append(queue, requires.Name)
+		}
+	}
+	if err := graph.checkCycles(); err != nil {
+		return nil, err
+	}
+	graph.computeReadability()
+	return graph, graph.indexPackages()
+}
+
+func isSystemModuleName(name string) bool {
+	return strings.HasPrefix(name, "java.") || strings.HasPrefix(name, "jdk.")
+}
+
+func (g *ModuleGraph) checkCycles() error {
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := map[*Module]int{}
+	var path []string
+	var visit func(m *Module) error
+	visit = func(m *Module) error {
+		switch state[m] {
+		case visiting:
+			return fmt.Errorf("java.lang.module.ResolutionException: Cycle detected: %s -> %s", strings.Join(path, " -> "), m.Name)
+		case done:
+			return nil
+		}
+		state[m] = visiting
+		path = append(path, m.Name)
+		for _, required := range g.required(m, false) {
+			if err := visit(required); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[m] = done
+		return nil
+	}
+	for _, name := range g.sortedNames() {
+		if err := visit(g.Modules[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// required returns the resolved modules that m requires, or only those it
+// requires transitively.
+func (g *ModuleGraph) required(m *Module, transitive bool) []*Module {
+	if m.Descriptor == nil {
+		return nil
+	}
+	var modules []*Module
+	for _, requires := range m.Descriptor.Requires {
+		if transitive && requires.Flags&uint16(constant.REQUIRES_ACC_TRANSITIVE) == 0 {
+			continue
+		}
+		if required := g.Modules[requires.Name]; required != nil {
+			modules = append(modules, required)
+		}
+	}
+	return modules
+}
+
+// computeReadability makes each module read what it requires, everything
+// implied by requires transitive, and java.base. Reading an automatic
+// module implies reading every automatic module.
+func (g *ModuleGraph) computeReadability() {
+	var automatic []*Module
+	for _, m := range g.Modules {
+		if m.Automatic {
+			automatic = append(automatic, m)
+		}
+	}
+	var addReads func(m *Module, other *Module)
+	addReads = func(m *Module, other *Module) {
+		if m.reads[other] {
+			return
+		}
+		m.AddReads(other)
+		for _, implied := range g.required(other, true) {
+			addReads(m, implied)
+		}
+		if other.Automatic {
+			for _, a := range automatic {
+				m.AddReads(a)
+			}
+		}
+	}
+	for _, m := range g.Modules {
+		if javaBase := g.Modules["java.base"]; javaBase != nil {
+			m.AddReads(javaBase)
+		}
+		for _, required := range g.required(m, false) {
+			addReads(m, required)
+		}
+	}
+	for _, m := range g.Modules {
+		for _, exports := range m.exports {
+			for name := range exports.targetNames {
+				if target := g.Modules[name]; target != nil {
+					exports.targets[target] = true
+				}
+			}
+		}
+		for _, opens := range m.opens {
+			for name := range opens.targetNames {
+				if target := g.Modules[name]; target != nil {
+					opens.targets[target] = true
+				}
+			}
+		}
+	}
+}
+
+// indexPackages maps each package to its module, rejecting packages split
+// across modules.
+func (g *ModuleGraph) indexPackages() error {
+	for _, name := range g.sortedNames() {
+		m := g.Modules[name]
+		for pkg := range m.Packages {
+			if other := g.packages[pkg]; other != nil {
+				return fmt.Errorf("java.lang.module.ResolutionException: Package %s in both module %s and module %s", pkg, other.Name, m.Name)
+			}
+			g.packages[pkg] = m
+		}
+	}
+	return nil
+}
+
+func (g *ModuleGraph) sortedNames() []string {
+	names := make([]string, 0, len(g.Modules))
+	for name := range g.Modules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ModuleOf returns the resolved module defining pkg, or nil if the
+// package belongs to the class path.
+func (g *ModuleGraph) ModuleOf(pkg string) *Module {
+	return g.packages[pkg]
+}
+
+// AddExports applies an --add-exports value, source/package=target(,target)*,
+// where ALL-UNNAMED stands for every unnamed module. With open set it
+// applies --add-opens instead.
+func (g *ModuleGraph) AddExports(value string, open bool) error {
+	option := "--add-exports"
+	if open {
+		option = "--add-opens"
+	}
+	sourcePackage, targets, ok := strings.Cut(value, "=")
+	source, pkg, ok2 := strings.Cut(sourcePackage, "/")
+	if !ok || !ok2 || source == "" || pkg == "" || targets == "" {
+		return fmt.Errorf("%s %s: expected <module>/<package>=<target-module>(,<target-module>)*", option, value)
+	}
+	module := g.Modules[source]
+	if module == nil {
+		return fmt.Errorf("%s %s: unknown module %s", option, value, source)
+	}
+	for _, target := range strings.Split(targets, ",") {
+		var to *Module
+		if target != "ALL-UNNAMED" {
+			if to = g.Modules[target]; to == nil {
+				return fmt.Errorf("%s %s: unknown module %s", option, value, target)
+			}
+		}
+		if open {
+			module.AddOpens(pkg, to)
+		} else {
+			module.AddExports(pkg, to)
+		}
+	}
+	return nil
+}
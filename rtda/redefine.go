@@ -0,0 +1,129 @@
+package rtda
+
+import (
+	"fmt"
+	"outro/parser"
+)
+
+// ClassDefinition pairs a loaded class with the class file to redefine it
+// with, like java.lang.instrument.ClassDefinition.
+type ClassDefinition struct {
+	Class *Class
+	Bytes []byte
+}
+
+// RedefineClasses replaces the methods of loaded classes with those of new
+// class files, which must declare the same superclass, interfaces,
+// fields and methods, differing only in code. Either every class is
+// redefined or, on an error, none is. Frames running an old method finish
+// with its old code and constants; methods looked up afterwards are the
+// new ones. Static fields keep their values.
+func (a *ApplicationClassLoader) RedefineClasses(definitions ...ClassDefinition) error {
+	redefined := make([]*Class, len(definitions))
+	for i, definition := range definitions {
+		class, err := a.redefinition(definition.Class, definition.Bytes)
+		if err != nil {
+			return err
+		}
+		redefined[i] = class
+	}
+	for i, definition := range definitions {
+		class := definition.Class
+		for _, method := range redefined[i].Methods {
+			method.Class = class
+		}
+		class.ConstantPool = redefined[i].ConstantPool
+		class.Methods = redefined[i].Methods
+		class.classfile = definition.Bytes
+	}
+	return nil
+}
+
+// RetransformClasses redefines classes with the class files they were
+// last defined with, running them through the transformers registered
+// now.
+func (a *ApplicationClassLoader) RetransformClasses(classes ...*Class) error {
+	definitions := make([]ClassDefinition, len(classes))
+	for i, class := range classes {
+		definitions[i] = ClassDefinition{Class: class, Bytes: class.classfile}
+	}
+	return a.RedefineClasses(definitions...)
+}
+
+// redefinition transforms, parses and verifies the new class file of
+// class and checks that it changes nothing but code.
+func (a *ApplicationClassLoader) redefinition(class *Class, data []byte) (*Class, error) {
+	if class.Loader != a || class.classfile == nil {
+		return nil, fmt.Errorf("java.lang.instrument.UnmodifiableClassException: %s", class.Name)
+	}
+	file, err := parser.NewClassFileParser(parser.NewByteReader(a.transform(class.Name, data))).Parse()
+	if err != nil {
+		return nil, err
+	}
+	if err := parser.CheckFormat(file); err != nil {
+		return nil, err
+	}
+	redefined := NewClass(file)
+	if redefined.Name != class.Name {
+		return nil, fmt.Errorf("java.lang.NoClassDefFoundError: %s (wrong name: %s)", class.Name, redefined.Name)
+	}
+	if err := checkRedefinition(class, redefined); err != nil {
+		return nil, fmt.Errorf("java.lang.UnsupportedOperationException: class redefinition failed: %s", err)
+	}
+	if a.verifier != nil {
+		if err := a.verifier.Verify(file); err != nil {
+			return nil, err
+		}
+	}
+	return redefined, nil
+}
+
+// checkRedefinition reports the first change of redefined to class that a
+// redefinition does not support, in the words of HotSpot.
+func checkRedefinition(class, redefined *Class) error {
+	if redefined.SuperClassName != class.SuperClassName || !equalStrings(redefined.InterfaceNames, class.InterfaceNames) {
+		return fmt.Errorf("attempted to change superclass or interfaces")
+	}
+	if redefined.AccessFlag != class.AccessFlag {
+		return fmt.Errorf("attempted to change the class modifiers")
+	}
+	if len(redefined.Fields) != len(class.Fields) {
+		return fmt.Errorf("attempted to change the schema (add/remove fields)")
+	}
+	for i, field := range class.Fields {
+		r := redefined.Fields[i]
+		if r.Name != field.Name || r.Descriptor != field.Descriptor || r.AccessFlag != field.AccessFlag {
+			return fmt.Errorf("attempted to change the schema (add/remove fields)")
+		}
+	}
+	methods := make(map[string]*Method, len(class.Methods))
+	for _, method := range class.Methods {
+		methods[method.Name+method.Descriptor] = method
+	}
+	for _, r := range redefined.Methods {
+		method := methods[r.Name+r.Descriptor]
+		if method == nil {
+			return fmt.Errorf("attempted to add a method")
+		}
+		if r.AccessFlag != method.AccessFlag {
+			return fmt.Errorf("attempted to change method modifiers")
+		}
+		delete(methods, r.Name+r.Descriptor)
+	}
+	if len(methods) > 0 {
+		return fmt.Errorf("attempted to delete a method")
+	}
+	return nil
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
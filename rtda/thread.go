@@ -26,6 +26,20 @@ func (t *Thread) PopFrame() *Frame {
 	return frame
 }
 
+// StackDepth returns the number of frames on the stack.
+func (t *Thread) StackDepth() int {
+	return len(t.stack)
+}
+
+// Frame returns the frame at depth, 0 being the current frame, or nil if
+// the stack is not that deep.
+func (t *Thread) Frame(depth int) *Frame {
+	if depth < 0 || depth >= len(t.stack) {
+		return nil
+	}
+	return t.stack[len(t.stack)-1-depth]
+}
+
 func (t *Thread) CurrentFrame() *Frame {
 	return t.stack[len(t.stack)-1]
 }
@@ -39,6 +53,6 @@ func (t *Thread) NewFrame(method *Method) {
 	frame.Method = method
 	frame.Thread = t
 	frame.localVariables = make([]interface{}, method.MaxLocals)
-	frame.operandStack = make([]interface{}, method.MaxStack)
+	frame.operandStack = make([]interface{}, 0, method.MaxStack)
 	t.PushFrame(&frame)
 }
@@ -0,0 +1,72 @@
+package rtda
+
+import (
+	"outro/parser"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ClassFileTransformer changes class files before their classes are
+// defined, like java.lang.instrument.ClassFileTransformer.
+type ClassFileTransformer interface {
+	// Transform returns the bytes to define in place of classfileBuffer,
+	// or nil to leave the class as it is. className is the internal name,
+	// such as "com/example/Main".
+	Transform(loader ClassLoader, className string, classfileBuffer []byte) []byte
+}
+
+// AddTransformer makes the loader pass every class it defines from now on
+// through transformer, after the transformers added before it.
+func (a *ApplicationClassLoader) AddTransformer(transformer ClassFileTransformer) {
+	a.transformers = append(a.transformers, transformer)
+}
+
+// RemoveTransformer unregisters transformer and reports whether it was
+// registered.
+func (a *ApplicationClassLoader) RemoveTransformer(transformer ClassFileTransformer) bool {
+	for i, t := range a.transformers {
+		if t == transformer {
+			a.transformers = append(a.transformers[:i:i], a.transformers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// LoadedClasses returns the classes the loader has defined, by name.
+func (a *ApplicationClassLoader) LoadedClasses() []*Class {
+	classes := make([]*Class, 0, len(a.classMap))
+	for _, class := range a.classMap {
+		classes = append(classes, class)
+	}
+	sort.Slice(classes, func(i, j int) bool { return classes[i].Name < classes[j].Name })
+	return classes
+}
+
+// transform runs the transformers in turn over the class file of the class
+// defined under key.
+func (a *ApplicationClassLoader) transform(key string, data []byte) []byte {
+	if len(a.transformers) == 0 {
+		return data
+	}
+	className := classFileName(key, data)
+	for _, transformer := range a.transformers {
+		if transformed := transformer.Transform(a, className, data); transformed != nil {
+			data = transformed
+		}
+	}
+	return data
+}
+
+// classFileName returns the name of the class defined under key, which for
+// a class read from a file is the one the file declares.
+func classFileName(key string, data []byte) string {
+	if !strings.HasSuffix(key, ".class") {
+		return key
+	}
+	if file, err := parser.NewClassFileParser(parser.NewByteReader(data)).Parse(); err == nil {
+		return file.ClassName(file.ThisClass)
+	}
+	return strings.TrimSuffix(filepath.Base(key), ".class")
+}
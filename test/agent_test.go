@@ -0,0 +1,198 @@
+package test
+
+import (
+	"outro/interpreter"
+	"outro/launcher"
+	"outro/rtda"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const plainSource = `.class public super gen/Plain
+.super java/lang/Object
+.method public static f()V
+    return
+.end method
+`
+
+// replacer defines the class name with the bytes of another class file and
+// records the classes it sees.
+type replacer struct {
+	name        string
+	replacement []byte
+	seen        []string
+	loader      rtda.ClassLoader
+}
+
+func (r *replacer) Transform(loader rtda.ClassLoader, className string, classfileBuffer []byte) []byte {
+	r.seen = append(r.seen, className)
+	r.loader = loader
+	if className != r.name {
+		return nil
+	}
+	return r.replacement
+}
+
+// premainSource is an agent whose premain divides by zero unless it gets
+// null options and an instrumentation. It predates stack map frames.
+const premainSource = `.bytecode 49.0
+.class public super gen/Agent
+.super java/lang/Object
+.method public static premain(Ljava/lang/String;Ljava/lang/instrument/Instrumentation;)V
+    aload_0
+    ifnonnull Fail
+    aload_1
+    ifnull Fail
+    return
+Fail:
+    iconst_1
+    iconst_0
+    idiv
+    pop
+    return
+.end method
+`
+
+func TestAgent(t *testing.T) {
+	Convey("Test Agent", t, func() {
+		Convey("transformers replace the bytes of classes", func() {
+			loader := classPathLoader(t, map[string]string{"gen/Plain": plainSource})
+			replacement := mustAssemble(plainSource + `.method public static g()V
+    return
+.end method
+`)
+			transformer := &replacer{name: "gen/Plain", replacement: replacement}
+			jvm := &interpreter.JVM{Loader: loader}
+			jvm.AddTransformer(transformer)
+
+			class, err := loader.LoadClass("gen/Plain")
+			So(err, ShouldBeNil)
+			So(transformer.seen, ShouldResemble, []string{"gen/Plain"})
+			So(transformer.loader, ShouldEqual, loader)
+			_, err = class.GetStaticMethod("g", "()V")
+			So(err, ShouldBeNil)
+			So(jvm.Instrumentation().AllLoadedClasses(), ShouldResemble, []*rtda.Class{class})
+
+			So(jvm.Instrumentation().RemoveTransformer(transformer), ShouldBeTrue)
+			So(jvm.Instrumentation().RemoveTransformer(transformer), ShouldBeFalse)
+		})
+
+		Convey("classes read from files are transformed by their name", func() {
+			loader := rtda.NewApplicationClassLoader()
+			transformer := &replacer{}
+			loader.AddTransformer(transformer)
+			_, err := loader.LoadClass("../java/classes/HelloWorld.class")
+			So(err, ShouldBeNil)
+			So(transformer.seen, ShouldResemble, []string{"org/example/HelloWorld"})
+		})
+
+		Convey("-javaagent runs premain before main", func() {
+			dir := t.TempDir()
+			agent := mustAssemble(premainSource)
+			jar := filepath.Join(dir, "agent.jar")
+			writeJar(jar, map[string][]byte{
+				"META-INF/MANIFEST.MF": []byte("Manifest-Version: 1.0\r\nPremain-Class: gen.Age\r\n nt\r\n\r\n"),
+				"gen/Agent.class":      agent,
+			})
+
+			options, err := launcher.ParseOptions([]string{"-javaagent:" + jar, "-cp", dir, "gen.Main"})
+			So(err, ShouldBeNil)
+			So(options.JavaAgents, ShouldResemble, []string{jar})
+			So(options.MainClass, ShouldEqual, "gen.Main")
+			loader, err := options.NewClassLoader()
+			So(err, ShouldBeNil)
+			agents, err := options.LoadAgents(loader)
+			So(err, ShouldBeNil)
+			So(agents, ShouldHaveLength, 1)
+			So(agents[0].Class.Name, ShouldEqual, "gen/Agent")
+			So(agents[0].Options, ShouldEqual, "")
+
+			jvm := &interpreter.JVM{Thread: rtda.NewThread(), Loader: loader}
+			So(jvm.RunPremain(agents[0].Class, agents[0].Options), ShouldBeNil)
+			So(jvm.Thread.StackDepth(), ShouldEqual, 0)
+		})
+
+		Convey("premain failures are reported", func() {
+			dir := t.TempDir()
+			agent := mustAssemble(premainSource)
+			jar := filepath.Join(dir, "agent.jar")
+			writeJar(jar, map[string][]byte{
+				"META-INF/MANIFEST.MF": []byte("Manifest-Version: 1.0\nPremain-Class: gen.Agent\n"),
+				"gen/Agent.class":      agent,
+				"java/lang/String.class": mustAssemble(`.class public final super java/lang/String
+.super java/lang/Object
+`),
+			})
+			options, err := launcher.ParseOptions([]string{"-javaagent:" + jar + "=verbose", "Main"})
+			So(err, ShouldBeNil)
+			loader, err := options.NewClassLoader()
+			So(err, ShouldBeNil)
+			agents, err := options.LoadAgents(loader)
+			So(err, ShouldBeNil)
+			So(agents[0].Options, ShouldEqual, "verbose")
+			jvm := &interpreter.JVM{Thread: rtda.NewThread(), Loader: loader}
+			So(jvm.RunPremain(agents[0].Class, agents[0].Options).Error(), ShouldEqual, "gen/Agent.premain: java.lang.ArithmeticException: / by zero")
+			So(jvm.Thread.StackDepth(), ShouldEqual, 0)
+		})
+
+		Convey("premain(String) does not get the instrumentation", func() {
+			loader := classPathLoader(t, map[string]string{"gen/Agent": `.bytecode 49.0
+.class public super gen/Agent
+.super java/lang/Object
+.method public static premain(Ljava/lang/String;)V
+    .limit locals 2
+    iconst_1
+    istore_1
+    return
+.end method
+`})
+			class, err := loader.LoadClass("gen/Agent")
+			So(err, ShouldBeNil)
+			jvm := &interpreter.JVM{Thread: rtda.NewThread(), Loader: loader}
+			jvm.AddCapabilities(interpreter.Capabilities{CanGenerateMethodEntryEvents: true, CanAccessLocalVariables: true})
+			var locals []interface{}
+			jvm.SetEventCallbacks(interpreter.EventCallbacks{
+				MethodEntry: func(thread *rtda.Thread, method *rtda.Method) {
+					locals, err = jvm.GetLocalVariables(thread, 0)
+				},
+			})
+			So(jvm.SetEventNotificationMode(true, interpreter.MethodEntry), ShouldBeNil)
+			So(jvm.RunPremain(class, ""), ShouldBeNil)
+			So(err, ShouldBeNil)
+			So(locals, ShouldResemble, []interface{}{nil, nil})
+		})
+
+		Convey("premains the interpreter cannot run are refused", func() {
+			loader := classPathLoader(t, map[string]string{"gen/Agent": `.bytecode 49.0
+.class public super gen/Agent
+.super java/lang/Object
+.method public static premain(Ljava/lang/String;)V
+    invokestatic gen/Agent/setUp()V
+    return
+.end method
+.method public static setUp()V
+    return
+.end method
+`})
+			class, err := loader.LoadClass("gen/Agent")
+			So(err, ShouldBeNil)
+			jvm := &interpreter.JVM{Thread: rtda.NewThread(), Loader: loader}
+			err = jvm.RunPremain(class, "")
+			So(err.Error(), ShouldEqual, "gen/Agent.premain uses invokestatic at offset 0, which outro cannot run yet")
+			So(jvm.Thread.StackDepth(), ShouldEqual, 0)
+		})
+
+		Convey("agent jars need a Premain-Class", func() {
+			jar := filepath.Join(t.TempDir(), "agent.jar")
+			writeJar(jar, map[string][]byte{"META-INF/MANIFEST.MF": []byte("Manifest-Version: 1.0\n")})
+			options, err := launcher.ParseOptions([]string{"-javaagent:" + jar, "Main"})
+			So(err, ShouldBeNil)
+			loader, err := options.NewClassLoader()
+			So(err, ShouldBeNil)
+			_, err = options.LoadAgents(loader)
+			So(err.Error(), ShouldEqual, "failed to find Premain-Class manifest attribute in "+jar)
+		})
+	})
+}
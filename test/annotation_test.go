@@ -0,0 +1,105 @@
+package test
+
+import (
+	"encoding/binary"
+	. "github.com/smartystreets/goconvey/convey"
+	"outro/constant"
+	"outro/model"
+	"outro/parser"
+	"testing"
+)
+
+// annotatedClassBytes assembles class Foo carrying
+// @com.example.Ann(value=42, names={"a\"b"}, kind=ElementType.TYPE, type=String[].class, nested=@com.example.Inner).
+func annotatedClassBytes() []byte {
+	u2 := func(data []byte, v uint16) []byte { return binary.BigEndian.AppendUint16(data, v) }
+	var annotation []byte
+	annotation = u2(u2(annotation, 4), 5)
+	annotation = u2(append(u2(annotation, 5), 'I'), 6)
+	annotation = u2(append(u2(append(u2(annotation, 7), '['), 1), 's'), 8)
+	annotation = u2(u2(append(u2(annotation, 9), 'e'), 10), 11)
+	annotation = u2(append(u2(annotation, 12), 'c'), 13)
+	annotation = u2(u2(append(u2(annotation, 14), '@'), 15), 0)
+	return annotatedClassBytesWith(annotation)
+}
+
+// annotatedClassBytesWith assembles class Foo with one runtime visible
+// annotation, whose type and element values index the constant pool of
+// annotatedClassBytes.
+func annotatedClassBytesWith(annotation []byte) []byte {
+	u2 := func(data []byte, v uint16) []byte { return binary.BigEndian.AppendUint16(data, v) }
+	utf8 := func(data []byte, s string) []byte {
+		return append(u2(append(data, constant.ConstantUtf8), uint16(len(s))), s...)
+	}
+	data := binary.BigEndian.AppendUint32(nil, constant.ClassFileMagic)
+	data = u2(u2(data, 0), 61)
+	data = u2(data, 18)
+	data = utf8(data, "Foo")                                                         // 1
+	data = u2(append(data, constant.ConstantClass), 1)                               // 2
+	data = utf8(data, "RuntimeVisibleAnnotations")                                   // 3
+	data = utf8(data, "Lcom/example/Ann;")                                           // 4
+	data = utf8(data, "value")                                                       // 5
+	data = binary.BigEndian.AppendUint32(append(data, constant.ConstantInteger), 42) // 6
+	data = utf8(data, "names")                                                       // 7
+	data = utf8(data, `a"b`)                                                         // 8
+	data = utf8(data, "kind")                                                        // 9
+	data = utf8(data, "Ljava/lang/annotation/ElementType;")                          // 10
+	data = utf8(data, "TYPE")                                                        // 11
+	data = utf8(data, "type")                                                        // 12
+	data = utf8(data, "[Ljava/lang/String;")                                         // 13
+	data = utf8(data, "nested")                                                      // 14
+	data = utf8(data, "Lcom/example/Inner;")                                         // 15
+	data = utf8(data, "AnnotationDefault")                                           // 16
+	data = utf8(data, "unused")                                                      // 17
+
+	body := append(u2(nil, 1), annotation...)
+
+	data = u2(data, uint16(constant.CLASS_ACC_PUBLIC))
+	data = u2(u2(u2(u2(u2(data, 2), 0), 0), 0), 0)
+	data = u2(data, 1)
+	data = binary.BigEndian.AppendUint32(u2(data, 3), uint32(len(body)))
+	return append(data, body...)
+}
+
+func TestAnnotations(t *testing.T) {
+	Convey("Test Annotations", t, func() {
+		class, err := parser.NewClassFileParser(parser.NewByteReader(annotatedClassBytes())).Parse()
+		So(err, ShouldBeNil)
+		annotations := class.Attributes.Get("RuntimeVisibleAnnotations").(*model.RuntimeVisibleAnnotationsAttributeInfo).Annotations
+		So(len(annotations), ShouldEqual, 1)
+		So(len(annotations[0].ElementValuePairs), ShouldEqual, 5)
+		So(annotations[0].ElementValuePairs[1].Value.ArrayValue[0].Tag, ShouldEqual, 's')
+		So(class.AnnotationString(&annotations[0]), ShouldEqual,
+			`@com.example.Ann(value=42, names={"a\"b"}, kind=java.lang.annotation.ElementType.TYPE, type=java.lang.String[].class, nested=@com.example.Inner)`)
+
+		nested := binary.BigEndian.AppendUint16(nil, 4)
+		nested = binary.BigEndian.AppendUint16(nested, 1)
+		nested = binary.BigEndian.AppendUint16(nested, 5)
+		for i := 0; i < 100000; i++ {
+			nested = append(nested, '[', 0, 1)
+		}
+		nested = append(nested, 'I', 0, 6)
+		cfe := classFormatError(parseBytes(annotatedClassBytesWith(nested)))
+		So(cfe, ShouldNotBeNil)
+		So(cfe.Reason, ShouldContainSubstring, "element values nested deeper than 256")
+	})
+	Convey("Test Element Value Rendering", t, func() {
+		class := &model.ClassFile{ConstantPool: []model.ConstantInfo{
+			{},
+			{Tag: constant.ConstantInteger, Info: []byte{0xff, 0xff, 0xff, 0xff}},
+			{Tag: constant.ConstantFloat, Info: []byte{0x7f, 0xc0, 0, 0}},
+			{Tag: constant.ConstantLong, Info: []byte{0, 0, 0, 0, 0, 0, 0, 7}},
+			{},
+			{Tag: constant.ConstantUtf8, Utf8: "Lcom/example/Only;"},
+			{Tag: constant.ConstantUtf8, Utf8: "value"},
+			{Tag: constant.ConstantInteger, Info: []byte{0, 0, 0, 'x'}},
+		}}
+		So(class.ElementValueString(&model.ElementValue{Tag: 'B', ConstValueIndex: 1}), ShouldEqual, "(byte)-1")
+		So(class.ElementValueString(&model.ElementValue{Tag: 'Z', ConstValueIndex: 1}), ShouldEqual, "true")
+		So(class.ElementValueString(&model.ElementValue{Tag: 'F', ConstValueIndex: 2}), ShouldEqual, "Float.NaN")
+		So(class.ElementValueString(&model.ElementValue{Tag: 'J', ConstValueIndex: 3}), ShouldEqual, "7L")
+		So(class.ElementValueString(&model.ElementValue{Tag: 'C', ConstValueIndex: 7}), ShouldEqual, "'x'")
+		single := &model.AnnotationInfo{TypeIndex: 5, ElementValuePairs: []model.ElementValuePair{{ElementNameIndex: 6, Value: model.ElementValue{Tag: 'I', ConstValueIndex: 1}}}}
+		So(class.AnnotationString(single), ShouldEqual, "@com.example.Only(-1)")
+	})
+}
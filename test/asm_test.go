@@ -0,0 +1,263 @@
+package test
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"outro/asm"
+	"outro/interpreter"
+	"outro/model"
+	"outro/parser"
+	"outro/rtda"
+	"outro/tool"
+	"outro/verifier"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// reassemble assembles source and disassembles the result.
+func reassemble(source string) (*model.ClassFile, string) {
+	class := assembleClass(source)
+	text, err := asm.Disassemble(class)
+	So(err, ShouldBeNil)
+	return class, text
+}
+
+// allOpcodesSource declares a method using every instruction once. Enough
+// fields precede it that "late" lands beyond the reach of ldc.
+func allOpcodesSource() string {
+	const branch = "L0"
+	operands := map[string]string{
+		"bipush": "-10", "sipush": "1000", "ldc": "7", "ldc_w": `"late"`, "ldc2_w": "5L",
+		"iload": "4", "lload": "4", "fload": "4", "dload": "4", "aload": "4",
+		"istore": "4", "lstore": "4", "fstore": "4", "dstore": "4", "astore": "4",
+		"ret": "4", "iinc": "4 -1",
+		"tableswitch":     "-1 1\n        L0\n        L0\n        L0\n        default: L0",
+		"lookupswitch":    "\n        -5: L0\n        100: L0\n        default: L0",
+		"getstatic":       "gen/All/c I",
+		"putstatic":       "gen/All/c I",
+		"getfield":        "gen/All/f0 I",
+		"putfield":        "gen/All/f0 I",
+		"invokevirtual":   "java/lang/Object/hashCode()I",
+		"invokespecial":   "java/lang/Object/<init>()V",
+		"invokestatic":    "interface java/util/List/of(Ljava/lang/Object;)Ljava/util/List;",
+		"invokeinterface": "java/lang/Runnable/run()V 1",
+		"invokedynamic": "run()Ljava/lang/Runnable; invokestatic java/lang/invoke/LambdaMetafactory/metafactory" +
+			"(Ljava/lang/invoke/MethodHandles$Lookup;Ljava/lang/String;Ljava/lang/invoke/MethodType;" +
+			"Ljava/lang/invoke/MethodType;Ljava/lang/invoke/MethodHandle;Ljava/lang/invoke/MethodType;)" +
+			"Ljava/lang/invoke/CallSite; { methodtype ()V methodhandle invokestatic gen/All/lambda()V methodtype ()V }",
+		"new": "java/lang/Object", "newarray": "boolean", "anewarray": "java/lang/String",
+		"checkcast": "[I", "instanceof": "gen/All", "multianewarray": "[[I 2",
+		"wide": "iinc 300 1000",
+	}
+	var names []string
+	for opcode, name := range interpreter.InstructDisplayNameMap {
+		if opcode >= interpreter.IFEQ && opcode <= interpreter.JSR || opcode == interpreter.IFNULL ||
+			opcode == interpreter.IFNONNULL || opcode == interpreter.GOTO_W || opcode == interpreter.JSR_W {
+			operands[name] = branch
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var sb strings.Builder
+	sb.WriteString(".class public super gen/All\n.super java/lang/Object\n.field static c I = 7\n")
+	for i := 0; i < 300; i++ {
+		fmt.Fprintf(&sb, ".field f%d I\n", i)
+	}
+	sb.WriteString(".method public static all()V\n    .limit stack 10\n    .limit locals 400\nL0:\n")
+	for _, name := range names {
+		sb.WriteString("    " + strings.TrimSpace(name+" "+operands[name]) + "\n")
+	}
+	sb.WriteString(".end method\n")
+	return sb.String()
+}
+
+func TestAssembler(t *testing.T) {
+	Convey("Test assembler and disassembler", t, func() {
+		Convey("disassemble fixtures into text that reassembles to the same text", func() {
+			for _, name := range []string{"HelloWorld", "MethodInvoke"} {
+				data, err := os.ReadFile("../java/classes/" + name + ".class")
+				So(err, ShouldBeNil)
+				class, err := parser.NewClassFileParser(parser.NewByteReader(data)).Parse()
+				So(err, ShouldBeNil)
+				text, err := asm.Disassemble(class)
+				So(err, ShouldBeNil)
+				So(text, ShouldContainSubstring, ".source "+name+".java")
+				_, again := reassemble(text)
+				So(again, ShouldEqual, text)
+
+				// The class the asm command writes verifies like the original.
+				dir := t.TempDir()
+				source := filepath.Join(dir, name+".j")
+				So(os.WriteFile(source, []byte(text), 0o644), ShouldBeNil)
+				So(tool.Asm([]string{"-d", dir, source}, &bytes.Buffer{}), ShouldBeNil)
+				entries, err := rtda.ParseClassPath(dir)
+				So(err, ShouldBeNil)
+				loader := rtda.NewModularClassLoader(entries, rtda.NewModuleGraph())
+				loader.SetVerifier(verifier.New(loader))
+				_, err = loader.LoadClass("org/example/" + name)
+				So(err, ShouldBeNil)
+			}
+		})
+
+		Convey("refuse to write classes outside the output directory", func() {
+			dir := t.TempDir()
+			out := filepath.Join(dir, "out")
+			for _, name := range []string{"../../x", "/tmp/x", "a//b", "a/./b"} {
+				source := filepath.Join(dir, "Escape.j")
+				So(os.WriteFile(source, []byte(".class public "+name+"\n.super java/lang/Object\n"), 0o644), ShouldBeNil)
+				err := tool.Asm([]string{"-d", out, source}, &bytes.Buffer{})
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "is not a relative path under")
+			}
+			_, err := os.Stat(filepath.Join(dir, "x.class"))
+			So(os.IsNotExist(err), ShouldBeTrue)
+		})
+
+		Convey("assemble every opcode", func() {
+			class, text := reassemble(allOpcodesSource())
+			for opcode, name := range interpreter.InstructDisplayNameMap {
+				if opcode == interpreter.WIDE {
+					continue
+				}
+				So(text, ShouldContainSubstring, "\n    "+name)
+			}
+			code := methodCode(class, "all", "()V").Code
+			So(bytes.Contains(code, []byte{byte(interpreter.WIDE), byte(interpreter.IINC), 1, 44, 3, 232}), ShouldBeTrue)
+			So(text, ShouldContainSubstring, "    iinc 300 1000\n")
+			So(text, ShouldContainSubstring, "    ldc_w \"late\"\n")
+			So(text, ShouldContainSubstring, "    invokestatic interface java/util/List/of(")
+			So(text, ShouldContainSubstring, "    tableswitch -1 1\n        L0\n        L0\n        L0\n        default: L0\n")
+			So(text, ShouldContainSubstring, "    lookupswitch\n        -5: L0\n        100: L0\n        default: L0\n")
+			So(text, ShouldContainSubstring, "{ methodtype ()V methodhandle invokestatic gen/All/lambda()V methodtype ()V }")
+			_, again := reassemble(text)
+			So(again, ShouldEqual, text)
+		})
+
+		Convey("assemble labels, handlers and computed limits", func() {
+			class, text := reassemble(`
+; counts down from n, catching any exception
+.bytecode 52.0
+.source Loop.java
+.class public super gen/Loop
+.super java/lang/Object
+
+.method public static count(I)I
+    .throws java/io/IOException
+    .catch java/lang/RuntimeException from Start to End using Handler
+Start:
+    .line 3
+    iload 0
+    ifle End
+    iinc 0 -1
+    goto Start
+End:
+    iload_0
+    ireturn
+Handler:
+    pop
+    iconst_m1
+    ireturn
+.end method
+`)
+			So(class.MajorVersion, ShouldEqual, 52)
+			code := methodCode(class, "count", "(I)I")
+			So(code.Code, ShouldResemble, []byte{
+				byte(interpreter.ILOAD_0), byte(interpreter.IFLE), 0, 9,
+				byte(interpreter.IINC), 0, 0xFF, byte(interpreter.GOTO), 0xFF, 0xF9,
+				byte(interpreter.ILOAD_0), byte(interpreter.IRETURN),
+				byte(interpreter.POP), byte(interpreter.ICONST_M1), byte(interpreter.IRETURN),
+			})
+			So(code.MaxStack, ShouldEqual, 1)
+			So(code.MaxLocals, ShouldEqual, 1)
+			So(code.ExceptionTable, ShouldResemble, []model.ExceptionTable{{StartPC: 0, EndPC: 10, HandlerPC: 12, CatchType: code.ExceptionTable[0].CatchType}})
+			So(class.ClassName(code.ExceptionTable[0].CatchType), ShouldEqual, "java/lang/RuntimeException")
+			So(text, ShouldContainSubstring, "    .throws java/io/IOException\n")
+			So(text, ShouldContainSubstring, "    .catch java/lang/RuntimeException from L0 to L10 using L12\n")
+			So(text, ShouldContainSubstring, "L0:\n    .line 3\n    iload_0\n    ifle L10\n")
+		})
+
+		Convey("round trip constant literals", func() {
+			_, text := reassemble(`
+.class public super gen/Constants
+.super java/lang/Object
+.field static final a I = -2147483648
+.field static final b J = 9223372036854775807L
+.field static final c F = NaNf
+.field static final d F = -0.0f
+.field static final e D = -Infinity
+.field static final f D = 1e+300
+.field static final g D = 0.1
+.field static final h Ljava/lang/String; = "tab\there \"quoted\" \u00e9"
+.field static final i F = 1.5f
+.signature "TT;"
+`)
+			for _, want := range []string{
+				"a I = -2147483648\n", "b J = 9223372036854775807L\n", "c F = NaNf\n", "d F = -0.0f\n",
+				"e D = -Infinity\n", "f D = 1e+300\n", "g D = 0.1\n", `h Ljava/lang/String; = "tab\there \"quoted\" é"` + "\n",
+				"i F = 1.5f\n.signature \"TT;\"\n",
+			} {
+				So(text, ShouldContainSubstring, want)
+			}
+			_, again := reassemble(text)
+			So(again, ShouldEqual, text)
+		})
+
+		Convey("round trip ldc of class, method type, method handle and dynamic constants", func() {
+			_, text := reassemble(`
+.class public super gen/Ldc
+.super java/lang/Object
+.method static values()V
+    ldc class [Ljava/lang/String;
+    ldc methodtype (I)V
+    ldc methodhandle getstatic java/lang/System/out Ljava/io/PrintStream;
+    ldc methodhandle invokeinterface java/lang/Runnable/run()V
+    ldc2_w dynamic big J invokestatic gen/Ldc/make(Ljava/lang/invoke/MethodHandles$Lookup;Ljava/lang/String;Ljava/lang/Class;)J { 3 }
+    return
+.end method
+`)
+			So(text, ShouldContainSubstring, "    .limit stack 6\n")
+			So(text, ShouldContainSubstring, "    ldc methodhandle getstatic java/lang/System/out Ljava/io/PrintStream;\n")
+			So(text, ShouldContainSubstring, "    ldc2_w dynamic big J invokestatic gen/Ldc/make(")
+			_, again := reassemble(text)
+			So(again, ShouldEqual, text)
+		})
+
+		Convey("report errors with line numbers", func() {
+			errorOf := func(source string) string {
+				_, err := asm.Assemble(source)
+				So(err, ShouldNotBeNil)
+				return err.Error()
+			}
+			header := ".class public gen/Bad\n.method static m()V\n"
+			So(errorOf(header+"    frobnicate\n"), ShouldEqual, `line 3: unknown instruction "frobnicate"`)
+			So(errorOf(header+"    goto Nowhere\n.end method\n"), ShouldEqual, "line 4: label Nowhere used on line 3 is not defined")
+			So(errorOf(header+"    bipush 300\n"), ShouldEqual, `line 3: invalid number "300"`)
+			So(errorOf(header+"    ldc 1L\n"), ShouldEqual, "line 3: ldc cannot load 1L")
+			So(errorOf(header+"A:\n    tableswitch 0 2\n        A\n        default: A\n"), ShouldEqual, "line 6: tableswitch 0 2 needs 3 targets, found 1")
+			So(errorOf(header+"    return\n"), ShouldEqual, "missing .end method")
+			So(errorOf(".field x I\n"), ShouldEqual, "line 1: .field before .class")
+			So(errorOf(header+"    iadd\n.end method\n"), ShouldContainSubstring, "stack underflow")
+		})
+
+		Convey("asm and disasm commands", func() {
+			dir := t.TempDir()
+			source := filepath.Join(dir, "Hello.j")
+			var hello bytes.Buffer
+			So(tool.Disasm([]string{"../java/classes/HelloWorld.class"}, &hello), ShouldBeNil)
+			So(os.WriteFile(source, hello.Bytes(), 0o644), ShouldBeNil)
+			var out bytes.Buffer
+			So(tool.Asm([]string{"-d", dir, source}, &out), ShouldBeNil)
+			path := filepath.Join(dir, "org", "example", "HelloWorld.class")
+			So(out.String(), ShouldEqual, path+"\n")
+			var again bytes.Buffer
+			So(tool.Disasm([]string{path}, &again), ShouldBeNil)
+			So(again.String(), ShouldEqual, hello.String())
+		})
+	})
+}
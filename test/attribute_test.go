@@ -0,0 +1,48 @@
+package test
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"os"
+	"outro/model"
+	"outro/parser"
+	"testing"
+)
+
+func parseClassFile(path string) *model.ClassFile {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		panic(err)
+	}
+	class, err := parser.NewClassFileParser(parser.NewByteReader(data)).Parse()
+	if err != nil {
+		panic(err)
+	}
+	return class
+}
+
+func TestTypedAttributes(t *testing.T) {
+	class := parseClassFile("../java/classes/MethodInvoke.class")
+	Convey("Test Typed Attributes", t, func() {
+		sourceFile := class.Attributes.Get("SourceFile").(*model.SourceFileAttributeInfo)
+		So(class.Utf8(sourceFile.SourceFileIndex), ShouldEqual, "MethodInvoke.java")
+
+		method, _ := class.GetMethod("accumulate", "([I)I")
+		So(method, ShouldNotBeNil)
+		code, err := class.GetCodeAttribute(method)
+		So(err, ShouldBeNil)
+		So(code.MaxStack, ShouldEqual, 2)
+		So(code.MaxLocals, ShouldEqual, 6)
+		So(len(code.Code), ShouldEqual, code.CodeLength)
+
+		lines := code.Attributes.Get("LineNumberTable").(*model.LineNumberTableAttributeInfo)
+		So(lines.LineNumberTable[0], ShouldResemble, model.LineNumberTable{StartPC: 0, LineNumber: 15})
+
+		locals := code.Attributes.Get("LocalVariableTable").(*model.LocalVariableTableAttributeInfo)
+		names := make([]string, len(locals.LocalVariableTable))
+		for i, local := range locals.LocalVariableTable {
+			names[i] = class.Utf8(local.NameIndex)
+		}
+		So(names, ShouldContain, "nums")
+		So(names, ShouldContain, "sum")
+	})
+}
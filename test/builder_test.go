@@ -0,0 +1,198 @@
+package test
+
+import (
+	"outro/asm"
+	"outro/builder"
+	"outro/constant"
+	. "outro/interpreter"
+	"outro/model"
+	"outro/parser"
+	"outro/rtda"
+	"outro/writer"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const publicStatic = uint16(constant.METHOD_ACC_PUBLIC | constant.METHOD_ACC_STATIC)
+
+func mustAssemble(source string) []byte {
+	data, err := asm.Assemble(source)
+	So(err, ShouldBeNil)
+	return data
+}
+
+// assembleClass assembles source and parses the class file it produces.
+func assembleClass(source string) *model.ClassFile {
+	class, err := parser.NewClassFileParser(parser.NewByteReader(mustAssemble(source))).Parse()
+	So(err, ShouldBeNil)
+	return class
+}
+
+func methodCode(class *model.ClassFile, name, descriptor string) *model.CodeAttributeInfo {
+	method, err := class.GetMethod(name, descriptor)
+	So(err, ShouldBeNil)
+	code, err := class.GetCodeAttribute(method)
+	So(err, ShouldBeNil)
+	return code
+}
+
+func TestClassBuilder(t *testing.T) {
+	Convey("Test class builder", t, func() {
+		Convey("builds classes with fields and straight-line methods", func() {
+			c := builder.NewClass("gen/Adder").SourceFile("Adder.java")
+			c.Field(uint16(constant.FIELD_ACC_PUBLIC|constant.FIELD_ACC_STATIC|constant.FIELD_ACC_FINAL), "LIMIT", "J").ConstantValue(int64(1) << 40)
+			c.Method(publicStatic, "add", "(II)I").
+				VarInsn(ILOAD, 0).VarInsn(ILOAD, 1).Insn(IADD).Insn(IRETURN)
+			c.Method(uint16(constant.METHOD_ACC_PUBLIC), "<init>", "()V").
+				VarInsn(ALOAD, 0).MethodInsn(INVOKESPECIAL, "java/lang/Object", "<init>", "()V", false).Insn(RETURN)
+			class, err := c.Build()
+			So(err, ShouldBeNil)
+			So(class.ClassName(class.ThisClass), ShouldEqual, "gen/Adder")
+			So(class.ClassName(class.SuperClass), ShouldEqual, "java/lang/Object")
+			So(class.MajorVersion, ShouldEqual, 61)
+
+			add := methodCode(class, "add", "(II)I")
+			So(add.Code, ShouldResemble, []byte{byte(ILOAD_0), byte(ILOAD_1), byte(IADD), byte(IRETURN)})
+			So(add.MaxStack, ShouldEqual, 2)
+			So(add.MaxLocals, ShouldEqual, 2)
+			init := methodCode(class, "<init>", "()V")
+			So(init.MaxStack, ShouldEqual, 1)
+			So(init.MaxLocals, ShouldEqual, 1)
+
+			field := class.Fields[0].Attributes.Get("ConstantValue").(*model.ConstantValueAttributeInfo)
+			So(class.ConstantPool[field.ConstantValueIndex].Tag, ShouldEqual, constant.ConstantLong)
+			So(class.ConstantPool[field.ConstantValueIndex+1].Tag, ShouldEqual, 0)
+
+			data, err := c.Bytes()
+			So(err, ShouldBeNil)
+			written, err := writer.Write(class)
+			So(err, ShouldBeNil)
+			So(written, ShouldResemble, data)
+
+			runtimeClass := rtda.NewClass(class)
+			method, err := runtimeClass.GetStaticMethod("add", "(II)I")
+			So(err, ShouldBeNil)
+			So(method.MaxStack, ShouldEqual, 2)
+		})
+
+		Convey("deduplicates constant pool entries", func() {
+			c := builder.NewClass("gen/Dedup")
+			m := c.Method(publicStatic, "twice", "()V")
+			for i := 0; i < 2; i++ {
+				m.FieldInsn(GETSTATIC, "java/lang/System", "out", "Ljava/io/PrintStream;").
+					LdcInsn("hi").
+					MethodInsn(INVOKEVIRTUAL, "java/io/PrintStream", "println", "(Ljava/lang/String;)V", false)
+			}
+			m.Insn(RETURN)
+			pool := c.Pool()
+			So(pool.Utf8("java/lang/System"), ShouldEqual, pool.Utf8("java/lang/System"))
+			class, err := c.Build()
+			So(err, ShouldBeNil)
+			code := methodCode(class, "twice", "()V")
+			So(code.Code[1:3], ShouldResemble, code.Code[9:11])
+			So(code.MaxStack, ShouldEqual, 2)
+			names := map[string]int{}
+			for _, entry := range class.ConstantPool {
+				if entry.Tag == constant.ConstantUtf8 {
+					names[entry.Utf8]++
+				}
+			}
+			for _, count := range names {
+				So(count, ShouldEqual, 1)
+			}
+		})
+
+		Convey("resolves forward and backward branches", func() {
+			// static int sum(int n) { int s = 0; while (n > 0) { s += n; n--; } return s; }
+			c := builder.NewClass("gen/Loop")
+			m := c.Method(publicStatic, "sum", "(I)I")
+			loop, done := m.NewLabel(), m.NewLabel()
+			m.Insn(ICONST_0).VarInsn(ISTORE, 1).
+				Mark(loop).VarInsn(ILOAD, 0).JumpInsn(IFLE, done).
+				VarInsn(ILOAD, 1).VarInsn(ILOAD, 0).Insn(IADD).VarInsn(ISTORE, 1).
+				IincInsn(0, -1).JumpInsn(GOTO, loop).
+				Mark(done).VarInsn(ILOAD, 1).Insn(IRETURN)
+			class, err := c.Build()
+			So(err, ShouldBeNil)
+			code := methodCode(class, "sum", "(I)I")
+			So(code.Code, ShouldResemble, []byte{
+				byte(ICONST_0), byte(ISTORE_1),
+				byte(ILOAD_0), byte(IFLE), 0, 13,
+				byte(ILOAD_1), byte(ILOAD_0), byte(IADD), byte(ISTORE_1),
+				byte(IINC), 0, 0xFF, byte(GOTO), 0xFF, 0xF5,
+				byte(ILOAD_1), byte(IRETURN),
+			})
+			So(code.MaxStack, ShouldEqual, 2)
+			So(code.MaxLocals, ShouldEqual, 2)
+		})
+
+		Convey("pads switches and uses wide forms", func() {
+			c := builder.NewClass("gen/Switch")
+			m := c.Method(publicStatic, "pick", "(I)I")
+			one, two, other := m.NewLabel(), m.NewLabel(), m.NewLabel()
+			m.VarInsn(ILOAD, 0).TableSwitchInsn(1, other, one, two).
+				Mark(one).PushInt(100).Insn(IRETURN).
+				Mark(two).PushInt(1000).Insn(IRETURN).
+				Mark(other).PushInt(7).VarInsn(ISTORE, 300).IincInsn(300, 1000).LdcInsn(1e100).Insn(POP2).PushInt(-1).Insn(IRETURN)
+			class, err := c.Build()
+			So(err, ShouldBeNil)
+			code := methodCode(class, "pick", "(I)I").Code
+			So(code[:8], ShouldResemble, []byte{byte(ILOAD_0), byte(TABLESWITCH), 0, 0, 0, 0, 0, 30})
+			So(code[8:24], ShouldResemble, []byte{0, 0, 0, 1, 0, 0, 0, 2, 0, 0, 0, 23, 0, 0, 0, 26})
+			So(code[24:27], ShouldResemble, []byte{byte(BIPUSH), 100, byte(IRETURN)})
+			So(code[27:31], ShouldResemble, []byte{byte(SIPUSH), 0x03, 0xE8, byte(IRETURN)})
+			So(code[31:37], ShouldResemble, []byte{byte(BIPUSH), 7, byte(WIDE), byte(ISTORE), 0x01, 0x2C})
+			So(code[37:43], ShouldResemble, []byte{byte(WIDE), byte(IINC), 0x01, 0x2C, 0x03, 0xE8})
+			So(code[43], ShouldEqual, byte(LDC2_W))
+			So(methodCode(class, "pick", "(I)I").MaxLocals, ShouldEqual, 301)
+			So(methodCode(class, "pick", "(I)I").MaxStack, ShouldEqual, 2)
+		})
+
+		Convey("counts handler entries and jsr return addresses", func() {
+			c := builder.NewClass("gen/Try")
+			m := c.Method(publicStatic, "run", "()V")
+			start, end, handler, after := m.NewLabel(), m.NewLabel(), m.NewLabel(), m.NewLabel()
+			m.Mark(start).MethodInsn(INVOKESTATIC, "gen/Try", "work", "()V", false).Mark(end).
+				JumpInsn(GOTO, after).
+				Mark(handler).VarInsn(ASTORE, 0).
+				Mark(after).Insn(RETURN).
+				TryCatchBlock(start, end, handler, "java/lang/Exception")
+			class, err := c.Build()
+			So(err, ShouldBeNil)
+			code := methodCode(class, "run", "()V")
+			So(code.ExceptionTable, ShouldResemble, []model.ExceptionTable{{
+				StartPC: 0, EndPC: 3, HandlerPC: 6, CatchType: code.ExceptionTable[0].CatchType,
+			}})
+			So(class.ClassName(code.ExceptionTable[0].CatchType), ShouldEqual, "java/lang/Exception")
+			So(code.MaxStack, ShouldEqual, 1)
+		})
+
+		Convey("reports malformed code", func() {
+			c := builder.NewClass("gen/Bad")
+			c.Method(publicStatic, "underflow", "()V").Insn(POP).Insn(RETURN)
+			_, err := c.Build()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "stack underflow at offset 0")
+
+			c = builder.NewClass("gen/Bad")
+			m := c.Method(publicStatic, "unmarked", "()V")
+			m.JumpInsn(GOTO, m.NewLabel())
+			_, err = c.Build()
+			So(err, ShouldNotBeNil)
+
+			c = builder.NewClass("gen/Bad")
+			m = c.Method(publicStatic, "merge", "(I)V")
+			join := m.NewLabel()
+			m.VarInsn(ILOAD, 0).JumpInsn(IFEQ, join).Insn(ICONST_1).Mark(join).Insn(RETURN)
+			_, err = c.Build()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "inconsistent stack height")
+
+			c = builder.NewClass("gen/Bad")
+			c.Method(publicStatic, "operands", "()V").Insn(BIPUSH)
+			_, err = c.Build()
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
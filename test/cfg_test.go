@@ -0,0 +1,166 @@
+package test
+
+import (
+	"bytes"
+	"os"
+	"outro/analysis"
+	"outro/parser"
+	"outro/rtda"
+	"outro/tool"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// graphOf builds the control-flow graph of a method of an assembled class.
+func graphOf(source, name, descriptor string) *analysis.Graph {
+	method, err := rtda.NewClass(assembleClass(source)).GetStaticMethod(name, descriptor)
+	So(err, ShouldBeNil)
+	graph, err := analysis.Build(method)
+	So(err, ShouldBeNil)
+	return graph
+}
+
+// successors lists the targets of the edges leaving b, with their kinds.
+func successors(b *analysis.Block) []string {
+	var names []string
+	for _, e := range b.Successors {
+		names = append(names, e.To.String()+" "+e.Kind.String())
+	}
+	return names
+}
+
+func TestControlFlowGraph(t *testing.T) {
+	Convey("Test control-flow graph", t, func() {
+		Convey("split nested loops into blocks", func() {
+			data, err := os.ReadFile("../java/classes/MethodInvoke.class")
+			So(err, ShouldBeNil)
+			classFile, err := parser.NewClassFileParser(parser.NewByteReader(data)).Parse()
+			So(err, ShouldBeNil)
+			method, err := rtda.NewClass(classFile).GetStaticMethod("lengthOfLIS", "([I)I")
+			So(err, ShouldBeNil)
+			g, err := analysis.Build(method)
+			So(err, ShouldBeNil)
+
+			var starts []int
+			for _, b := range g.Blocks {
+				starts = append(starts, b.Start)
+			}
+			So(starts, ShouldResemble, []int{0, 9, 15, 22, 28, 38, 53, 59, 73})
+			So(successors(g.Blocks[1]), ShouldResemble, []string{"B8 jump", "B2 fallthrough"})
+			So(successors(g.Blocks[6]), ShouldResemble, []string{"B3 jump"})
+			So(successors(g.Blocks[8]), ShouldBeEmpty)
+			So(g.BlockAt(30), ShouldEqual, g.Blocks[4])
+			So(g.BlockAt(75), ShouldBeNil)
+
+			So(g.Blocks[0].IDom, ShouldBeNil)
+			So(g.Blocks[6].IDom, ShouldEqual, g.Blocks[4])
+			So(g.Blocks[7].IDom, ShouldEqual, g.Blocks[3])
+			So(g.Blocks[8].IDom, ShouldEqual, g.Blocks[1])
+			So(g.Dominates(g.Blocks[3], g.Blocks[5]), ShouldBeTrue)
+			So(g.Dominates(g.Blocks[5], g.Blocks[6]), ShouldBeFalse)
+			So(g.Dominated(g.Blocks[4]), ShouldResemble, []*analysis.Block{g.Blocks[5], g.Blocks[6]})
+
+			So(g.Loops, ShouldHaveLength, 2)
+			outer, inner := g.Loops[0], g.Loops[1]
+			So(outer.Header, ShouldEqual, g.Blocks[1])
+			So(outer.Depth, ShouldEqual, 1)
+			So(outer.Blocks, ShouldHaveLength, 7)
+			So(outer.BackEdges[0].From, ShouldEqual, g.Blocks[7])
+			So(inner.Header, ShouldEqual, g.Blocks[3])
+			So(inner.Parent, ShouldEqual, outer)
+			So(inner.Depth, ShouldEqual, 2)
+			So(inner.Blocks, ShouldResemble, []*analysis.Block{g.Blocks[3], g.Blocks[4], g.Blocks[5], g.Blocks[6]})
+			So(g.Blocks[5].Loop, ShouldEqual, inner)
+			So(g.Blocks[2].Loop, ShouldEqual, outer)
+			So(g.Blocks[8].Loop, ShouldBeNil)
+		})
+
+		Convey("add exception and switch edges", func() {
+			g := graphOf(`
+.class public super gen/Try
+.super java/lang/Object
+.method public static f(I)I
+    .catch java/lang/ArithmeticException from Start to End using Handler
+    .catch all from Start to End using Any
+Start:
+    iconst_1
+    iload_0
+    idiv
+    ifne End
+    goto Start
+End:
+    iload_0
+    lookupswitch
+        1: Start
+        2: End
+        default: Dead
+Handler:
+    pop
+    iconst_0
+    ireturn
+Any:
+    athrow
+Dead:
+    iconst_m1
+    ireturn
+.end method
+`, "f", "(I)I")
+			So(g.Blocks, ShouldHaveLength, 6)
+			So(successors(g.Blocks[0]), ShouldResemble, []string{
+				"B2 jump", "B1 fallthrough", "B3 exception", "B4 exception",
+			})
+			So(g.Blocks[0].Successors[2].CatchType, ShouldEqual, "java/lang/ArithmeticException")
+			So(g.Blocks[0].Successors[3].CatchType, ShouldEqual, "")
+			So(successors(g.Blocks[1]), ShouldResemble, []string{"B0 jump", "B3 exception", "B4 exception"})
+			So(successors(g.Blocks[2]), ShouldResemble, []string{"B5 jump", "B0 jump", "B2 jump"})
+			So(g.Blocks[3].Handler, ShouldBeTrue)
+			So(g.Blocks[3].IDom, ShouldEqual, g.Blocks[0])
+			So(g.Reachable(g.Blocks[5]), ShouldBeTrue)
+			So(g.Loops, ShouldHaveLength, 2)
+			So(g.Loops[0].Header, ShouldEqual, g.Blocks[0])
+			So(g.Loops[1].Header, ShouldEqual, g.Blocks[2])
+			So(g.Loops[1].Parent, ShouldEqual, g.Loops[0])
+
+			var out bytes.Buffer
+			So(g.WriteDOT(&out), ShouldBeNil)
+			dot := out.String()
+			So(dot, ShouldStartWith, "digraph \"gen/Try.f(I)I\" {\n")
+			So(dot, ShouldContainSubstring, "  B0 -> B3 [style=dashed, label=\"java/lang/ArithmeticException\"];\n")
+			So(dot, ShouldContainSubstring, "  B0 -> B4 [style=dashed, label=\"any\"];\n")
+			So(dot, ShouldContainSubstring, "  B2 -> B0 [label=\"1\", style=bold, color=red];\n")
+			So(dot, ShouldContainSubstring, "  B2 -> B2 [label=\"2\", style=bold, color=red];\n")
+			So(dot, ShouldContainSubstring, "  B2 -> B5 [label=\"default\"];\n")
+			So(dot, ShouldContainSubstring, "B3 [label=\"B3 [")
+			So(dot, ShouldContainSubstring, "handler\\l")
+		})
+
+		Convey("leave blocks after a return unreachable", func() {
+			g := graphOf(`
+.class public super gen/Dead
+.super java/lang/Object
+.method public static f()V
+    return
+    nop
+    return
+.end method
+`, "f", "()V")
+			So(g.Blocks, ShouldHaveLength, 2)
+			So(g.Reachable(g.Blocks[1]), ShouldBeFalse)
+			So(g.Dominates(g.Blocks[0], g.Blocks[1]), ShouldBeFalse)
+		})
+
+		Convey("cfg command", func() {
+			var out bytes.Buffer
+			So(tool.Cfg([]string{"../java/classes/MethodInvoke.class", "lengthOfLIS"}, &out), ShouldBeNil)
+			So(out.String(), ShouldStartWith, "digraph \"org/example/MethodInvoke.lengthOfLIS([I)I\" {\n")
+			So(out.String(), ShouldContainSubstring, "    subgraph cluster_loop3 {\n      label=\"loop B3, depth 2\";\n")
+			So(out.String(), ShouldContainSubstring, "  B7 -> B1 [style=bold, color=red];\n")
+			out.Reset()
+			So(tool.Cfg([]string{"../java/classes/MethodInvoke.class", "max([I)I"}, &out), ShouldBeNil)
+			So(out.String(), ShouldContainSubstring, "loop B1, depth 1")
+			err := tool.Cfg([]string{"../java/classes/MethodInvoke.class", "min"}, &out)
+			So(err.Error(), ShouldEqual, "java.lang.NoSuchMethodError: org/example/MethodInvoke.min")
+		})
+	})
+}
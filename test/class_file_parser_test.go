@@ -18,7 +18,10 @@ func TestClassParse(t *testing.T) {
 	if err != nil {
 		panic(err)
 	}
-	class := parser.NewClassFileParser(parser.NewByteReader(bytes)).Parse()
+	class, err := parser.NewClassFileParser(parser.NewByteReader(bytes)).Parse()
+	if err != nil {
+		panic(err)
+	}
 	Convey("Test Class Parse", t, func() {
 		So(class.Magic, ShouldEqual, 0xCAFEBABE)
 		So(class.MinorVersion, ShouldEqual, 0)
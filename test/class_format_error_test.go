@@ -0,0 +1,87 @@
+package test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	. "github.com/smartystreets/goconvey/convey"
+	"os"
+	"outro/parser"
+	"testing"
+)
+
+func parseBytes(data []byte) error {
+	_, err := parser.NewClassFileParser(parser.NewByteReader(data)).Parse()
+	return err
+}
+
+func classFormatError(err error) *parser.ClassFormatError {
+	var cfe *parser.ClassFormatError
+	if errors.As(err, &cfe) {
+		return cfe
+	}
+	return nil
+}
+
+func TestClassFormatError(t *testing.T) {
+	original, err := os.ReadFile("../java/classes/HelloWorld.class")
+	if err != nil {
+		panic(err)
+	}
+	mutate := func(f func(data []byte) []byte) []byte {
+		data := make([]byte, len(original))
+		copy(data, original)
+		return f(data)
+	}
+	Convey("Test Class Format Error", t, func() {
+		Convey("bad magic", func() {
+			cfe := classFormatError(parseBytes(mutate(func(data []byte) []byte {
+				data[0] = 0xBE
+				return data
+			})))
+			So(cfe, ShouldNotBeNil)
+			So(cfe.Offset, ShouldEqual, 0)
+		})
+		Convey("unsupported major version", func() {
+			cfe := classFormatError(parseBytes(mutate(func(data []byte) []byte {
+				binary.BigEndian.PutUint16(data[6:], 200)
+				return data
+			})))
+			So(cfe, ShouldNotBeNil)
+			So(cfe.Reason, ShouldContainSubstring, "major version 200")
+		})
+		Convey("every truncation is reported without panicking", func() {
+			for i := 0; i < len(original); i++ {
+				So(classFormatError(parseBytes(original[:i])), ShouldNotBeNil)
+			}
+		})
+		Convey("invalid constant pool tag", func() {
+			cfe := classFormatError(parseBytes(mutate(func(data []byte) []byte {
+				data[10] = 2
+				return data
+			})))
+			So(cfe, ShouldNotBeNil)
+			So(cfe.Offset, ShouldEqual, 10)
+		})
+		Convey("trailing bytes", func() {
+			cfe := classFormatError(parseBytes(append(mutate(func(data []byte) []byte { return data }), 0)))
+			So(cfe, ShouldNotBeNil)
+			So(cfe.Offset, ShouldEqual, len(original))
+		})
+		Convey("code that overruns its attribute", func() {
+			class, err := parser.NewClassFileParser(parser.NewByteReader(original)).Parse()
+			So(err, ShouldBeNil)
+			code := class.Methods[0].Attributes[0].Info
+			body := bytes.Index(original, code)
+			cfe := classFormatError(parseBytes(mutate(func(data []byte) []byte {
+				binary.BigEndian.PutUint32(data[body+4:], uint32(len(code)))
+				return data
+			})))
+			So(cfe, ShouldNotBeNil)
+			So(cfe.Reason, ShouldContainSubstring, "truncated")
+		})
+		Convey("unmodified input parses", func() {
+			So(parseBytes(original), ShouldBeNil)
+		})
+	})
+}
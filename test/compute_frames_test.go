@@ -0,0 +1,155 @@
+package test
+
+import (
+	"os"
+	"outro/constant"
+	"outro/interpreter"
+	"outro/model"
+	"outro/parser"
+	"outro/rtda"
+	"outro/verifier"
+	"outro/writer"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// computeFrames assembles a class, computes the frames of its methods and
+// returns it parsed back from the bytes written.
+func computeFrames(v *verifier.Verifier, source string) (*model.ClassFile, error) {
+	file := assembleClass(source)
+	if err := v.ComputeAllFrames(file); err != nil {
+		return nil, err
+	}
+	data, err := writer.Write(file)
+	So(err, ShouldBeNil)
+	return parser.NewClassFileParser(parser.NewByteReader(data)).Parse()
+}
+
+func stackMapTable(file *model.ClassFile, name, descriptor string) (*model.CodeAttributeInfo, *model.StackMapTableAttributeInfo) {
+	method, err := file.GetMethod(name, descriptor)
+	So(err, ShouldBeNil)
+	code, err := file.GetCodeAttribute(method)
+	So(err, ShouldBeNil)
+	table, _ := code.Attributes.Get("StackMapTable").(*model.StackMapTableAttributeInfo)
+	return code, table
+}
+
+func TestComputeFrames(t *testing.T) {
+	Convey("Test computing stack map frames", t, func() {
+		v := verifier.New(rtda.NewApplicationClassLoader())
+
+		Convey("compute limits and frames that verify", func() {
+			So(v.Verify(assembleClass(sumSource)), ShouldNotBeNil)
+			file, err := computeFrames(v, sumSource)
+			So(err, ShouldBeNil)
+			code, table := stackMapTable(file, "sum", "(I)I")
+			So(code.MaxStack, ShouldEqual, 2)
+			So(code.MaxLocals, ShouldEqual, 2)
+			So(table, ShouldNotBeNil)
+			So(len(table.Frames), ShouldEqual, 2)
+			So(table.Entries[0].FrameType, ShouldEqual, constant.AppendFrame)
+			So(table.Entries[0].Locals, ShouldHaveLength, 1)
+			So(table.Frames[1].Offset, ShouldEqual, 16)
+			So(v.Verify(file), ShouldBeNil)
+		})
+
+		Convey("place frames where javac did", func() {
+			data, err := os.ReadFile("../java/classes/MethodInvoke.class")
+			So(err, ShouldBeNil)
+			file, err := parser.NewClassFileParser(parser.NewByteReader(data)).Parse()
+			So(err, ShouldBeNil)
+			code, original := stackMapTable(file, "accumulate", "([I)I")
+			maxStack, maxLocals := code.MaxStack, code.MaxLocals
+			code.MaxStack, code.MaxLocals = 0, 0
+			So(v.ComputeAllFrames(file), ShouldBeNil)
+			_, computed := stackMapTable(file, "accumulate", "([I)I")
+			So(code.MaxStack, ShouldEqual, maxStack)
+			So(code.MaxLocals, ShouldEqual, maxLocals)
+			// javac also chops locals whose scope has ended, so only the
+			// offsets are the same.
+			So(len(computed.Frames), ShouldEqual, len(original.Frames))
+			for i, frame := range computed.Frames {
+				So(frame.Offset, ShouldEqual, original.Frames[i].Offset)
+			}
+			So(v.Verify(file), ShouldBeNil)
+		})
+
+		Convey("find common superclasses through the class loader", func() {
+			loader := classPathLoader(t, map[string]string{
+				"gen/Base":  ".class public super gen/Base\n.super java/lang/Object\n",
+				"gen/Sub":   ".class public super gen/Sub\n.super gen/Base\n",
+				"gen/Other": ".class public super gen/Other\n.super gen/Base\n",
+			})
+			file, err := computeFrames(verifier.New(loader), `.class public super gen/Join
+.super java/lang/Object
+.method public static f(ZLgen/Sub;Lgen/Other;)Lgen/Base;
+    iload_0
+    ifeq Else
+    aload_1
+    goto Join
+Else:
+    aload_2
+Join:
+    areturn
+.end method
+`)
+			So(err, ShouldBeNil)
+			_, table := stackMapTable(file, "f", "(ZLgen/Sub;Lgen/Other;)Lgen/Base;")
+			So(table.Frames, ShouldHaveLength, 2)
+			join := table.Frames[1]
+			So(join.Stack, ShouldHaveLength, 1)
+			So(join.Stack[0].ClassName, ShouldEqual, "gen/Base")
+			So(file.ClassName(join.Stack[0].CpoolIndex), ShouldEqual, "gen/Base")
+			So(verifier.New(loader).Verify(file), ShouldBeNil)
+		})
+
+		Convey("replace unreachable code with athrow", func() {
+			file, err := computeFrames(v, `.class public super gen/Dead
+.super java/lang/Object
+.method public static f()I
+    iconst_1
+    ireturn
+    iconst_2
+    iconst_3
+    iadd
+    ireturn
+.end method
+`)
+			So(err, ShouldBeNil)
+			code, table := stackMapTable(file, "f", "()I")
+			So(code.Code[2:], ShouldResemble, []byte{byte(interpreter.NOP), byte(interpreter.NOP), byte(interpreter.NOP), byte(interpreter.ATHROW)})
+			So(table.Frames, ShouldHaveLength, 1)
+			So(table.Frames[0].Offset, ShouldEqual, 2)
+			So(table.Frames[0].Stack[0].ClassName, ShouldEqual, "java/lang/Throwable")
+			So(v.Verify(file), ShouldBeNil)
+		})
+
+		Convey("leave straight-line code without a table", func() {
+			file, err := computeFrames(v, ".class public super gen/Line\n.super java/lang/Object\n"+
+				".method public static f(JD)D\n    lload_0\n    l2d\n    dload_2\n    dadd\n    dreturn\n.end method\n")
+			So(err, ShouldBeNil)
+			code, table := stackMapTable(file, "f", "(JD)D")
+			So(table, ShouldBeNil)
+			So(code.MaxStack, ShouldEqual, 4)
+			So(code.MaxLocals, ShouldEqual, 4)
+		})
+
+		Convey("reject code frames cannot describe", func() {
+			_, err := computeFrames(v, `.class public super gen/Jsr
+.super java/lang/Object
+.method public static f()V
+    jsr Sub
+    return
+Sub:
+    astore_0
+    ret 0
+.end method
+`)
+			So(err.Error(), ShouldEqual, "java.lang.VerifyError: gen/Jsr.f()V at offset 0: jsr cannot be described by stack map frames")
+			_, err = computeFrames(v, ".class public super gen/Bad\n.super java/lang/Object\n"+
+				".method public static f()I\n    fconst_0\n    ireturn\n.end method\n")
+			So(err.Error(), ShouldEqual, "java.lang.VerifyError: gen/Bad.f()I at offset 1: expected int, found float")
+		})
+	})
+}
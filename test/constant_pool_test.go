@@ -0,0 +1,59 @@
+package test
+
+import (
+	"encoding/binary"
+	. "github.com/smartystreets/goconvey/convey"
+	"outro/constant"
+	"outro/parser"
+	"outro/rtda"
+	"testing"
+)
+
+// moduleInfoBytes assembles a class file with an empty body whose constant
+// pool contains a CONSTANT_Module, a CONSTANT_Package and a CONSTANT_Dynamic.
+func moduleInfoBytes(major uint16, accessFlags uint16) []byte {
+	u2 := func(data []byte, v uint16) []byte { return binary.BigEndian.AppendUint16(data, v) }
+	utf8 := func(data []byte, s string) []byte {
+		return append(u2(append(data, constant.ConstantUtf8), uint16(len(s))), s...)
+	}
+	data := binary.BigEndian.AppendUint32(nil, constant.ClassFileMagic)
+	data = u2(u2(data, 0), major)
+	data = u2(data, 9)
+	data = utf8(data, "module-info")                   // 1
+	data = u2(append(data, constant.ConstantClass), 1) // 2
+	data = utf8(data, "com/example")                   // 3
+	data = u2(append(data, constant.ConstantModule), 3)
+	data = u2(append(data, constant.ConstantPackage), 3)
+	data = utf8(data, "I") // 6
+	data = u2(u2(append(data, constant.ConstantNameAndType), 3), 6)
+	data = u2(u2(append(data, constant.ConstantDynamic), 0), 7)
+	data = u2(data, accessFlags)
+	data = u2(data, 2) // this_class
+	data = u2(data, 0) // super_class
+	return u2(u2(u2(u2(data, 0), 0), 0), 0)
+}
+
+func TestModuleAndDynamicConstants(t *testing.T) {
+	Convey("Test Module, Package and Dynamic constants", t, func() {
+		Convey("are parsed in a module-info class", func() {
+			data := moduleInfoBytes(61, uint16(constant.CLASS_ACC_MODULE))
+			classFile, err := parser.NewClassFileParser(parser.NewByteReader(data)).Parse()
+			So(err, ShouldBeNil)
+			class := rtda.NewClass(classFile)
+			So(class.Name, ShouldEqual, "module-info")
+			So(class.GetConstant(4), ShouldResemble, &rtda.ModuleRef{Name: "com/example"})
+			So(class.GetConstant(5), ShouldResemble, &rtda.PackageRef{Name: "com/example"})
+			So(class.GetConstant(8), ShouldResemble, &rtda.Dynamic{Name: "com/example", Descriptor: "I"})
+		})
+		Convey("are rejected outside a module", func() {
+			cfe := classFormatError(parseBytes(moduleInfoBytes(61, uint16(constant.CLASS_ACC_PUBLIC))))
+			So(cfe, ShouldNotBeNil)
+			So(cfe.Reason, ShouldContainSubstring, "not a module")
+		})
+		Convey("are rejected before the version that introduced them", func() {
+			cfe := classFormatError(parseBytes(moduleInfoBytes(54, uint16(constant.CLASS_ACC_MODULE))))
+			So(cfe, ShouldNotBeNil)
+			So(cfe.Reason, ShouldContainSubstring, "tag 17")
+		})
+	})
+}
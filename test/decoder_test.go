@@ -0,0 +1,136 @@
+package test
+
+import (
+	"outro/interpreter"
+	"outro/rtda"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const countdownSource = `
+.class public super gen/Countdown
+.super java/lang/Object
+.method public static sum(I)I
+    iconst_0
+    istore_1
+Loop:
+    iload_0
+    ifeq Done
+    iload_0
+    tableswitch 1 2
+        One
+        Two
+        default: Other
+One:
+    iinc 1 1
+    goto Next
+Two:
+    iinc 1 10
+    goto Next
+Other:
+    iinc 1 1000
+Next:
+    iinc 0 -1
+    iload_0
+    ifne Loop
+Done:
+    iload_1
+    ireturn
+.end method
+`
+
+func TestDecoder(t *testing.T) {
+	Convey("Test instruction decoder", t, func() {
+		Convey("decode every opcode with its operands", func() {
+			code := methodCode(assembleClass(allOpcodesSource()), "all", "()V").Code
+			instructions, err := interpreter.Decode(code)
+			So(err, ShouldBeNil)
+			next := 0
+			seen := map[interpreter.Instruct]*interpreter.Instruction{}
+			for i := range instructions {
+				in := &instructions[i]
+				So(in.Offset, ShouldEqual, next)
+				next = in.Next()
+				if _, ok := seen[in.Opcode]; !ok || in.Wide {
+					seen[in.Opcode] = in
+				}
+			}
+			So(next, ShouldEqual, len(code))
+
+			So(seen[interpreter.BIPUSH].Const, ShouldEqual, -10)
+			So(seen[interpreter.SIPUSH].Const, ShouldEqual, 1000)
+			So(seen[interpreter.ILOAD].Local, ShouldEqual, 4)
+			So(seen[interpreter.NEWARRAY].ArrayType, ShouldEqual, 4)
+			So(seen[interpreter.LDC_W].Index, ShouldBeGreaterThan, 255)
+			So(seen[interpreter.INVOKEINTERFACE].Count, ShouldEqual, 1)
+			So(seen[interpreter.INVOKEINTERFACE].Length, ShouldEqual, 5)
+			So(seen[interpreter.MULTIANEWARRAY].Count, ShouldEqual, 2)
+			for _, op := range []interpreter.Instruct{interpreter.IFEQ, interpreter.GOTO, interpreter.GOTO_W, interpreter.IFNONNULL} {
+				So(seen[op].Target, ShouldEqual, 0)
+			}
+			wide := seen[interpreter.IINC]
+			So(wide.Wide, ShouldBeTrue)
+			So(wide.Length, ShouldEqual, 6)
+			So(wide.Local, ShouldEqual, 300)
+			So(wide.Const, ShouldEqual, 1000)
+			table := seen[interpreter.TABLESWITCH]
+			So(table.Keys, ShouldResemble, []int32{-1, 0, 1})
+			So(table.Targets, ShouldResemble, []int{0, 0, 0})
+			So(table.Length, ShouldEqual, 1+(4-(table.Offset+1)%4)%4+12+3*4)
+			lookup := seen[interpreter.LOOKUPSWITCH]
+			So(lookup.Keys, ShouldResemble, []int32{-5, 100})
+			So(lookup.Target, ShouldEqual, 0)
+		})
+
+		Convey("decode a single instruction at an offset", func() {
+			code := []byte{byte(interpreter.NOP), byte(interpreter.IFEQ), 0xFF, 0xFF}
+			in, err := interpreter.DecodeAt(code, 1)
+			So(err, ShouldBeNil)
+			So(in.Opcode, ShouldEqual, interpreter.IFEQ)
+			So(in.Target, ShouldEqual, 0)
+			So(in.Next(), ShouldEqual, 4)
+		})
+
+		Convey("the implicit forms of loads and stores have their local", func() {
+			for op := interpreter.ILOAD_0; op <= interpreter.ALOAD_3; op++ {
+				in, err := interpreter.DecodeAt([]byte{byte(op)}, 0)
+				So(err, ShouldBeNil)
+				So(in.Local, ShouldEqual, int(op-interpreter.ILOAD_0)%4)
+			}
+			for op := interpreter.ISTORE_0; op <= interpreter.ASTORE_3; op++ {
+				in, err := interpreter.DecodeAt([]byte{byte(op)}, 0)
+				So(err, ShouldBeNil)
+				So(in.Local, ShouldEqual, int(op-interpreter.ISTORE_0)%4)
+			}
+			in, err := interpreter.DecodeAt([]byte{byte(interpreter.LSTORE_2)}, 0)
+			So(err, ShouldBeNil)
+			So(in.Local, ShouldEqual, 2)
+		})
+
+		Convey("report truncated and invalid code", func() {
+			_, err := interpreter.Decode([]byte{byte(interpreter.SIPUSH), 1})
+			So(err.Error(), ShouldEqual, "truncated sipush at offset 0")
+			_, err = interpreter.Decode([]byte{byte(interpreter.NOP), 0xE0})
+			So(err.Error(), ShouldEqual, "invalid opcode 0xe0 at offset 1")
+			_, err = interpreter.Decode([]byte{byte(interpreter.WIDE), byte(interpreter.IADD), 0, 0})
+			So(err.Error(), ShouldEqual, "invalid wide opcode 0x60 at offset 0")
+			_, err = interpreter.Decode([]byte{byte(interpreter.TABLESWITCH), 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0})
+			So(err.Error(), ShouldEqual, "invalid tableswitch bounds at offset 0")
+		})
+
+		Convey("run branches, switches and iinc until the method returns", func() {
+			code := methodCode(assembleClass(countdownSource), "sum", "(I)I").Code
+			for n, want := range map[int32]int32{0: 0, 1: 1, 2: 11, 3: 1011, 5: 3011} {
+				thread := rtda.NewThread()
+				thread.NewFrame(&rtda.Method{MaxStack: 1})
+				thread.NewFrame(&rtda.Method{Name: "sum", Descriptor: "(I)I", MaxStack: 1, MaxLocals: 2, Code: code})
+				thread.CurrentFrame().SetLocalVariableInt(0, n)
+				jvm := interpreter.JVM{Thread: thread}
+				jvm.Execute()
+				So(thread.StackDepth(), ShouldEqual, 1)
+				So(thread.CurrentFrame().PopInt(), ShouldEqual, want)
+			}
+		})
+	})
+}
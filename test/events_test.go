@@ -0,0 +1,144 @@
+package test
+
+import (
+	"fmt"
+	"outro/interpreter"
+	"outro/rtda"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const eventsSource = `.class public super gen/Events
+.super java/lang/Object
+.method public static twice(I)I
+    iload_0
+    iconst_2
+    imul
+    ireturn
+.end method
+.method public static divide(I)I
+    iconst_1
+    iload_0
+    idiv
+    ireturn
+.end method
+.method public static array()[I
+    iconst_1
+    newarray int
+    areturn
+.end method
+.method public static main([Ljava/lang/String;)V
+    return
+.end method
+`
+
+func TestEvents(t *testing.T) {
+	Convey("Test Events", t, func() {
+		loader := classPathLoader(t, map[string]string{"gen/Events": eventsSource})
+		jvm := &interpreter.JVM{Thread: rtda.NewThread(), Loader: loader}
+		var events []string
+		record := func(format string, args ...interface{}) {
+			events = append(events, fmt.Sprintf(format, args...))
+		}
+
+		Convey("events need their capabilities", func() {
+			err := jvm.SetEventNotificationMode(true, interpreter.ClassLoad, interpreter.MethodEntry)
+			So(err.Error(), ShouldEqual, "MethodEntry events need the CanGenerateMethodEntryEvents capability")
+			_, err = jvm.GetLocalVariables(jvm.Thread, 0)
+			So(err.Error(), ShouldEqual, "inspecting frames needs the CanAccessLocalVariables capability")
+			So(jvm.SetFieldAccessWatch(&rtda.Field{}), ShouldNotBeNil)
+			So(jvm.SetEventNotificationMode(true, interpreter.Event(99)).Error(), ShouldEqual, "invalid event Event(99)")
+			So(jvm.SetEventNotificationMode(true, interpreter.ClassLoad, interpreter.ThreadStart), ShouldBeNil)
+		})
+
+		Convey("events are posted to the callbacks", func() {
+			jvm.AddCapabilities(interpreter.Capabilities{
+				CanGenerateMethodEntryEvents: true,
+				CanGenerateMethodExitEvents:  true,
+				CanGenerateExceptionEvents:   true,
+				CanAccessLocalVariables:      true,
+			})
+			jvm.SetEventCallbacks(interpreter.EventCallbacks{
+				ClassLoad:    func(thread *rtda.Thread, class *rtda.Class) { record("load %s", class.Name) },
+				ClassPrepare: func(thread *rtda.Thread, class *rtda.Class) { record("prepare %s", class.Name) },
+				MethodEntry: func(thread *rtda.Thread, method *rtda.Method) {
+					locals, err := jvm.GetLocalVariables(thread, 0)
+					So(err, ShouldBeNil)
+					trace := jvm.GetStackTrace(thread)
+					record("entry %s %v depth %d", method.Name, locals, len(trace))
+				},
+				MethodExit: func(thread *rtda.Thread, method *rtda.Method, poppedByException bool, value interface{}) {
+					stack, err := jvm.GetOperandStack(thread, 0)
+					So(err, ShouldBeNil)
+					record("exit %s %v %v %v", method.Name, poppedByException, value, stack)
+				},
+				Exception: func(thread *rtda.Thread, method *rtda.Method, location int, exception error, catchMethod *rtda.Method, catchLocation int) {
+					record("exception %s@%d %v %v %d", method.Name, location, exception, catchMethod == nil, catchLocation)
+				},
+				ThreadStart: func(thread *rtda.Thread) { record("start") },
+				ThreadEnd:   func(thread *rtda.Thread) { record("end") },
+			})
+			So(jvm.SetEventNotificationMode(true,
+				interpreter.ClassLoad, interpreter.ClassPrepare, interpreter.MethodEntry, interpreter.MethodExit,
+				interpreter.Exception, interpreter.ThreadStart, interpreter.ThreadEnd), ShouldBeNil)
+
+			class, err := loader.LoadClass("gen/Events")
+			So(err, ShouldBeNil)
+			main, err := class.GetMainMethod()
+			So(err, ShouldBeNil)
+			twice, err := class.GetStaticMethod("twice", "(I)I")
+			So(err, ShouldBeNil)
+			divide, err := class.GetStaticMethod("divide", "(I)I")
+			So(err, ShouldBeNil)
+
+			jvm.Thread.NewFrame(main)
+			jvm.Thread.NewFrame(twice)
+			jvm.Thread.CurrentFrame().SetLocalVariableInt(0, 21)
+			jvm.Execute()
+			trace := jvm.GetStackTrace(jvm.Thread)
+			So(trace, ShouldResemble, []interpreter.StackFrame{{Method: main, Location: 0}})
+
+			jvm.Thread.NewFrame(divide)
+			jvm.Thread.CurrentFrame().SetLocalVariableInt(0, 0)
+			So(func() { jvm.Execute() }, ShouldPanic)
+
+			array, err := class.GetStaticMethod("array", "()[I")
+			So(err, ShouldBeNil)
+			jvm.Thread = rtda.NewThread()
+			jvm.Thread.NewFrame(main)
+			jvm.Thread.NewFrame(array)
+			So(func() { jvm.Execute() }, ShouldPanicWith, "todo: newarray")
+
+			So(events, ShouldResemble, []string{
+				"load gen/Events",
+				"prepare gen/Events",
+				"start",
+				"entry twice [21] depth 2",
+				"exit twice false 42 [42]",
+				"end",
+				"start",
+				"entry divide [0] depth 2",
+				"exception divide@2 java.lang.ArithmeticException: / by zero true -1",
+				"exit divide true <nil> []",
+				"end",
+				"start",
+				"entry array [] depth 2",
+				"exception array@1 todo: newarray true -1",
+				"exit array true <nil> [1]",
+				"end",
+			})
+		})
+
+		Convey("disabled events are not posted", func() {
+			jvm.SetEventCallbacks(interpreter.EventCallbacks{
+				ClassLoad: func(thread *rtda.Thread, class *rtda.Class) { record("load %s", class.Name) },
+			})
+			So(jvm.SetEventNotificationMode(true, interpreter.ClassLoad), ShouldBeNil)
+			So(jvm.SetEventNotificationMode(false, interpreter.ClassLoad), ShouldBeNil)
+			_, err := loader.LoadClass("gen/Events")
+			So(err, ShouldBeNil)
+			So(events, ShouldBeEmpty)
+		})
+	})
+}
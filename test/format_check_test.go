@@ -0,0 +1,107 @@
+package test
+
+import (
+	"os"
+	"outro/parser"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// checkFormat assembles a class and checks its format.
+func checkFormat(source string) error {
+	return parser.CheckFormat(assembleClass(source))
+}
+
+const formatHeader = ".class public super gen/F\n.super java/lang/Object\n"
+
+func TestFormatCheck(t *testing.T) {
+	Convey("Test Format Check", t, func() {
+		Convey("the fixtures are well formed", func() {
+			for _, name := range []string{"HelloWorld", "MethodInvoke"} {
+				data, err := os.ReadFile("../java/classes/" + name + ".class")
+				So(err, ShouldBeNil)
+				file, err := parser.NewClassFileParser(parser.NewByteReader(data)).Parse()
+				So(err, ShouldBeNil)
+				So(parser.CheckFormat(file), ShouldBeNil)
+			}
+		})
+		Convey("errors have no offset", func() {
+			err := checkFormat(formatHeader + ".field public a I\n.field public a I\n")
+			cfe := classFormatError(err)
+			So(cfe, ShouldNotBeNil)
+			So(cfe.Offset, ShouldEqual, -1)
+			So(err.Error(), ShouldEqual, "java.lang.ClassFormatError: duplicate field a I")
+		})
+		Convey("a field may be redeclared with another type", func() {
+			So(checkFormat(formatHeader+".field public a I\n.field public a J\n"), ShouldBeNil)
+		})
+		Convey("duplicate methods", func() {
+			method := ".method public static f()V\nreturn\n.end method\n"
+			So(checkFormat(formatHeader+method+method).Error(), ShouldContainSubstring, "duplicate method f()V")
+		})
+		Convey("conflicting field modifiers", func() {
+			So(checkFormat(formatHeader+".field public private a I\n").Error(), ShouldContainSubstring,
+				"illegal field modifiers in field a")
+			So(checkFormat(formatHeader+".field final volatile a I\n").Error(), ShouldContainSubstring,
+				"illegal field modifiers in field a")
+		})
+		Convey("conflicting class modifiers", func() {
+			So(checkFormat(".class public final abstract gen/F\n.super java/lang/Object\n").Error(), ShouldContainSubstring,
+				"illegal class modifiers in class gen/F")
+		})
+		Convey("interfaces must be abstract and extend Object", func() {
+			So(checkFormat(".class public interface gen/I\n.super java/lang/Object\n").Error(), ShouldContainSubstring,
+				"illegal class modifiers in interface gen/I")
+			So(checkFormat(".class public interface abstract gen/I\n.super java/lang/Thread\n").Error(), ShouldContainSubstring,
+				"interface gen/I must have java/lang/Object as its superclass")
+			So(checkFormat(".class public interface abstract gen/I\n.super java/lang/Object\n"), ShouldBeNil)
+		})
+		Convey("interface fields are public static final", func() {
+			So(checkFormat(".class public interface abstract gen/I\n.super java/lang/Object\n.field public a I\n").Error(),
+				ShouldContainSubstring, "illegal field modifiers in field a")
+		})
+		Convey("interface methods before Java 8 are public abstract", func() {
+			source := ".bytecode 51.0\n.class public interface abstract gen/I\n.super java/lang/Object\n" +
+				".method public static f()V\nreturn\n.end method\n"
+			So(checkFormat(source).Error(), ShouldContainSubstring, "illegal method modifiers in method f()V")
+		})
+		Convey("abstract methods cannot be private", func() {
+			source := ".class public abstract super gen/F\n.super java/lang/Object\n" +
+				".method private abstract f()V\n.end method\n"
+			So(checkFormat(source).Error(), ShouldContainSubstring, "illegal method modifiers in method f()V")
+		})
+		Convey("constructors and initializers", func() {
+			So(checkFormat(formatHeader+".method public static <init>()V\nreturn\n.end method\n").Error(),
+				ShouldContainSubstring, "illegal method modifiers in method <init>()V")
+			So(checkFormat(formatHeader+".method public <init>()I\niconst_0\nireturn\n.end method\n").Error(),
+				ShouldContainSubstring, "method <init> has illegal descriptor ()I")
+			So(checkFormat(formatHeader+".method public <clinit>()V\nreturn\n.end method\n").Error(),
+				ShouldContainSubstring, "method <clinit> is not static")
+			So(checkFormat(formatHeader+".method static <clinit>(I)V\nreturn\n.end method\n").Error(),
+				ShouldContainSubstring, "method <clinit> has illegal descriptor (I)V")
+		})
+		Convey("illegal names", func() {
+			So(checkFormat(formatHeader+".field public a.b I\n").Error(), ShouldContainSubstring, `illegal field name "a.b"`)
+			So(checkFormat(formatHeader+".method public static f<x>()V\nreturn\n.end method\n").Error(),
+				ShouldContainSubstring, `illegal method name "f<x>"`)
+			So(checkFormat(".class public super gen//F\n.super java/lang/Object\n").Error(), ShouldContainSubstring,
+				`illegal class name "gen//F"`)
+		})
+		Convey("constant pool references of the wrong kind", func() {
+			file := assembleClass(formatHeader + ".method public static f()V\nreturn\n.end method\n")
+			// Point this_class at its own name instead of the class entry.
+			file.ConstantPool[file.ThisClass].Info = append([]byte(nil), file.ConstantPool[file.ThisClass].Info...)
+			file.ConstantPool[file.ThisClass].Info[1] = byte(file.ThisClass)
+			So(parser.CheckFormat(file).Error(), ShouldContainSubstring,
+				"refers to invalid entry")
+		})
+		Convey("the class loader rejects badly formed classes", func() {
+			loader := classPathLoader(t, map[string]string{
+				"gen/F": formatHeader + ".field public a I\n.field public a I\n",
+			})
+			_, err := loader.LoadClass("gen/F")
+			So(classFormatError(err), ShouldNotBeNil)
+		})
+	})
+}
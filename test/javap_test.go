@@ -0,0 +1,193 @@
+package test
+
+import (
+	"bytes"
+	"outro/javap"
+	"outro/tool"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// javapOf assembles source and prints the class with options.
+func javapOf(source string, options javap.Options) string {
+	var out bytes.Buffer
+	So(javap.Write(&out, assembleClass(source), nil, options), ShouldBeNil)
+	return out.String()
+}
+
+func TestJavap(t *testing.T) {
+	Convey("Test javap", t, func() {
+		run := func(args ...string) string {
+			var out bytes.Buffer
+			So(tool.Javap(args, &out), ShouldBeNil)
+			return out.String()
+		}
+
+		Convey("print declarations", func() {
+			So(run("../java/classes/HelloWorld.class"), ShouldEqual, `Compiled from "HelloWorld.java"
+public class org.example.HelloWorld {
+  public org.example.HelloWorld();
+  public static void main(java.lang.String[]);
+}
+`)
+		})
+
+		Convey("disassemble code with -c", func() {
+			So(run("-c", "../java/classes/HelloWorld.class"), ShouldEqual, `Compiled from "HelloWorld.java"
+public class org.example.HelloWorld {
+  public org.example.HelloWorld();
+    Code:
+       0: aload_0
+       1: invokespecial #1                  // Method java/lang/Object."<init>":()V
+       4: return
+
+  public static void main(java.lang.String[]);
+    Code:
+       0: getstatic     #7                  // Field java/lang/System.out:Ljava/io/PrintStream;
+       3: ldc           #13                 // String Hello, World!
+       5: invokevirtual #15                 // Method java/io/PrintStream.println:(Ljava/lang/String;)V
+       8: return
+}
+`)
+		})
+
+		Convey("print descriptors with -s and tables with -l", func() {
+			out := run("-s", "-l", "../java/classes/HelloWorld.class")
+			So(out, ShouldContainSubstring, "  public static void main(java.lang.String[]);\n    descriptor: ([Ljava/lang/String;)V\n    LineNumberTable:\n      line 5: 0\n      line 6: 8\n")
+			So(out, ShouldContainSubstring, "      Start  Length  Slot  Name   Signature\n          0       9     0  args   [Ljava/lang/String;\n")
+			So(out, ShouldNotContainSubstring, "Code:")
+		})
+
+		Convey("print the constant pool, flags and attributes with -v", func() {
+			out := run("-v", "../java/classes/HelloWorld.class")
+			So(out, ShouldStartWith, "Classfile /")
+			So(out, ShouldContainSubstring, "; size 559 bytes\n  SHA-256 checksum ")
+			for _, want := range []string{
+				"public class org.example.HelloWorld\n  minor version: 0\n  major version: 61\n  flags: (0x0021) ACC_PUBLIC, ACC_SUPER\n",
+				"  this_class: #21                         // org/example/HelloWorld\n",
+				"  interfaces: 0, fields: 0, methods: 2, attributes: 1\nConstant pool:\n",
+				"   #1 = Methodref          #2.#3          // java/lang/Object.\"<init>\":()V\n",
+				"  #14 = Utf8               Hello, World!\n",
+				"    flags: (0x0009) ACC_PUBLIC, ACC_STATIC\n    Code:\n      stack=2, locals=1, args_size=1\n         0: getstatic",
+				"      LineNumberTable:\n        line 5: 0\n",
+				"}\nSourceFile: \"HelloWorld.java\"\n",
+			} {
+				So(out, ShouldContainSubstring, want)
+			}
+		})
+
+		Convey("print stack map frames", func() {
+			out := run("-v", "../java/classes/MethodInvoke.class")
+			So(out, ShouldContainSubstring, "      StackMapTable: number_of_entries = 5\n        frame_type = 254 /* append */\n")
+			So(out, ShouldContainSubstring, "          locals = [ class \"[I\", int, int ]\n")
+			So(out, ShouldContainSubstring, "        frame_type = 255 /* full_frame */\n")
+			So(out, ShouldContainSubstring, "          stack = []\n")
+		})
+
+		Convey("hide private members unless -p", func() {
+			source := `
+.class public super gen/Secret
+.super java/lang/Object
+.implements java/lang/Runnable
+.field private count I
+.field protected static volatile name Ljava/lang/String;
+.method private hidden()V
+    return
+.end method
+.method public varargs run([Ljava/lang/String;)V
+    .throws java/io/IOException
+    return
+.end method
+`
+			out := javapOf(source, javap.Options{})
+			So(out, ShouldEqual, `public class gen.Secret implements java.lang.Runnable {
+  protected static volatile java.lang.String name;
+  public void run(java.lang.String...) throws java.io.IOException;
+}
+`)
+			out = javapOf(source, javap.Options{Private: true})
+			So(out, ShouldContainSubstring, "  private int count;\n")
+			So(out, ShouldContainSubstring, "  private void hidden();\n")
+		})
+
+		Convey("print switches, wide instructions and exception tables", func() {
+			out := javapOf(`
+.class public super gen/Switch
+.super java/lang/Object
+.method public static pick(I)I
+    .catch all from A to B using H
+A:
+    iload_0
+    tableswitch 0 1
+        A
+        B
+        default: B
+    iload_0
+    lookupswitch
+        -1: A
+        default: B
+    iinc 300 2
+B:
+    iconst_0
+    newarray int
+    pop
+    iconst_1
+    iconst_1
+    multianewarray [[I 2
+    pop
+    iconst_0
+    ireturn
+H:
+    athrow
+.end method
+`, javap.Options{Code: true})
+			So(out, ShouldContainSubstring, `       1: tableswitch   { // 0 to 1
+                     0: 0
+                     1: 50
+               default: 50
+          }
+`)
+			So(out, ShouldContainSubstring, `      25: lookupswitch  { // 1
+                    -1: 0
+               default: 50
+          }
+`)
+			So(out, ShouldContainSubstring, "      50: iconst_0\n      51: newarray       int\n")
+			So(out, ShouldContainSubstring, "      44: iinc_w        300, 2\n")
+			So(out, ShouldContainSubstring, "      56: multianewarray #")
+			So(out, ShouldContainSubstring, ",  2             // class \"[[I\"\n")
+			So(out, ShouldContainSubstring, "    Exception table:\n       from    to  target type\n           0    50    63   any\n")
+		})
+
+		Convey("render generic signatures", func() {
+			out := javapOf(`
+.class public abstract interface gen/Box
+.super java/lang/Object
+.implements java/lang/Iterable
+.signature "<T:Ljava/lang/Object;U::Ljava/lang/Comparable<-TU;>;>Ljava/lang/Object;Ljava/lang/Iterable<TT;>;"
+.field public static final EMPTY Ljava/util/Map;
+.signature "Ljava/util/Map<Ljava/lang/String;+Ljava/util/List<*>;>;"
+.method public abstract map(Ljava/util/function/Function;)Lgen/Box;
+    .throws java/lang/Exception
+.signature "<R:Ljava/lang/Object;>(Ljava/util/function/Function<-TT;+TR;>;)Lgen/Box<TR;>;^TX;"
+.end method
+.method public first()Ljava/lang/Object;
+    aconst_null
+    areturn
+.end method
+`, javap.Options{})
+			lines := strings.Split(out, "\n")
+			So(lines[0], ShouldEqual, "public interface gen.Box<T, U extends java.lang.Comparable<? super U>> extends java.lang.Iterable<T> {")
+			So(lines[1], ShouldEqual, "  public static final java.util.Map<java.lang.String, ? extends java.util.List<?>> EMPTY;")
+			So(lines[2], ShouldEqual, "  public abstract <R> gen.Box<R> map(java.util.function.Function<? super T, ? extends R>) throws X;")
+			So(lines[3], ShouldEqual, "  public default java.lang.Object first();")
+		})
+
+		Convey("reject unknown options", func() {
+			So(tool.Javap([]string{"-x", "A.class"}, &bytes.Buffer{}), ShouldNotBeNil)
+			So(tool.Javap(nil, &bytes.Buffer{}), ShouldNotBeNil)
+		})
+	})
+}
@@ -19,7 +19,10 @@ func TestMethodInvoke(t *testing.T) {
 	if err != nil {
 		panic(err)
 	}
-	class := parser.NewClassFileParser(parser.NewByteReader(bytes)).Parse()
+	class, err := parser.NewClassFileParser(parser.NewByteReader(bytes)).Parse()
+	if err != nil {
+		panic(err)
+	}
 	assertClassParse(t, class)
 }
 
@@ -0,0 +1,354 @@
+package test
+
+import (
+	"archive/zip"
+	"encoding/binary"
+	"os"
+	"outro/constant"
+	"outro/launcher"
+	"outro/rtda"
+	"outro/verifier"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// classPool accumulates a constant pool for synthesized class files.
+type classPool struct {
+	data  []byte
+	count uint16
+}
+
+func (p *classPool) utf8(s string) uint16 {
+	p.data = append(binary.BigEndian.AppendUint16(append(p.data, constant.ConstantUtf8), uint16(len(s))), s...)
+	p.count++
+	return p.count
+}
+
+func (p *classPool) ref(tag uint8, s string) uint16 {
+	name := p.utf8(s)
+	p.data = binary.BigEndian.AppendUint16(append(p.data, tag), name)
+	p.count++
+	return p.count
+}
+
+// classFileBytes assembles a class with no fields or methods around pool.
+func classFileBytes(pool *classPool, accessFlags, thisClass, superClass uint16, attributes []byte, attributeCount uint16) []byte {
+	u2 := func(data []byte, v uint16) []byte { return binary.BigEndian.AppendUint16(data, v) }
+	data := binary.BigEndian.AppendUint32(nil, constant.ClassFileMagic)
+	data = u2(u2(data, 0), 61)
+	data = append(u2(data, pool.count+1), pool.data...)
+	data = u2(u2(u2(data, accessFlags), thisClass), superClass)
+	data = u2(u2(u2(data, 0), 0), 0)
+	return append(u2(data, attributeCount), attributes...)
+}
+
+func plainClassBytes(name string, accessFlags uint16) []byte {
+	pool := &classPool{}
+	thisClass := pool.ref(constant.ConstantClass, name)
+	superClass := pool.ref(constant.ConstantClass, "java/lang/Object")
+	return classFileBytes(pool, accessFlags, thisClass, superClass, nil, 0)
+}
+
+type testModule struct {
+	name     string
+	flags    uint16
+	requires map[string]constant.AccessFlag
+	exports  map[string][]string
+	opens    map[string][]string
+}
+
+func testModuleInfoBytes(m testModule) []byte {
+	u2 := func(data []byte, v uint16) []byte { return binary.BigEndian.AppendUint16(data, v) }
+	pool := &classPool{}
+	thisClass := pool.ref(constant.ConstantClass, "module-info")
+	attributeName := pool.utf8("Module")
+	body := u2(u2(u2(nil, pool.ref(constant.ConstantModule, m.name)), m.flags), 0)
+	body = u2(body, uint16(len(m.requires)))
+	for name, flags := range m.requires {
+		body = u2(u2(u2(body, pool.ref(constant.ConstantModule, name)), uint16(flags)), 0)
+	}
+	for _, directives := range []map[string][]string{m.exports, m.opens} {
+		body = u2(body, uint16(len(directives)))
+		for pkg, to := range directives {
+			body = u2(u2(u2(body, pool.ref(constant.ConstantPackage, pkg)), 0), uint16(len(to)))
+			for _, target := range to {
+				body = u2(body, pool.ref(constant.ConstantModule, target))
+			}
+		}
+	}
+	body = u2(u2(body, 0), 0)
+	attribute := append(binary.BigEndian.AppendUint32(u2(nil, attributeName), uint32(len(body))), body...)
+	return classFileBytes(pool, uint16(constant.CLASS_ACC_MODULE), thisClass, 0, attribute, 1)
+}
+
+// writeFiles writes name -> contents under dir.
+func writeFiles(dir string, files map[string][]byte) {
+	for name, data := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		So(os.MkdirAll(filepath.Dir(path), 0o755), ShouldBeNil)
+		So(os.WriteFile(path, data, 0o644), ShouldBeNil)
+	}
+}
+
+func writeJar(path string, files map[string][]byte) {
+	file, err := os.Create(path)
+	So(err, ShouldBeNil)
+	defer file.Close()
+	archive := zip.NewWriter(file)
+	for name, data := range files {
+		w, err := archive.Create(name)
+		So(err, ShouldBeNil)
+		_, err = w.Write(data)
+		So(err, ShouldBeNil)
+	}
+	So(archive.Close(), ShouldBeNil)
+}
+
+// moduleWorld lays out a module path with the modules app, lib, base and
+// other plus the automatic module util, and a class path with one class.
+func moduleWorld(t *testing.T) (modulePath string, classPath string) {
+	public := uint16(constant.CLASS_ACC_PUBLIC)
+	root := t.TempDir()
+	modulePath = filepath.Join(root, "mods")
+	classPath = filepath.Join(root, "classes")
+	writeFiles(filepath.Join(modulePath, "app"), map[string][]byte{
+		"module-info.class": testModuleInfoBytes(testModule{
+			name:     "app",
+			requires: map[string]constant.AccessFlag{"lib": 0, "java.base": constant.REQUIRES_ACC_MANDATED},
+		}),
+		"com/app/Main.class": plainClassBytes("com/app/Main", public),
+	})
+	writeFiles(filepath.Join(modulePath, "lib"), map[string][]byte{
+		"module-info.class": testModuleInfoBytes(testModule{
+			name:     "lib",
+			requires: map[string]constant.AccessFlag{"base": constant.REQUIRES_ACC_TRANSITIVE},
+			exports:  map[string][]string{"com/lib/api": nil},
+		}),
+		"com/lib/api/Api.class":       plainClassBytes("com/lib/api/Api", public),
+		"com/lib/api/Hidden.class":    plainClassBytes("com/lib/api/Hidden", 0),
+		"com/lib/internal/Impl.class": plainClassBytes("com/lib/internal/Impl", public),
+	})
+	writeFiles(filepath.Join(modulePath, "base"), map[string][]byte{
+		"module-info.class": testModuleInfoBytes(testModule{
+			name:    "base",
+			exports: map[string][]string{"com/base": nil, "com/base/friends": {"app"}},
+		}),
+		"com/base/Base.class":           plainClassBytes("com/base/Base", public),
+		"com/base/friends/Friend.class": plainClassBytes("com/base/friends/Friend", public),
+	})
+	writeFiles(filepath.Join(modulePath, "other"), map[string][]byte{
+		"module-info.class": testModuleInfoBytes(testModule{
+			name:    "other",
+			flags:   uint16(constant.MODULE_ACC_OPEN),
+			exports: map[string][]string{"com/other": nil},
+		}),
+		"com/other/Other.class": plainClassBytes("com/other/Other", public),
+	})
+	writeJar(filepath.Join(modulePath, "util-lang-1.2.3.jar"), map[string][]byte{
+		"com/util/Util.class": plainClassBytes("com/util/Util", public),
+	})
+	writeFiles(classPath, map[string][]byte{
+		"com/cp/Plain.class": plainClassBytes("com/cp/Plain", public),
+	})
+	return modulePath, classPath
+}
+
+func loadWith(args ...string) (*rtda.ApplicationClassLoader, *rtda.Class, error) {
+	options, err := launcher.ParseOptions(args)
+	So(err, ShouldBeNil)
+	loader, err := options.NewClassLoader()
+	if err != nil {
+		return nil, nil, err
+	}
+	class, err := options.LoadMainClass(loader)
+	return loader, class, err
+}
+
+func TestModuleSystem(t *testing.T) {
+	Convey("Test the module system", t, func() {
+		modulePath, classPath := moduleWorld(t)
+
+		Convey("launcher options are parsed like the java command", func() {
+			options, err := launcher.ParseOptions([]string{
+				"-p", "mods", "--add-opens=lib/com.lib.internal=ALL-UNNAMED", "--add-modules", "a,b",
+				"-m", "app/com.app.Main", "x", "-y",
+			})
+			So(err, ShouldBeNil)
+			So(options.ModulePath, ShouldEqual, "mods")
+			So(options.AddOpens, ShouldResemble, []string{"lib/com.lib.internal=ALL-UNNAMED"})
+			So(options.AddModules, ShouldResemble, []string{"a", "b"})
+			So(options.Module, ShouldEqual, "app/com.app.Main")
+			So(options.Args, ShouldResemble, []string{"x", "-y"})
+
+			options, err = launcher.ParseOptions([]string{"-cp", "classes", "com.cp.Plain", "arg"})
+			So(err, ShouldBeNil)
+			So(options.MainClass, ShouldEqual, "com.cp.Plain")
+			So(options.Args, ShouldResemble, []string{"arg"})
+
+			_, err = launcher.ParseOptions([]string{"--bogus", "x"})
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("the main class is loaded into its module", func() {
+			loader, main, err := loadWith("-p", modulePath, "-m", "app/com.app.Main")
+			So(err, ShouldBeNil)
+			So(main.Module.Name, ShouldEqual, "app")
+			graph := loader.Modules()
+			So(graph.Modules, ShouldContainKey, "lib")
+			So(graph.Modules, ShouldContainKey, "base")
+			So(graph.Modules, ShouldContainKey, "java.base")
+			So(graph.Modules, ShouldNotContainKey, "other")
+			So(graph.Modules["app"].CanRead(graph.Modules["lib"]), ShouldBeTrue)
+			So(graph.Modules["app"].CanRead(graph.Modules["base"]), ShouldBeTrue)
+			So(graph.Modules["base"].CanRead(graph.Modules["lib"]), ShouldBeFalse)
+		})
+
+		Convey("exported packages of readable modules are accessible", func() {
+			_, main, err := loadWith("-p", modulePath, "-m", "app/com.app.Main")
+			So(err, ShouldBeNil)
+			api, err := main.ResolveClass("com/lib/api/Api")
+			So(err, ShouldBeNil)
+			So(api.Module.Name, ShouldEqual, "lib")
+			_, err = main.ResolveClass("com/base/Base")
+			So(err, ShouldBeNil)
+			_, err = main.ResolveClass("com/base/friends/Friend")
+			So(err, ShouldBeNil)
+		})
+
+		Convey("concealed packages and non-public classes are not", func() {
+			_, main, err := loadWith("-p", modulePath, "-m", "app/com.app.Main")
+			So(err, ShouldBeNil)
+			_, err = main.ResolveClass("com/lib/internal/Impl")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "java.lang.IllegalAccessError: class com.app.Main (in module app) cannot access "+
+				"class com.lib.internal.Impl (in module lib) because module lib does not export com.lib.internal to module app")
+			_, err = main.ResolveClass("com/lib/api/Hidden")
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("unread modules are not accessible", func() {
+			_, main, err := loadWith("-p", modulePath, "--add-modules", "other", "-m", "app/com.app.Main")
+			So(err, ShouldBeNil)
+			_, err = main.ResolveClass("com/other/Other")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEndWith, "because module app does not read module other")
+		})
+
+		Convey("--add-exports and --add-opens override the descriptor", func() {
+			_, main, err := loadWith("-p", modulePath,
+				"--add-exports", "lib/com.lib.internal=app", "-m", "app/com.app.Main")
+			So(err, ShouldBeNil)
+			impl, err := main.ResolveClass("com/lib/internal/Impl")
+			So(err, ShouldBeNil)
+			So(rtda.CheckReflectiveAccess(main, impl, uint16(constant.METHOD_ACC_PUBLIC)), ShouldBeNil)
+			err = rtda.CheckReflectiveAccess(main, impl, uint16(constant.METHOD_ACC_PRIVATE))
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, `module lib does not "opens com.lib.internal" to module app`)
+
+			_, main, err = loadWith("-p", modulePath,
+				"--add-opens", "lib/com.lib.internal=app", "-m", "app/com.app.Main")
+			So(err, ShouldBeNil)
+			impl, err = main.ResolveClass("com/lib/internal/Impl")
+			So(err, ShouldBeNil)
+			So(rtda.CheckReflectiveAccess(main, impl, uint16(constant.METHOD_ACC_PRIVATE)), ShouldBeNil)
+		})
+
+		Convey("the verifier loads the classes it checks without access checks", func() {
+			data := mustAssemble(`.bytecode 49.0
+.class public super com/app/Check
+.super java/lang/Object
+.method public static f(ZLcom/lib/internal/Impl;Lcom/lib/api/Api;)Ljava/lang/Object;
+    iload_0
+    ifeq Api
+    aload_1
+    goto Join
+Api:
+    aload_2
+Join:
+    areturn
+.end method
+`)
+			writeFiles(filepath.Join(modulePath, "app"), map[string][]byte{"com/app/Check.class": data})
+			options, err := launcher.ParseOptions([]string{"-p", modulePath, "-m", "app/com.app.Main"})
+			So(err, ShouldBeNil)
+			loader, err := options.NewClassLoader()
+			So(err, ShouldBeNil)
+			loader.SetVerifier(verifier.New(loader))
+			check, err := loader.LoadClass("com/app/Check")
+			So(err, ShouldBeNil)
+			_, err = check.ResolveClass("com/lib/internal/Impl")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "java.lang.IllegalAccessError: class com.app.Check (in module app) cannot access "+
+				"class com.lib.internal.Impl (in module lib) because module lib does not export com.lib.internal to module app")
+		})
+
+		Convey("open modules allow deep reflection", func() {
+			loader, _, err := loadWith("-p", modulePath, "--add-modules", "other", "-cp", classPath, "com.cp.Plain")
+			So(err, ShouldBeNil)
+			plain, err := loader.LoadClass("com/cp/Plain")
+			So(err, ShouldBeNil)
+			other, err := plain.ResolveClass("com/other/Other")
+			So(err, ShouldBeNil)
+			So(rtda.CheckReflectiveAccess(plain, other, uint16(constant.METHOD_ACC_PRIVATE)), ShouldBeNil)
+		})
+
+		Convey("class path code lives in the unnamed module and reads everything", func() {
+			loader, plain, err := loadWith("-p", modulePath, "--add-modules", "lib", "-cp", classPath, "com.cp.Plain")
+			So(err, ShouldBeNil)
+			So(plain.Module, ShouldEqual, loader.Modules().Unnamed)
+			_, err = plain.ResolveClass("com/lib/api/Api")
+			So(err, ShouldBeNil)
+			_, err = plain.ResolveClass("com/lib/internal/Impl")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEndWith, "does not export com.lib.internal to unnamed module")
+
+			_, plain, err = loadWith("-p", modulePath, "--add-modules", "lib",
+				"--add-exports", "lib/com.lib.internal=ALL-UNNAMED", "-cp", classPath, "com.cp.Plain")
+			So(err, ShouldBeNil)
+			_, err = plain.ResolveClass("com/lib/internal/Impl")
+			So(err, ShouldBeNil)
+		})
+
+		Convey("plain jars on the module path become automatic modules", func() {
+			loader, plain, err := loadWith("-p", modulePath, "--add-modules", "util.lang", "-cp", classPath, "com.cp.Plain")
+			So(err, ShouldBeNil)
+			util := loader.Modules().Modules["util.lang"]
+			So(util, ShouldNotBeNil)
+			So(util.Automatic, ShouldBeTrue)
+			So(util.CanRead(loader.Modules().Unnamed), ShouldBeTrue)
+			class, err := plain.ResolveClass("com/util/Util")
+			So(err, ShouldBeNil)
+			So(class.Module, ShouldEqual, util)
+			So(rtda.CheckReflectiveAccess(plain, class, 0), ShouldBeNil)
+		})
+
+		Convey("resolution fails for missing modules and cycles", func() {
+			_, _, err := loadWith("-p", modulePath, "-m", "missing/a.B")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "java.lang.module.FindException: Module missing not found")
+
+			writeFiles(filepath.Join(modulePath, "c1"), map[string][]byte{
+				"module-info.class": testModuleInfoBytes(testModule{name: "c1", requires: map[string]constant.AccessFlag{"c2": 0}}),
+			})
+			writeFiles(filepath.Join(modulePath, "c2"), map[string][]byte{
+				"module-info.class": testModuleInfoBytes(testModule{name: "c2", requires: map[string]constant.AccessFlag{"c1": 0}}),
+			})
+			_, _, err = loadWith("-p", modulePath, "--add-modules", "c1", "-cp", classPath, "com.cp.Plain")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldStartWith, "java.lang.module.ResolutionException: Cycle detected")
+		})
+
+		Convey("a split package is rejected", func() {
+			writeFiles(filepath.Join(modulePath, "split"), map[string][]byte{
+				"module-info.class":     testModuleInfoBytes(testModule{name: "split"}),
+				"com/lib/api/Dup.class": plainClassBytes("com/lib/api/Dup", 0),
+			})
+			_, _, err := loadWith("-p", modulePath, "--add-modules", "lib,split", "-cp", classPath, "com.cp.Plain")
+			So(err, ShouldNotBeNil)
+			So(strings.Contains(err.Error(), "Package com.lib.api in both module"), ShouldBeTrue)
+		})
+	})
+}
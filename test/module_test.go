@@ -0,0 +1,152 @@
+package test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"outro/constant"
+	"outro/model"
+	"outro/parser"
+	"outro/tool"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// describedModuleBytes builds the module-info class of
+//
+//	module com.example@1.0 {
+//	    requires transitive java.logging;
+//	    requires static java.sql;
+//	    exports com.example.api;
+//	    exports com.example.internal to com.friend;
+//	    opens com.example.res;
+//	    uses com.example.spi.Service;
+//	    provides com.example.spi.Service with com.example.impl.Impl;
+//	}
+//
+// with an implicit java.base dependence, ModulePackages and ModuleMainClass.
+func describedModuleBytes() []byte {
+	var pool []byte
+	count := uint16(1)
+	u2 := func(data []byte, v uint16) []byte { return binary.BigEndian.AppendUint16(data, v) }
+	utf8 := func(s string) uint16 {
+		pool = append(u2(append(pool, constant.ConstantUtf8), uint16(len(s))), s...)
+		count++
+		return count - 1
+	}
+	ref := func(tag uint8, s string) uint16 {
+		name := utf8(s)
+		pool = u2(append(pool, tag), name)
+		count++
+		return count - 1
+	}
+	thisClass := ref(constant.ConstantClass, "module-info")
+	module := ref(constant.ConstantModule, "com.example")
+	version := utf8("1.0")
+	javaBase := ref(constant.ConstantModule, "java.base")
+	javaLogging := ref(constant.ConstantModule, "java.logging")
+	javaSQL := ref(constant.ConstantModule, "java.sql")
+	friend := ref(constant.ConstantModule, "com.friend")
+	api := ref(constant.ConstantPackage, "com/example/api")
+	internal := ref(constant.ConstantPackage, "com/example/internal")
+	res := ref(constant.ConstantPackage, "com/example/res")
+	impl := ref(constant.ConstantPackage, "com/example/impl")
+	spi := ref(constant.ConstantPackage, "com/example/spi")
+	service := ref(constant.ConstantClass, "com/example/spi/Service")
+	implClass := ref(constant.ConstantClass, "com/example/impl/Impl")
+	mainClass := ref(constant.ConstantClass, "com/example/Main")
+	moduleName := utf8("Module")
+	packagesName := utf8("ModulePackages")
+	mainClassName := utf8("ModuleMainClass")
+
+	var body []byte
+	body = u2(u2(u2(body, module), 0), version)
+	body = u2(body, 3)
+	body = u2(u2(u2(body, javaBase), uint16(constant.REQUIRES_ACC_MANDATED)), 0)
+	body = u2(u2(u2(body, javaLogging), uint16(constant.REQUIRES_ACC_TRANSITIVE)), 0)
+	body = u2(u2(u2(body, javaSQL), uint16(constant.REQUIRES_ACC_STATIC_PHASE)), 0)
+	body = u2(body, 2)
+	body = u2(u2(u2(body, internal), 0), 1)
+	body = u2(body, friend)
+	body = u2(u2(u2(body, api), 0), 0)
+	body = u2(body, 1)
+	body = u2(u2(u2(body, res), 0), 0)
+	body = u2(u2(body, 1), service)
+	body = u2(body, 1)
+	body = u2(u2(u2(body, service), 1), implClass)
+
+	data := binary.BigEndian.AppendUint32(nil, constant.ClassFileMagic)
+	data = u2(u2(data, 0), 61)
+	data = append(u2(data, count), pool...)
+	data = u2(data, uint16(constant.CLASS_ACC_MODULE))
+	data = u2(u2(data, thisClass), 0)
+	data = u2(u2(u2(data, 0), 0), 0)
+	data = u2(data, 3)
+	data = append(binary.BigEndian.AppendUint32(u2(data, moduleName), uint32(len(body))), body...)
+	data = binary.BigEndian.AppendUint32(u2(data, packagesName), 12)
+	data = u2(u2(u2(u2(u2(u2(data, 5), api), internal), res), impl), spi)
+	data = binary.BigEndian.AppendUint32(u2(data, mainClassName), 2)
+	return u2(data, mainClass)
+}
+
+func TestModuleDescriptor(t *testing.T) {
+	Convey("Test Module attribute decoding", t, func() {
+		classFile, err := parser.NewClassFileParser(parser.NewByteReader(describedModuleBytes())).Parse()
+		So(err, ShouldBeNil)
+
+		Convey("resolves every directive", func() {
+			descriptor, err := classFile.ModuleDescriptor()
+			So(err, ShouldBeNil)
+			So(descriptor.Name, ShouldEqual, "com.example")
+			So(descriptor.Version, ShouldEqual, "1.0")
+			So(descriptor.IsOpen(), ShouldBeFalse)
+			So(descriptor.Requires, ShouldHaveLength, 3)
+			So(descriptor.Requires[1], ShouldResemble, model.ModuleRequires{
+				Name: "java.logging", Flags: uint16(constant.REQUIRES_ACC_TRANSITIVE),
+			})
+			So(descriptor.Exports[0], ShouldResemble, model.ModuleExports{
+				Package: "com.example.internal", To: []string{"com.friend"},
+			})
+			So(descriptor.Opens, ShouldResemble, []model.ModuleExports{{Package: "com.example.res"}})
+			So(descriptor.Uses, ShouldResemble, []string{"com.example.spi.Service"})
+			So(descriptor.Provides, ShouldResemble, []model.ModuleProvides{{
+				Service: "com.example.spi.Service", With: []string{"com.example.impl.Impl"},
+			}})
+			So(descriptor.Packages, ShouldHaveLength, 5)
+			So(descriptor.MainClass, ShouldEqual, "com.example.Main")
+		})
+
+		Convey("is rendered like jar --describe-module", func() {
+			descriptor, _ := classFile.ModuleDescriptor()
+			So(tool.DescribeModule(descriptor, ""), ShouldEqual, `com.example@1.0
+exports com.example.api
+requires java.base mandated
+requires java.logging transitive
+requires java.sql static
+uses com.example.spi.Service
+provides com.example.spi.Service with com.example.impl.Impl
+qualified exports com.example.internal to com.friend
+opens com.example.res
+contains com.example.impl
+contains com.example.spi
+main-class com.example.Main
+`)
+		})
+
+		Convey("is reported by the module-info command", func() {
+			dir := t.TempDir()
+			So(os.WriteFile(filepath.Join(dir, "module-info.class"), describedModuleBytes(), 0o644), ShouldBeNil)
+			var out bytes.Buffer
+			So(tool.ModuleInfo([]string{dir}, &out), ShouldBeNil)
+			So(out.String(), ShouldStartWith, "com.example@1.0 file://")
+			So(out.String(), ShouldContainSubstring, "main-class com.example.Main\n")
+		})
+
+		Convey("fails for a class without a Module attribute", func() {
+			_, err := parseClassFile("../java/classes/HelloWorld.class").ModuleDescriptor()
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
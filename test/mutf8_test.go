@@ -0,0 +1,56 @@
+package test
+
+import (
+	"bytes"
+	. "github.com/smartystreets/goconvey/convey"
+	"os"
+	"outro/parser"
+	"testing"
+)
+
+func TestModifiedUTF8(t *testing.T) {
+	Convey("Test Modified UTF-8", t, func() {
+		Convey("U+0000 is two bytes", func() {
+			s, err := parser.DecodeMUTF8([]byte{'a', 0xC0, 0x80, 'b'})
+			So(err, ShouldBeNil)
+			So(s, ShouldEqual, "a\x00b")
+			So(parser.EncodeMUTF8("a\x00b"), ShouldResemble, []byte{'a', 0xC0, 0x80, 'b'})
+		})
+		Convey("supplementary characters are surrogate pairs", func() {
+			encoded := []byte{0xED, 0xA0, 0xBD, 0xED, 0xB8, 0x80}
+			s, err := parser.DecodeMUTF8(encoded)
+			So(err, ShouldBeNil)
+			So(s, ShouldEqual, "\U0001F600")
+			So(parser.EncodeMUTF8("\U0001F600"), ShouldResemble, encoded)
+			chars, err := parser.DecodeMUTF8ToUTF16(encoded)
+			So(err, ShouldBeNil)
+			So(chars, ShouldResemble, []uint16{0xD83D, 0xDE00})
+		})
+		Convey("unpaired surrogates survive as UTF-16", func() {
+			chars, err := parser.DecodeMUTF8ToUTF16([]byte{0xED, 0xA0, 0xBD})
+			So(err, ShouldBeNil)
+			So(chars, ShouldResemble, []uint16{0xD83D})
+			So(parser.EncodeUTF16ToMUTF8(chars), ShouldResemble, []byte{0xED, 0xA0, 0xBD})
+		})
+		Convey("invalid sequences are rejected", func() {
+			for _, data := range [][]byte{{0}, {0xF0, 0x9F, 0x98, 0x80}, {0xC0}, {0xC1, 0x81}, {0xE0, 0x80, 0x80}, {0xFF}} {
+				_, err := parser.DecodeMUTF8(data)
+				So(err, ShouldNotBeNil)
+			}
+		})
+		Convey("class files with invalid entries are rejected", func() {
+			original, err := os.ReadFile("../java/classes/HelloWorld.class")
+			So(err, ShouldBeNil)
+			class, err := parser.NewClassFileParser(parser.NewByteReader(original)).Parse()
+			So(err, ShouldBeNil)
+			So(class.ClassName(class.ThisClass), ShouldEqual, "org/example/HelloWorld")
+
+			data := append([]byte{}, original...)
+			offset := bytes.Index(data, []byte("Hello, World!"))
+			data[offset] = 0xFF
+			cfe := classFormatError(parseBytes(data))
+			So(cfe, ShouldNotBeNil)
+			So(cfe.Offset, ShouldEqual, offset)
+		})
+	})
+}
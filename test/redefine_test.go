@@ -0,0 +1,116 @@
+package test
+
+import (
+	"outro/interpreter"
+	"outro/rtda"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const hotSource = `.class public super gen/Hot
+.super java/lang/Object
+.field public static count I
+.method public static f()I
+    ldc 100000
+    ireturn
+.end method
+.method public static g()V
+    return
+.end method
+`
+
+// hotBytes assembles gen/Hot with replace applied to its source.
+func hotBytes(replace ...string) []byte {
+	return mustAssemble(strings.NewReplacer(replace...).Replace(hotSource))
+}
+
+// call runs method on thread above a frame of caller and returns the int
+// it returns.
+func call(thread *rtda.Thread, caller, method *rtda.Method) int32 {
+	thread.NewFrame(caller)
+	thread.NewFrame(method)
+	jvm := &interpreter.JVM{Thread: thread}
+	jvm.Execute()
+	return thread.PopFrame().PopInt()
+}
+
+func TestRedefine(t *testing.T) {
+	Convey("Test Redefine", t, func() {
+		loader := classPathLoader(t, map[string]string{"gen/Hot": hotSource})
+		class, err := loader.LoadClass("gen/Hot")
+		So(err, ShouldBeNil)
+		f, err := class.GetStaticMethod("f", "()I")
+		So(err, ShouldBeNil)
+		g, err := class.GetStaticMethod("g", "()V")
+		So(err, ShouldBeNil)
+		inst := interpreter.NewInstrumentation(loader)
+		So(inst.IsRedefineClassesSupported(), ShouldBeTrue)
+		So(inst.IsModifiableClass(class), ShouldBeTrue)
+
+		Convey("redefined methods run new code while old frames finish on the old", func() {
+			thread := rtda.NewThread()
+			thread.NewFrame(g)
+			thread.NewFrame(f)
+			So(inst.RedefineClasses(rtda.ClassDefinition{Class: class, Bytes: hotBytes("100000", "200000")}), ShouldBeNil)
+			(&interpreter.JVM{Thread: thread}).Execute()
+			So(thread.PopFrame().PopInt(), ShouldEqual, 100000)
+
+			redefined, err := class.GetStaticMethod("f", "()I")
+			So(err, ShouldBeNil)
+			So(redefined, ShouldNotEqual, f)
+			So(redefined.Class, ShouldEqual, class)
+			So(call(thread, g, redefined), ShouldEqual, 200000)
+			So(call(thread, g, f), ShouldEqual, 100000)
+			loaded, err := loader.LoadClass("gen/Hot")
+			So(err, ShouldBeNil)
+			So(loaded, ShouldEqual, class)
+		})
+
+		Convey("redefinitions may change only code", func() {
+			for replacement, message := range map[string]string{
+				".method public static g()V":  "attempted to add a method\n.method public static h()V",
+				"count I":                     "attempted to change the schema (add/remove fields)\ncount J",
+				"public static g":             "attempted to change method modifiers\npublic static final g",
+				".super java/lang/Object":     "attempted to change superclass or interfaces\n.super java/lang/Object\n.implements java/lang/Runnable",
+				".class public super gen/Hot": "attempted to change the class modifiers\n.class public final super gen/Hot",
+			} {
+				expected, changed, _ := strings.Cut(message, "\n")
+				err := loader.RedefineClasses(rtda.ClassDefinition{Class: class, Bytes: hotBytes(replacement, changed)})
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "java.lang.UnsupportedOperationException: class redefinition failed: "+expected)
+			}
+			err := loader.RedefineClasses(rtda.ClassDefinition{Class: class, Bytes: hotBytes("gen/Hot", "gen/Cold")})
+			So(err.Error(), ShouldEqual, "java.lang.NoClassDefFoundError: gen/Hot (wrong name: gen/Cold)")
+		})
+
+		Convey("a failed redefinition changes no class", func() {
+			err := loader.RedefineClasses(
+				rtda.ClassDefinition{Class: class, Bytes: hotBytes("100000", "200000")},
+				rtda.ClassDefinition{Class: class, Bytes: hotBytes("ldc 100000", "lconst_0")},
+			)
+			So(err, ShouldNotBeNil)
+			So(strings.HasPrefix(err.Error(), "java.lang.VerifyError"), ShouldBeTrue)
+			unchanged, err := class.GetStaticMethod("f", "()I")
+			So(err, ShouldBeNil)
+			So(unchanged, ShouldEqual, f)
+		})
+
+		Convey("retransformation runs the transformers again", func() {
+			transformer := &replacer{name: "gen/Hot", replacement: hotBytes("100000", "300000")}
+			inst.AddTransformer(transformer)
+			So(inst.RetransformClasses(class), ShouldBeNil)
+			So(transformer.seen, ShouldResemble, []string{"gen/Hot"})
+			retransformed, err := class.GetStaticMethod("f", "()I")
+			So(err, ShouldBeNil)
+			So(call(rtda.NewThread(), g, retransformed), ShouldEqual, 300000)
+
+			inst.RemoveTransformer(transformer)
+			So(inst.RetransformClasses(class), ShouldBeNil)
+			original, err := class.GetStaticMethod("f", "()I")
+			So(err, ShouldBeNil)
+			So(call(rtda.NewThread(), g, original), ShouldEqual, 100000)
+		})
+	})
+}
@@ -0,0 +1,61 @@
+package test
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"outro/constant"
+	"outro/model"
+	"testing"
+)
+
+func TestStackMapTable(t *testing.T) {
+	class := parseClassFile("../java/classes/MethodInvoke.class")
+	integer := model.VerificationTypeInfo{Tag: constant.ItemInteger}
+	intArray := model.VerificationTypeInfo{Tag: constant.ItemObject, ClassName: "[I"}
+	Convey("Test StackMapTable", t, func() {
+		Convey("is parsed and expanded for compiled code", func() {
+			method, _ := class.GetMethod("accumulate", "([I)I")
+			code, _ := class.GetCodeAttribute(method)
+			stackMap := code.Attributes.Get("StackMapTable").(*model.StackMapTableAttributeInfo)
+			So(stackMap.Entries[0].FrameType, ShouldEqual, constant.FullFrame)
+			So(stackMap.Entries[1].FrameType, ShouldEqual, constant.ChopFrame)
+			So(stackMap.Frames[0].Offset, ShouldEqual, 10)
+			So(len(stackMap.Frames[0].Locals), ShouldEqual, 5)
+			So(stackMap.Frames[0].Locals[0].ClassName, ShouldEqual, "[I")
+			So(stackMap.Frames[1].Offset, ShouldEqual, 33)
+			So(len(stackMap.Frames[1].Locals), ShouldEqual, 2)
+		})
+		Convey("expands every frame kind", func() {
+			locals, err := model.InitialFrameLocals("Foo", "bar", "([IJ)V", true)
+			So(err, ShouldBeNil)
+			So(locals, ShouldResemble, []model.VerificationTypeInfo{intArray, {Tag: constant.ItemLong}})
+			frames, err := model.ExpandStackMapFrames(locals, []model.StackMapFrame{
+				{FrameType: 3, OffsetDelta: 3},
+				{FrameType: 254, OffsetDelta: 4, Locals: []model.VerificationTypeInfo{integer, integer, integer}},
+				{FrameType: 65, OffsetDelta: 1, Stack: []model.VerificationTypeInfo{integer}},
+				{FrameType: constant.SameLocals1StackItemFrameExtended, OffsetDelta: 300, Stack: []model.VerificationTypeInfo{{Tag: constant.ItemNull}}},
+				{FrameType: 249, OffsetDelta: 0},
+				{FrameType: constant.SameFrameExtended, OffsetDelta: 100},
+				{FrameType: constant.FullFrame, OffsetDelta: 0, Locals: []model.VerificationTypeInfo{integer}, Stack: []model.VerificationTypeInfo{}},
+			})
+			So(err, ShouldBeNil)
+			offsets := []uint16{}
+			sizes := []int{}
+			for _, frame := range frames {
+				offsets = append(offsets, frame.Offset)
+				sizes = append(sizes, len(frame.Locals))
+			}
+			So(offsets, ShouldResemble, []uint16{3, 8, 10, 311, 312, 413, 414})
+			So(sizes, ShouldResemble, []int{2, 5, 5, 5, 3, 3, 1})
+			So(frames[2].Stack, ShouldResemble, []model.VerificationTypeInfo{integer})
+		})
+		Convey("rejects chopping more locals than exist", func() {
+			_, err := model.ExpandStackMapFrames(nil, []model.StackMapFrame{{FrameType: 250, OffsetDelta: 0}})
+			So(err, ShouldNotBeNil)
+		})
+		Convey("gives constructors an uninitialized receiver", func() {
+			locals, err := model.InitialFrameLocals("Foo", "<init>", "()V", false)
+			So(err, ShouldBeNil)
+			So(locals, ShouldResemble, []model.VerificationTypeInfo{{Tag: constant.ItemUninitializedThis}})
+		})
+	})
+}
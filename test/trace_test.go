@@ -0,0 +1,145 @@
+package test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"outro/interpreter"
+	"outro/launcher"
+	"outro/rtda"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const traceSource = `.class public super gen/Trace
+.super java/lang/Object
+.method public static add(I)I
+    iload_0
+    bipush 10
+    iadd
+    ireturn
+.end method
+.method public static main([Ljava/lang/String;)V
+    return
+.end method
+`
+
+// traceAdd runs gen/Trace.add(32) above a frame of main, then main, with
+// tracer.
+func traceAdd(t *testing.T, tracer interpreter.Tracer) {
+	loader := classPathLoader(t, map[string]string{"gen/Trace": traceSource})
+	class, err := loader.LoadClass("gen/Trace")
+	So(err, ShouldBeNil)
+	main, err := class.GetMainMethod()
+	So(err, ShouldBeNil)
+	add, err := class.GetStaticMethod("add", "(I)I")
+	So(err, ShouldBeNil)
+	jvm := &interpreter.JVM{Thread: rtda.NewThread(), Loader: loader, Tracer: tracer}
+	jvm.Thread.NewFrame(main)
+	jvm.Thread.NewFrame(add)
+	jvm.Thread.CurrentFrame().SetLocalVariableInt(0, 32)
+	jvm.Execute()
+	So(jvm.Thread.CurrentFrame().PopInt(), ShouldEqual, 42)
+	jvm.Execute()
+	So(jvm.Thread.StackDepth(), ShouldEqual, 0)
+}
+
+var errTraceFull = errors.New("trace full")
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errTraceFull
+}
+
+func TestTrace(t *testing.T) {
+	Convey("Test Trace", t, func() {
+		Convey("the text tracer writes a line for every instruction", func() {
+			var out bytes.Buffer
+			tracer, err := interpreter.FilterTracer(interpreter.NewTextTracer(&out), "gen/Trace#add")
+			So(err, ShouldBeNil)
+			traceAdd(t, tracer)
+			So(out.String(), ShouldEqual, `gen/Trace.add(I)I 0 iload_0 stack=[] locals=[32]
+gen/Trace.add(I)I 1 bipush const=10 stack=[32] locals=[32]
+gen/Trace.add(I)I 3 iadd stack=[32 10] locals=[32]
+gen/Trace.add(I)I 4 ireturn stack=[42] locals=[32]
+`)
+		})
+
+		Convey("the JSON tracer writes a record for every instruction", func() {
+			var out bytes.Buffer
+			tracer, err := interpreter.FilterTracer(interpreter.NewJSONTracer(&out), "gen/*#a*")
+			So(err, ShouldBeNil)
+			traceAdd(t, tracer)
+			var records []map[string]interface{}
+			scanner := bufio.NewScanner(&out)
+			for scanner.Scan() {
+				var record map[string]interface{}
+				So(json.Unmarshal(scanner.Bytes(), &record), ShouldBeNil)
+				records = append(records, record)
+			}
+			So(records, ShouldHaveLength, 4)
+			So(records[1], ShouldResemble, map[string]interface{}{
+				"class":      "gen/Trace",
+				"method":     "add",
+				"descriptor": "(I)I",
+				"pc":         1.0,
+				"opcode":     "bipush",
+				"operands":   map[string]interface{}{"const": 10.0},
+				"stack":      []interface{}{32.0},
+				"locals":     []interface{}{32.0},
+			})
+		})
+
+		Convey("filters pass the methods they match", func() {
+			var out bytes.Buffer
+			tracer, err := interpreter.FilterTracer(interpreter.NewTextTracer(&out), "gen.Trace#main")
+			So(err, ShouldBeNil)
+			traceAdd(t, tracer)
+			So(out.String(), ShouldEqual, "gen/Trace.main([Ljava/lang/String;)V 0 return stack=[] locals=[null]\n")
+			out.Reset()
+			tracer, err = interpreter.FilterTracer(interpreter.NewTextTracer(&out), "gen.Trace")
+			So(err, ShouldBeNil)
+			traceAdd(t, tracer)
+			So(strings.Count(out.String(), "\n"), ShouldEqual, 5)
+			_, err = interpreter.FilterTracer(tracer, "gen/[")
+			So(err.Error(), ShouldEqual, "invalid trace pattern gen/[: syntax error in pattern")
+		})
+
+		Convey("the JVM reports the first error writing the trace", func() {
+			tracer := interpreter.NewTextTracer(failingWriter{})
+			var err error
+			func() {
+				defer func() { err, _ = recover().(error) }()
+				traceAdd(t, tracer)
+			}()
+			So(errors.Is(err, errTraceFull), ShouldBeTrue)
+			So(err.Error(), ShouldEqual, "writing the trace: trace full")
+			So(tracer.Flush(), ShouldEqual, errTraceFull)
+		})
+
+		Convey("choose tracing with -Xtrace", func() {
+			options, err := launcher.ParseOptions([]string{"gen.Main"})
+			So(err, ShouldBeNil)
+			tracer, err := options.NewTracer(&bytes.Buffer{})
+			So(err, ShouldBeNil)
+			So(tracer, ShouldBeNil)
+
+			for arg, trace := range map[string]string{"-Xtrace": "text", "-Xtrace:json": "json", "-Xtrace:text:gen.Trace#add": "text:gen.Trace#add"} {
+				options, err := launcher.ParseOptions([]string{arg, "gen.Main"})
+				So(err, ShouldBeNil)
+				So(options.Trace, ShouldEqual, trace)
+				tracer, err := options.NewTracer(&bytes.Buffer{})
+				So(err, ShouldBeNil)
+				So(tracer, ShouldNotBeNil)
+			}
+			_, err = launcher.ParseOptions([]string{"-Xtrace:xml", "gen.Main"})
+			So(err.Error(), ShouldEqual, "invalid -Xtrace format: xml")
+			_, err = launcher.ParseOptions([]string{"-Xtrace:json:[", "gen.Main"})
+			So(strings.HasPrefix(err.Error(), "invalid trace pattern"), ShouldBeTrue)
+		})
+	})
+}
@@ -0,0 +1,165 @@
+package test
+
+import (
+	"os"
+	"outro/interpreter"
+	"outro/model"
+	"outro/parser"
+	"outro/rtda"
+	"outro/tree"
+	"outro/verifier"
+	"outro/writer"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const treeSource = `.class public super gen/Tree
+.super java/lang/Object
+.method public static f(I)I
+    iload_0
+    ifeq Zero
+    iconst_1
+    ireturn
+Zero:
+    iconst_0
+    ireturn
+.end method
+.method public static g(I)I
+    iload_0
+    tableswitch 0 1
+        A
+        B
+        default: B
+A:
+    iconst_1
+    ireturn
+B:
+    iconst_0
+    ireturn
+.end method
+`
+
+// readTree parses a class file and reads the code of one of its methods.
+func readTree(data []byte, name, descriptor string) (*model.ClassFile, *model.MethodInfo, *tree.Code) {
+	file, err := parser.NewClassFileParser(parser.NewByteReader(data)).Parse()
+	So(err, ShouldBeNil)
+	for i := range file.Methods {
+		method := &file.Methods[i]
+		if file.Utf8(method.NameIndex) == name && file.Utf8(method.DescriptorIndex) == descriptor {
+			code, err := tree.Read(file, method)
+			So(err, ShouldBeNil)
+			return file, method, code
+		}
+	}
+	panic("no method " + name + descriptor)
+}
+
+func TestTree(t *testing.T) {
+	Convey("Test Tree", t, func() {
+		Convey("reading and writing code keeps it", func() {
+			data, err := os.ReadFile("../java/classes/MethodInvoke.class")
+			So(err, ShouldBeNil)
+			file, err := parser.NewClassFileParser(parser.NewByteReader(data)).Parse()
+			So(err, ShouldBeNil)
+			for i := range file.Methods {
+				method := &file.Methods[i]
+				original := method.Attributes.Get("Code").(*model.CodeAttributeInfo)
+				code, err := tree.Read(file, method)
+				So(err, ShouldBeNil)
+				So(code.Write(file, method), ShouldBeNil)
+				written := method.Attributes.Get("Code").(*model.CodeAttributeInfo)
+				So(written.Code, ShouldResemble, original.Code)
+				So(written.ExceptionTable, ShouldResemble, original.ExceptionTable)
+				lines := written.Attributes.Get("LineNumberTable").(*model.LineNumberTableAttributeInfo)
+				So(lines.LineNumberTable, ShouldResemble, original.Attributes.Get("LineNumberTable").(*model.LineNumberTableAttributeInfo).LineNumberTable)
+				So(written.Attributes.Get("StackMapTable"), ShouldBeNil)
+			}
+		})
+
+		Convey("far branches become goto_w", func() {
+			data := mustAssemble(treeSource)
+			file, method, code := readTree(data, "f", "(I)I")
+			ifeq := code.Instructions.First().Next()
+			So(ifeq.(*tree.Insn).Opcode, ShouldEqual, interpreter.IFEQ)
+			for i := 0; i < 40000; i++ {
+				code.Instructions.InsertAfter(ifeq, &tree.Insn{Opcode: interpreter.NOP})
+			}
+			So(code.Write(file, method), ShouldBeNil)
+			written := method.Attributes.Get("Code").(*model.CodeAttributeInfo)
+			instructions, err := interpreter.Decode(written.Code)
+			So(err, ShouldBeNil)
+			So(instructions[1].Opcode, ShouldEqual, interpreter.IFNE)
+			So(instructions[1].Target, ShouldEqual, 9)
+			So(instructions[2].Opcode, ShouldEqual, interpreter.GOTO_W)
+			zero := instructions[len(instructions)-2]
+			So(zero.Opcode, ShouldEqual, interpreter.ICONST_0)
+			So(instructions[2].Target, ShouldEqual, zero.Offset)
+
+			v := verifier.New(rtda.NewApplicationClassLoader())
+			So(v.ComputeAllFrames(file), ShouldBeNil)
+			So(v.Verify(file), ShouldBeNil)
+			_, err = writer.Write(file)
+			So(err, ShouldBeNil)
+		})
+
+		Convey("switches are padded again", func() {
+			data := mustAssemble(treeSource)
+			file, method, code := readTree(data, "g", "(I)I")
+			code.Instructions.Insert(&tree.Insn{Opcode: interpreter.NOP})
+			So(code.Write(file, method), ShouldBeNil)
+			written := method.Attributes.Get("Code").(*model.CodeAttributeInfo)
+			instructions, err := interpreter.Decode(written.Code)
+			So(err, ShouldBeNil)
+			tableswitch := instructions[2]
+			So(tableswitch.Opcode, ShouldEqual, interpreter.TABLESWITCH)
+			So(tableswitch.Length, ShouldEqual, 1+1+12+8)
+			So(tableswitch.Targets, ShouldResemble, []int{instructions[3].Offset, instructions[5].Offset})
+			So(tableswitch.Target, ShouldEqual, instructions[5].Offset)
+		})
+
+		Convey("locals beyond 255 are wide", func() {
+			data := mustAssemble(treeSource)
+			file, method, code := readTree(data, "g", "(I)I")
+			code.Instructions.Insert(
+				&tree.Insn{Opcode: interpreter.IINC, Local: 300, Const: 1000},
+				&tree.Insn{Opcode: interpreter.ILOAD, Local: 2},
+				&tree.Insn{Opcode: interpreter.POP},
+			)
+			So(code.Write(file, method), ShouldBeNil)
+			written := method.Attributes.Get("Code").(*model.CodeAttributeInfo)
+			So(written.Code[:8], ShouldResemble, []byte{byte(interpreter.WIDE), byte(interpreter.IINC), 1, 44, 3, 232,
+				byte(interpreter.ILOAD_2), byte(interpreter.POP)})
+		})
+
+		Convey("code type annotations follow their labels", func() {
+			file, method, code := readTree(richClassBytes(), "m", "(Ljava/util/List;)Z")
+			original := method.Attributes.Get("Code").(*model.CodeAttributeInfo).Attributes.
+				Get("RuntimeVisibleTypeAnnotations").(*model.RuntimeVisibleTypeAnnotationsAttributeInfo).Annotations
+			So(code.VisibleTypeAnnotations, ShouldHaveLength, 2)
+			So(code.Write(file, method), ShouldBeNil)
+			annotations := func() []model.TypeAnnotationInfo {
+				written := method.Attributes.Get("Code").(*model.CodeAttributeInfo)
+				return written.Attributes.Get("RuntimeVisibleTypeAnnotations").(*model.RuntimeVisibleTypeAnnotationsAttributeInfo).Annotations
+			}
+			So(annotations(), ShouldResemble, original)
+
+			code.Instructions.Insert(&tree.Insn{Opcode: interpreter.NOP})
+			So(code.Write(file, method), ShouldBeNil)
+			So(annotations()[0].TargetInfo.Offset, ShouldEqual, original[0].TargetInfo.Offset+1)
+			So(annotations()[1].TargetInfo.Table, ShouldResemble, []model.LocalVarTargetInfo{{StartPC: 1, Length: original[1].TargetInfo.Table[0].Length}})
+			data, err := writer.Write(file)
+			So(err, ShouldBeNil)
+			_, err = parser.NewClassFileParser(parser.NewByteReader(data)).Parse()
+			So(err, ShouldBeNil)
+		})
+
+		Convey("removed labels are reported", func() {
+			data := mustAssemble(treeSource)
+			file, method, code := readTree(data, "f", "(I)I")
+			ifeq := code.Instructions.First().Next().(*tree.Insn)
+			code.Instructions.Remove(ifeq.Target)
+			So(code.Write(file, method).Error(), ShouldEqual, "branch target of ifeq at offset 1 is not in the code")
+		})
+	})
+}
@@ -0,0 +1,67 @@
+package test
+
+import (
+	"encoding/binary"
+	. "github.com/smartystreets/goconvey/convey"
+	"outro/constant"
+	"outro/model"
+	"outro/parser"
+	"testing"
+)
+
+// typeAnnotatedClassBytes assembles class Foo whose only attribute is a
+// RuntimeVisibleTypeAnnotations with the given body.
+func typeAnnotatedClassBytes(body []byte) []byte {
+	u2 := func(data []byte, v uint16) []byte { return binary.BigEndian.AppendUint16(data, v) }
+	utf8 := func(data []byte, s string) []byte {
+		return append(u2(append(data, constant.ConstantUtf8), uint16(len(s))), s...)
+	}
+	data := binary.BigEndian.AppendUint32(nil, constant.ClassFileMagic)
+	data = u2(u2(data, 0), 61)
+	data = u2(data, 5)
+	data = utf8(data, "Foo")                           // 1
+	data = u2(append(data, constant.ConstantClass), 1) // 2
+	data = utf8(data, "RuntimeVisibleTypeAnnotations") // 3
+	data = utf8(data, "LNonNull;")                     // 4
+	data = u2(data, uint16(constant.CLASS_ACC_PUBLIC))
+	data = u2(u2(u2(u2(u2(data, 2), 0), 0), 0), 0)
+	data = u2(data, 1)
+	data = binary.BigEndian.AppendUint32(u2(data, 3), uint32(len(body)))
+	return append(data, body...)
+}
+
+func TestTypeAnnotations(t *testing.T) {
+	Convey("Test Type Annotations", t, func() {
+		body := []byte{0, 5}
+		// @NonNull on the type argument of the superclass: extends Base<@NonNull T>
+		body = append(body, constant.TargetClassExtends, 0xFF, 0xFF, 1, constant.TypePathTypeArgument, 0, 0, 4, 0, 0)
+		// bound 1 of type parameter 2
+		body = append(body, constant.TargetClassTypeParameterBound, 2, 1, 0, 0, 4, 0, 0)
+		// a local variable live in two ranges
+		body = append(body, constant.TargetLocalVariable, 0, 2, 0, 0, 0, 5, 0, 1, 0, 9, 0, 3, 0, 1, 0, 0, 4, 0, 0)
+		// the second type argument of a cast at offset 12, inside an array
+		body = append(body, constant.TargetCast, 0, 12, 1, 1, constant.TypePathArray, 0, 0, 4, 0, 0)
+		// the third type in the throws clause
+		body = append(body, constant.TargetThrows, 0, 2, 0, 0, 4, 0, 0)
+
+		class, err := parser.NewClassFileParser(parser.NewByteReader(typeAnnotatedClassBytes(body))).Parse()
+		So(err, ShouldBeNil)
+		annotations := class.Attributes.Get("RuntimeVisibleTypeAnnotations").(*model.RuntimeVisibleTypeAnnotationsAttributeInfo).Annotations
+		So(len(annotations), ShouldEqual, 5)
+		So(annotations[0].TargetInfo.SupertypeIndex, ShouldEqual, 0xFFFF)
+		So(annotations[0].TargetPath, ShouldResemble, []model.TypePathEntry{{TypePathKind: constant.TypePathTypeArgument}})
+		So(class.Utf8(annotations[0].TypeIndex), ShouldEqual, "LNonNull;")
+		So(annotations[1].TargetInfo.TypeParameterIndex, ShouldEqual, 2)
+		So(annotations[1].TargetInfo.BoundIndex, ShouldEqual, 1)
+		So(annotations[2].TargetInfo.Table, ShouldResemble, []model.LocalVarTargetInfo{{StartPC: 0, Length: 5, Index: 1}, {StartPC: 9, Length: 3, Index: 1}})
+		So(annotations[3].TargetInfo.Offset, ShouldEqual, 12)
+		So(annotations[3].TargetInfo.TypeArgumentIndex, ShouldEqual, 1)
+		So(annotations[4].TargetInfo.ThrowsTypeIndex, ShouldEqual, 2)
+
+		Convey("rejects unknown target types", func() {
+			cfe := classFormatError(parseBytes(typeAnnotatedClassBytes([]byte{0, 1, 0x30, 0, 0, 4, 0, 0})))
+			So(cfe, ShouldNotBeNil)
+			So(cfe.Reason, ShouldContainSubstring, "target type")
+		})
+	})
+}
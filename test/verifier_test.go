@@ -0,0 +1,382 @@
+package test
+
+import (
+	"errors"
+	"os"
+	"outro/asm"
+	"outro/launcher"
+	"outro/model"
+	"outro/parser"
+	"outro/rtda"
+	"outro/verifier"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// verifyMethod assembles a class with one static method of the given
+// descriptor and verifies it.
+func verifyMethod(descriptor, body string) error {
+	file := assembleClass(".class public super gen/V\n.super java/lang/Object\n" +
+		".method public static f" + descriptor + "\n" + body + "\n.end method\n")
+	return verifier.New(rtda.NewApplicationClassLoader()).Verify(file)
+}
+
+// patchedMethodInvoke parses the MethodInvoke fixture and overwrites code
+// bytes of its accumulate method from offset on.
+func patchedMethodInvoke(offset int, code ...byte) *model.ClassFile {
+	data, err := os.ReadFile("../java/classes/MethodInvoke.class")
+	So(err, ShouldBeNil)
+	file, err := parser.NewClassFileParser(parser.NewByteReader(data)).Parse()
+	So(err, ShouldBeNil)
+	method, err := file.GetMethod("accumulate", "([I)I")
+	So(err, ShouldBeNil)
+	attribute, err := file.GetCodeAttribute(method)
+	So(err, ShouldBeNil)
+	copy(attribute.Code[offset:], code)
+	return file
+}
+
+// classPathLoader assembles classes into a class path directory and
+// returns a loader over it that verifies what it loads.
+func classPathLoader(t *testing.T, sources map[string]string) *rtda.ApplicationClassLoader {
+	dir := t.TempDir()
+	for name, source := range sources {
+		data, err := asm.Assemble(source)
+		So(err, ShouldBeNil)
+		So(os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), 0o755), ShouldBeNil)
+		So(os.WriteFile(filepath.Join(dir, name+".class"), data, 0o644), ShouldBeNil)
+	}
+	entries, err := rtda.ParseClassPath(dir)
+	So(err, ShouldBeNil)
+	loader := rtda.NewModularClassLoader(entries, rtda.NewModuleGraph())
+	loader.SetVerifier(verifier.New(loader))
+	return loader
+}
+
+// verifyOldMethod is verifyMethod for a version 49 class file, which has
+// its types inferred.
+func verifyOldMethod(descriptor, body string) error {
+	file := assembleClass(".bytecode 49.0\n.class public super gen/Old\n.super java/lang/Object\n" +
+		".method public static f" + descriptor + "\n" + body + "\n.end method\n")
+	return verifier.New(rtda.NewApplicationClassLoader()).Verify(file)
+}
+
+// sumSource sums the numbers from n down to 1 in a loop.
+const sumSource = `.class public super gen/Sum
+.super java/lang/Object
+.method public static sum(I)I
+    .limit locals 2
+    iconst_0
+    istore_1
+Loop:
+    iload_0
+    ifeq Done
+    iload_1
+    iload_0
+    iadd
+    istore_1
+    iinc 0 -1
+    goto Loop
+Done:
+    iload_1
+    ireturn
+.end method
+`
+
+func TestVerifier(t *testing.T) {
+	Convey("Test type-checking verifier", t, func() {
+		Convey("accept compiled classes", func() {
+			v := verifier.New(rtda.NewApplicationClassLoader())
+			for _, name := range []string{"HelloWorld", "MethodInvoke"} {
+				data, err := os.ReadFile("../java/classes/" + name + ".class")
+				So(err, ShouldBeNil)
+				file, err := parser.NewClassFileParser(parser.NewByteReader(data)).Parse()
+				So(err, ShouldBeNil)
+				So(v.Verify(file), ShouldBeNil)
+			}
+		})
+
+		Convey("report operands of the wrong type", func() {
+			err := verifyMethod("()I", `    ldc "x"
+    ireturn`)
+			So(err.Error(), ShouldEqual, "java.lang.VerifyError: gen/V.f()I at offset 2: expected int, found java/lang/String")
+			var verifyError *verifier.VerifyError
+			So(errors.As(err, &verifyError), ShouldBeTrue)
+			So(verifyError.Method, ShouldEqual, "f")
+			So(verifyError.Offset, ShouldEqual, 2)
+
+			err = verifyMethod("()J", `    fconst_0
+    fconst_1
+    lreturn`)
+			So(err.Error(), ShouldEqual, "java.lang.VerifyError: gen/V.f()J at offset 2: expected long, found float")
+			err = verifyMethod("(F)I", `    iload_0
+    ireturn`)
+			So(err.Error(), ShouldEqual, "java.lang.VerifyError: gen/V.f(F)I at offset 0: expected int in local 0, found float")
+			err = verifyMethod("()V", `    iconst_0
+    newarray int
+    iconst_0
+    baload
+    pop
+    return`)
+			So(err.Error(), ShouldEqual, "java.lang.VerifyError: gen/V.f()V at offset 4: expected array of byte or boolean, found [I")
+			err = verifyMethod("()I", `    iconst_1
+    ireturn
+    iconst_0
+    ireturn`)
+			So(err.Error(), ShouldEqual, "java.lang.VerifyError: gen/V.f()I at offset 2: expecting a stack map frame")
+		})
+
+		Convey("keep longs and doubles whole", func() {
+			So(verifyMethod("(JI)J", `    lload_0
+    iload_2
+    dup_x2
+    pop
+    lstore_0
+    pop
+    lload_0
+    lreturn`), ShouldBeNil)
+			err := verifyMethod("()V", `    lconst_0
+    dup
+    return`)
+			So(err.Error(), ShouldEqual, "java.lang.VerifyError: gen/V.f()V at offset 1: expected category 1 value, found long")
+			err = verifyMethod("(J)J", `    iconst_0
+    istore_1
+    lload_0
+    lreturn`)
+			So(err.Error(), ShouldEqual, "java.lang.VerifyError: gen/V.f(J)J at offset 2: expected long in local 0, found top")
+		})
+
+		Convey("track object initialization", func() {
+			So(verifyMethod("()Ljava/lang/Object;", `    new java/lang/Object
+    dup
+    invokespecial java/lang/Object/<init>()V
+    areturn`), ShouldBeNil)
+			err := verifyMethod("()Ljava/lang/Object;", `    new java/lang/Object
+    areturn`)
+			So(err.Error(), ShouldEqual, "java.lang.VerifyError: gen/V.f()Ljava/lang/Object; at offset 3: expected java/lang/Object, found uninitialized(0)")
+			err = verifyMethod("()V", `    new java/lang/Object
+    invokespecial java/lang/String/<init>()V
+    return`)
+			So(err.Error(), ShouldEqual, "java.lang.VerifyError: gen/V.f()V at offset 3: call to java/lang/String.<init> on uninitialized(0) of java/lang/Object")
+
+			data, err := asm.Assemble(`.class public super gen/Ctor
+.super java/lang/Object
+.method public <init>()V
+    return
+.end method
+`)
+			So(err, ShouldBeNil)
+			file, err := parser.NewClassFileParser(parser.NewByteReader(data)).Parse()
+			So(err, ShouldBeNil)
+			err = verifier.New(rtda.NewApplicationClassLoader()).Verify(file)
+			So(err.Error(), ShouldEqual, "java.lang.VerifyError: gen/Ctor.<init>()V at offset 0: constructor must call super() or this() before return")
+		})
+
+		Convey("check frames against the stack map", func() {
+			v := verifier.New(rtda.NewApplicationClassLoader())
+			// aconst_null, astore_1 leave null where the loop expects an int.
+			err := v.Verify(patchedMethodInvoke(0, 0x01, 0x4c))
+			So(err.Error(), ShouldEqual, "java.lang.VerifyError: org/example/MethodInvoke.accumulate([I)I at offset 10: "+
+				"expected int in local 1 of the stack map frame at offset 10, found null")
+			// if_icmpge 16, where no frame is declared.
+			err = v.Verify(patchedMethodInvoke(14, 0x00, 0x03))
+			So(err.Error(), ShouldEqual, "java.lang.VerifyError: org/example/MethodInvoke.accumulate([I)I at offset 13: "+
+				"expecting a stack map frame at branch target 16")
+			// nop instead of the iconst_0 istore_1 stores.
+			err = v.Verify(patchedMethodInvoke(0, 0x00))
+			So(err.Error(), ShouldEqual, "java.lang.VerifyError: org/example/MethodInvoke.accumulate([I)I at offset 1: operand stack underflow, expected int")
+			// iload_1 instead of the array for the loop.
+			err = v.Verify(patchedMethodInvoke(2, 0x1b))
+			So(err.Error(), ShouldEqual, "java.lang.VerifyError: org/example/MethodInvoke.accumulate([I)I at offset 3: expected reference, found int")
+		})
+
+		Convey("load classes to check assignability when linking", func() {
+			loader := classPathLoader(t, map[string]string{
+				"gen/Base":  ".class public super gen/Base\n.super java/lang/Object\n",
+				"gen/Sub":   ".class public super gen/Sub\n.super gen/Base\n",
+				"gen/Shape": ".class public interface abstract gen/Shape\n.super java/lang/Object\n",
+				"gen/Good": `.class public super gen/Good
+.super java/lang/Object
+.method public static f(Lgen/Sub;)Lgen/Base;
+    aload_0
+    areturn
+.end method
+.method public static g(Lgen/Base;)Lgen/Shape;
+    aload_0
+    areturn
+.end method
+`,
+				"gen/Bad": `.class public super gen/Bad
+.super java/lang/Object
+.method public static f(Lgen/Base;)Lgen/Sub;
+    aload_0
+    areturn
+.end method
+`,
+			})
+			good, err := loader.LoadClass("gen/Good")
+			So(err, ShouldBeNil)
+			So(good.Name, ShouldEqual, "gen/Good")
+			_, err = loader.LoadClass("gen/Bad")
+			So(err.Error(), ShouldEqual, "java.lang.VerifyError: gen/Bad.f(Lgen/Base;)Lgen/Sub; at offset 1: expected gen/Sub, found gen/Base")
+			_, err = loader.LoadClass("gen/Bad")
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestTypeInference(t *testing.T) {
+	Convey("Test type-inferring verifier", t, func() {
+		Convey("infer types through loops", func() {
+			So(verifyOldMethod("(I)I", `    iconst_0
+    istore_1
+Loop:
+    iload_0
+    ifeq Done
+    iinc 1 2
+    iinc 0 -1
+    goto Loop
+Done:
+    iload_1
+    ireturn`), ShouldBeNil)
+			err := verifyOldMethod("()I", `    fconst_0
+    ireturn`)
+			So(err.Error(), ShouldEqual, "java.lang.VerifyError: gen/Old.f()I at offset 1: expected int, found float")
+		})
+
+		Convey("make locals merged from different types unusable", func() {
+			err := verifyOldMethod("(I)I", `    .limit locals 2
+    iload_0
+    ifeq Else
+    iconst_1
+    istore_1
+    goto Join
+Else:
+    fconst_1
+    fstore_1
+Join:
+    iload_1
+    ireturn`)
+			So(err.Error(), ShouldEqual, "java.lang.VerifyError: gen/Old.f(I)I at offset 11: expected int in local 1, found top")
+		})
+
+		Convey("merge classes to their common superclass", func() {
+			join := func(returnType string) string {
+				return `.bytecode 49.0
+.class public super gen/Join` + returnType + `
+.super java/lang/Object
+.method public static f(ZLgen/Sub;Lgen/Other;)Lgen/` + returnType + `;
+    iload_0
+    ifeq Else
+    aload_1
+    goto Join
+Else:
+    aload_2
+Join:
+    areturn
+.end method
+`
+			}
+			loader := classPathLoader(t, map[string]string{
+				"gen/Base":     ".class public super gen/Base\n.super java/lang/Object\n",
+				"gen/Sub":      ".class public super gen/Sub\n.super gen/Base\n",
+				"gen/Other":    ".class public super gen/Other\n.super gen/Base\n",
+				"gen/JoinBase": join("Base"),
+				"gen/JoinSub":  join("Sub"),
+			})
+			_, err := loader.LoadClass("gen/JoinBase")
+			So(err, ShouldBeNil)
+			_, err = loader.LoadClass("gen/JoinSub")
+			So(err.Error(), ShouldEqual, "java.lang.VerifyError: gen/JoinSub.f(ZLgen/Sub;Lgen/Other;)Lgen/Sub; at offset 9: expected gen/Sub, found gen/Base")
+		})
+
+		Convey("follow jsr and ret subroutines", func() {
+			So(verifyOldMethod("(I)I", `    iload_0
+    istore_1
+    jsr Sub
+    iload_1
+    ireturn
+Sub:
+    astore_2
+    iinc 1 1
+    ret 2`), ShouldBeNil)
+
+			// Locals the subroutine leaves alone keep the type they have at
+			// each call.
+			So(verifyOldMethod("(I)I", `    .limit locals 4
+    iconst_1
+    istore_3
+    jsr Sub
+    iload_3
+    istore_0
+    fconst_1
+    fstore_3
+    jsr Sub
+    fload_3
+    f2i
+    iload_0
+    iadd
+    ireturn
+Sub:
+    astore_2
+    ret 2`), ShouldBeNil)
+
+			err := verifyOldMethod("(I)I", `    iload_0
+    istore_1
+    jsr Sub
+    iload_1
+    ireturn
+Sub:
+    astore_2
+    fconst_0
+    fstore_1
+    ret 2`)
+			So(err.Error(), ShouldEqual, "java.lang.VerifyError: gen/Old.f(I)I at offset 5: expected int in local 1, found float")
+			err = verifyOldMethod("()V", `    iconst_0
+    istore_1
+    ret 1`)
+			So(err.Error(), ShouldEqual, "java.lang.VerifyError: gen/Old.f()V at offset 2: expected returnAddress in local 1, found int")
+		})
+
+		Convey("fail version 50 over to inference", func() {
+			for version, ok := range map[string]bool{"50.0": true, "51.0": false} {
+				file := assembleClass(".bytecode " + version + "\n" + sumSource)
+				err := verifier.New(rtda.NewApplicationClassLoader()).Verify(file)
+				if ok {
+					So(err, ShouldBeNil)
+				} else {
+					So(err.Error(), ShouldEqual, "java.lang.VerifyError: gen/Sum.sum(I)I at offset 3: expecting a stack map frame at branch target 16")
+				}
+			}
+		})
+
+		Convey("choose verification with -Xverify", func() {
+			options, err := launcher.ParseOptions([]string{"gen.Main"})
+			So(err, ShouldBeNil)
+			So(options.Verify, ShouldEqual, "remote")
+			_, err = launcher.ParseOptions([]string{"-Xverify:some", "gen.Main"})
+			So(err.Error(), ShouldEqual, "invalid -Xverify mode: some")
+
+			dir := t.TempDir()
+			data, err := asm.Assemble(".bytecode 51.0\n" + sumSource)
+			So(err, ShouldBeNil)
+			So(os.MkdirAll(filepath.Join(dir, "gen"), 0o755), ShouldBeNil)
+			So(os.WriteFile(filepath.Join(dir, "gen", "Sum.class"), data, 0o644), ShouldBeNil)
+			for _, mode := range []string{"none", "remote", "all"} {
+				options, err := launcher.ParseOptions([]string{"-Xverify:" + mode, "-cp", dir, "gen.Sum"})
+				So(err, ShouldBeNil)
+				So(options.Verify, ShouldEqual, mode)
+				loader, err := options.NewClassLoader()
+				So(err, ShouldBeNil)
+				_, err = options.LoadMainClass(loader)
+				if mode == "none" {
+					So(err, ShouldBeNil)
+				} else {
+					So(err, ShouldNotBeNil)
+				}
+			}
+		})
+	})
+}
@@ -0,0 +1,411 @@
+package test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"outro/asm"
+	"outro/builder"
+	"outro/constant"
+	"outro/interpreter"
+	"outro/model"
+	"outro/parser"
+	"outro/rtda"
+	"outro/verifier"
+	"outro/visitor"
+	"outro/writer"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// renamer renames method f to g and drops field dropped.
+type renamer struct {
+	visitor.ClassVisitor
+}
+
+func (r *renamer) VisitField(access uint16, name, descriptor, signature string, value interface{}) visitor.FieldVisitor {
+	if name == "dropped" {
+		return nil
+	}
+	return r.ClassVisitor.VisitField(access, name, descriptor, signature, value)
+}
+
+func (r *renamer) VisitMethod(access uint16, name, descriptor, signature string, exceptions []string) visitor.MethodVisitor {
+	if name == "f" {
+		name = "g"
+	}
+	return &counter{MethodVisitor: r.ClassVisitor.VisitMethod(access, name, descriptor, signature, exceptions)}
+}
+
+// counter increments the static field gen/Count.calls at the start of
+// every method.
+type counter struct {
+	visitor.MethodVisitor
+}
+
+func (c *counter) VisitCode() {
+	c.MethodVisitor.VisitCode()
+	c.VisitFieldInsn(interpreter.GETSTATIC, "gen/Count", "calls", "I")
+	c.VisitInsn(interpreter.ICONST_1)
+	c.VisitInsn(interpreter.IADD)
+	c.VisitFieldInsn(interpreter.PUTSTATIC, "gen/Count", "calls", "I")
+}
+
+// roundTrip reads a class file and writes it again with no visitor in
+// between.
+func roundTrip(data []byte) *model.ClassFile {
+	reader, err := visitor.NewClassReader(data)
+	So(err, ShouldBeNil)
+	w := visitor.NewClassWriter()
+	So(reader.Accept(w), ShouldBeNil)
+	data, err = w.Bytes()
+	So(err, ShouldBeNil)
+	file, err := parser.NewClassFileParser(parser.NewByteReader(data)).Parse()
+	So(err, ShouldBeNil)
+	return file
+}
+
+func TestVisitor(t *testing.T) {
+	Convey("Test Visitor", t, func() {
+		Convey("reading and writing a class keeps its code", func() {
+			for _, name := range []string{"HelloWorld", "MethodInvoke"} {
+				data, err := os.ReadFile("../java/classes/" + name + ".class")
+				So(err, ShouldBeNil)
+				original, err := parser.NewClassFileParser(parser.NewByteReader(data)).Parse()
+				So(err, ShouldBeNil)
+				expected, err := asm.Disassemble(original)
+				So(err, ShouldBeNil)
+				actual, err := asm.Disassemble(roundTrip(data))
+				So(err, ShouldBeNil)
+				So(actual, ShouldEqual, expected)
+			}
+		})
+
+		Convey("reading and writing a class keeps its annotations", func() {
+			original, err := parser.NewClassFileParser(parser.NewByteReader(annotatedClassBytes())).Parse()
+			So(err, ShouldBeNil)
+			written := roundTrip(annotatedClassBytes())
+			So(written.SuperClass, ShouldEqual, 0)
+			expected := original.Attributes.Get("RuntimeVisibleAnnotations").(*model.RuntimeVisibleAnnotationsAttributeInfo)
+			actual := written.Attributes.Get("RuntimeVisibleAnnotations").(*model.RuntimeVisibleAnnotationsAttributeInfo)
+			So(actual.Annotations, ShouldHaveLength, 1)
+			So(written.AnnotationString(&actual.Annotations[0]), ShouldEqual, original.AnnotationString(&expected.Annotations[0]))
+		})
+
+		Convey("reading and writing a class keeps its stack map frames", func() {
+			data, err := os.ReadFile("../java/classes/MethodInvoke.class")
+			So(err, ShouldBeNil)
+			original, err := parser.NewClassFileParser(parser.NewByteReader(data)).Parse()
+			So(err, ShouldBeNil)
+			written := roundTrip(data)
+			for _, method := range original.Methods {
+				name, descriptor := original.Utf8(method.NameIndex), original.Utf8(method.DescriptorIndex)
+				if _, table := stackMapTable(original, name, descriptor); table != nil {
+					So(framesOf(written, name, descriptor), ShouldResemble, framesOf(original, name, descriptor))
+				}
+			}
+
+			// The frames at Other and Done hold the uninitialized builder.
+			computed, err := computeFrames(verifier.New(rtda.NewApplicationClassLoader()), `.class public super gen/Uninitialized
+.super java/lang/Object
+.method public static f(I)Ljava/lang/Object;
+    new java/lang/StringBuilder
+    dup
+    iload_0
+    ifeq Other
+    iconst_1
+    goto Done
+Other:
+    iconst_2
+Done:
+    invokespecial java/lang/StringBuilder/<init>(I)V
+    areturn
+.end method
+`)
+			So(err, ShouldBeNil)
+			data, err = writer.Write(computed)
+			So(err, ShouldBeNil)
+			frames := framesOf(roundTrip(data), "f", "(I)Ljava/lang/Object;")
+			So(frames, ShouldResemble, framesOf(computed, "f", "(I)Ljava/lang/Object;"))
+			So(frames, ShouldHaveLength, 2)
+			So(frames[1].Stack[0], ShouldResemble, model.VerificationTypeInfo{Tag: constant.ItemUninitialized})
+		})
+
+		Convey("reading and writing a class keeps its other attributes", func() {
+			original, err := parser.NewClassFileParser(parser.NewByteReader(richClassBytes())).Parse()
+			So(err, ShouldBeNil)
+			reader, err := visitor.NewClassReader(richClassBytes())
+			So(err, ShouldBeNil)
+			w := visitor.NewClassWriter().CopyPool(reader)
+			So(reader.Accept(w), ShouldBeNil)
+			data, err := w.Bytes()
+			So(err, ShouldBeNil)
+			written, err := parser.NewClassFileParser(parser.NewByteReader(data)).Parse()
+			So(err, ShouldBeNil)
+
+			for _, name := range []string{"Record", "RuntimeVisibleTypeAnnotations"} {
+				So(written.Attributes.Get(name), ShouldResemble, original.Attributes.Get(name))
+			}
+			So(attributeInfo(written.Attributes, "Custom"), ShouldResemble, attributeInfo(original.Attributes, "Custom"))
+			So(attributeInfo(written.Attributes, "Custom"), ShouldNotBeEmpty)
+			method, err := written.GetMethod("m", "(Ljava/util/List;)Z")
+			So(err, ShouldBeNil)
+			originalMethod, err := original.GetMethod("m", "(Ljava/util/List;)Z")
+			So(err, ShouldBeNil)
+			for _, name := range []string{"MethodParameters", "RuntimeInvisibleParameterAnnotations"} {
+				So(method.Attributes.Get(name), ShouldNotBeNil)
+				So(method.Attributes.Get(name), ShouldResemble, originalMethod.Attributes.Get(name))
+			}
+			code, err := written.GetCodeAttribute(method)
+			So(err, ShouldBeNil)
+			originalCode, err := original.GetCodeAttribute(originalMethod)
+			So(err, ShouldBeNil)
+			for _, name := range []string{"LocalVariableTable", "LocalVariableTypeTable", "RuntimeVisibleTypeAnnotations"} {
+				So(code.Attributes.Get(name), ShouldNotBeNil)
+				So(code.Attributes.Get(name), ShouldResemble, originalCode.Attributes.Get(name))
+			}
+			So(attributeInfo(code.Attributes, "CustomCode"), ShouldResemble, attributeInfo(originalCode.Attributes, "CustomCode"))
+		})
+
+		Convey("reading and writing a module keeps its directives", func() {
+			class := builder.NewClass("module-info").Version(53, 0).Access(uint16(constant.CLASS_ACC_MODULE)).Super("")
+			pool := class.Pool()
+			class.Attribute("Module", &model.ModuleAttributeInfo{ModuleInfo: model.ModuleInfo{
+				ModuleNameIndex:    pool.Module("com.lib"),
+				ModuleVersionIndex: pool.Utf8("1.0"),
+				Requires:           []model.RequiresInfo{{RequiresIndex: pool.Module("java.base"), RequiresFlags: 0x8000}},
+				Exports:            []model.ExportsInfo{{ExportsIndex: pool.Package("com/lib/api")}},
+				Opens: []model.OpensInfo{{
+					OpensIndex:   pool.Package("com/lib/impl"),
+					OpensToIndex: []uint16{pool.Module("com.app")},
+				}},
+				Uses: []model.UsesInfo{{UsesIndex: pool.Class("com/lib/api/Service")}},
+				Provides: []model.ProvidesInfo{{
+					ProvidesIndex:     pool.Class("com/lib/api/Service"),
+					ProvidesWithIndex: []uint16{pool.Class("com/lib/impl/Impl")},
+				}},
+			}})
+			class.Attribute("ModulePackages", &model.ModulePackagesAttributeInfo{
+				PackageIndex: []uint16{pool.Package("com/lib/api"), pool.Package("com/lib/impl")},
+			})
+			class.Attribute("ModuleMainClass", &model.ModuleMainClassAttributeInfo{MainClassIndex: pool.Class("com/lib/impl/Main")})
+			data, err := class.Bytes()
+			So(err, ShouldBeNil)
+			original, err := parser.NewClassFileParser(parser.NewByteReader(data)).Parse()
+			So(err, ShouldBeNil)
+			expected, err := original.ModuleDescriptor()
+			So(err, ShouldBeNil)
+			actual, err := roundTrip(data).ModuleDescriptor()
+			So(err, ShouldBeNil)
+			So(actual, ShouldResemble, expected)
+			So(actual.Version, ShouldEqual, "1.0")
+		})
+
+		Convey("a chain of visitors transforms a class", func() {
+			data := mustAssemble(`.class public super gen/Count
+.super java/lang/Object
+.field public static calls I
+.field public static dropped J
+.method public static f(I)I
+    iload_0
+    ifge Positive
+    iconst_0
+    ireturn
+Positive:
+    iload_0
+    ireturn
+.end method
+`)
+			reader, err := visitor.NewClassReader(data)
+			So(err, ShouldBeNil)
+			w := visitor.NewClassWriter().ComputeFrames(verifier.New(rtda.NewApplicationClassLoader()))
+			So(reader.Accept(&renamer{ClassVisitor: w}), ShouldBeNil)
+			data, err = w.Bytes()
+			So(err, ShouldBeNil)
+			file, err := parser.NewClassFileParser(parser.NewByteReader(data)).Parse()
+			So(err, ShouldBeNil)
+
+			So(file.Fields, ShouldHaveLength, 1)
+			f, err := file.GetMethod("f", "(I)I")
+			So(err, ShouldBeNil)
+			So(f, ShouldBeNil)
+			code, table := stackMapTable(file, "g", "(I)I")
+			So(code.Code[0], ShouldEqual, byte(interpreter.GETSTATIC))
+			So(code.MaxStack, ShouldEqual, 2)
+			So(table.Frames, ShouldHaveLength, 1)
+			So(table.Frames[0].Offset, ShouldEqual, 14)
+			So(verifier.New(rtda.NewApplicationClassLoader()).Verify(file), ShouldBeNil)
+		})
+
+		Convey("a malformed method ends the events before it", func() {
+			data := mustAssemble(`.class public super gen/Broken
+.super java/lang/Object
+.field public static x I
+.method public static ok()V
+    return
+.end method
+.method public static broken()V
+    nop
+    return
+.end method
+`)
+			_, err := visitor.NewClassReader(append(data, 0))
+			So(err.Error(), ShouldContainSubstring, "1 extra bytes at the end of class file")
+
+			// Give broken a code length of 0.
+			at := bytes.Index(data, []byte{0, 0, 0, 2, byte(interpreter.NOP), byte(interpreter.RETURN)})
+			So(at, ShouldBeGreaterThan, 0)
+			data[at+3] = 0
+			reader, err := visitor.NewClassReader(data)
+			So(err, ShouldBeNil)
+			log := &eventLog{ClassVisitor: visitor.NewClassWriter()}
+			err = reader.Accept(log)
+			So(err.Error(), ShouldContainSubstring, "invalid code length 0")
+			So(log.events, ShouldResemble, []string{"field x", "method ok"})
+		})
+
+		Convey("writer errors are reported by Bytes", func() {
+			data := mustAssemble(`.class public super gen/Bad
+.super java/lang/Object
+.method public static f()V
+    return
+.end method
+`)
+			reader, err := visitor.NewClassReader(data)
+			So(err, ShouldBeNil)
+			w := visitor.NewClassWriter()
+			So(reader.Accept(&badLdc{ClassVisitor: w}), ShouldBeNil)
+			_, err = w.Bytes()
+			So(err.Error(), ShouldContainSubstring, "cannot load constant of type bool")
+		})
+	})
+}
+
+// framesOf returns the stack map frames of a method without the constant
+// pool indexes of their classes.
+func framesOf(file *model.ClassFile, name, descriptor string) []model.StackMapFrameState {
+	_, table := stackMapTable(file, name, descriptor)
+	So(table, ShouldNotBeNil)
+	frames := make([]model.StackMapFrameState, len(table.Frames))
+	for i, frame := range table.Frames {
+		frames[i] = model.StackMapFrameState{Offset: frame.Offset}
+		for _, t := range frame.Locals {
+			t.CpoolIndex = 0
+			frames[i].Locals = append(frames[i].Locals, t)
+		}
+		for _, t := range frame.Stack {
+			t.CpoolIndex = 0
+			frames[i].Stack = append(frames[i].Stack, t)
+		}
+	}
+	return frames
+}
+
+func attributeInfo(attributes model.Attributes, name string) []byte {
+	for _, attribute := range attributes {
+		if attribute.Name == name {
+			return attribute.Info
+		}
+	}
+	return nil
+}
+
+// richClassBytes builds gen/Rich with a record component, type annotations,
+// method parameters, parameter annotations, a local variable signature and
+// attributes outro does not know, whose content refers to the constant
+// pool.
+func richClassBytes() []byte {
+	class := builder.NewClass("gen/Rich").Super("java/lang/Record")
+	pool := class.Pool()
+	payload := binary.BigEndian.AppendUint16(nil, pool.Utf8("payload"))
+	annotation := model.AnnotationInfo{TypeIndex: pool.Utf8("Lgen/NotNull;")}
+	class.Attribute("Record", &model.RecordAttributeInfo{Components: []model.RecordComponentInfo{{
+		ComponentNameIndex:       pool.Utf8("items"),
+		ComponentDescriptorIndex: pool.Utf8("Ljava/util/List;"),
+		Attributes: model.Attributes{
+			class.NewAttribute("Signature", &model.SignatureAttributeInfo{SignatureIndex: pool.Utf8("Ljava/util/List<Ljava/lang/String;>;")}),
+			class.NewAttribute("Custom", payload),
+			class.NewAttribute("RuntimeVisibleAnnotations", &model.RuntimeVisibleAnnotationsAttributeInfo{
+				Annotations: []model.AnnotationInfo{annotation},
+			}),
+		},
+	}}})
+	class.Attribute("RuntimeVisibleTypeAnnotations", &model.RuntimeVisibleTypeAnnotationsAttributeInfo{
+		Annotations: []model.TypeAnnotationInfo{{
+			TargetType: constant.TargetClassExtends,
+			TargetInfo: model.TargetInfo{SupertypeIndex: 0xFFFF},
+			TypeIndex:  pool.Utf8("Lgen/Tagged;"),
+		}},
+	})
+	class.Attribute("Custom", payload)
+
+	m := class.Method(uint16(constant.METHOD_ACC_PUBLIC|constant.METHOD_ACC_STATIC), "m", "(Ljava/util/List;)Z")
+	m.Attribute("MethodParameters", &model.MethodParametersAttributeInfo{
+		Parameters: []model.ParameterInfo{{NameIndex: pool.Utf8("items"), AccessFlags: uint16(constant.METHOD_ACC_FINAL)}},
+	})
+	m.Attribute("RuntimeInvisibleParameterAnnotations", &model.RuntimeInvisibleParameterAnnotationsAttributeInfo{
+		ParameterAnnotations: []model.ParameterAnnotationInfo{{Annotations: []model.AnnotationInfo{annotation}}},
+	})
+	start, test, end := m.NewLabel(), m.NewLabel(), m.NewLabel()
+	m.Mark(start).VarInsn(interpreter.ALOAD, 0)
+	m.Mark(test).TypeInsn(interpreter.INSTANCEOF, "java/util/ArrayList")
+	m.Insn(interpreter.IRETURN).Mark(end)
+	m.LocalVariable(0, "items", "Ljava/util/List;", start, end)
+	m.LocalVariableType(0, "items", "Ljava/util/List<Ljava/lang/String;>;", start, end)
+	m.CodeAttribute("RuntimeVisibleTypeAnnotations", func() interface{} {
+		return &model.RuntimeVisibleTypeAnnotationsAttributeInfo{Annotations: []model.TypeAnnotationInfo{
+			{
+				TargetType: constant.TargetInstanceof,
+				TargetInfo: model.TargetInfo{Offset: uint16(test.Offset())},
+				TypeIndex:  pool.Utf8("Lgen/Tagged;"),
+			},
+			{
+				TargetType: constant.TargetLocalVariable,
+				TargetInfo: model.TargetInfo{Table: []model.LocalVarTargetInfo{{
+					StartPC: uint16(start.Offset()),
+					Length:  uint16(end.Offset() - start.Offset()),
+				}}},
+				TargetPath: []model.TypePathEntry{{TypePathKind: 3}},
+				TypeIndex:  pool.Utf8("Lgen/NotNull;"),
+			},
+		}}
+	})
+	m.CodeAttribute("CustomCode", func() interface{} { return payload })
+	data, err := class.Bytes()
+	So(err, ShouldBeNil)
+	return data
+}
+
+// eventLog records the members visited and the end of the class.
+type eventLog struct {
+	visitor.ClassVisitor
+	events []string
+}
+
+func (l *eventLog) VisitField(access uint16, name, descriptor, signature string, value interface{}) visitor.FieldVisitor {
+	l.events = append(l.events, "field "+name)
+	return l.ClassVisitor.VisitField(access, name, descriptor, signature, value)
+}
+
+func (l *eventLog) VisitMethod(access uint16, name, descriptor, signature string, exceptions []string) visitor.MethodVisitor {
+	l.events = append(l.events, "method "+name)
+	return l.ClassVisitor.VisitMethod(access, name, descriptor, signature, exceptions)
+}
+
+func (l *eventLog) VisitEnd() {
+	l.events = append(l.events, "end")
+	l.ClassVisitor.VisitEnd()
+}
+
+// badLdc loads a constant no class file can hold.
+type badLdc struct {
+	visitor.ClassVisitor
+}
+
+func (b *badLdc) VisitMethod(access uint16, name, descriptor, signature string, exceptions []string) visitor.MethodVisitor {
+	mv := b.ClassVisitor.VisitMethod(access, name, descriptor, signature, exceptions)
+	mv.VisitLdcInsn(true)
+	mv.VisitInsn(interpreter.POP)
+	return mv
+}
@@ -0,0 +1,103 @@
+package test
+
+import (
+	"os"
+	"outro/constant"
+	"outro/model"
+	"outro/parser"
+	"outro/writer"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestClassFileWriter(t *testing.T) {
+	Convey("Test class file writer", t, func() {
+		Convey("round-trips class files byte for byte", func() {
+			inputs := map[string][]byte{
+				"module-info":      moduleInfoBytes(61, uint16(constant.CLASS_ACC_MODULE)),
+				"described module": describedModuleBytes(),
+				"annotations":      annotatedClassBytes(),
+				"type annotations": typeAnnotatedClassBytes([]byte{0, 1,
+					constant.TargetLocalVariable, 0, 1, 0, 0, 0, 5, 0, 1, 0, 0, 4, 0, 0}),
+			}
+			for _, path := range []string{"../java/classes/HelloWorld.class", "../java/classes/MethodInvoke.class"} {
+				data, err := os.ReadFile(path)
+				So(err, ShouldBeNil)
+				inputs[path] = data
+			}
+			for _, data := range inputs {
+				class, err := parser.NewClassFileParser(parser.NewByteReader(data)).Parse()
+				So(err, ShouldBeNil)
+				written, err := writer.Write(class)
+				So(err, ShouldBeNil)
+				So(written, ShouldResemble, data)
+			}
+		})
+
+		Convey("writes edits to the model", func() {
+			class := parseClassFile("../java/classes/HelloWorld.class")
+			class.ConstantPool = append(class.ConstantPool, model.ConstantInfo{Tag: constant.ConstantUtf8, Utf8: "Custom\u00e9"})
+			class.Attributes = append(class.Attributes, model.AttributeInfo{
+				AttributeNameIndex: uint16(len(class.ConstantPool) - 1),
+				Info:               []byte{1, 2, 3},
+			})
+			sourceFile := class.Attributes.Get("SourceFile").(*model.SourceFileAttributeInfo)
+			class.ConstantPool[sourceFile.SourceFileIndex].Utf8 = "Renamed.java"
+
+			written, err := writer.Write(class)
+			So(err, ShouldBeNil)
+			reparsed, err := parser.NewClassFileParser(parser.NewByteReader(written)).Parse()
+			So(err, ShouldBeNil)
+			So(reparsed.ConstantPoolCount, ShouldEqual, len(class.ConstantPool))
+			So(reparsed.Utf8(reparsed.Attributes.Get("SourceFile").(*model.SourceFileAttributeInfo).SourceFileIndex), ShouldEqual, "Renamed.java")
+			custom := reparsed.Attributes[len(reparsed.Attributes)-1]
+			So(custom.Name, ShouldEqual, "Custom\u00e9")
+			So(custom.Value, ShouldBeNil)
+			So(custom.Info, ShouldResemble, []byte{1, 2, 3})
+		})
+
+		Convey("writes same frames in the form their offset delta needs", func() {
+			class := parseClassFile("../java/classes/MethodInvoke.class")
+			var edited []*model.StackMapFrame
+			for i := range class.Methods {
+				code := class.Methods[i].Attributes.Get("Code").(*model.CodeAttributeInfo)
+				if table, ok := code.Attributes.Get("StackMapTable").(*model.StackMapTableAttributeInfo); ok {
+					for j := range table.Entries {
+						if frame := &table.Entries[j]; frame.FrameType < 128 {
+							frame.OffsetDelta += 64
+							edited = append(edited, frame)
+						}
+					}
+				}
+			}
+			So(edited, ShouldNotBeEmpty)
+			written, err := writer.Write(class)
+			So(err, ShouldBeNil)
+			reparsed, err := parser.NewClassFileParser(parser.NewByteReader(written)).Parse()
+			So(err, ShouldBeNil)
+			var frames []model.StackMapFrame
+			for i := range reparsed.Methods {
+				code := reparsed.Methods[i].Attributes.Get("Code").(*model.CodeAttributeInfo)
+				if table, ok := code.Attributes.Get("StackMapTable").(*model.StackMapTableAttributeInfo); ok {
+					for _, frame := range table.Entries {
+						if frame.FrameType == constant.SameFrameExtended || frame.FrameType == constant.SameLocals1StackItemFrameExtended {
+							frames = append(frames, frame)
+						}
+					}
+				}
+			}
+			So(frames, ShouldHaveLength, len(edited))
+			for i, frame := range frames {
+				So(frame.OffsetDelta, ShouldEqual, edited[i].OffsetDelta)
+			}
+		})
+
+		Convey("rejects values it cannot encode", func() {
+			class := parseClassFile("../java/classes/HelloWorld.class")
+			class.Attributes[0].Value = "not an attribute"
+			_, err := writer.Write(class)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,113 @@
+package tool
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"outro/asm"
+	"outro/model"
+	"outro/rtda"
+	"outro/verifier"
+	"outro/writer"
+	"path/filepath"
+	"strings"
+)
+
+// Asm implements "outro asm [-d dir] [-cp path] <file.j>", writing the
+// assembled class to dir/<class name>.class. Classes of version 50 and
+// later get their StackMapTable, max_stack and max_locals computed, loading
+// the classes whose types frames merge from path, by default dir.
+func Asm(args []string, out io.Writer) error {
+	dir, classPath := ".", ""
+	for len(args) > 2 && (args[0] == "-d" || args[0] == "-cp") {
+		if args[0] == "-d" {
+			dir = args[1]
+		} else {
+			classPath = args[1]
+		}
+		args = args[2:]
+	}
+	if len(args) != 1 {
+		return errors.New("usage: outro asm [-d <directory>] [-cp <class path>] <file.j>")
+	}
+	if classPath == "" {
+		classPath = dir
+	}
+	source, err := os.ReadFile(args[0])
+	if err != nil {
+		return err
+	}
+	data, err := asm.Assemble(string(source))
+	if err != nil {
+		return fmt.Errorf("%s: %w", args[0], err)
+	}
+	classFile, err := parseClassBytes(data)
+	if err != nil {
+		return err
+	}
+	className := classFile.ClassName(classFile.ThisClass)
+	if !isOutputName(className) {
+		return fmt.Errorf("%s: class name %q is not a relative path under %s", args[0], className, dir)
+	}
+	path := filepath.Join(dir, filepath.FromSlash(className)+".class")
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	if classFile.MajorVersion >= 50 {
+		if data, err = computeFrames(classFile, classPath); err != nil {
+			return fmt.Errorf("%s: %w", args[0], err)
+		}
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(out, path)
+	return err
+}
+
+// isOutputName reports whether className names a file under the output
+// directory: its segments are non-empty and neither "." nor "..", and it
+// holds no separators other than '/'.
+func isOutputName(className string) bool {
+	if strings.ContainsAny(className, "\\:\x00") {
+		return false
+	}
+	for _, segment := range strings.Split(className, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+// computeFrames computes the frames of every method of classFile and
+// encodes it again.
+func computeFrames(classFile *model.ClassFile, classPath string) ([]byte, error) {
+	entries, err := rtda.ParseClassPath(classPath)
+	if err != nil {
+		return nil, err
+	}
+	loader := rtda.NewModularClassLoader(entries, rtda.NewModuleGraph())
+	if err := verifier.New(loader).ComputeAllFrames(classFile); err != nil {
+		return nil, err
+	}
+	return writer.Write(classFile)
+}
+
+// Disasm implements "outro disasm <file.class>".
+func Disasm(args []string, out io.Writer) error {
+	if len(args) != 1 {
+		return errors.New("usage: outro disasm <file.class>")
+	}
+	classFile, err := parseClassFile(args[0])
+	if err != nil {
+		return err
+	}
+	text, err := asm.Disassemble(classFile)
+	if err != nil {
+		return fmt.Errorf("%s: %w", args[0], err)
+	}
+	_, err = io.WriteString(out, text)
+	return err
+}
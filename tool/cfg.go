@@ -0,0 +1,50 @@
+package tool
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"outro/analysis"
+	"outro/rtda"
+	"strings"
+)
+
+// Cfg implements "outro cfg <file.class> <method>", writing the
+// control-flow graph of the method as Graphviz DOT. The method is a name,
+// or a name followed by its descriptor when it is overloaded.
+func Cfg(args []string, out io.Writer) error {
+	if len(args) != 2 {
+		return errors.New("usage: outro cfg <file.class> <method>[<descriptor>]")
+	}
+	classFile, err := parseClassFile(args[0])
+	if err != nil {
+		return err
+	}
+	class := rtda.NewClass(classFile)
+	name, descriptor := args[1], ""
+	if i := strings.IndexByte(name, '('); i >= 0 {
+		name, descriptor = name[:i], name[i:]
+	}
+	var found []*rtda.Method
+	for _, method := range class.Methods {
+		if method.Name == name && (descriptor == "" || method.Descriptor == descriptor) {
+			found = append(found, method)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return fmt.Errorf("java.lang.NoSuchMethodError: %s.%s%s", class.Name, name, descriptor)
+	case 1:
+	default:
+		var candidates []string
+		for _, method := range found {
+			candidates = append(candidates, method.Name+method.Descriptor)
+		}
+		return fmt.Errorf("method %s is overloaded, add a descriptor: %s", name, strings.Join(candidates, ", "))
+	}
+	graph, err := analysis.Build(found[0])
+	if err != nil {
+		return fmt.Errorf("%s.%s%s: %w", class.Name, found[0].Name, found[0].Descriptor, err)
+	}
+	return graph.WriteDOT(out)
+}
@@ -0,0 +1,57 @@
+package tool
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"outro/javap"
+)
+
+// Javap implements "outro javap [-c] [-v] [-p] [-l] [-s] <file.class>...",
+// printing each class in the format of the JDK's javap.
+func Javap(args []string, out io.Writer) error {
+	var options javap.Options
+	var paths []string
+	for _, arg := range args {
+		switch arg {
+		case "-c":
+			options.Code = true
+		case "-v", "-verbose":
+			options.Verbose = true
+		case "-p", "-private":
+			options.Private = true
+		case "-l":
+			options.Lines = true
+		case "-s":
+			options.Signatures = true
+		default:
+			if len(arg) > 1 && arg[0] == '-' {
+				return fmt.Errorf("javap: unknown option %s", arg)
+			}
+			paths = append(paths, arg)
+		}
+	}
+	if len(paths) == 0 {
+		return errors.New("usage: outro javap [-c] [-v] [-p] [-l] [-s] <file.class>...")
+	}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		classFile, err := parseClassBytes(data)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		file := &javap.File{Path: path, Modified: info.ModTime(), Data: data}
+		if err := javap.Write(out, classFile, file, options); err != nil {
+			return err
+		}
+	}
+	return nil
+}
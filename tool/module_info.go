@@ -0,0 +1,187 @@
+package tool
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"outro/constant"
+	"outro/model"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const moduleInfoClass = "module-info.class"
+
+// ModuleInfo implements "outro module-info <file>". The file may be a
+// module-info.class, a directory containing one, or a modular jar.
+func ModuleInfo(args []string, out io.Writer) error {
+	if len(args) != 1 {
+		return errors.New("usage: outro module-info <module-info.class | directory | jar>")
+	}
+	classFile, location, err := readModuleInfo(args[0])
+	if err != nil {
+		return err
+	}
+	descriptor, err := classFile.ModuleDescriptor()
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(out, DescribeModule(descriptor, location))
+	return err
+}
+
+func readModuleInfo(path string) (*model.ClassFile, string, error) {
+	absolute, err := filepath.Abs(path)
+	if err != nil {
+		return nil, "", err
+	}
+	location := "file://" + filepath.ToSlash(absolute)
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, "", err
+	}
+	if info.IsDir() {
+		classFile, err := parseClassFile(filepath.Join(path, moduleInfoClass))
+		return classFile, location + "/", err
+	}
+	if !strings.HasSuffix(path, ".jar") {
+		classFile, err := parseClassFile(path)
+		return classFile, location, err
+	}
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, "", err
+	}
+	defer archive.Close()
+	entry, err := archive.Open(moduleInfoClass)
+	if err != nil {
+		return nil, "", fmt.Errorf("%s: no module descriptor found", path)
+	}
+	defer entry.Close()
+	data, err := io.ReadAll(entry)
+	if err != nil {
+		return nil, "", err
+	}
+	classFile, err := parseClassBytes(data)
+	return classFile, "jar:" + location + "!/" + moduleInfoClass, err
+}
+
+// DescribeModule renders a module descriptor in the format of
+// jar --describe-module.
+func DescribeModule(descriptor *model.ModuleDescriptor, location string) string {
+	var sb strings.Builder
+	sb.WriteString(descriptor.Name)
+	if descriptor.Version != "" {
+		sb.WriteString("@" + descriptor.Version)
+	}
+	if location != "" {
+		sb.WriteString(" " + location)
+	}
+	if descriptor.IsOpen() {
+		sb.WriteString(" open")
+	}
+	sb.WriteString("\n")
+
+	exports := sortedExports(descriptor.Exports)
+	for _, e := range exports {
+		if len(e.To) == 0 {
+			fmt.Fprintf(&sb, "exports %s%s\n", e.Package, exportsModifiers(e.Flags))
+		}
+	}
+	requires := append([]model.ModuleRequires(nil), descriptor.Requires...)
+	sort.SliceStable(requires, func(i, j int) bool { return requires[i].Name < requires[j].Name })
+	for _, r := range requires {
+		fmt.Fprintf(&sb, "requires %s%s\n", r.Name, requiresModifiers(r.Flags))
+	}
+	for _, service := range sortedStrings(descriptor.Uses) {
+		fmt.Fprintf(&sb, "uses %s\n", service)
+	}
+	provides := append([]model.ModuleProvides(nil), descriptor.Provides...)
+	sort.SliceStable(provides, func(i, j int) bool { return provides[i].Service < provides[j].Service })
+	for _, p := range provides {
+		fmt.Fprintf(&sb, "provides %s with %s\n", p.Service, strings.Join(p.With, " "))
+	}
+	for _, e := range exports {
+		if len(e.To) > 0 {
+			fmt.Fprintf(&sb, "qualified exports %s to %s\n", e.Package, strings.Join(sortedStrings(e.To), " "))
+		}
+	}
+	opens := sortedExports(descriptor.Opens)
+	for _, o := range opens {
+		if len(o.To) == 0 {
+			fmt.Fprintf(&sb, "opens %s%s\n", o.Package, exportsModifiers(o.Flags))
+		}
+	}
+	for _, o := range opens {
+		if len(o.To) > 0 {
+			fmt.Fprintf(&sb, "qualified opens %s to %s\n", o.Package, strings.Join(sortedStrings(o.To), " "))
+		}
+	}
+
+	concealed := map[string]bool{}
+	for _, pkg := range descriptor.Packages {
+		concealed[pkg] = true
+	}
+	for _, e := range descriptor.Exports {
+		delete(concealed, e.Package)
+	}
+	for _, o := range descriptor.Opens {
+		delete(concealed, o.Package)
+	}
+	var contains []string
+	for pkg := range concealed {
+		contains = append(contains, pkg)
+	}
+	for _, pkg := range sortedStrings(contains) {
+		fmt.Fprintf(&sb, "contains %s\n", pkg)
+	}
+	if descriptor.MainClass != "" {
+		fmt.Fprintf(&sb, "main-class %s\n", descriptor.MainClass)
+	}
+	return sb.String()
+}
+
+func sortedExports(exports []model.ModuleExports) []model.ModuleExports {
+	sorted := append([]model.ModuleExports(nil), exports...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Package < sorted[j].Package })
+	return sorted
+}
+
+func sortedStrings(s []string) []string {
+	sorted := append([]string(nil), s...)
+	sort.Strings(sorted)
+	return sorted
+}
+
+func requiresModifiers(flags uint16) string {
+	return modifiers(flags, map[constant.AccessFlag]string{
+		constant.REQUIRES_ACC_TRANSITIVE:   "transitive",
+		constant.REQUIRES_ACC_STATIC_PHASE: "static",
+		constant.REQUIRES_ACC_SYNTHETIC:    "synthetic",
+		constant.REQUIRES_ACC_MANDATED:     "mandated",
+	})
+}
+
+func exportsModifiers(flags uint16) string {
+	return modifiers(flags, map[constant.AccessFlag]string{
+		constant.EXPORTS_OPENS_ACC_SYNTHETIC: "synthetic",
+		constant.EXPORTS_OPENS_ACC_MANDATED:  "mandated",
+	})
+}
+
+// modifiers renders the set flags as " a b", sorted by name as the JDK does.
+func modifiers(flags uint16, names map[constant.AccessFlag]string) string {
+	var set []string
+	for flag, name := range names {
+		if flags&uint16(flag) != 0 {
+			set = append(set, name)
+		}
+	}
+	if len(set) == 0 {
+		return ""
+	}
+	return " " + strings.Join(sortedStrings(set), " ")
+}
@@ -0,0 +1,35 @@
+// Package tool implements the outro subcommands that inspect and transform
+// class files instead of running them.
+package tool
+
+import (
+	"io"
+	"os"
+	"outro/model"
+	"outro/parser"
+)
+
+// Command runs a subcommand with its arguments, writing its report to out.
+type Command func(args []string, out io.Writer) error
+
+// Commands maps subcommand names, as given after "outro", to their
+// implementations.
+var Commands = map[string]Command{
+	"asm":         Asm,
+	"cfg":         Cfg,
+	"disasm":      Disasm,
+	"javap":       Javap,
+	"module-info": ModuleInfo,
+}
+
+func parseClassFile(path string) (*model.ClassFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseClassBytes(data)
+}
+
+func parseClassBytes(data []byte) (*model.ClassFile, error) {
+	return parser.NewClassFileParser(parser.NewByteReader(data)).Parse()
+}
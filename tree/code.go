@@ -0,0 +1,451 @@
+package tree
+
+import (
+	"fmt"
+	"outro/builder"
+	"outro/constant"
+	"outro/interpreter"
+	"outro/model"
+)
+
+// Insn is an instruction. Its operands are those of
+// interpreter.Instruction, with labels in place of branch offsets. Loads
+// and stores are in their general form, such as ILOAD with Local 1 for
+// ILOAD_1, and LDC stands for LDC_W too: Write picks the encoding.
+type Insn struct {
+	link
+	Opcode interpreter.Instruct
+	// Local is the local variable of loads, stores, iinc and ret.
+	Local int
+	// Index is the constant pool index of ldc, field, method, type and
+	// invokedynamic instructions.
+	Index int
+	// Const is the immediate value of bipush, sipush and iinc.
+	Const int32
+	// Target is the branch target, or the default target of a switch.
+	Target *Label
+	// Count is the argument count of invokeinterface or the dimensions of
+	// multianewarray.
+	Count     int
+	ArrayType uint8
+	// Keys and Targets are the cases of tableswitch and lookupswitch.
+	Keys    []int32
+	Targets []*Label
+
+	offset int
+	// long marks a branch promoted to goto_w or jsr_w, or a conditional
+	// branch inverted around a goto_w.
+	long bool
+}
+
+// Label is a position in the code, before the instruction that follows it
+// in the list.
+type Label struct {
+	link
+	offset int
+}
+
+func NewLabel() *Label {
+	return &Label{}
+}
+
+// TryCatchBlock is an exception handler for the code from Start up to End.
+// CatchType is a class constant pool index, or 0 to catch everything.
+type TryCatchBlock struct {
+	Start, End, Handler *Label
+	CatchType           uint16
+}
+
+type LineNumber struct {
+	Line  int
+	Start *Label
+}
+
+// LocalVariable is an entry of the LocalVariableTable or, in
+// Code.LocalVariableTypes, of the LocalVariableTypeTable, whose
+// DescriptorIndex is that of the signature.
+type LocalVariable struct {
+	Index                      int
+	NameIndex, DescriptorIndex uint16
+	Start, End                 *Label
+}
+
+// TypeAnnotation is a type annotation on the code. The offsets of its
+// target are held by labels: Ranges for local variable targets and At for
+// offset and type argument targets. The ExceptionTableIndex of a catch
+// target is an index into Code.TryCatchBlocks.
+type TypeAnnotation struct {
+	model.TypeAnnotationInfo
+	Ranges []LocalVariableRange
+	At     *Label
+}
+
+// LocalVariableRange is where a local variable annotated by a type
+// annotation is live.
+type LocalVariableRange struct {
+	Start, End *Label
+	Index      int
+}
+
+// Code is the editable code of a method.
+type Code struct {
+	Instructions       InsnList
+	TryCatchBlocks     []TryCatchBlock
+	LineNumbers        []LineNumber
+	LocalVariables     []LocalVariable
+	LocalVariableTypes []LocalVariable
+	// VisibleTypeAnnotations and InvisibleTypeAnnotations are the
+	// RuntimeVisibleTypeAnnotations and RuntimeInvisibleTypeAnnotations of
+	// the code.
+	VisibleTypeAnnotations   []TypeAnnotation
+	InvisibleTypeAnnotations []TypeAnnotation
+	// MaxStack and MaxLocals are written as they are; ComputeFrames of the
+	// verifier recomputes them.
+	MaxStack, MaxLocals int
+	// Attributes are the other attributes of the code.
+	Attributes model.Attributes
+	// Pool is the constant pool of the class, for the operands of new
+	// instructions. Write stores it back in the class file.
+	Pool *builder.ConstantPool
+}
+
+// offsetAttributes name the code attributes that hold offsets the tree
+// does not keep up to date, which are dropped.
+var offsetAttributes = map[string]bool{
+	"StackMapTable": true,
+}
+
+// Read decodes the code of method into a tree.
+func Read(file *model.ClassFile, method *model.MethodInfo) (*Code, error) {
+	attribute, ok := method.Attributes.Get("Code").(*model.CodeAttributeInfo)
+	if !ok {
+		return nil, fmt.Errorf("method %s%s has no code", file.Utf8(method.NameIndex), file.Utf8(method.DescriptorIndex))
+	}
+	instructions, err := interpreter.Decode(attribute.Code)
+	if err != nil {
+		return nil, err
+	}
+	starts := map[int]bool{len(attribute.Code): true}
+	for _, in := range instructions {
+		starts[in.Offset] = true
+	}
+	labels := map[int]*Label{}
+	var labelErr error
+	label := func(offset int) *Label {
+		if !starts[offset] && labelErr == nil {
+			labelErr = fmt.Errorf("offset %d is not the start of an instruction", offset)
+		}
+		if labels[offset] == nil {
+			labels[offset] = NewLabel()
+		}
+		return labels[offset]
+	}
+
+	c := &Code{
+		MaxStack:  int(attribute.MaxStack),
+		MaxLocals: int(attribute.MaxLocals),
+		Pool:      builder.ExtendConstantPool(file.ConstantPool),
+	}
+	for _, handler := range attribute.ExceptionTable {
+		c.TryCatchBlocks = append(c.TryCatchBlocks, TryCatchBlock{
+			Start:     label(int(handler.StartPC)),
+			End:       label(int(handler.EndPC)),
+			Handler:   label(int(handler.HandlerPC)),
+			CatchType: handler.CatchType,
+		})
+	}
+	for _, a := range attribute.Attributes {
+		switch table := a.Value.(type) {
+		case *model.LineNumberTableAttributeInfo:
+			for _, line := range table.LineNumberTable {
+				c.LineNumbers = append(c.LineNumbers, LineNumber{Line: int(line.LineNumber), Start: label(int(line.StartPC))})
+			}
+		case *model.LocalVariableTableAttributeInfo:
+			for _, local := range table.LocalVariableTable {
+				c.LocalVariables = append(c.LocalVariables, LocalVariable{
+					Index:           int(local.Index),
+					NameIndex:       local.NameIndex,
+					DescriptorIndex: local.DescriptorIndex,
+					Start:           label(int(local.StartPC)),
+					End:             label(int(local.StartPC) + int(local.Length)),
+				})
+			}
+		case *model.LocalVariableTypeTableAttributeInfo:
+			for _, local := range table.LocalVariableTable {
+				c.LocalVariableTypes = append(c.LocalVariableTypes, LocalVariable{
+					Index:           int(local.Index),
+					NameIndex:       local.NameIndex,
+					DescriptorIndex: local.SignatureIndex,
+					Start:           label(int(local.StartPc)),
+					End:             label(int(local.StartPc) + int(local.Length)),
+				})
+			}
+		case *model.RuntimeVisibleTypeAnnotationsAttributeInfo:
+			c.VisibleTypeAnnotations = readTypeAnnotations(table.Annotations, label)
+		case *model.RuntimeInvisibleTypeAnnotationsAttributeInfo:
+			c.InvisibleTypeAnnotations = readTypeAnnotations(table.Annotations, label)
+		default:
+			if !offsetAttributes[a.Name] {
+				c.Attributes = append(c.Attributes, a)
+			}
+		}
+	}
+
+	insns := make([]*Insn, len(instructions))
+	for i := range instructions {
+		in := &instructions[i]
+		insn := &Insn{
+			Opcode:    in.Opcode,
+			Local:     in.Local,
+			Index:     in.Index,
+			Const:     in.Const,
+			Count:     in.Count,
+			ArrayType: in.ArrayType,
+			Keys:      in.Keys,
+		}
+		switch op := in.Opcode; {
+		case op >= interpreter.ILOAD_0 && op <= interpreter.ALOAD_3:
+			insn.Opcode = interpreter.ILOAD + (op-interpreter.ILOAD_0)/4
+		case op >= interpreter.ISTORE_0 && op <= interpreter.ASTORE_3:
+			insn.Opcode = interpreter.ISTORE + (op-interpreter.ISTORE_0)/4
+		case op == interpreter.LDC_W:
+			insn.Opcode = interpreter.LDC
+		case isJump(op), op == interpreter.TABLESWITCH || op == interpreter.LOOKUPSWITCH:
+			insn.Target = label(in.Target)
+			for _, target := range in.Targets {
+				insn.Targets = append(insn.Targets, label(target))
+			}
+		}
+		insns[i] = insn
+	}
+	if labelErr != nil {
+		return nil, labelErr
+	}
+	for i, insn := range insns {
+		if l := labels[instructions[i].Offset]; l != nil {
+			c.Instructions.Add(l)
+		}
+		c.Instructions.Add(insn)
+	}
+	if l := labels[len(attribute.Code)]; l != nil {
+		c.Instructions.Add(l)
+	}
+	return c, nil
+}
+
+// readTypeAnnotations labels the offsets of the targets of annotations.
+func readTypeAnnotations(annotations []model.TypeAnnotationInfo, label func(int) *Label) []TypeAnnotation {
+	read := make([]TypeAnnotation, len(annotations))
+	for i, a := range annotations {
+		read[i].TypeAnnotationInfo = a
+		read[i].TargetInfo.Table = nil
+		for _, local := range a.TargetInfo.Table {
+			read[i].Ranges = append(read[i].Ranges, LocalVariableRange{
+				Start: label(int(local.StartPC)),
+				End:   label(int(local.StartPC) + int(local.Length)),
+				Index: int(local.Index),
+			})
+		}
+		if a.TargetType >= constant.TargetInstanceof {
+			read[i].At = label(int(a.TargetInfo.Offset))
+		}
+	}
+	return read
+}
+
+func isJump(op interpreter.Instruct) bool {
+	return op >= interpreter.IFEQ && op <= interpreter.JSR ||
+		op == interpreter.IFNULL || op == interpreter.IFNONNULL ||
+		op == interpreter.GOTO_W || op == interpreter.JSR_W
+}
+
+// Write lays out the code and makes it the Code attribute of method,
+// storing the constant pool in file.
+func (c *Code) Write(file *model.ClassFile, method *model.MethodInfo) error {
+	length, err := c.layout()
+	if err != nil {
+		return err
+	}
+	code := make([]byte, 0, length)
+	for node := c.Instructions.First(); node != nil; node = node.Next() {
+		if insn, ok := node.(*Insn); ok {
+			if code, err = insn.encode(code); err != nil {
+				return err
+			}
+		}
+	}
+
+	offset := func(l *Label) (uint16, error) {
+		if l == nil || !c.Instructions.Contains(l) {
+			return 0, fmt.Errorf("label is not in the code")
+		}
+		return uint16(l.offset), nil
+	}
+	handlers := make([]model.ExceptionTable, 0, len(c.TryCatchBlocks))
+	// handlerIndex maps the index of a block to that of its handler, or -1
+	// if the block is dropped.
+	handlerIndex := make([]int, len(c.TryCatchBlocks))
+	for i, block := range c.TryCatchBlocks {
+		handlerIndex[i] = -1
+		start, err1 := offset(block.Start)
+		end, err2 := offset(block.End)
+		handler, err3 := offset(block.Handler)
+		if err := firstError(err1, err2, err3); err != nil {
+			return err
+		}
+		if start >= end {
+			// The code the block protected has been removed.
+			continue
+		}
+		handlerIndex[i] = len(handlers)
+		handlers = append(handlers, model.ExceptionTable{StartPC: start, EndPC: end, HandlerPC: handler, CatchType: block.CatchType})
+	}
+
+	attributes := append(model.Attributes(nil), c.Attributes...)
+	if len(c.LineNumbers) > 0 {
+		table := &model.LineNumberTableAttributeInfo{}
+		for _, line := range c.LineNumbers {
+			start, err := offset(line.Start)
+			if err != nil {
+				return err
+			}
+			table.LineNumberTable = append(table.LineNumberTable, model.LineNumberTable{StartPC: start, LineNumber: uint16(line.Line)})
+		}
+		table.LineNumberTableCount = uint16(len(table.LineNumberTable))
+		attributes = append(attributes, c.attribute("LineNumberTable", table))
+	}
+	if len(c.LocalVariables) > 0 {
+		table := &model.LocalVariableTableAttributeInfo{}
+		for _, local := range c.LocalVariables {
+			start, err1 := offset(local.Start)
+			end, err2 := offset(local.End)
+			if err := firstError(err1, err2); err != nil {
+				return err
+			}
+			table.LocalVariableTable = append(table.LocalVariableTable, model.LocalVariableTable{
+				StartPC:         start,
+				Length:          end - start,
+				NameIndex:       local.NameIndex,
+				DescriptorIndex: local.DescriptorIndex,
+				Index:           uint16(local.Index),
+			})
+		}
+		attributes = append(attributes, c.attribute("LocalVariableTable", table))
+	}
+	if len(c.LocalVariableTypes) > 0 {
+		table := &model.LocalVariableTypeTableAttributeInfo{}
+		for _, local := range c.LocalVariableTypes {
+			start, err1 := offset(local.Start)
+			end, err2 := offset(local.End)
+			if err := firstError(err1, err2); err != nil {
+				return err
+			}
+			table.LocalVariableTable = append(table.LocalVariableTable, model.LocalVariableTypeInfo{
+				StartPc:        start,
+				Length:         end - start,
+				NameIndex:      local.NameIndex,
+				SignatureIndex: local.DescriptorIndex,
+				Index:          uint16(local.Index),
+			})
+		}
+		attributes = append(attributes, c.attribute("LocalVariableTypeTable", table))
+	}
+	if len(c.VisibleTypeAnnotations) > 0 {
+		annotations, err := writeTypeAnnotations(c.VisibleTypeAnnotations, offset, handlerIndex)
+		if err != nil {
+			return err
+		}
+		attributes = append(attributes, c.attribute("RuntimeVisibleTypeAnnotations",
+			&model.RuntimeVisibleTypeAnnotationsAttributeInfo{Annotations: annotations}))
+	}
+	if len(c.InvisibleTypeAnnotations) > 0 {
+		annotations, err := writeTypeAnnotations(c.InvisibleTypeAnnotations, offset, handlerIndex)
+		if err != nil {
+			return err
+		}
+		attributes = append(attributes, c.attribute("RuntimeInvisibleTypeAnnotations",
+			&model.RuntimeInvisibleTypeAnnotationsAttributeInfo{Annotations: annotations}))
+	}
+
+	value := &model.CodeAttributeInfo{
+		MaxStack:             uint16(c.MaxStack),
+		MaxLocals:            uint16(c.MaxLocals),
+		CodeLength:           uint32(len(code)),
+		Code:                 code,
+		ExceptionTableLength: uint16(len(handlers)),
+		ExceptionTable:       handlers,
+		AttributesCount:      uint16(len(attributes)),
+		Attributes:           attributes,
+	}
+	replaced := false
+	for i := range method.Attributes {
+		if method.Attributes[i].Name == "Code" {
+			method.Attributes[i].Value = value
+			replaced = true
+		}
+	}
+	if !replaced {
+		method.Attributes = append(method.Attributes, c.attribute("Code", value))
+		method.AttributesCount = uint16(len(method.Attributes))
+	}
+	if err := c.Pool.Err(); err != nil {
+		return err
+	}
+	file.ConstantPool = c.Pool.Entries()
+	file.ConstantPoolCount = uint16(len(file.ConstantPool))
+	return nil
+}
+
+// writeTypeAnnotations puts the offsets of the labels of annotations back
+// in their targets. Annotations of dropped try catch blocks are dropped too.
+func writeTypeAnnotations(annotations []TypeAnnotation, offset func(*Label) (uint16, error), handlerIndex []int) ([]model.TypeAnnotationInfo, error) {
+	written := make([]model.TypeAnnotationInfo, 0, len(annotations))
+	for _, a := range annotations {
+		info := a.TypeAnnotationInfo
+		info.TargetInfo.Table = nil
+		for _, r := range a.Ranges {
+			start, err1 := offset(r.Start)
+			end, err2 := offset(r.End)
+			if err := firstError(err1, err2); err != nil {
+				return nil, err
+			}
+			info.TargetInfo.Table = append(info.TargetInfo.Table, model.LocalVarTargetInfo{
+				StartPC: start,
+				Length:  end - start,
+				Index:   uint16(r.Index),
+			})
+		}
+		if a.At != nil {
+			at, err := offset(a.At)
+			if err != nil {
+				return nil, err
+			}
+			info.TargetInfo.Offset = at
+		}
+		if info.TargetType == constant.TargetExceptionParameter {
+			index := int(info.TargetInfo.ExceptionTableIndex)
+			if index >= len(handlerIndex) {
+				return nil, fmt.Errorf("type annotation of try catch block %d, which does not exist", index)
+			}
+			if handlerIndex[index] < 0 {
+				continue
+			}
+			info.TargetInfo.ExceptionTableIndex = uint16(handlerIndex[index])
+		}
+		written = append(written, info)
+	}
+	return written, nil
+}
+
+func (c *Code) attribute(name string, value interface{}) model.AttributeInfo {
+	return model.AttributeInfo{AttributeNameIndex: c.Pool.Utf8(name), Name: name, Value: value}
+}
+
+func firstError(errs ...error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
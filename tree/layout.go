@@ -0,0 +1,243 @@
+package tree
+
+import (
+	"encoding/binary"
+	"fmt"
+	"outro/interpreter"
+)
+
+// layout gives every node its offset and returns the length of the code.
+// A branch too far for a 16-bit offset is made long and the code laid out
+// again; as instructions only grow this ends when every branch reaches.
+func (c *Code) layout() (int, error) {
+	for node := c.Instructions.First(); node != nil; node = node.Next() {
+		if insn, ok := node.(*Insn); ok {
+			if _, ok := interpreter.InstructDisplayNameMap[insn.Opcode]; !ok || insn.Opcode == interpreter.WIDE {
+				return 0, fmt.Errorf("invalid opcode %#x", byte(insn.Opcode))
+			}
+			insn.long = insn.Opcode == interpreter.GOTO_W || insn.Opcode == interpreter.JSR_W
+		}
+	}
+	for {
+		offset := 0
+		for node := c.Instructions.First(); node != nil; node = node.Next() {
+			switch n := node.(type) {
+			case *Label:
+				n.offset = offset
+			case *Insn:
+				n.offset = offset
+				offset += n.size()
+			}
+		}
+		if offset == 0 || offset > 65535 {
+			return 0, fmt.Errorf("invalid code length %d", offset)
+		}
+		grown := false
+		for node := c.Instructions.First(); node != nil; node = node.Next() {
+			insn, ok := node.(*Insn)
+			if !ok || !isJump(insn.Opcode) {
+				continue
+			}
+			if insn.Target == nil || !c.Instructions.Contains(insn.Target) {
+				return 0, fmt.Errorf("branch target of %s at offset %d is not in the code",
+					interpreter.InstructDisplayNameMap[insn.Opcode], insn.offset)
+			}
+			if delta := insn.Target.offset - insn.offset; !insn.long && (delta < -32768 || delta > 32767) {
+				insn.long, grown = true, true
+			}
+		}
+		if !grown {
+			return offset, c.checkSwitchTargets()
+		}
+	}
+}
+
+func (c *Code) checkSwitchTargets() error {
+	for node := c.Instructions.First(); node != nil; node = node.Next() {
+		insn, ok := node.(*Insn)
+		if !ok || insn.Opcode != interpreter.TABLESWITCH && insn.Opcode != interpreter.LOOKUPSWITCH {
+			continue
+		}
+		if len(insn.Keys) != len(insn.Targets) || insn.Opcode == interpreter.TABLESWITCH && len(insn.Keys) == 0 {
+			return fmt.Errorf("%s at offset %d has %d keys and %d targets",
+				interpreter.InstructDisplayNameMap[insn.Opcode], insn.offset, len(insn.Keys), len(insn.Targets))
+		}
+		for _, target := range append([]*Label{insn.Target}, insn.Targets...) {
+			if target == nil || !c.Instructions.Contains(target) {
+				return fmt.Errorf("branch target of %s at offset %d is not in the code",
+					interpreter.InstructDisplayNameMap[insn.Opcode], insn.offset)
+			}
+		}
+	}
+	return nil
+}
+
+// padding returns the bytes that align a switch's operands to 4 bytes.
+func (insn *Insn) padding() int {
+	return (4 - (insn.offset+1)%4) % 4
+}
+
+func (insn *Insn) wide() bool {
+	if insn.Opcode == interpreter.IINC {
+		return insn.Local > 0xFF || insn.Const < -128 || insn.Const > 127
+	}
+	return insn.Local > 0xFF
+}
+
+func (insn *Insn) size() int {
+	switch op := insn.Opcode; {
+	case op == interpreter.TABLESWITCH:
+		return 1 + insn.padding() + 12 + 4*len(insn.Targets)
+	case op == interpreter.LOOKUPSWITCH:
+		return 1 + insn.padding() + 8 + 8*len(insn.Targets)
+	case isJump(op):
+		switch {
+		case !insn.long:
+			return 3
+		case op == interpreter.GOTO || op == interpreter.GOTO_W || op == interpreter.JSR || op == interpreter.JSR_W:
+			return 5
+		}
+		// The inverted branch skips the goto_w that follows it.
+		return 3 + 5
+	case isVarInsn(op):
+		switch {
+		case insn.wide():
+			return 4
+		case insn.Local <= 3 && op != interpreter.RET:
+			return 1
+		}
+		return 2
+	case op == interpreter.IINC:
+		if insn.wide() {
+			return 6
+		}
+		return 3
+	case op == interpreter.BIPUSH || op == interpreter.NEWARRAY:
+		return 2
+	case op == interpreter.LDC || op == interpreter.LDC_W:
+		if insn.Index <= 0xFF {
+			return 2
+		}
+		return 3
+	case op == interpreter.INVOKEINTERFACE || op == interpreter.INVOKEDYNAMIC:
+		return 5
+	case op == interpreter.MULTIANEWARRAY:
+		return 4
+	case op == interpreter.SIPUSH, op == interpreter.LDC2_W, op >= interpreter.GETSTATIC && op <= interpreter.INVOKESTATIC,
+		op == interpreter.NEW, op == interpreter.ANEWARRAY, op == interpreter.CHECKCAST, op == interpreter.INSTANCEOF:
+		return 3
+	}
+	return 1
+}
+
+func isVarInsn(op interpreter.Instruct) bool {
+	return op >= interpreter.ILOAD && op <= interpreter.ALOAD ||
+		op >= interpreter.ISTORE && op <= interpreter.ASTORE || op == interpreter.RET
+}
+
+// invert returns the conditional branch taken when op is not.
+func invert(op interpreter.Instruct) interpreter.Instruct {
+	switch op {
+	case interpreter.IFNULL:
+		return interpreter.IFNONNULL
+	case interpreter.IFNONNULL:
+		return interpreter.IFNULL
+	}
+	return interpreter.IFEQ + ((op - interpreter.IFEQ) ^ 1)
+}
+
+func (insn *Insn) encode(code []byte) ([]byte, error) {
+	u2 := func(v int) { code = binary.BigEndian.AppendUint16(code, uint16(v)) }
+	u4 := func(v int) { code = binary.BigEndian.AppendUint32(code, uint32(v)) }
+	switch op := insn.Opcode; {
+	case op == interpreter.TABLESWITCH || op == interpreter.LOOKUPSWITCH:
+		code = append(code, byte(op))
+		code = append(code, make([]byte, insn.padding())...)
+		u4(insn.Target.offset - insn.offset)
+		if op == interpreter.TABLESWITCH {
+			u4(int(insn.Keys[0]))
+			u4(int(insn.Keys[len(insn.Keys)-1]))
+		} else {
+			u4(len(insn.Keys))
+		}
+		for i, target := range insn.Targets {
+			if op == interpreter.LOOKUPSWITCH {
+				u4(int(insn.Keys[i]))
+			}
+			u4(target.offset - insn.offset)
+		}
+	case isJump(op):
+		delta := insn.Target.offset - insn.offset
+		switch {
+		case !insn.long:
+			code = append(code, byte(op))
+			u2(delta)
+		case op == interpreter.GOTO || op == interpreter.GOTO_W:
+			code = append(code, byte(interpreter.GOTO_W))
+			u4(delta)
+		case op == interpreter.JSR || op == interpreter.JSR_W:
+			code = append(code, byte(interpreter.JSR_W))
+			u4(delta)
+		default:
+			code = append(code, byte(invert(op)))
+			u2(3 + 5)
+			code = append(code, byte(interpreter.GOTO_W))
+			u4(delta - 3)
+		}
+	case isVarInsn(op):
+		switch {
+		case insn.wide():
+			code = append(code, byte(interpreter.WIDE), byte(op))
+			u2(insn.Local)
+		case insn.Local <= 3 && op != interpreter.RET && op <= interpreter.ALOAD:
+			code = append(code, byte(interpreter.ILOAD_0+(op-interpreter.ILOAD)*4)+byte(insn.Local))
+		case insn.Local <= 3 && op != interpreter.RET:
+			code = append(code, byte(interpreter.ISTORE_0+(op-interpreter.ISTORE)*4)+byte(insn.Local))
+		default:
+			code = append(code, byte(op), byte(insn.Local))
+		}
+	case op == interpreter.IINC:
+		if insn.wide() {
+			code = append(code, byte(interpreter.WIDE), byte(op))
+			u2(insn.Local)
+			u2(int(insn.Const))
+		} else {
+			code = append(code, byte(op), byte(insn.Local), byte(int8(insn.Const)))
+		}
+	case op == interpreter.BIPUSH:
+		code = append(code, byte(op), byte(int8(insn.Const)))
+	case op == interpreter.SIPUSH:
+		code = append(code, byte(op))
+		u2(int(insn.Const))
+	case op == interpreter.NEWARRAY:
+		code = append(code, byte(op), insn.ArrayType)
+	case op == interpreter.LDC || op == interpreter.LDC_W:
+		if insn.Index <= 0xFF {
+			code = append(code, byte(interpreter.LDC), byte(insn.Index))
+		} else {
+			code = append(code, byte(interpreter.LDC_W))
+			u2(insn.Index)
+		}
+	case op == interpreter.INVOKEINTERFACE || op == interpreter.INVOKEDYNAMIC:
+		code = append(code, byte(op))
+		u2(insn.Index)
+		if op == interpreter.INVOKEINTERFACE {
+			code = append(code, byte(insn.Count), 0)
+		} else {
+			code = append(code, 0, 0)
+		}
+	case op == interpreter.MULTIANEWARRAY:
+		code = append(code, byte(op))
+		u2(insn.Index)
+		code = append(code, byte(insn.Count))
+	case insn.size() == 3:
+		code = append(code, byte(op))
+		u2(insn.Index)
+	default:
+		code = append(code, byte(op))
+	}
+	if insn.Index < 0 || insn.Index > 0xFFFF || insn.Local < 0 || insn.Local > 0xFFFF {
+		return nil, fmt.Errorf("operand of %s at offset %d out of range", interpreter.InstructDisplayNameMap[insn.Opcode], insn.offset)
+	}
+	return code, nil
+}
@@ -0,0 +1,150 @@
+// Package tree represents the code of a method as an editable list of
+// instructions, in the style of ASM's tree API. Branch targets, exception
+// ranges, line numbers and local variables refer to Label nodes in the
+// list rather than to offsets, so instructions can be inserted and removed
+// freely; Write lays the code out again, choosing short or wide forms,
+// switch padding and goto_w for branches that no longer reach.
+//
+//	code, err := tree.Read(file, method)
+//	code.Instructions.Insert(&tree.Insn{Opcode: interpreter.NOP})
+//	err = code.Write(file, method)
+//
+// Operands that name constants are constant pool indexes; Code.Pool adds
+// new ones. The StackMapTable is dropped when code is read, since its
+// offsets would go stale: verifier.ComputeFrames computes it again.
+package tree
+
+// Node is an element of an InsnList: an *Insn or a *Label.
+type Node interface {
+	Next() Node
+	Previous() Node
+	links() *link
+}
+
+type link struct {
+	list           *InsnList
+	previous, next Node
+}
+
+func (l *link) links() *link {
+	return l
+}
+
+// Next returns the node after this one, or nil.
+func (l *link) Next() Node {
+	return l.next
+}
+
+// Previous returns the node before this one, or nil.
+func (l *link) Previous() Node {
+	return l.previous
+}
+
+// InsnList is a doubly linked list of nodes. Inserting a node that is in
+// a list moves it.
+type InsnList struct {
+	first, last Node
+	length      int
+}
+
+func (l *InsnList) First() Node {
+	return l.first
+}
+
+func (l *InsnList) Last() Node {
+	return l.last
+}
+
+func (l *InsnList) Len() int {
+	return l.length
+}
+
+// Contains reports whether node is in the list.
+func (l *InsnList) Contains(node Node) bool {
+	return node.links().list == l
+}
+
+// Add appends nodes to the end of the list.
+func (l *InsnList) Add(nodes ...Node) {
+	for _, node := range nodes {
+		l.insert(node, l.last, nil)
+	}
+}
+
+// Insert puts nodes at the start of the list.
+func (l *InsnList) Insert(nodes ...Node) {
+	l.insertBetween(nil, l.first, nodes)
+}
+
+// InsertBefore puts nodes, in order, before mark.
+func (l *InsnList) InsertBefore(mark Node, nodes ...Node) {
+	l.insertBetween(mark.Previous(), mark, nodes)
+}
+
+// InsertAfter puts nodes, in order, after mark.
+func (l *InsnList) InsertAfter(mark Node, nodes ...Node) {
+	l.insertBetween(mark, mark.Next(), nodes)
+}
+
+func (l *InsnList) insertBetween(previous, next Node, nodes []Node) {
+	for _, node := range nodes {
+		switch node {
+		case previous:
+			previous = node.Previous()
+		case next:
+			next = node.Next()
+		}
+		l.insert(node, previous, next)
+		previous = node
+	}
+}
+
+func (l *InsnList) insert(node, previous, next Node) {
+	if list := node.links().list; list != nil {
+		list.Remove(node)
+	}
+	n := node.links()
+	n.list, n.previous, n.next = l, previous, next
+	if previous == nil {
+		l.first = node
+	} else {
+		previous.links().next = node
+	}
+	if next == nil {
+		l.last = node
+	} else {
+		next.links().previous = node
+	}
+	l.length++
+}
+
+// Remove takes node out of the list; it does nothing if node is in
+// another list or none.
+func (l *InsnList) Remove(node Node) {
+	n := node.links()
+	if n.list != l {
+		return
+	}
+	if n.previous == nil {
+		l.first = n.next
+	} else {
+		n.previous.links().next = n.next
+	}
+	if n.next == nil {
+		l.last = n.previous
+	} else {
+		n.next.links().previous = n.previous
+	}
+	n.list, n.previous, n.next = nil, nil, nil
+	l.length--
+}
+
+// Nodes returns the nodes in order, so the list can be changed while they
+// are iterated.
+func (l *InsnList) Nodes() []Node {
+	nodes := make([]Node, 0, l.length)
+	for node := l.first; node != nil; node = node.Next() {
+		nodes = append(nodes, node)
+	}
+	return nodes
+}
@@ -0,0 +1,305 @@
+package verifier
+
+import (
+	"outro/builder"
+	"outro/constant"
+	. "outro/interpreter"
+	"outro/model"
+	"sort"
+)
+
+// ComputeFrames recomputes max_stack and max_locals of the code of a method
+// and, in class files verified by type checking, replaces its StackMapTable
+// with a frame at each instruction where the type checker needs one. The
+// types are inferred as for verification, loading classes to find common
+// superclasses, so code that does not verify is rejected.
+//
+// Unreachable code cannot be described by frames; like ASM's COMPUTE_FRAMES
+// it is replaced by nops ending in athrow and cut out of exception handler
+// ranges. Classes the stack map frames name are added to the constant pool.
+func (v *Verifier) ComputeFrames(file *model.ClassFile, info *model.MethodInfo) error {
+	code, ok := info.Attributes.Get("Code").(*model.CodeAttributeInfo)
+	if !ok {
+		return nil
+	}
+	c := &classVerifier{file: file, loader: v.loader, className: file.ClassName(file.ThisClass)}
+	m, err := c.newMethodVerifier(info, code)
+	if err != nil {
+		return err
+	}
+	withFrames := file.MajorVersion >= TypeCheckingVersion
+	static := info.AccessFlags&uint16(constant.METHOD_ACC_STATIC) != 0
+	parameters, err := model.InitialFrameLocals(m.className, m.name, m.descriptor, static)
+	if err != nil {
+		return m.errorf("%v", err)
+	}
+	m.maxStack, m.maxLocals = 0xFFFF, len(expand(parameters))
+	for i := range m.instructions {
+		in := &m.instructions[i]
+		if withFrames && (in.Opcode == JSR || in.Opcode == JSR_W || in.Opcode == RET) {
+			m.offset = in.Offset
+			return m.errorf("%s cannot be described by stack map frames", InstructDisplayNameMap[in.Opcode])
+		}
+		if local, slots, ok := localOperand(in); ok && local+slots > m.maxLocals {
+			m.maxLocals = local + slots
+		}
+	}
+	initial, err := m.initialFrame(info)
+	if err != nil {
+		return err
+	}
+	if err := m.inferTypes(initial.clone()); err != nil {
+		return err
+	}
+	states := m.inference.states
+
+	bytecode, handlers := code.Code, code.ExceptionTable
+	var offsets []int
+	if withFrames {
+		dead := m.unreachable()
+		if len(dead) > 0 {
+			bytecode = append([]byte(nil), code.Code...)
+			handlers = handlersWithout(code.ExceptionTable, dead)
+		}
+		offsets = m.frameOffsets(dead, handlers)
+		for _, r := range dead {
+			for i := r[0]; i < r[1]-1; i++ {
+				bytecode[i] = byte(NOP)
+			}
+			bytecode[r[1]-1] = byte(ATHROW)
+			thrown := &frame{stack: []Type{objectType("java/lang/Throwable")}}
+			for range initial.locals {
+				thrown.locals = append(thrown.locals, topType)
+			}
+			states[r[0]] = thrown
+		}
+	}
+	maxStack := 0
+	for _, state := range states {
+		if len(state.stack) > maxStack {
+			maxStack = len(state.stack)
+		}
+	}
+
+	attributes := code.Attributes
+	if withFrames {
+		pool := builder.ExtendConstantPool(file.ConstantPool)
+		table, err := encodeFrames(pool, initial, states, offsets)
+		if err != nil {
+			return m.errorf("%v", err)
+		}
+		attributes = nil
+		for _, attribute := range code.Attributes {
+			if attribute.Name != "StackMapTable" {
+				attributes = append(attributes, attribute)
+			}
+		}
+		if table != nil {
+			attributes = append(attributes, model.AttributeInfo{
+				AttributeNameIndex: pool.Utf8("StackMapTable"),
+				Name:               "StackMapTable",
+				Value:              table,
+			})
+		}
+		if err := pool.Err(); err != nil {
+			return m.errorf("%v", err)
+		}
+		file.ConstantPool = pool.Entries()
+		file.ConstantPoolCount = uint16(len(file.ConstantPool))
+	}
+	code.MaxStack, code.MaxLocals = uint16(maxStack), uint16(m.maxLocals)
+	code.Code, code.CodeLength = bytecode, uint32(len(bytecode))
+	code.ExceptionTable, code.ExceptionTableLength = handlers, uint16(len(handlers))
+	code.Attributes, code.AttributesCount = attributes, uint16(len(attributes))
+	return nil
+}
+
+// ComputeAllFrames computes the frames of every method of a class file.
+func (v *Verifier) ComputeAllFrames(file *model.ClassFile) error {
+	for i := range file.Methods {
+		if err := v.ComputeFrames(file, &file.Methods[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unreachable returns the runs of instructions that type inference never
+// reached, as [start, end) offsets.
+func (m *methodVerifier) unreachable() [][2]int {
+	var dead [][2]int
+	for i := range m.instructions {
+		in := &m.instructions[i]
+		if m.inference.states[in.Offset] != nil {
+			continue
+		}
+		if n := len(dead); n > 0 && dead[n-1][1] == in.Offset {
+			dead[n-1][1] = in.Next()
+		} else {
+			dead = append(dead, [2]int{in.Offset, in.Next()})
+		}
+	}
+	return dead
+}
+
+// frameOffsets returns in order the offsets the type checker needs a frame
+// at: branch targets, exception handlers, instructions after one that does
+// not fall through, and the start of unreachable code.
+func (m *methodVerifier) frameOffsets(dead [][2]int, handlers []model.ExceptionTable) []int {
+	needed := map[int]bool{}
+	for i := range m.instructions {
+		in := &m.instructions[i]
+		if m.inference.states[in.Offset] == nil {
+			continue
+		}
+		switch op := in.Opcode; {
+		case op >= IFEQ && op <= IF_ACMPNE, op == IFNULL || op == IFNONNULL:
+			needed[in.Target] = true
+		case op == GOTO || op == GOTO_W:
+			needed[in.Target] = true
+			needed[in.Next()] = true
+		case op == TABLESWITCH || op == LOOKUPSWITCH:
+			needed[in.Target] = true
+			for _, target := range in.Targets {
+				needed[target] = true
+			}
+			needed[in.Next()] = true
+		case op >= IRETURN && op <= RETURN, op == ATHROW:
+			needed[in.Next()] = true
+		}
+	}
+	for _, handler := range handlers {
+		needed[int(handler.HandlerPC)] = true
+	}
+	var offsets []int
+	for offset := range needed {
+		if m.inference.states[offset] != nil {
+			offsets = append(offsets, offset)
+		}
+	}
+	for _, r := range dead {
+		// The athrow that replaces the code does not fall through either.
+		offsets = append(offsets, r[0])
+		if m.inference.states[r[1]] != nil && !needed[r[1]] {
+			offsets = append(offsets, r[1])
+		}
+	}
+	sort.Ints(offsets)
+	return offsets
+}
+
+// handlersWithout cuts the dead ranges out of the range of each exception
+// handler, splitting a handler around them or dropping it if nothing is
+// left.
+func handlersWithout(handlers []model.ExceptionTable, dead [][2]int) []model.ExceptionTable {
+	var kept []model.ExceptionTable
+	for _, handler := range handlers {
+		parts := [][2]int{{int(handler.StartPC), int(handler.EndPC)}}
+		for _, r := range dead {
+			var cut [][2]int
+			for _, part := range parts {
+				if r[1] <= part[0] || r[0] >= part[1] {
+					cut = append(cut, part)
+					continue
+				}
+				if part[0] < r[0] {
+					cut = append(cut, [2]int{part[0], r[0]})
+				}
+				if r[1] < part[1] {
+					cut = append(cut, [2]int{r[1], part[1]})
+				}
+			}
+			parts = cut
+		}
+		for _, part := range parts {
+			handler.StartPC, handler.EndPC = uint16(part[0]), uint16(part[1])
+			kept = append(kept, handler)
+		}
+	}
+	return kept
+}
+
+// encodeFrames writes the states at offsets as stack map frames, each in
+// the most compact form relative to the frame before it. It returns nil if
+// there are no frames.
+func encodeFrames(pool *builder.ConstantPool, initial *frame, states map[int]*frame, offsets []int) (*model.StackMapTableAttributeInfo, error) {
+	if len(offsets) == 0 {
+		return nil, nil
+	}
+	initialLocals := trimTops(compress(pool, initial.locals))
+	previous, previousOffset := initialLocals, -1
+	entries := make([]model.StackMapFrame, 0, len(offsets))
+	for _, offset := range offsets {
+		locals, stack := trimTops(compress(pool, states[offset].locals)), compress(pool, states[offset].stack)
+		delta := offset - previousOffset - 1
+		entry := model.StackMapFrame{OffsetDelta: uint16(delta)}
+		diff := len(locals) - len(previous)
+		switch {
+		case len(stack) == 0 && equalTypes(locals, previous):
+			entry.FrameType = constant.SameFrameExtended
+			if delta < 64 {
+				entry.FrameType = constant.SameFrame + uint8(delta)
+			}
+		case len(stack) == 1 && equalTypes(locals, previous):
+			entry.FrameType = constant.SameLocals1StackItemFrameExtended
+			if delta < 64 {
+				entry.FrameType = constant.SameLocals1StackItemFrame + uint8(delta)
+			}
+			entry.Stack = stack
+		case len(stack) == 0 && diff < 0 && diff >= -3 && equalTypes(locals, previous[:len(locals)]):
+			entry.FrameType = constant.SameFrameExtended - uint8(-diff)
+		case len(stack) == 0 && diff > 0 && diff <= 3 && equalTypes(locals[:len(previous)], previous):
+			entry.FrameType = constant.SameFrameExtended + uint8(diff)
+			entry.Locals = locals[len(previous):]
+		default:
+			entry.FrameType = constant.FullFrame
+			entry.Locals, entry.Stack = locals, stack
+		}
+		entries = append(entries, entry)
+		previous, previousOffset = locals, offset
+	}
+	frames, err := model.ExpandStackMapFrames(initialLocals, entries)
+	if err != nil {
+		return nil, err
+	}
+	return &model.StackMapTableAttributeInfo{
+		NumberOfEntries: uint16(len(entries)),
+		Entries:         entries,
+		Frames:          frames,
+	}, nil
+}
+
+// compress turns slots back into stack map types, where long and double
+// stand for two slots, adding the classes of object types to the pool.
+func compress(pool *builder.ConstantPool, slots []Type) []Type {
+	var types []Type
+	for i := 0; i < len(slots); i += size(slots[i]) {
+		t := slots[i]
+		if t.Tag == constant.ItemObject {
+			t.CpoolIndex = pool.Class(t.ClassName)
+		}
+		types = append(types, t)
+	}
+	return types
+}
+
+// trimTops drops the unusable locals at the end of a frame, which the type
+// checker fills in.
+func trimTops(types []Type) []Type {
+	for len(types) > 0 && types[len(types)-1].Tag == constant.ItemTop {
+		types = types[:len(types)-1]
+	}
+	return types
+}
+
+func equalTypes(a, b []Type) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,196 @@
+package verifier
+
+import "outro/constant"
+
+// frame holds the types of the local variables and operand stack, one per
+// slot. The second slot of a long or double is top.
+type frame struct {
+	locals []Type
+	stack  []Type
+}
+
+// newFrame expands the types of a stack map frame, where long and double
+// stand for two slots, and fills the remaining locals with top.
+func (m *methodVerifier) newFrame(locals, stack []Type) (*frame, error) {
+	f := &frame{locals: expand(locals), stack: expand(stack)}
+	if len(f.locals) > m.maxLocals {
+		return nil, m.errorf("%d local variable slots exceed max_locals %d", len(f.locals), m.maxLocals)
+	}
+	if len(f.stack) > m.maxStack {
+		return nil, m.errorf("%d operand stack slots exceed max_stack %d", len(f.stack), m.maxStack)
+	}
+	for len(f.locals) < m.maxLocals {
+		f.locals = append(f.locals, topType)
+	}
+	return f, nil
+}
+
+func expand(types []Type) []Type {
+	slots := make([]Type, 0, len(types))
+	for _, t := range types {
+		slots = append(slots, normalize(t))
+		if size(t) == 2 {
+			slots = append(slots, topType)
+		}
+	}
+	return slots
+}
+
+func (f *frame) clone() *frame {
+	return &frame{
+		locals: append([]Type(nil), f.locals...),
+		stack:  append([]Type(nil), f.stack...),
+	}
+}
+
+func (m *methodVerifier) push(f *frame, t Type) error {
+	if len(f.stack)+size(t) > m.maxStack {
+		return m.errorf("operand stack overflow, max_stack is %d", m.maxStack)
+	}
+	f.stack = append(f.stack, t)
+	if size(t) == 2 {
+		f.stack = append(f.stack, topType)
+	}
+	return nil
+}
+
+// peek returns the value on top of the stack, looking through the top
+// slot of a long or double.
+func (f *frame) peek() Type {
+	top := f.stack[len(f.stack)-1]
+	if top.Tag == constant.ItemTop && len(f.stack) > 1 && size(f.stack[len(f.stack)-2]) == 2 {
+		return f.stack[len(f.stack)-2]
+	}
+	return top
+}
+
+// pop pops a value assignable to want.
+func (m *methodVerifier) pop(f *frame, want Type) error {
+	if len(f.stack) == 0 {
+		return m.errorf("operand stack underflow, expected %s", typeName(want))
+	}
+	found := f.peek()
+	if size(found) != size(want) || len(f.stack) < size(want) {
+		return m.mismatch(typeName(want), found)
+	}
+	if ok, err := m.isAssignable(found, want); err != nil {
+		return err
+	} else if !ok {
+		return m.mismatch(typeName(want), found)
+	}
+	f.stack = f.stack[:len(f.stack)-size(want)]
+	return nil
+}
+
+// popReference pops a reference, which may be uninitialized.
+func (m *methodVerifier) popReference(f *frame) (Type, error) {
+	if len(f.stack) == 0 {
+		return Type{}, m.errorf("operand stack underflow, expected reference")
+	}
+	found := f.peek()
+	if !isReference(found) {
+		return Type{}, m.mismatch("reference", found)
+	}
+	f.stack = f.stack[:len(f.stack)-1]
+	return found, nil
+}
+
+// popArray pops null or an array whose component descriptor starts with
+// one of kinds, 'L' standing for any reference component. It returns the
+// component type, null for a null array.
+func (m *methodVerifier) popArray(f *frame, expected string, kinds ...byte) (Type, error) {
+	if len(f.stack) == 0 {
+		return Type{}, m.errorf("operand stack underflow, expected %s", expected)
+	}
+	found := f.peek()
+	if found.Tag == constant.ItemNull {
+		f.stack = f.stack[:len(f.stack)-1]
+		return nullType, nil
+	}
+	if found.Tag == constant.ItemObject && len(found.ClassName) > 1 && found.ClassName[0] == '[' {
+		component := found.ClassName[1:]
+		for _, kind := range kinds {
+			if component[0] == kind || kind == 'L' && component[0] == '[' {
+				f.stack = f.stack[:len(f.stack)-1]
+				if isReferenceDescriptor(component) {
+					return objectType(componentName(component)), nil
+				}
+				return Type{}, nil
+			}
+		}
+	}
+	return Type{}, m.mismatch(expected, found)
+}
+
+// load pushes local variable index, which must hold a value assignable to
+// want.
+func (m *methodVerifier) load(f *frame, index int, want Type) error {
+	if index+size(want) > m.maxLocals {
+		return m.errorf("local variable %d out of range, max_locals is %d", index, m.maxLocals)
+	}
+	found := f.locals[index]
+	if ok, err := m.isAssignable(found, want); err != nil {
+		return err
+	} else if !ok || size(want) == 2 && f.locals[index+1].Tag != constant.ItemTop {
+		return m.errorf("expected %s in local %d, found %s", typeName(want), index, typeName(found))
+	}
+	return m.push(f, found)
+}
+
+// store sets local variable index to t, invalidating a long or double in
+// the slot before that it overwrites half of.
+func (m *methodVerifier) store(f *frame, index int, t Type) error {
+	if index+size(t) > m.maxLocals {
+		return m.errorf("local variable %d out of range, max_locals is %d", index, m.maxLocals)
+	}
+	if index > 0 && size(f.locals[index-1]) == 2 {
+		f.locals[index-1] = topType
+	}
+	f.locals[index] = t
+	if size(t) == 2 {
+		f.locals[index+1] = topType
+	}
+	return nil
+}
+
+// shuffle rearranges the top depth slots of the stack for the pop, dup and
+// swap instructions: order lists the new top slots by their position among
+// the old ones, deepest first. No long or double may straddle a cut, a
+// depth below the top where the instruction splits the values.
+func (m *methodVerifier) shuffle(f *frame, depth int, cuts []int, order ...int) error {
+	if len(f.stack) < depth {
+		return m.errorf("operand stack underflow")
+	}
+	for _, cut := range cuts {
+		if i := len(f.stack) - cut; f.stack[i].Tag == constant.ItemTop {
+			if i > 0 {
+				i--
+			}
+			return m.mismatch("category 1 value", f.stack[i])
+		}
+	}
+	if len(f.stack)-depth+len(order) > m.maxStack {
+		return m.errorf("operand stack overflow, max_stack is %d", m.maxStack)
+	}
+	old := append([]Type(nil), f.stack[len(f.stack)-depth:]...)
+	f.stack = f.stack[:len(f.stack)-depth]
+	for _, i := range order {
+		f.stack = append(f.stack, old[i])
+	}
+	return nil
+}
+
+// replace changes every occurrence of from in the frame to to, as when an
+// object is initialized.
+func (f *frame) replace(from, to Type) {
+	for i, t := range f.locals {
+		if t == from {
+			f.locals[i] = to
+		}
+	}
+	for i, t := range f.stack {
+		if t == from {
+			f.stack[i] = to
+		}
+	}
+}
@@ -0,0 +1,352 @@
+package verifier
+
+import (
+	"outro/constant"
+	. "outro/interpreter"
+	"sort"
+	"strings"
+)
+
+// itemReturnAddress tags the return address pushed by jsr. It never
+// appears in a class file, so it has no stack map encoding; Offset is the
+// start of the subroutine.
+const itemReturnAddress uint8 = 9
+
+func returnAddressType(subroutine int) Type {
+	return Type{Tag: itemReturnAddress, Offset: uint16(subroutine)}
+}
+
+// inference holds the types inferred at each instruction that control has
+// reached so far.
+type inference struct {
+	states map[int]*frame
+	// pending are the offsets whose state changed since they were last
+	// executed.
+	pending map[int]bool
+	// rets are the ret instructions found in each subroutine, and locals
+	// the locals each subroutine uses.
+	rets   map[int][]int
+	locals map[int]map[int]bool
+}
+
+// inferTypes runs the data-flow analysis: it executes each instruction
+// whose incoming types changed, merging the outgoing types into its
+// successors, until nothing changes.
+func (m *methodVerifier) inferTypes(initial *frame) error {
+	m.inference = &inference{
+		states:  map[int]*frame{},
+		pending: map[int]bool{},
+		rets:    map[int][]int{},
+		locals:  map[int]map[int]bool{},
+	}
+	if err := m.merge(initial, 0); err != nil {
+		return err
+	}
+	for len(m.inference.pending) > 0 {
+		m.offset = m.nextPending()
+		delete(m.inference.pending, m.offset)
+		in := m.at[m.offset]
+		f := m.inference.states[m.offset].clone()
+		if err := m.checkHandlers(f); err != nil {
+			return err
+		}
+		falls, err := m.execute(f, in)
+		if err != nil {
+			return err
+		}
+		if isStore(in.Opcode) {
+			// A handler may also see the local just stored.
+			if err := m.checkHandlers(&frame{locals: f.locals}); err != nil {
+				return err
+			}
+		}
+		if !falls {
+			continue
+		}
+		if in.Next() == len(m.code.Code) {
+			return m.errorf("execution falls off the end of the code")
+		}
+		if err := m.merge(f, in.Next()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// nextPending picks the pending instruction earliest in the code, which
+// tends to reach the fixed point in few passes.
+func (m *methodVerifier) nextPending() int {
+	next := -1
+	for offset := range m.inference.pending {
+		if next < 0 || offset < next {
+			next = offset
+		}
+	}
+	return next
+}
+
+func isStore(op Instruct) bool {
+	return op >= ISTORE && op <= ASTORE || op >= ISTORE_0 && op <= ASTORE_3
+}
+
+// merge combines f into the types at target. Locals of different types
+// become unusable; the operand stacks must agree in height and in the kind
+// of each value.
+func (m *methodVerifier) merge(f *frame, target int) error {
+	state := m.inference.states[target]
+	if state == nil {
+		m.inference.states[target] = f.clone()
+		m.inference.pending[target] = true
+		return nil
+	}
+	if len(state.stack) != len(f.stack) {
+		return m.errorf("inconsistent stack height %d and %d at offset %d", len(state.stack), len(f.stack), target)
+	}
+	changed := false
+	for i, t := range f.locals {
+		merged, ok, err := m.mergeTypes(state.locals[i], t)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			merged = topType
+		}
+		if merged != state.locals[i] {
+			state.locals[i] = merged
+			changed = true
+		}
+	}
+	for i, t := range f.stack {
+		merged, ok, err := m.mergeTypes(state.stack[i], t)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return m.errorf("incompatible types %s and %s in stack slot %d at offset %d",
+				typeName(state.stack[i]), typeName(t), i, target)
+		}
+		if merged != state.stack[i] {
+			state.stack[i] = merged
+			changed = true
+		}
+	}
+	if changed {
+		m.inference.pending[target] = true
+	}
+	return nil
+}
+
+// mergeTypes returns the most specific type of which a and b are both
+// instances, if there is one. Two classes merge to their first common
+// superclass.
+func (m *methodVerifier) mergeTypes(a, b Type) (merged Type, ok bool, err error) {
+	switch {
+	case a == b:
+		return a, true, nil
+	case a.Tag == constant.ItemNull && b.Tag == constant.ItemObject:
+		return b, true, nil
+	case a.Tag == constant.ItemObject && b.Tag == constant.ItemNull:
+		return a, true, nil
+	case a.Tag == constant.ItemObject && b.Tag == constant.ItemObject:
+		className, err := m.commonSuperclass(a.ClassName, b.ClassName)
+		return objectType(className), err == nil, err
+	}
+	return Type{}, false, nil
+}
+
+// commonSuperclass returns the first superclass shared by two classes or
+// array classes. Interfaces merge to java/lang/Object, as assignments to
+// them are checked at run time.
+func (m *methodVerifier) commonSuperclass(a, b string) (string, error) {
+	if a == b {
+		return a, nil
+	}
+	if strings.HasPrefix(a, "[") || strings.HasPrefix(b, "[") {
+		if strings.HasPrefix(a, "[") && strings.HasPrefix(b, "[") &&
+			isReferenceDescriptor(a[1:]) && isReferenceDescriptor(b[1:]) {
+			component, err := m.commonSuperclass(componentName(a[1:]), componentName(b[1:]))
+			return arrayOf(component), err
+		}
+		return "java/lang/Object", nil
+	}
+	ancestors := map[string]bool{}
+	for name := a; name != "java/lang/Object" && name != ""; {
+		access, superName, err := m.classInfo(name)
+		if err != nil {
+			return "", err
+		}
+		if access&uint16(constant.CLASS_ACC_INTERFACE) != 0 {
+			return "java/lang/Object", nil
+		}
+		ancestors[name] = true
+		name = superName
+	}
+	for name := b; name != "java/lang/Object" && name != ""; {
+		if ancestors[name] {
+			return name, nil
+		}
+		access, superName, err := m.classInfo(name)
+		if err != nil {
+			return "", err
+		}
+		if access&uint16(constant.CLASS_ACC_INTERFACE) != 0 {
+			break
+		}
+		name = superName
+	}
+	return "java/lang/Object", nil
+}
+
+// jsr pushes the return address and enters the subroutine. The instruction
+// after the jsr is reached when the subroutine returns, through ret.
+func (m *methodVerifier) jsr(f *frame, in *Instruction) error {
+	if m.inference == nil {
+		return m.errorf("%s is not supported by the type checker", InstructDisplayNameMap[in.Opcode])
+	}
+	if err := m.push(f, returnAddressType(in.Target)); err != nil {
+		return err
+	}
+	if err := m.branch(f, in.Target); err != nil {
+		return err
+	}
+	for _, ret := range m.inference.rets[in.Target] {
+		if err := m.returnTo(in, ret); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ret returns from the subroutine whose address is in the local to every
+// jsr that calls it.
+func (m *methodVerifier) ret(f *frame, in *Instruction) error {
+	if m.inference == nil {
+		return m.errorf("%s is not supported by the type checker", InstructDisplayNameMap[in.Opcode])
+	}
+	if in.Local >= m.maxLocals {
+		return m.errorf("local variable %d out of range, max_locals is %d", in.Local, m.maxLocals)
+	}
+	address := f.locals[in.Local]
+	if address.Tag != itemReturnAddress {
+		return m.errorf("expected returnAddress in local %d, found %s", in.Local, typeName(address))
+	}
+	subroutine := int(address.Offset)
+	rets := m.inference.rets[subroutine]
+	if i := sort.SearchInts(rets, in.Offset); i == len(rets) || rets[i] != in.Offset {
+		rets = append(rets, in.Offset)
+		sort.Ints(rets)
+		m.inference.rets[subroutine] = rets
+	}
+	for i := range m.instructions {
+		caller := &m.instructions[i]
+		if (caller.Opcode == JSR || caller.Opcode == JSR_W) && caller.Target == subroutine {
+			if err := m.returnTo(caller, in.Offset); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// returnTo merges the types at a ret into the instruction after a jsr to
+// its subroutine. Locals the subroutine uses take their types at the ret;
+// the others keep the types they had at the jsr.
+func (m *methodVerifier) returnTo(caller *Instruction, ret int) error {
+	callerState, retState := m.inference.states[caller.Offset], m.inference.states[ret]
+	if callerState == nil || retState == nil {
+		return nil
+	}
+	used, err := m.subroutineLocals(caller.Target, map[int]bool{})
+	if err != nil {
+		return err
+	}
+	f := &frame{locals: append([]Type(nil), callerState.locals...), stack: retState.stack}
+	for i := range f.locals {
+		if used[i] {
+			f.locals[i] = retState.locals[i]
+		}
+	}
+	if caller.Next() == len(m.code.Code) {
+		return m.errorf("execution falls off the end of the code")
+	}
+	return m.merge(f, caller.Next())
+}
+
+// subroutineLocals returns the locals read or written by the instructions
+// of a subroutine and the subroutines it calls, found by following control
+// from its start up to its rets.
+func (m *methodVerifier) subroutineLocals(start int, active map[int]bool) (map[int]bool, error) {
+	if used, ok := m.inference.locals[start]; ok {
+		return used, nil
+	}
+	if active[start] {
+		return nil, m.errorf("recursive call to the subroutine at offset %d", start)
+	}
+	active[start] = true
+	defer delete(active, start)
+
+	used := map[int]bool{}
+	visited := map[int]bool{}
+	work := []int{start}
+	for len(work) > 0 {
+		offset := work[len(work)-1]
+		work = work[:len(work)-1]
+		in := m.at[offset]
+		if visited[offset] || in == nil {
+			continue
+		}
+		visited[offset] = true
+		if local, slots, ok := localOperand(in); ok {
+			for i := 0; i < slots; i++ {
+				used[local+i] = true
+			}
+		}
+		switch op := in.Opcode; {
+		case op == RET, op >= IRETURN && op <= RETURN, op == ATHROW:
+		case op == JSR || op == JSR_W:
+			nested, err := m.subroutineLocals(in.Target, active)
+			if err != nil {
+				return nil, err
+			}
+			for local := range nested {
+				used[local] = true
+			}
+			work = append(work, in.Next())
+		case op == GOTO || op == GOTO_W:
+			work = append(work, in.Target)
+		case op == TABLESWITCH || op == LOOKUPSWITCH:
+			work = append(append(work, in.Target), in.Targets...)
+		case op >= IFEQ && op <= IF_ACMPNE, op == IFNULL || op == IFNONNULL:
+			work = append(work, in.Target, in.Next())
+		default:
+			work = append(work, in.Next())
+		}
+	}
+	m.inference.locals[start] = used
+	return used, nil
+}
+
+// localOperand returns the local variable an instruction reads or writes
+// and the slots it takes.
+func localOperand(in *Instruction) (local, slots int, ok bool) {
+	switch op := in.Opcode; {
+	case op == LLOAD || op == DLOAD || op == LSTORE || op == DSTORE:
+		return in.Local, 2, true
+	case op >= ILOAD && op <= ALOAD, op >= ISTORE && op <= ASTORE, op == IINC, op == RET:
+		return in.Local, 1, true
+	case op >= ILOAD_0 && op <= ALOAD_3:
+		return int(op-ILOAD_0) % 4, slotsOf(int(op-ILOAD_0) / 4), true
+	case op >= ISTORE_0 && op <= ASTORE_3:
+		return int(op-ISTORE_0) % 4, slotsOf(int(op-ISTORE_0) / 4), true
+	}
+	return 0, 0, false
+}
+
+// slotsOf returns the slots taken by the i, l, f, d or a variant of an
+// instruction, by its position in that order.
+func slotsOf(variant int) int {
+	if variant == 1 || variant == 3 {
+		return 2
+	}
+	return 1
+}
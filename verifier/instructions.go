@@ -0,0 +1,554 @@
+package verifier
+
+import (
+	"encoding/binary"
+	"outro/constant"
+	. "outro/interpreter"
+	"outro/model"
+	"strings"
+)
+
+// valueTypes are the types loaded, stored and computed by the i, l, f, d
+// and a variants of an instruction, in opcode order. Reference variants
+// are checked separately.
+var valueTypes = [...]Type{intType, longType, floatType, doubleType}
+
+// conversions give the operand and result types of i2l to i2s.
+var conversions = map[Instruct][2]Type{
+	I2L: {intType, longType}, I2F: {intType, floatType}, I2D: {intType, doubleType},
+	L2I: {longType, intType}, L2F: {longType, floatType}, L2D: {longType, doubleType},
+	F2I: {floatType, intType}, F2L: {floatType, longType}, F2D: {floatType, doubleType},
+	D2I: {doubleType, intType}, D2L: {doubleType, longType}, D2F: {doubleType, floatType},
+	I2B: {intType, intType}, I2C: {intType, intType}, I2S: {intType, intType},
+}
+
+// primitiveArrays are the array classes created by newarray, by type code.
+var primitiveArrays = map[uint8]string{
+	4: "[Z", 5: "[C", 6: "[F", 7: "[D", 8: "[B", 9: "[S", 10: "[I", 11: "[J",
+}
+
+// execute applies the type rule of in to f, checking branches against their
+// targets' stack map frames. It reports whether control may continue with
+// the next instruction.
+func (m *methodVerifier) execute(f *frame, in *Instruction) (falls bool, err error) {
+	switch op := in.Opcode; {
+	case op == NOP:
+	case op == ACONST_NULL:
+		return true, m.push(f, nullType)
+	case op >= ICONST_M1 && op <= ICONST_5, op == BIPUSH, op == SIPUSH:
+		return true, m.push(f, intType)
+	case op == LCONST_0 || op == LCONST_1:
+		return true, m.push(f, longType)
+	case op >= FCONST_0 && op <= FCONST_2:
+		return true, m.push(f, floatType)
+	case op == DCONST_0 || op == DCONST_1:
+		return true, m.push(f, doubleType)
+	case op == LDC || op == LDC_W || op == LDC2_W:
+		t, err := m.constantType(in.Index)
+		if err != nil {
+			return false, err
+		}
+		if (size(t) == 2) != (op == LDC2_W) {
+			return false, m.errorf("%s of a %s constant", InstructDisplayNameMap[op], typeName(t))
+		}
+		return true, m.push(f, t)
+
+	case op >= ILOAD && op <= DLOAD:
+		return true, m.load(f, in.Local, valueTypes[op-ILOAD])
+	case op >= ILOAD_0 && op <= DLOAD_3:
+		return true, m.load(f, int(op-ILOAD_0)%4, valueTypes[(op-ILOAD_0)/4])
+	case op == ALOAD, op >= ALOAD_0 && op <= ALOAD_3:
+		index := in.Local
+		if op != ALOAD {
+			index = int(op - ALOAD_0)
+		}
+		if index >= m.maxLocals {
+			return false, m.errorf("local variable %d out of range, max_locals is %d", index, m.maxLocals)
+		}
+		if t := f.locals[index]; !isReference(t) {
+			return false, m.errorf("expected reference in local %d, found %s", index, typeName(t))
+		}
+		return true, m.push(f, f.locals[index])
+	case op >= ISTORE && op <= DSTORE:
+		return true, m.popStore(f, in.Local, valueTypes[op-ISTORE])
+	case op >= ISTORE_0 && op <= DSTORE_3:
+		return true, m.popStore(f, int(op-ISTORE_0)%4, valueTypes[(op-ISTORE_0)/4])
+	case op == ASTORE, op >= ASTORE_0 && op <= ASTORE_3:
+		index := in.Local
+		if op != ASTORE {
+			index = int(op - ASTORE_0)
+		}
+		// Only astore can move the return address of a jsr.
+		if len(f.stack) > 0 && f.peek().Tag == itemReturnAddress {
+			t := f.peek()
+			f.stack = f.stack[:len(f.stack)-1]
+			return true, m.store(f, index, t)
+		}
+		t, err := m.popReference(f)
+		if err != nil {
+			return false, err
+		}
+		return true, m.store(f, index, t)
+	case op == IINC:
+		if in.Local >= m.maxLocals {
+			return false, m.errorf("local variable %d out of range, max_locals is %d", in.Local, m.maxLocals)
+		}
+		if t := f.locals[in.Local]; t != intType {
+			return false, m.errorf("expected int in local %d, found %s", in.Local, typeName(t))
+		}
+
+	case op >= IALOAD && op <= SALOAD:
+		return true, m.arrayLoad(f, op)
+	case op >= IASTORE && op <= SASTORE:
+		return true, m.arrayStore(f, op)
+
+	case op == POP:
+		return true, m.shuffle(f, 1, []int{1})
+	case op == POP2:
+		return true, m.shuffle(f, 2, []int{2})
+	case op == DUP:
+		return true, m.shuffle(f, 1, []int{1}, 0, 0)
+	case op == DUP_X1:
+		return true, m.shuffle(f, 2, []int{1, 2}, 1, 0, 1)
+	case op == DUP_X2:
+		return true, m.shuffle(f, 3, []int{1, 3}, 2, 0, 1, 2)
+	case op == DUP2:
+		return true, m.shuffle(f, 2, []int{2}, 0, 1, 0, 1)
+	case op == DUP2_X1:
+		return true, m.shuffle(f, 3, []int{2, 3}, 1, 2, 0, 1, 2)
+	case op == DUP2_X2:
+		return true, m.shuffle(f, 4, []int{2, 4}, 2, 3, 0, 1, 2, 3)
+	case op == SWAP:
+		return true, m.shuffle(f, 2, []int{1, 2}, 1, 0)
+
+	case op >= IADD && op <= DREM:
+		t := valueTypes[(op-IADD)%4]
+		return true, m.apply(f, t, t, t)
+	case op >= INEG && op <= DNEG:
+		t := valueTypes[op-INEG]
+		return true, m.apply(f, t, t)
+	case op >= ISHL && op <= LUSHR:
+		t := valueTypes[(op-ISHL)%2]
+		return true, m.apply(f, t, t, intType)
+	case op >= IAND && op <= LXOR:
+		t := valueTypes[(op-IAND)%2]
+		return true, m.apply(f, t, t, t)
+	case op >= I2L && op <= I2S:
+		conversion := conversions[op]
+		return true, m.apply(f, conversion[1], conversion[0])
+	case op == LCMP:
+		return true, m.apply(f, intType, longType, longType)
+	case op == FCMPL || op == FCMPG:
+		return true, m.apply(f, intType, floatType, floatType)
+	case op == DCMPL || op == DCMPG:
+		return true, m.apply(f, intType, doubleType, doubleType)
+
+	case op >= IFEQ && op <= IFLE:
+		return true, m.popBranch(f, in.Target, intType)
+	case op >= IF_ICMPEQ && op <= IF_ICMPLE:
+		return true, m.popBranch(f, in.Target, intType, intType)
+	case op == IF_ACMPEQ || op == IF_ACMPNE:
+		return true, m.popBranch(f, in.Target, objectRefType, objectRefType)
+	case op == IFNULL || op == IFNONNULL:
+		return true, m.popBranch(f, in.Target, objectRefType)
+	case op == GOTO || op == GOTO_W:
+		return false, m.branch(f, in.Target)
+	case op == TABLESWITCH || op == LOOKUPSWITCH:
+		if err := m.pop(f, intType); err != nil {
+			return false, err
+		}
+		for _, target := range append([]int{in.Target}, in.Targets...) {
+			if err := m.branch(f, target); err != nil {
+				return false, err
+			}
+		}
+		return false, nil
+	case op == JSR || op == JSR_W:
+		return false, m.jsr(f, in)
+	case op == RET:
+		return false, m.ret(f, in)
+
+	case op >= IRETURN && op <= RETURN:
+		return false, m.checkReturn(f, op)
+	case op >= GETSTATIC && op <= PUTFIELD:
+		return true, m.accessField(f, op, in.Index)
+	case op >= INVOKEVIRTUAL && op <= INVOKEINTERFACE:
+		return true, m.invoke(f, in)
+	case op == INVOKEDYNAMIC:
+		return true, m.invokeDynamic(f, in.Index)
+
+	case op == NEW:
+		className, err := m.classConstant(in.Index)
+		if err != nil {
+			return false, err
+		}
+		if strings.HasPrefix(className, "[") {
+			return false, m.errorf("new of array class %s", className)
+		}
+		created := Type{Tag: constant.ItemUninitialized, Offset: uint16(in.Offset)}
+		for _, t := range f.stack {
+			if t == created {
+				return false, m.errorf("%s is already on the operand stack", typeName(created))
+			}
+		}
+		f.replace(created, topType)
+		return true, m.push(f, created)
+	case op == NEWARRAY:
+		className, ok := primitiveArrays[in.ArrayType]
+		if !ok {
+			return false, m.errorf("invalid array type %d", in.ArrayType)
+		}
+		return true, m.apply(f, objectType(className), intType)
+	case op == ANEWARRAY:
+		className, err := m.classConstant(in.Index)
+		if err != nil {
+			return false, err
+		}
+		return true, m.apply(f, objectType(arrayOf(className)), intType)
+	case op == MULTIANEWARRAY:
+		className, err := m.classConstant(in.Index)
+		if err != nil {
+			return false, err
+		}
+		if in.Count < 1 || len(className) < in.Count || strings.Count(className[:in.Count], "[") != in.Count {
+			return false, m.errorf("multianewarray of %d dimensions of %s", in.Count, className)
+		}
+		for i := 0; i < in.Count; i++ {
+			if err := m.pop(f, intType); err != nil {
+				return false, err
+			}
+		}
+		return true, m.push(f, objectType(className))
+	case op == ARRAYLENGTH:
+		if _, err := m.popArray(f, "array", 'B', 'C', 'D', 'F', 'I', 'J', 'S', 'Z', 'L'); err != nil {
+			return false, err
+		}
+		return true, m.push(f, intType)
+	case op == ATHROW:
+		return false, m.pop(f, objectType("java/lang/Throwable"))
+	case op == CHECKCAST:
+		className, err := m.classConstant(in.Index)
+		if err != nil {
+			return false, err
+		}
+		return true, m.apply(f, objectType(className), objectRefType)
+	case op == INSTANCEOF:
+		if _, err := m.classConstant(in.Index); err != nil {
+			return false, err
+		}
+		return true, m.apply(f, intType, objectRefType)
+	case op == MONITORENTER || op == MONITOREXIT:
+		return true, m.pop(f, objectRefType)
+	default:
+		return false, m.errorf("illegal opcode %s", InstructDisplayNameMap[op])
+	}
+	return true, nil
+}
+
+// apply pops operands, the last one first, and pushes result.
+func (m *methodVerifier) apply(f *frame, result Type, operands ...Type) error {
+	for i := len(operands) - 1; i >= 0; i-- {
+		if err := m.pop(f, operands[i]); err != nil {
+			return err
+		}
+	}
+	return m.push(f, result)
+}
+
+func (m *methodVerifier) popStore(f *frame, index int, t Type) error {
+	if err := m.pop(f, t); err != nil {
+		return err
+	}
+	return m.store(f, index, t)
+}
+
+func (m *methodVerifier) popBranch(f *frame, target int, operands ...Type) error {
+	for i := len(operands) - 1; i >= 0; i-- {
+		if err := m.pop(f, operands[i]); err != nil {
+			return err
+		}
+	}
+	return m.branch(f, target)
+}
+
+// arrayElements are the component descriptors accepted by the array load
+// and store instructions, the value type they move and the expected type
+// they report.
+var arrayElements = map[Instruct]struct {
+	kinds    []byte
+	value    Type
+	expected string
+}{
+	IALOAD: {[]byte{'I'}, intType, "array of int"}, IASTORE: {[]byte{'I'}, intType, "array of int"},
+	LALOAD: {[]byte{'J'}, longType, "array of long"}, LASTORE: {[]byte{'J'}, longType, "array of long"},
+	FALOAD: {[]byte{'F'}, floatType, "array of float"}, FASTORE: {[]byte{'F'}, floatType, "array of float"},
+	DALOAD: {[]byte{'D'}, doubleType, "array of double"}, DASTORE: {[]byte{'D'}, doubleType, "array of double"},
+	AALOAD: {[]byte{'L'}, objectRefType, "array of reference"}, AASTORE: {[]byte{'L'}, objectRefType, "array of reference"},
+	BALOAD: {[]byte{'B', 'Z'}, intType, "array of byte or boolean"}, BASTORE: {[]byte{'B', 'Z'}, intType, "array of byte or boolean"},
+	CALOAD: {[]byte{'C'}, intType, "array of char"}, CASTORE: {[]byte{'C'}, intType, "array of char"},
+	SALOAD: {[]byte{'S'}, intType, "array of short"}, SASTORE: {[]byte{'S'}, intType, "array of short"},
+}
+
+func (m *methodVerifier) arrayLoad(f *frame, op Instruct) error {
+	element := arrayElements[op]
+	if err := m.pop(f, intType); err != nil {
+		return err
+	}
+	component, err := m.popArray(f, element.expected, element.kinds...)
+	if err != nil {
+		return err
+	}
+	if op == AALOAD {
+		return m.push(f, component)
+	}
+	return m.push(f, element.value)
+}
+
+// arrayStore checks the value stored by aastore only to be a reference;
+// whether the array accepts it is checked at run time.
+func (m *methodVerifier) arrayStore(f *frame, op Instruct) error {
+	element := arrayElements[op]
+	if err := m.pop(f, element.value); err != nil {
+		return err
+	}
+	if err := m.pop(f, intType); err != nil {
+		return err
+	}
+	_, err := m.popArray(f, element.expected, element.kinds...)
+	return err
+}
+
+func (m *methodVerifier) checkReturn(f *frame, op Instruct) error {
+	if op == RETURN {
+		if m.returnType != "V" {
+			return m.errorf("return from a method returning %s", m.returnType)
+		}
+		if m.name == "<init>" {
+			for _, t := range f.locals {
+				if t.Tag == constant.ItemUninitializedThis {
+					return m.errorf("constructor must call super() or this() before return")
+				}
+			}
+		}
+		return nil
+	}
+	returnType := m.returnType
+	if returnType == "V" {
+		return m.errorf("%s from a void method", InstructDisplayNameMap[op])
+	}
+	want := model.FieldTypeVerificationType(returnType)
+	valueReturn := op == ARETURN
+	if !valueReturn {
+		valueReturn = want == valueTypes[op-IRETURN]
+	}
+	if !valueReturn || op == ARETURN && want.Tag != constant.ItemObject {
+		return m.errorf("%s from a method returning %s", InstructDisplayNameMap[op], returnType)
+	}
+	return m.pop(f, want)
+}
+
+// memberRef returns the class, name and descriptor of the field or method
+// reference at index, which must have one of tags.
+func (m *methodVerifier) memberRef(index int, tags ...uint8) (className, name, descriptor string, err error) {
+	if index <= 0 || index >= len(m.file.ConstantPool) {
+		return "", "", "", m.errorf("invalid constant pool index %d", index)
+	}
+	info := m.file.ConstantPool[index]
+	for _, tag := range tags {
+		if info.Tag == tag {
+			className = m.file.ClassName(binary.BigEndian.Uint16(info.Info[0:2]))
+			name, descriptor = m.file.NameAndType(binary.BigEndian.Uint16(info.Info[2:4]))
+			return className, name, descriptor, nil
+		}
+	}
+	return "", "", "", m.errorf("constant pool entry #%d has the wrong type", index)
+}
+
+func (m *methodVerifier) classConstant(index int) (string, error) {
+	if index <= 0 || index >= len(m.file.ConstantPool) || m.file.ConstantPool[index].Tag != constant.ConstantClass {
+		return "", m.errorf("constant pool entry #%d is not a class", index)
+	}
+	return m.file.ClassName(uint16(index)), nil
+}
+
+// constantType returns the type of the value loaded by ldc from index.
+func (m *methodVerifier) constantType(index int) (Type, error) {
+	if index <= 0 || index >= len(m.file.ConstantPool) {
+		return Type{}, m.errorf("invalid constant pool index %d", index)
+	}
+	info := m.file.ConstantPool[index]
+	switch info.Tag {
+	case constant.ConstantInteger:
+		return intType, nil
+	case constant.ConstantFloat:
+		return floatType, nil
+	case constant.ConstantLong:
+		return longType, nil
+	case constant.ConstantDouble:
+		return doubleType, nil
+	case constant.ConstantString:
+		return objectType("java/lang/String"), nil
+	case constant.ConstantClass:
+		return objectType("java/lang/Class"), nil
+	case constant.ConstantMethodType:
+		return objectType("java/lang/invoke/MethodType"), nil
+	case constant.ConstantMethodHandle:
+		return objectType("java/lang/invoke/MethodHandle"), nil
+	case constant.ConstantDynamic:
+		_, descriptor := m.file.NameAndType(binary.BigEndian.Uint16(info.Info[2:4]))
+		if n, err := model.ParseFieldType(descriptor); err != nil || n != len(descriptor) {
+			return Type{}, m.errorf("invalid field descriptor %q", descriptor)
+		}
+		return model.FieldTypeVerificationType(descriptor), nil
+	}
+	return Type{}, m.errorf("constant pool entry #%d is not loadable", index)
+}
+
+func (m *methodVerifier) accessField(f *frame, op Instruct, index int) error {
+	className, _, descriptor, err := m.memberRef(index, constant.ConstantFieldRef)
+	if err != nil {
+		return err
+	}
+	if n, err := model.ParseFieldType(descriptor); err != nil || n != len(descriptor) {
+		return m.errorf("invalid field descriptor %q", descriptor)
+	}
+	value := model.FieldTypeVerificationType(descriptor)
+	switch op {
+	case GETSTATIC:
+		return m.push(f, value)
+	case PUTSTATIC:
+		return m.pop(f, value)
+	case GETFIELD:
+		return m.apply(f, value, objectType(className))
+	}
+	if err := m.pop(f, value); err != nil {
+		return err
+	}
+	// A constructor may set the fields of its own class before calling
+	// super().
+	if len(f.stack) > 0 && f.peek().Tag == constant.ItemUninitializedThis && className == m.className {
+		f.stack = f.stack[:len(f.stack)-1]
+		return nil
+	}
+	return m.pop(f, objectType(className))
+}
+
+func (m *methodVerifier) invoke(f *frame, in *Instruction) error {
+	tags := []uint8{constant.ConstantMethodRef, constant.ConstantInterfaceMethodRef}
+	switch in.Opcode {
+	case INVOKEVIRTUAL:
+		tags = tags[:1]
+	case INVOKEINTERFACE:
+		tags = tags[1:]
+	}
+	className, name, descriptor, err := m.memberRef(in.Index, tags...)
+	if err != nil {
+		return err
+	}
+	if name == "<clinit>" || name == "<init>" && in.Opcode != INVOKESPECIAL {
+		return m.errorf("illegal call to %s", name)
+	}
+	parameters, returnType, err := model.ParseMethodDescriptor(descriptor)
+	if err != nil {
+		return m.errorf("invalid method descriptor %q", descriptor)
+	}
+	if in.Opcode == INVOKEINTERFACE {
+		slots := 1
+		for _, parameter := range parameters {
+			slots += model.FieldTypeSlots(parameter)
+		}
+		if in.Count != slots {
+			return m.errorf("invokeinterface count %d, arguments take %d slots", in.Count, slots)
+		}
+	}
+	if err := m.popArguments(f, parameters); err != nil {
+		return err
+	}
+	switch {
+	case in.Opcode == INVOKESTATIC:
+	case name == "<init>":
+		if returnType != "V" {
+			return m.errorf("constructor %s%s does not return void", name, descriptor)
+		}
+		receiver, err := m.popReference(f)
+		if err != nil {
+			return err
+		}
+		if err := m.initialize(f, receiver, className); err != nil {
+			return err
+		}
+	case in.Opcode == INVOKESPECIAL:
+		if err := m.pop(f, objectType(m.className)); err != nil {
+			return err
+		}
+	default:
+		if err := m.pop(f, objectType(className)); err != nil {
+			return err
+		}
+	}
+	if returnType == "V" {
+		return nil
+	}
+	return m.push(f, model.FieldTypeVerificationType(returnType))
+}
+
+func (m *methodVerifier) invokeDynamic(f *frame, index int) error {
+	if index <= 0 || index >= len(m.file.ConstantPool) || m.file.ConstantPool[index].Tag != constant.ConstantInvokeDynamic {
+		return m.errorf("constant pool entry #%d is not a call site", index)
+	}
+	name, descriptor := m.file.NameAndType(binary.BigEndian.Uint16(m.file.ConstantPool[index].Info[2:4]))
+	if name == "<init>" || name == "<clinit>" {
+		return m.errorf("illegal call to %s", name)
+	}
+	parameters, returnType, err := model.ParseMethodDescriptor(descriptor)
+	if err != nil {
+		return m.errorf("invalid method descriptor %q", descriptor)
+	}
+	if err := m.popArguments(f, parameters); err != nil {
+		return err
+	}
+	if returnType == "V" {
+		return nil
+	}
+	return m.push(f, model.FieldTypeVerificationType(returnType))
+}
+
+func (m *methodVerifier) popArguments(f *frame, parameters []string) error {
+	for i := len(parameters) - 1; i >= 0; i-- {
+		if err := m.pop(f, model.FieldTypeVerificationType(parameters[i])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// initialize marks the object a constructor of className was called on as
+// initialized, everywhere in the frame. An object made by new must be of
+// that class; this, in a constructor, of the class or its superclass.
+func (m *methodVerifier) initialize(f *frame, receiver Type, className string) error {
+	var initialized Type
+	switch receiver.Tag {
+	case constant.ItemUninitialized:
+		created := m.at[int(receiver.Offset)]
+		if created == nil || created.Opcode != NEW {
+			return m.errorf("%s is not created by new", typeName(receiver))
+		}
+		newClass, err := m.classConstant(created.Index)
+		if err != nil {
+			return err
+		}
+		if newClass != className {
+			return m.errorf("call to %s.<init> on %s of %s", className, typeName(receiver), newClass)
+		}
+		initialized = objectType(newClass)
+	case constant.ItemUninitializedThis:
+		if className != m.className && className != m.file.ClassName(m.file.SuperClass) {
+			return m.errorf("call to %s.<init> on this of %s", className, m.className)
+		}
+		initialized = objectType(m.className)
+	default:
+		return m.mismatch("uninitialized object", receiver)
+	}
+	f.replace(receiver, initialized)
+	return nil
+}
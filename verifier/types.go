@@ -0,0 +1,180 @@
+package verifier
+
+import (
+	"fmt"
+	"outro/constant"
+	"outro/model"
+	"strings"
+)
+
+// Type is a verification type. Object types name a class or, in
+// descriptor form, an array class; Uninitialized types carry the offset of
+// their new instruction.
+type Type = model.VerificationTypeInfo
+
+var (
+	topType       = Type{Tag: constant.ItemTop}
+	intType       = Type{Tag: constant.ItemInteger}
+	floatType     = Type{Tag: constant.ItemFloat}
+	longType      = Type{Tag: constant.ItemLong}
+	doubleType    = Type{Tag: constant.ItemDouble}
+	nullType      = Type{Tag: constant.ItemNull}
+	objectRefType = objectType("java/lang/Object")
+)
+
+func objectType(className string) Type {
+	return Type{Tag: constant.ItemObject, ClassName: className}
+}
+
+// normalize drops the constant pool index of a type read from a stack map
+// frame, so that equal types compare equal.
+func normalize(t Type) Type {
+	switch t.Tag {
+	case constant.ItemObject:
+		return objectType(t.ClassName)
+	case constant.ItemUninitialized:
+		return Type{Tag: t.Tag, Offset: t.Offset}
+	}
+	return Type{Tag: t.Tag}
+}
+
+// size returns the number of local variable or operand stack slots a value
+// of type t takes.
+func size(t Type) int {
+	if t.Tag == constant.ItemLong || t.Tag == constant.ItemDouble {
+		return 2
+	}
+	return 1
+}
+
+func isReference(t Type) bool {
+	switch t.Tag {
+	case constant.ItemObject, constant.ItemNull, constant.ItemUninitialized, constant.ItemUninitializedThis:
+		return true
+	}
+	return false
+}
+
+// typeName names t the way it appears in verify errors.
+func typeName(t Type) string {
+	switch t.Tag {
+	case constant.ItemTop:
+		return "top"
+	case constant.ItemInteger:
+		return "int"
+	case constant.ItemFloat:
+		return "float"
+	case constant.ItemLong:
+		return "long"
+	case constant.ItemDouble:
+		return "double"
+	case constant.ItemNull:
+		return "null"
+	case constant.ItemUninitializedThis:
+		return "uninitializedThis"
+	case constant.ItemUninitialized:
+		return fmt.Sprintf("uninitialized(%d)", t.Offset)
+	case constant.ItemObject:
+		return t.ClassName
+	case itemReturnAddress:
+		return fmt.Sprintf("returnAddress(%d)", t.Offset)
+	}
+	return fmt.Sprintf("type(%d)", t.Tag)
+}
+
+// arrayOf returns the array class whose components are of the class or
+// array class named className.
+func arrayOf(className string) string {
+	if strings.HasPrefix(className, "[") {
+		return "[" + className
+	}
+	return "[L" + className + ";"
+}
+
+// componentName returns the class or array class of the components of a
+// reference array, given the component descriptor.
+func componentName(descriptor string) string {
+	if strings.HasPrefix(descriptor, "L") {
+		return descriptor[1 : len(descriptor)-1]
+	}
+	return descriptor
+}
+
+// isAssignable reports whether a value of type from may be used where type
+// to is expected, loading classes to walk their superclasses if needed.
+// https://docs.oracle.com/javase/specs/jvms/se8/html/jvms-4.html#jvms-4.10.1.2
+func (c *classVerifier) isAssignable(from, to Type) (bool, error) {
+	if from == to || to.Tag == constant.ItemTop {
+		return true, nil
+	}
+	if to.Tag != constant.ItemObject {
+		return false, nil
+	}
+	switch from.Tag {
+	case constant.ItemNull:
+		return true, nil
+	case constant.ItemObject:
+		return c.isSubclass(from.ClassName, to.ClassName)
+	}
+	return false, nil
+}
+
+// isSubclass reports whether the class or array class from may be assigned
+// to the class or array class to. Every class may be assigned to an
+// interface; the check is left to invokeinterface at run time.
+func (c *classVerifier) isSubclass(from, to string) (bool, error) {
+	if from == to || to == "java/lang/Object" {
+		return true, nil
+	}
+	if strings.HasPrefix(to, "[") {
+		if !strings.HasPrefix(from, "[") {
+			return false, nil
+		}
+		fromComponent, toComponent := from[1:], to[1:]
+		if !isReferenceDescriptor(fromComponent) || !isReferenceDescriptor(toComponent) {
+			return false, nil
+		}
+		return c.isSubclass(componentName(fromComponent), componentName(toComponent))
+	}
+	if strings.HasPrefix(from, "[") {
+		return to == "java/lang/Cloneable" || to == "java/io/Serializable", nil
+	}
+	access, _, err := c.classInfo(to)
+	if err != nil {
+		return false, err
+	}
+	if access&uint16(constant.CLASS_ACC_INTERFACE) != 0 {
+		return true, nil
+	}
+	for name := from; name != "java/lang/Object"; {
+		_, superName, err := c.classInfo(name)
+		if err != nil {
+			return false, err
+		}
+		if superName == to {
+			return true, nil
+		}
+		if superName == "" {
+			break
+		}
+		name = superName
+	}
+	return false, nil
+}
+
+func isReferenceDescriptor(descriptor string) bool {
+	return strings.HasPrefix(descriptor, "L") || strings.HasPrefix(descriptor, "[")
+}
+
+// classInfo returns the access flags and superclass of a class, taken from
+// the class being verified or else loaded.
+func (c *classVerifier) classInfo(className string) (access uint16, superName string, err error) {
+	if className == c.className {
+		return c.file.AccessFlags, c.file.ClassName(c.file.SuperClass), nil
+	}
+	class, err := c.loader.LoadClass(className)
+	if err != nil {
+		return 0, "", err
+	}
+	return class.AccessFlag, class.SuperClassName, nil
+}
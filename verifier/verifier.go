@@ -0,0 +1,303 @@
+// Package verifier checks the bytecode of a class before it runs, so that
+// the interpreter never sees an operand of the wrong type, a stack that
+// overflows or a local variable out of range.
+//
+// Class files of version 50 and later are verified by type checking: each
+// instruction is checked against the types in the StackMapTable frames
+// instead of inferring them.
+// https://docs.oracle.com/javase/specs/jvms/se8/html/jvms-4.html#jvms-4.10.1
+//
+// Older class files have no StackMapTable, so their types are inferred by
+// data-flow analysis, which also follows jsr and ret subroutines.
+// https://docs.oracle.com/javase/specs/jvms/se8/html/jvms-4.html#jvms-4.10.2
+//
+// The same inference computes the StackMapTable of generated or rewritten
+// code, see ComputeFrames.
+package verifier
+
+import (
+	"fmt"
+	"outro/constant"
+	"outro/interpreter"
+	"outro/model"
+	"outro/rtda"
+)
+
+// TypeCheckingVersion is the first class file major version verified by
+// type checking.
+const TypeCheckingVersion = 50
+
+// VerifyError reports code that fails verification. Offset is -1 for
+// errors about the method as a whole.
+type VerifyError struct {
+	Class      string
+	Method     string
+	Descriptor string
+	Offset     int
+	Reason     string
+}
+
+func (e *VerifyError) Error() string {
+	location := fmt.Sprintf("%s.%s%s", e.Class, e.Method, e.Descriptor)
+	if e.Offset >= 0 {
+		location += fmt.Sprintf(" at offset %d", e.Offset)
+	}
+	return fmt.Sprintf("java.lang.VerifyError: %s: %s", location, e.Reason)
+}
+
+// Verifier verifies the classes of a class loader, which it uses to load
+// the classes whose hierarchy decides whether one type is assignable to
+// another.
+type Verifier struct {
+	loader rtda.ClassLoader
+}
+
+func New(loader rtda.ClassLoader) *Verifier {
+	return &Verifier{loader: loader}
+}
+
+// Verify checks every method of a class file.
+func (v *Verifier) Verify(file *model.ClassFile) error {
+	c := &classVerifier{file: file, loader: v.loader, className: file.ClassName(file.ThisClass)}
+	for i := range file.Methods {
+		if err := c.verifyMethod(&file.Methods[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type classVerifier struct {
+	file      *model.ClassFile
+	loader    rtda.ClassLoader
+	className string
+}
+
+// methodVerifier holds the state of verifying one method.
+type methodVerifier struct {
+	*classVerifier
+	name       string
+	descriptor string
+	returnType string
+	maxStack   int
+	maxLocals  int
+	code       *model.CodeAttributeInfo
+	// instructions are indexed by offset in at.
+	instructions []interpreter.Instruction
+	at           map[int]*interpreter.Instruction
+	// frames are the stack map frames by offset.
+	frames map[int]*frame
+	// inference is set while types are inferred rather than checked.
+	inference *inference
+	// offset is the instruction being checked.
+	offset int
+}
+
+func (c *classVerifier) verifyMethod(info *model.MethodInfo) error {
+	code, ok := info.Attributes.Get("Code").(*model.CodeAttributeInfo)
+	if !ok {
+		return nil
+	}
+	m, err := c.newMethodVerifier(info, code)
+	if err != nil {
+		return err
+	}
+	initial, err := m.initialFrame(info)
+	if err != nil {
+		return err
+	}
+	if c.file.MajorVersion < TypeCheckingVersion {
+		return m.inferTypes(initial)
+	}
+	err = m.checkTypes(initial.clone())
+	if err != nil && c.file.MajorVersion == TypeCheckingVersion {
+		// Version 50 class files may still come from compilers that do not
+		// write a StackMapTable, so they fail over to type inference.
+		m.offset = -1
+		return m.inferTypes(initial)
+	}
+	return err
+}
+
+// newMethodVerifier decodes the code of a method and checks that its
+// exception handlers cover whole instructions.
+func (c *classVerifier) newMethodVerifier(info *model.MethodInfo, code *model.CodeAttributeInfo) (*methodVerifier, error) {
+	m := &methodVerifier{
+		classVerifier: c,
+		name:          c.file.Utf8(info.NameIndex),
+		descriptor:    c.file.Utf8(info.DescriptorIndex),
+		maxStack:      int(code.MaxStack),
+		maxLocals:     int(code.MaxLocals),
+		code:          code,
+		offset:        -1,
+	}
+	_, returnType, err := model.ParseMethodDescriptor(m.descriptor)
+	if err != nil {
+		return nil, m.errorf("invalid descriptor: %v", err)
+	}
+	m.returnType = returnType
+	if m.instructions, err = interpreter.Decode(code.Code); err != nil {
+		return nil, m.errorf("%v", err)
+	}
+	if len(m.instructions) == 0 {
+		return nil, m.errorf("code is empty")
+	}
+	m.at = make(map[int]*interpreter.Instruction, len(m.instructions))
+	for i := range m.instructions {
+		m.at[m.instructions[i].Offset] = &m.instructions[i]
+	}
+	for _, handler := range code.ExceptionTable {
+		if m.at[int(handler.StartPC)] == nil || m.at[int(handler.HandlerPC)] == nil ||
+			handler.StartPC >= handler.EndPC || int(handler.EndPC) > len(code.Code) ||
+			m.at[int(handler.EndPC)] == nil && int(handler.EndPC) != len(code.Code) {
+			return nil, m.errorf("invalid exception handler [%d, %d) -> %d", handler.StartPC, handler.EndPC, handler.HandlerPC)
+		}
+	}
+	return m, nil
+}
+
+// initialFrame returns the types on entry to the method: the receiver and
+// the parameters.
+func (m *methodVerifier) initialFrame(info *model.MethodInfo) (*frame, error) {
+	static := info.AccessFlags&uint16(constant.METHOD_ACC_STATIC) != 0
+	locals, err := model.InitialFrameLocals(m.className, m.name, m.descriptor, static)
+	if err != nil {
+		return nil, m.errorf("%v", err)
+	}
+	return m.newFrame(locals, nil)
+}
+
+// readFrames expands the StackMapTable frames into slots.
+func (m *methodVerifier) readFrames() error {
+	m.frames = map[int]*frame{}
+	table, ok := m.code.Attributes.Get("StackMapTable").(*model.StackMapTableAttributeInfo)
+	if !ok {
+		return nil
+	}
+	for _, state := range table.Frames {
+		offset := int(state.Offset)
+		if m.at[offset] == nil {
+			return m.errorf("stack map frame at offset %d is not at an instruction", offset)
+		}
+		m.offset = offset
+		f, err := m.newFrame(state.Locals, state.Stack)
+		if err != nil {
+			return err
+		}
+		m.frames[offset] = f
+	}
+	m.offset = -1
+	return nil
+}
+
+// checkTypes checks the instructions in code order. The frame flows from
+// each instruction into the next unless control cannot pass there; a stack
+// map frame then has to say what the next instruction starts with.
+func (m *methodVerifier) checkTypes(current *frame) error {
+	if err := m.readFrames(); err != nil {
+		return err
+	}
+	for i := range m.instructions {
+		in := &m.instructions[i]
+		m.offset = in.Offset
+		if mapped, ok := m.frames[in.Offset]; ok {
+			if current != nil {
+				if err := m.checkFrame(current, mapped, in.Offset); err != nil {
+					return err
+				}
+			}
+			current = mapped.clone()
+		} else if current == nil {
+			return m.errorf("expecting a stack map frame")
+		}
+		if err := m.checkHandlers(current); err != nil {
+			return err
+		}
+		falls, err := m.execute(current, in)
+		if err != nil {
+			return err
+		}
+		if !falls {
+			current = nil
+		}
+	}
+	if current != nil {
+		return m.errorf("execution falls off the end of the code")
+	}
+	return nil
+}
+
+// checkHandlers checks that the handlers covering the current instruction
+// accept its locals with the caught exception on the stack.
+func (m *methodVerifier) checkHandlers(current *frame) error {
+	for _, handler := range m.code.ExceptionTable {
+		if m.offset < int(handler.StartPC) || m.offset >= int(handler.EndPC) {
+			continue
+		}
+		catchType := "java/lang/Throwable"
+		if handler.CatchType != 0 {
+			if catchType = m.file.ClassName(handler.CatchType); catchType == "" {
+				return m.errorf("invalid catch type #%d", handler.CatchType)
+			}
+		}
+		thrown := &frame{locals: current.locals, stack: []Type{objectType(catchType)}}
+		if err := m.branch(thrown, int(handler.HandlerPC)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// branch checks that f is assignable to the stack map frame at target, or
+// merges it into the types inferred there.
+func (m *methodVerifier) branch(f *frame, target int) error {
+	if m.inference != nil {
+		return m.merge(f, target)
+	}
+	mapped, ok := m.frames[target]
+	if !ok {
+		return m.errorf("expecting a stack map frame at branch target %d", target)
+	}
+	return m.checkFrame(f, mapped, target)
+}
+
+// checkFrame checks that each local and stack slot of f is assignable to
+// the one of the stack map frame at offset.
+func (m *methodVerifier) checkFrame(f, mapped *frame, offset int) error {
+	if len(f.stack) != len(mapped.stack) {
+		return m.errorf("expected stack height %d of the stack map frame at offset %d, found %d",
+			len(mapped.stack), offset, len(f.stack))
+	}
+	for i, t := range f.locals {
+		if ok, err := m.isAssignable(t, mapped.locals[i]); err != nil {
+			return err
+		} else if !ok {
+			return m.errorf("expected %s in local %d of the stack map frame at offset %d, found %s",
+				typeName(mapped.locals[i]), i, offset, typeName(t))
+		}
+	}
+	for i, t := range f.stack {
+		if ok, err := m.isAssignable(t, mapped.stack[i]); err != nil {
+			return err
+		} else if !ok {
+			return m.errorf("expected %s in stack slot %d of the stack map frame at offset %d, found %s",
+				typeName(mapped.stack[i]), i, offset, typeName(t))
+		}
+	}
+	return nil
+}
+
+func (m *methodVerifier) errorf(format string, args ...interface{}) error {
+	return &VerifyError{
+		Class:      m.className,
+		Method:     m.name,
+		Descriptor: m.descriptor,
+		Offset:     m.offset,
+		Reason:     fmt.Sprintf(format, args...),
+	}
+}
+
+// mismatch reports a value of the wrong type.
+func (m *methodVerifier) mismatch(expected string, found Type) error {
+	return m.errorf("expected %s, found %s", expected, typeName(found))
+}
@@ -0,0 +1,222 @@
+package visitor
+
+import (
+	"outro/model"
+)
+
+// annotations collects the annotations and type annotations visited on a
+// class, field, method or record component until they are added as
+// attributes at VisitEnd.
+type annotations struct {
+	visible, invisible           []model.AnnotationInfo
+	visibleTypes, invisibleTypes []model.TypeAnnotationInfo
+}
+
+func (a *annotations) visit(class *ClassWriter, descriptor string, visible bool) AnnotationVisitor {
+	annotation := &model.AnnotationInfo{TypeIndex: class.class.Pool().Utf8(descriptor)}
+	return &annotationWriter{
+		class:   class,
+		element: elementValuePairs(class, annotation),
+		end: func() {
+			if visible {
+				a.visible = append(a.visible, *annotation)
+			} else {
+				a.invisible = append(a.invisible, *annotation)
+			}
+		},
+	}
+}
+
+// visitType visits a type annotation outside code.
+func (a *annotations) visitType(class *ClassWriter, ref TypeReference, path []TypePathStep, descriptor string, visible bool) AnnotationVisitor {
+	return typeAnnotation(class, ref, path, descriptor, func(annotation model.TypeAnnotationInfo) {
+		annotation.TargetInfo = targetInfo(ref, nil)
+		if visible {
+			a.visibleTypes = append(a.visibleTypes, annotation)
+		} else {
+			a.invisibleTypes = append(a.invisibleTypes, annotation)
+		}
+	})
+}
+
+func (a *annotations) add(attribute func(name string, value interface{})) {
+	if len(a.visible) > 0 {
+		attribute("RuntimeVisibleAnnotations", &model.RuntimeVisibleAnnotationsAttributeInfo{Annotations: a.visible})
+	}
+	if len(a.invisible) > 0 {
+		attribute("RuntimeInvisibleAnnotations", &model.RuntimeInvisibleAnnotationsAttributeInfo{Annotations: a.invisible})
+	}
+	if len(a.visibleTypes) > 0 {
+		attribute("RuntimeVisibleTypeAnnotations", &model.RuntimeVisibleTypeAnnotationsAttributeInfo{Annotations: a.visibleTypes})
+	}
+	if len(a.invisibleTypes) > 0 {
+		attribute("RuntimeInvisibleTypeAnnotations", &model.RuntimeInvisibleTypeAnnotationsAttributeInfo{Annotations: a.invisibleTypes})
+	}
+}
+
+// typeAnnotation returns the visitor of a type annotation, which end
+// receives without its TargetInfo.
+func typeAnnotation(class *ClassWriter, ref TypeReference, path []TypePathStep, descriptor string, end func(model.TypeAnnotationInfo)) AnnotationVisitor {
+	annotation := &model.AnnotationInfo{TypeIndex: class.class.Pool().Utf8(descriptor)}
+	steps := make([]model.TypePathEntry, len(path))
+	for i, step := range path {
+		steps[i] = model.TypePathEntry{TypePathKind: step.Kind, TypeArgumentIndex: step.TypeArgument}
+	}
+	return &annotationWriter{
+		class:   class,
+		element: elementValuePairs(class, annotation),
+		end: func() {
+			end(model.TypeAnnotationInfo{
+				TargetType:           ref.Sort,
+				TargetPath:           steps,
+				TypeIndex:            annotation.TypeIndex,
+				NumElementValuePairs: annotation.NumElementValuePairs,
+				ElementValuePairs:    annotation.ElementValuePairs,
+			})
+		},
+	}
+}
+
+// targetInfo returns the target_info of ref, with offset giving the
+// offsets of the labels of a target in code.
+func targetInfo(ref TypeReference, offset func(*Label) int) model.TargetInfo {
+	info := model.TargetInfo{
+		TypeParameterIndex:   ref.TypeParameter,
+		BoundIndex:           ref.Bound,
+		SupertypeIndex:       ref.Supertype,
+		FormalParameterIndex: ref.FormalParameter,
+		ThrowsTypeIndex:      ref.Throws,
+		ExceptionTableIndex:  ref.TryCatchBlock,
+		TypeArgumentIndex:    ref.TypeArgument,
+	}
+	if offset == nil {
+		return info
+	}
+	for _, r := range ref.Ranges {
+		start := offset(r.Start)
+		info.Table = append(info.Table, model.LocalVarTargetInfo{
+			StartPC: uint16(start),
+			Length:  uint16(offset(r.End) - start),
+			Index:   uint16(r.Index),
+		})
+	}
+	if ref.Label != nil {
+		info.Offset = uint16(offset(ref.Label))
+	}
+	return info
+}
+
+// parameterAnnotations collects the visible or invisible annotations of
+// the parameters of a method.
+type parameterAnnotations struct {
+	count      int
+	parameters []model.ParameterAnnotationInfo
+}
+
+func (p *parameterAnnotations) visit(class *ClassWriter, parameter int, descriptor string) AnnotationVisitor {
+	annotation := &model.AnnotationInfo{TypeIndex: class.class.Pool().Utf8(descriptor)}
+	return &annotationWriter{
+		class:   class,
+		element: elementValuePairs(class, annotation),
+		end: func() {
+			for len(p.parameters) <= parameter {
+				p.parameters = append(p.parameters, model.ParameterAnnotationInfo{})
+			}
+			p.parameters[parameter].Annotations = append(p.parameters[parameter].Annotations, *annotation)
+		},
+	}
+}
+
+// table returns the annotations of count parameters, or of as many as were
+// annotated if that is more.
+func (p *parameterAnnotations) table() []model.ParameterAnnotationInfo {
+	for len(p.parameters) < p.count {
+		p.parameters = append(p.parameters, model.ParameterAnnotationInfo{})
+	}
+	return p.parameters
+}
+
+// elementValuePairs returns the element function of an annotation.
+func elementValuePairs(class *ClassWriter, annotation *model.AnnotationInfo) func(string, model.ElementValue) {
+	return func(name string, value model.ElementValue) {
+		annotation.ElementValuePairs = append(annotation.ElementValuePairs, model.ElementValuePair{
+			ElementNameIndex: class.class.Pool().Utf8(name),
+			Value:            value,
+		})
+		annotation.NumElementValuePairs = uint16(len(annotation.ElementValuePairs))
+	}
+}
+
+// annotationWriter turns the values it visits into element values, which
+// element receives, and calls end at VisitEnd.
+type annotationWriter struct {
+	class   *ClassWriter
+	element func(name string, value model.ElementValue)
+	end     func()
+}
+
+func (a *annotationWriter) Visit(name string, value interface{}) {
+	pool := a.class.class.Pool()
+	var element model.ElementValue
+	switch v := value.(type) {
+	case int8:
+		element = model.ElementValue{Tag: 'B', ConstValueIndex: pool.Integer(int32(v))}
+	case uint16:
+		element = model.ElementValue{Tag: 'C', ConstValueIndex: pool.Integer(int32(v))}
+	case int16:
+		element = model.ElementValue{Tag: 'S', ConstValueIndex: pool.Integer(int32(v))}
+	case bool:
+		var z int32
+		if v {
+			z = 1
+		}
+		element = model.ElementValue{Tag: 'Z', ConstValueIndex: pool.Integer(z)}
+	case int32:
+		element = model.ElementValue{Tag: 'I', ConstValueIndex: pool.Integer(v)}
+	case int64:
+		element = model.ElementValue{Tag: 'J', ConstValueIndex: pool.Long(v)}
+	case float32:
+		element = model.ElementValue{Tag: 'F', ConstValueIndex: pool.Float(v)}
+	case float64:
+		element = model.ElementValue{Tag: 'D', ConstValueIndex: pool.Double(v)}
+	case string:
+		element = model.ElementValue{Tag: 's', ConstValueIndex: pool.Utf8(v)}
+	case ClassValue:
+		element = model.ElementValue{Tag: 'c', ClassInfoIndex: pool.Utf8(string(v))}
+	default:
+		a.class.fail("annotation element %s cannot have a value of type %T", name, value)
+		return
+	}
+	a.element(name, element)
+}
+
+func (a *annotationWriter) VisitEnum(name, descriptor, value string) {
+	pool := a.class.class.Pool()
+	a.element(name, model.ElementValue{Tag: 'e', TypeNameIndex: pool.Utf8(descriptor), ConstNameIndex: pool.Utf8(value)})
+}
+
+func (a *annotationWriter) VisitAnnotation(name, descriptor string) AnnotationVisitor {
+	annotation := &model.AnnotationInfo{TypeIndex: a.class.class.Pool().Utf8(descriptor)}
+	return &annotationWriter{
+		class:   a.class,
+		element: elementValuePairs(a.class, annotation),
+		end: func() {
+			a.element(name, model.ElementValue{Tag: '@', AnnotationValue: annotation})
+		},
+	}
+}
+
+func (a *annotationWriter) VisitArray(name string) AnnotationVisitor {
+	values := []model.ElementValue{}
+	return &annotationWriter{
+		class:   a.class,
+		element: func(_ string, value model.ElementValue) { values = append(values, value) },
+		end:     func() { a.element(name, model.ElementValue{Tag: '[', ArrayValue: values}) },
+	}
+}
+
+func (a *annotationWriter) VisitEnd() {
+	if a.end != nil {
+		a.end()
+	}
+}
@@ -0,0 +1,88 @@
+package visitor
+
+import (
+	"outro/model"
+)
+
+// moduleWriter builds the Module, ModulePackages and ModuleMainClass
+// attributes of a module-info class.
+type moduleWriter struct {
+	class     *ClassWriter
+	module    model.ModuleInfo
+	packages  []uint16
+	mainClass uint16
+}
+
+func (m *moduleWriter) modules(names []string) []uint16 {
+	indexes := make([]uint16, len(names))
+	for i, name := range names {
+		indexes[i] = m.class.class.Pool().Module(name)
+	}
+	return indexes
+}
+
+func (m *moduleWriter) VisitMainClass(mainClass string) {
+	m.mainClass = m.class.class.Pool().Class(mainClass)
+}
+
+func (m *moduleWriter) VisitPackage(packageName string) {
+	m.packages = append(m.packages, m.class.class.Pool().Package(packageName))
+}
+
+func (m *moduleWriter) VisitRequire(module string, access uint16, version string) {
+	pool := m.class.class.Pool()
+	requires := model.RequiresInfo{RequiresIndex: pool.Module(module), RequiresFlags: access}
+	if version != "" {
+		requires.RequiresVersion = pool.Utf8(version)
+	}
+	m.module.Requires = append(m.module.Requires, requires)
+}
+
+func (m *moduleWriter) VisitExport(packageName string, access uint16, modules ...string) {
+	m.module.Exports = append(m.module.Exports, model.ExportsInfo{
+		ExportsIndex:   m.class.class.Pool().Package(packageName),
+		ExportsFlags:   access,
+		ExportsToCount: uint16(len(modules)),
+		ExportsToIndex: m.modules(modules),
+	})
+}
+
+func (m *moduleWriter) VisitOpen(packageName string, access uint16, modules ...string) {
+	m.module.Opens = append(m.module.Opens, model.OpensInfo{
+		OpensIndex:   m.class.class.Pool().Package(packageName),
+		OpensFlags:   access,
+		OpensToCount: uint16(len(modules)),
+		OpensToIndex: m.modules(modules),
+	})
+}
+
+func (m *moduleWriter) VisitUse(service string) {
+	m.module.Uses = append(m.module.Uses, model.UsesInfo{UsesIndex: m.class.class.Pool().Class(service)})
+}
+
+func (m *moduleWriter) VisitProvide(service string, providers ...string) {
+	pool := m.class.class.Pool()
+	with := make([]uint16, len(providers))
+	for i, provider := range providers {
+		with[i] = pool.Class(provider)
+	}
+	m.module.Provides = append(m.module.Provides, model.ProvidesInfo{
+		ProvidesIndex:     pool.Class(service),
+		ProvidesWithCount: uint16(len(with)),
+		ProvidesWithIndex: with,
+	})
+}
+
+func (m *moduleWriter) VisitEnd() {
+	w := m.class.class
+	w.Attribute("Module", &model.ModuleAttributeInfo{ModuleInfo: m.module})
+	if len(m.packages) > 0 {
+		w.Attribute("ModulePackages", &model.ModulePackagesAttributeInfo{
+			PackageCount: uint16(len(m.packages)),
+			PackageIndex: m.packages,
+		})
+	}
+	if m.mainClass != 0 {
+		w.Attribute("ModuleMainClass", &model.ModuleMainClassAttributeInfo{MainClassIndex: m.mainClass})
+	}
+}
@@ -0,0 +1,722 @@
+package visitor
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"outro/constant"
+	"outro/interpreter"
+	"outro/model"
+	"outro/parser"
+)
+
+// ClassReader parses a class file as it visits it. The header and the class
+// attributes, which hold the signature and bootstrap methods members refer
+// to, are parsed up front; each field and method is parsed from the class
+// file only when its turn comes to be visited.
+type ClassReader struct {
+	parser *parser.ClassFileParser
+	reader *parser.ByteReader
+	// file holds the header and the class attributes.
+	file *model.ClassFile
+	// members is the offset of the fields.
+	members int
+	err     error
+}
+
+// NewClassReader parses the header and attributes of a class file for
+// reading; errors in its fields and methods are reported by Accept.
+func NewClassReader(data []byte) (*ClassReader, error) {
+	reader := parser.NewByteReader(data)
+	p := parser.NewClassFileParser(reader)
+	file, err := p.ParseHeader()
+	if err != nil {
+		return nil, err
+	}
+	r := &ClassReader{parser: p, reader: reader, file: file, members: reader.Offset()}
+	for i := 0; i < 2; i++ {
+		count := reader.ReadUint16()
+		for j := 0; j < int(count) && reader.Err() == nil; j++ {
+			p.SkipMember()
+		}
+	}
+	count := reader.ReadUint16()
+	for i := 0; i < int(count) && reader.Err() == nil; i++ {
+		file.Attributes = append(file.Attributes, p.ParseAttribute())
+	}
+	if err := p.ParseEnd(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// ClassName returns the name of the class, for choosing how to visit it.
+func (r *ClassReader) ClassName() string {
+	return r.file.ClassName(r.file.ThisClass)
+}
+
+// Accept makes v visit the class. A malformed field or method ends the
+// events before it, without VisitEnd, and its error is returned; the first
+// malformed constant pool reference is returned after the remaining events
+// have been visited.
+func (r *ClassReader) Accept(v ClassVisitor) error {
+	r.err = nil
+	if err := r.reader.Err(); err != nil {
+		return err
+	}
+	file := r.file
+	superName := ""
+	if file.SuperClass != 0 {
+		superName = file.ClassName(file.SuperClass)
+	}
+	interfaces := make([]string, len(file.Interfaces))
+	for i, index := range file.Interfaces {
+		interfaces[i] = file.ClassName(index)
+	}
+	v.Visit(file.MajorVersion, file.MinorVersion, file.AccessFlags, file.ClassName(file.ThisClass),
+		r.signature(file.Attributes), superName, interfaces)
+
+	if source, ok := file.Attributes.Get("SourceFile").(*model.SourceFileAttributeInfo); ok {
+		v.VisitSource(file.Utf8(source.SourceFileIndex))
+	}
+	r.module(v)
+	if enclosing, ok := file.Attributes.Get("EnclosingMethod").(*model.EnclosingMethodAttributeInfo); ok {
+		name, descriptor := "", ""
+		if enclosing.MethodIndex != 0 {
+			name, descriptor = file.NameAndType(enclosing.MethodIndex)
+		}
+		v.VisitOuterClass(file.ClassName(enclosing.ClassIndex), name, descriptor)
+	}
+	if host, ok := file.Attributes.Get("NestHost").(*model.NestHostAttributeInfo); ok {
+		v.VisitNestHost(file.ClassName(host.ClassIndex))
+	}
+	r.annotations(file.Attributes, v.VisitAnnotation)
+	r.typeAnnotations(file.Attributes, nil, v.VisitTypeAnnotation)
+	r.attributes(file.Attributes, classEvents, v.VisitAttribute)
+	if inner, ok := file.Attributes.Get("InnerClasses").(*model.InnerClassesAttributeInfo); ok {
+		for _, class := range inner.Classes {
+			outerName := ""
+			if class.OuterClassInfoIndex != 0 {
+				outerName = file.ClassName(class.OuterClassInfoIndex)
+			}
+			v.VisitInnerClass(file.ClassName(class.InnerClassInfoIndex), outerName,
+				file.Utf8(class.InnerNameIndex), class.InnerClassAccessFlagsInfo)
+		}
+	}
+	if members, ok := file.Attributes.Get("NestMembers").(*model.NestMembersAttributeInfo); ok {
+		for _, index := range members.Classes {
+			v.VisitNestMember(file.ClassName(index))
+		}
+	}
+	if permitted, ok := file.Attributes.Get("PermittedSubclasses").(*model.PermittedSubclassesAttributeInfo); ok {
+		for _, index := range permitted.Classes {
+			v.VisitPermittedSubclass(file.ClassName(index))
+		}
+	}
+	if record, ok := file.Attributes.Get("Record").(*model.RecordAttributeInfo); ok {
+		for i := range record.Components {
+			r.recordComponent(v, &record.Components[i])
+		}
+	}
+
+	r.reader.Seek(r.members)
+	count := r.reader.ReadUint16()
+	for i := 0; i < int(count); i++ {
+		field := r.parser.ParseField()
+		if err := r.reader.Err(); err != nil {
+			return err
+		}
+		r.field(v, &field)
+	}
+	count = r.reader.ReadUint16()
+	for i := 0; i < int(count); i++ {
+		method := r.parser.ParseMethod()
+		if err := r.reader.Err(); err != nil {
+			return err
+		}
+		r.method(v, &method)
+	}
+	v.VisitEnd()
+	return r.err
+}
+
+func (r *ClassReader) fail(format string, args ...interface{}) {
+	if r.err == nil {
+		r.err = fmt.Errorf("%s: %s", r.ClassName(), fmt.Sprintf(format, args...))
+	}
+}
+
+// The attributes each structure has events for; the others are visited
+// with VisitAttribute.
+var (
+	classEvents = events("SourceFile", "Module", "ModulePackages", "ModuleMainClass", "EnclosingMethod",
+		"NestHost", "InnerClasses", "NestMembers", "PermittedSubclasses", "Record", "BootstrapMethods")
+	recordComponentEvents = events()
+	fieldEvents           = events("ConstantValue")
+	methodEvents          = events("Code", "Exceptions", "AnnotationDefault", "MethodParameters",
+		"RuntimeVisibleParameterAnnotations", "RuntimeInvisibleParameterAnnotations")
+	codeEvents = events("LineNumberTable", "LocalVariableTable", "LocalVariableTypeTable", "StackMapTable",
+		"RuntimeVisibleTypeAnnotations", "RuntimeInvisibleTypeAnnotations")
+)
+
+// events returns a set of attribute names with those every class, field,
+// method and record component has events for.
+func events(names ...string) map[string]bool {
+	set := map[string]bool{}
+	for _, name := range append(names, "Signature", "RuntimeVisibleAnnotations", "RuntimeInvisibleAnnotations",
+		"RuntimeVisibleTypeAnnotations", "RuntimeInvisibleTypeAnnotations") {
+		set[name] = true
+	}
+	return set
+}
+
+// attributes visits the attributes that are not in events.
+func (r *ClassReader) attributes(attributes model.Attributes, events map[string]bool, visit func(Attribute)) {
+	for _, attribute := range attributes {
+		if !events[attribute.Name] {
+			visit(Attribute{Name: attribute.Name, Data: attribute.Info})
+		}
+	}
+}
+
+func (r *ClassReader) signature(attributes model.Attributes) string {
+	if signature, ok := attributes.Get("Signature").(*model.SignatureAttributeInfo); ok {
+		return r.file.Utf8(signature.SignatureIndex)
+	}
+	return ""
+}
+
+func (r *ClassReader) field(v ClassVisitor, field *model.FieldInfo) {
+	var value interface{}
+	if constantValue, ok := field.Attributes.Get("ConstantValue").(*model.ConstantValueAttributeInfo); ok {
+		value = r.constant(constantValue.ConstantValueIndex)
+	}
+	fv := v.VisitField(field.AccessFlags, r.file.Utf8(field.NameIndex), r.file.Utf8(field.DescriptorIndex),
+		r.signature(field.Attributes), value)
+	if fv == nil {
+		return
+	}
+	r.annotations(field.Attributes, fv.VisitAnnotation)
+	r.typeAnnotations(field.Attributes, nil, fv.VisitTypeAnnotation)
+	r.attributes(field.Attributes, fieldEvents, fv.VisitAttribute)
+	fv.VisitEnd()
+}
+
+func (r *ClassReader) recordComponent(v ClassVisitor, component *model.RecordComponentInfo) {
+	rv := v.VisitRecordComponent(r.file.Utf8(component.ComponentNameIndex),
+		r.file.Utf8(component.ComponentDescriptorIndex), r.signature(component.Attributes))
+	if rv == nil {
+		return
+	}
+	r.annotations(component.Attributes, rv.VisitAnnotation)
+	r.typeAnnotations(component.Attributes, nil, rv.VisitTypeAnnotation)
+	r.attributes(component.Attributes, recordComponentEvents, rv.VisitAttribute)
+	rv.VisitEnd()
+}
+
+// module visits the Module attribute with the ModuleMainClass and
+// ModulePackages attributes.
+func (r *ClassReader) module(v ClassVisitor) {
+	file := r.file
+	attribute, ok := file.Attributes.Get("Module").(*model.ModuleAttributeInfo)
+	if !ok {
+		return
+	}
+	module := &attribute.ModuleInfo
+	mv := v.VisitModule(file.ModuleName(module.ModuleNameIndex), module.ModuleFlags, file.Utf8(module.ModuleVersionIndex))
+	if mv == nil {
+		return
+	}
+	if mainClass, ok := file.Attributes.Get("ModuleMainClass").(*model.ModuleMainClassAttributeInfo); ok {
+		mv.VisitMainClass(file.ClassName(mainClass.MainClassIndex))
+	}
+	if packages, ok := file.Attributes.Get("ModulePackages").(*model.ModulePackagesAttributeInfo); ok {
+		for _, index := range packages.PackageIndex {
+			mv.VisitPackage(file.PackageName(index))
+		}
+	}
+	for _, requires := range module.Requires {
+		mv.VisitRequire(file.ModuleName(requires.RequiresIndex), requires.RequiresFlags, file.Utf8(requires.RequiresVersion))
+	}
+	for _, exports := range module.Exports {
+		mv.VisitExport(file.PackageName(exports.ExportsIndex), exports.ExportsFlags, r.moduleNames(exports.ExportsToIndex)...)
+	}
+	for _, opens := range module.Opens {
+		mv.VisitOpen(file.PackageName(opens.OpensIndex), opens.OpensFlags, r.moduleNames(opens.OpensToIndex)...)
+	}
+	for _, uses := range module.Uses {
+		mv.VisitUse(file.ClassName(uses.UsesIndex))
+	}
+	for _, provides := range module.Provides {
+		providers := make([]string, len(provides.ProvidesWithIndex))
+		for i, index := range provides.ProvidesWithIndex {
+			providers[i] = file.ClassName(index)
+		}
+		mv.VisitProvide(file.ClassName(provides.ProvidesIndex), providers...)
+	}
+	mv.VisitEnd()
+}
+
+func (r *ClassReader) moduleNames(indexes []uint16) []string {
+	names := make([]string, len(indexes))
+	for i, index := range indexes {
+		names[i] = r.file.ModuleName(index)
+	}
+	return names
+}
+
+func (r *ClassReader) method(v ClassVisitor, method *model.MethodInfo) {
+	var exceptions []string
+	if thrown, ok := method.Attributes.Get("Exceptions").(*model.ExceptionsAttributeInfo); ok {
+		for _, index := range thrown.ExceptionIndexTable {
+			exceptions = append(exceptions, r.file.ClassName(index))
+		}
+	}
+	mv := v.VisitMethod(method.AccessFlags, r.file.Utf8(method.NameIndex), r.file.Utf8(method.DescriptorIndex),
+		r.signature(method.Attributes), exceptions)
+	if mv == nil {
+		return
+	}
+	if parameters, ok := method.Attributes.Get("MethodParameters").(*model.MethodParametersAttributeInfo); ok {
+		for _, parameter := range parameters.Parameters {
+			name := ""
+			if parameter.NameIndex != 0 {
+				name = r.file.Utf8(parameter.NameIndex)
+			}
+			mv.VisitParameter(name, parameter.AccessFlags)
+		}
+	}
+	r.annotations(method.Attributes, mv.VisitAnnotation)
+	if annotationDefault, ok := method.Attributes.Get("AnnotationDefault").(*model.AnnotationDefaultAttributeInfo); ok {
+		if av := mv.VisitAnnotationDefault(); av != nil {
+			r.elementValue(av, "", &annotationDefault.Default)
+			av.VisitEnd()
+		}
+	}
+	if visible, ok := method.Attributes.Get("RuntimeVisibleParameterAnnotations").(*model.RuntimeVisibleParameterAnnotationsAttributeInfo); ok {
+		r.parameterAnnotations(mv, visible.ParameterAnnotations, true)
+	}
+	if invisible, ok := method.Attributes.Get("RuntimeInvisibleParameterAnnotations").(*model.RuntimeInvisibleParameterAnnotationsAttributeInfo); ok {
+		r.parameterAnnotations(mv, invisible.ParameterAnnotations, false)
+	}
+	r.typeAnnotations(method.Attributes, nil, mv.VisitTypeAnnotation)
+	r.attributes(method.Attributes, methodEvents, mv.VisitAttribute)
+	if code, ok := method.Attributes.Get("Code").(*model.CodeAttributeInfo); ok {
+		r.code(mv, code)
+	}
+	mv.VisitEnd()
+}
+
+func (r *ClassReader) code(v MethodVisitor, code *model.CodeAttributeInfo) {
+	instructions, err := interpreter.Decode(code.Code)
+	if err != nil {
+		r.fail("%v", err)
+		return
+	}
+	labels := map[int]*Label{}
+	label := func(offset int) *Label {
+		if labels[offset] == nil {
+			labels[offset] = &Label{Offset: offset}
+		}
+		return labels[offset]
+	}
+
+	v.VisitCode()
+	for _, handler := range code.ExceptionTable {
+		catchType := ""
+		if handler.CatchType != 0 {
+			catchType = r.file.ClassName(handler.CatchType)
+		}
+		v.VisitTryCatchBlock(label(int(handler.StartPC)), label(int(handler.EndPC)), label(int(handler.HandlerPC)), catchType)
+	}
+	lines := map[int][]int{}
+	if table, ok := code.Attributes.Get("LineNumberTable").(*model.LineNumberTableAttributeInfo); ok {
+		for _, line := range table.LineNumberTable {
+			label(int(line.StartPC))
+			lines[int(line.StartPC)] = append(lines[int(line.StartPC)], int(line.LineNumber))
+		}
+	}
+	locals, _ := code.Attributes.Get("LocalVariableTable").(*model.LocalVariableTableAttributeInfo)
+	if locals != nil {
+		for _, local := range locals.LocalVariableTable {
+			label(int(local.StartPC))
+			label(int(local.StartPC) + int(local.Length))
+		}
+	}
+	types, _ := code.Attributes.Get("LocalVariableTypeTable").(*model.LocalVariableTypeTableAttributeInfo)
+	if types != nil {
+		for _, local := range types.LocalVariableTable {
+			label(int(local.StartPc))
+			label(int(local.StartPc) + int(local.Length))
+		}
+	}
+	frames := map[int]*model.StackMapFrameState{}
+	if table, ok := code.Attributes.Get("StackMapTable").(*model.StackMapTableAttributeInfo); ok {
+		for i := range table.Frames {
+			frame := &table.Frames[i]
+			frames[int(frame.Offset)] = frame
+			for _, types := range [][]model.VerificationTypeInfo{frame.Locals, frame.Stack} {
+				for _, t := range types {
+					if t.Tag == constant.ItemUninitialized {
+						label(int(t.Offset))
+					}
+				}
+			}
+		}
+	}
+	// Type annotations without a visitor only create their labels.
+	r.typeAnnotations(code.Attributes, label, nil)
+	// Create the labels of forward branches before they are visited.
+	for i := range instructions {
+		in := &instructions[i]
+		if isJump(in.Opcode) || in.Opcode == interpreter.TABLESWITCH || in.Opcode == interpreter.LOOKUPSWITCH {
+			label(in.Target)
+		}
+		for _, target := range in.Targets {
+			label(target)
+		}
+	}
+
+	for i := range instructions {
+		in := &instructions[i]
+		if l := labels[in.Offset]; l != nil {
+			v.VisitLabel(l)
+			for _, line := range lines[in.Offset] {
+				v.VisitLineNumber(line, l)
+			}
+		}
+		if frame := frames[in.Offset]; frame != nil {
+			v.VisitFrame(r.frameTypes(frame.Locals, label), r.frameTypes(frame.Stack, label))
+			delete(frames, in.Offset)
+		}
+		r.instruction(v, in, label)
+	}
+	if l := labels[len(code.Code)]; l != nil {
+		v.VisitLabel(l)
+	}
+	for offset := range frames {
+		r.fail("stack map frame at offset %d is not at an instruction", offset)
+	}
+	r.typeAnnotations(code.Attributes, label, v.VisitTypeAnnotation)
+	r.attributes(code.Attributes, codeEvents, v.VisitAttribute)
+	r.localVariables(v, locals, types, labels)
+	v.VisitMaxs(int(code.MaxStack), int(code.MaxLocals))
+}
+
+// localVariables visits the variables of the LocalVariableTable with their
+// signature, if the LocalVariableTypeTable has the same variable, and then
+// the variables only the LocalVariableTypeTable has.
+func (r *ClassReader) localVariables(v MethodVisitor, locals *model.LocalVariableTableAttributeInfo,
+	types *model.LocalVariableTypeTableAttributeInfo, labels map[int]*Label) {
+	var generic []model.LocalVariableTypeInfo
+	if types != nil {
+		generic = append(generic, types.LocalVariableTable...)
+	}
+	if locals != nil {
+		for _, local := range locals.LocalVariableTable {
+			signature := ""
+			for i, t := range generic {
+				if t.StartPc == local.StartPC && t.Length == local.Length && t.Index == local.Index {
+					signature = r.file.Utf8(t.SignatureIndex)
+					generic = append(generic[:i], generic[i+1:]...)
+					break
+				}
+			}
+			v.VisitLocalVariable(r.file.Utf8(local.NameIndex), r.file.Utf8(local.DescriptorIndex), signature,
+				labels[int(local.StartPC)], labels[int(local.StartPC)+int(local.Length)], int(local.Index))
+		}
+	}
+	for _, t := range generic {
+		v.VisitLocalVariable(r.file.Utf8(t.NameIndex), "", r.file.Utf8(t.SignatureIndex),
+			labels[int(t.StartPc)], labels[int(t.StartPc)+int(t.Length)], int(t.Index))
+	}
+}
+
+// frameTypes returns the types of a stack map frame as VisitFrame takes
+// them.
+func (r *ClassReader) frameTypes(types []model.VerificationTypeInfo, label func(int) *Label) []interface{} {
+	values := make([]interface{}, len(types))
+	for i, t := range types {
+		switch t.Tag {
+		case constant.ItemObject:
+			// Locals the frame keeps from the method descriptor have no
+			// constant pool entry.
+			values[i] = t.ClassName
+			if t.CpoolIndex != 0 {
+				values[i] = r.className(t.CpoolIndex)
+			}
+		case constant.ItemUninitialized:
+			values[i] = label(int(t.Offset))
+		default:
+			values[i] = FrameType(t.Tag)
+		}
+	}
+	return values
+}
+
+func isJump(op interpreter.Instruct) bool {
+	return op >= interpreter.IFEQ && op <= interpreter.JSR ||
+		op == interpreter.IFNULL || op == interpreter.IFNONNULL ||
+		op == interpreter.GOTO_W || op == interpreter.JSR_W
+}
+
+func (r *ClassReader) instruction(v MethodVisitor, in *interpreter.Instruction, label func(int) *Label) {
+	switch op := in.Opcode; {
+	case op == interpreter.BIPUSH || op == interpreter.SIPUSH:
+		v.VisitIntInsn(op, int(in.Const))
+	case op == interpreter.NEWARRAY:
+		v.VisitIntInsn(op, int(in.ArrayType))
+	case op == interpreter.LDC || op == interpreter.LDC_W || op == interpreter.LDC2_W:
+		v.VisitLdcInsn(r.constant(uint16(in.Index)))
+	case op >= interpreter.ILOAD && op <= interpreter.ALOAD,
+		op >= interpreter.ISTORE && op <= interpreter.ASTORE,
+		op == interpreter.RET:
+		v.VisitVarInsn(op, in.Local)
+	case op >= interpreter.ILOAD_0 && op <= interpreter.ALOAD_3:
+		v.VisitVarInsn(interpreter.ILOAD+(op-interpreter.ILOAD_0)/4, int(op-interpreter.ILOAD_0)%4)
+	case op >= interpreter.ISTORE_0 && op <= interpreter.ASTORE_3:
+		v.VisitVarInsn(interpreter.ISTORE+(op-interpreter.ISTORE_0)/4, int(op-interpreter.ISTORE_0)%4)
+	case op == interpreter.IINC:
+		v.VisitIincInsn(in.Local, int(in.Const))
+	case isJump(op):
+		v.VisitJumpInsn(op, label(in.Target))
+	case op == interpreter.TABLESWITCH:
+		targets := make([]*Label, len(in.Targets))
+		for i, target := range in.Targets {
+			targets[i] = label(target)
+		}
+		v.VisitTableSwitchInsn(in.Keys[0], in.Keys[len(in.Keys)-1], label(in.Target), targets...)
+	case op == interpreter.LOOKUPSWITCH:
+		targets := make([]*Label, len(in.Targets))
+		for i, target := range in.Targets {
+			targets[i] = label(target)
+		}
+		v.VisitLookupSwitchInsn(label(in.Target), in.Keys, targets)
+	case op >= interpreter.GETSTATIC && op <= interpreter.PUTFIELD:
+		owner, name, descriptor, _ := r.member(uint16(in.Index))
+		v.VisitFieldInsn(op, owner, name, descriptor)
+	case op >= interpreter.INVOKEVIRTUAL && op <= interpreter.INVOKEINTERFACE:
+		owner, name, descriptor, isInterface := r.member(uint16(in.Index))
+		v.VisitMethodInsn(op, owner, name, descriptor, isInterface)
+	case op == interpreter.INVOKEDYNAMIC:
+		d := r.dynamic(uint16(in.Index), constant.ConstantInvokeDynamic)
+		v.VisitInvokeDynamicInsn(d.Name, d.Descriptor, d.Bootstrap, d.Arguments...)
+	case op == interpreter.NEW || op == interpreter.ANEWARRAY,
+		op == interpreter.CHECKCAST || op == interpreter.INSTANCEOF:
+		v.VisitTypeInsn(op, r.className(uint16(in.Index)))
+	case op == interpreter.MULTIANEWARRAY:
+		v.VisitMultiANewArrayInsn(r.className(uint16(in.Index)), in.Count)
+	default:
+		v.VisitInsn(op)
+	}
+}
+
+func (r *ClassReader) entry(index uint16, tags ...uint8) *model.ConstantInfo {
+	if int(index) < len(r.file.ConstantPool) {
+		entry := &r.file.ConstantPool[index]
+		for _, tag := range tags {
+			if entry.Tag == tag {
+				return entry
+			}
+		}
+	}
+	r.fail("invalid constant pool reference %d", index)
+	return &model.ConstantInfo{Info: make([]byte, 8)}
+}
+
+func (r *ClassReader) className(index uint16) string {
+	entry := r.entry(index, constant.ConstantClass)
+	return r.file.Utf8(binary.BigEndian.Uint16(entry.Info))
+}
+
+func (r *ClassReader) member(index uint16) (owner, name, descriptor string, isInterface bool) {
+	entry := r.entry(index, constant.ConstantFieldRef, constant.ConstantMethodRef, constant.ConstantInterfaceMethodRef)
+	owner = r.className(binary.BigEndian.Uint16(entry.Info))
+	name, descriptor = r.file.NameAndType(binary.BigEndian.Uint16(entry.Info[2:]))
+	return owner, name, descriptor, entry.Tag == constant.ConstantInterfaceMethodRef
+}
+
+func (r *ClassReader) handle(index uint16) Handle {
+	entry := r.entry(index, constant.ConstantMethodHandle)
+	owner, name, descriptor, isInterface := r.member(binary.BigEndian.Uint16(entry.Info[1:]))
+	return Handle{Kind: entry.Info[0], Owner: owner, Name: name, Descriptor: descriptor, IsInterface: isInterface}
+}
+
+// dynamic resolves a CONSTANT_InvokeDynamic or CONSTANT_Dynamic with its
+// bootstrap method.
+func (r *ClassReader) dynamic(index uint16, tag uint8) ConstantDynamic {
+	entry := r.entry(index, tag)
+	name, descriptor := r.file.NameAndType(binary.BigEndian.Uint16(entry.Info[2:]))
+	d := ConstantDynamic{Name: name, Descriptor: descriptor}
+	bootstrapMethods, _ := r.file.Attributes.Get("BootstrapMethods").(*model.BootstrapMethodsAttributeInfo)
+	bootstrap := int(binary.BigEndian.Uint16(entry.Info))
+	if bootstrapMethods == nil || bootstrap >= len(bootstrapMethods.BootstrapMethods) {
+		r.fail("invalid bootstrap method %d", bootstrap)
+		return d
+	}
+	method := bootstrapMethods.BootstrapMethods[bootstrap]
+	d.Bootstrap = r.handle(method.BootstrapMethodRef)
+	for _, argument := range method.BootstrapArguments {
+		d.Arguments = append(d.Arguments, r.constant(argument))
+	}
+	return d
+}
+
+// constant returns a loadable constant as the value VisitLdcInsn takes.
+func (r *ClassReader) constant(index uint16) interface{} {
+	entry := r.entry(index, constant.ConstantInteger, constant.ConstantFloat, constant.ConstantLong,
+		constant.ConstantDouble, constant.ConstantString, constant.ConstantClass, constant.ConstantMethodType,
+		constant.ConstantMethodHandle, constant.ConstantDynamic)
+	switch entry.Tag {
+	case constant.ConstantInteger:
+		return int32(binary.BigEndian.Uint32(entry.Info))
+	case constant.ConstantFloat:
+		return math.Float32frombits(binary.BigEndian.Uint32(entry.Info))
+	case constant.ConstantLong:
+		return int64(binary.BigEndian.Uint64(entry.Info))
+	case constant.ConstantDouble:
+		return math.Float64frombits(binary.BigEndian.Uint64(entry.Info))
+	case constant.ConstantString:
+		return r.file.Utf8(binary.BigEndian.Uint16(entry.Info))
+	case constant.ConstantClass:
+		return ClassConstant(r.className(index))
+	case constant.ConstantMethodType:
+		return MethodTypeConstant(r.file.Utf8(binary.BigEndian.Uint16(entry.Info)))
+	case constant.ConstantMethodHandle:
+		return r.handle(index)
+	case constant.ConstantDynamic:
+		return r.dynamic(index, constant.ConstantDynamic)
+	}
+	return int32(0)
+}
+
+func (r *ClassReader) annotations(attributes model.Attributes, visit func(descriptor string, visible bool) AnnotationVisitor) {
+	if visible, ok := attributes.Get("RuntimeVisibleAnnotations").(*model.RuntimeVisibleAnnotationsAttributeInfo); ok {
+		for i := range visible.Annotations {
+			r.annotation(visit(r.file.Utf8(visible.Annotations[i].TypeIndex), true), &visible.Annotations[i])
+		}
+	}
+	if invisible, ok := attributes.Get("RuntimeInvisibleAnnotations").(*model.RuntimeInvisibleAnnotationsAttributeInfo); ok {
+		for i := range invisible.Annotations {
+			r.annotation(visit(r.file.Utf8(invisible.Annotations[i].TypeIndex), false), &invisible.Annotations[i])
+		}
+	}
+}
+
+func (r *ClassReader) parameterAnnotations(v MethodVisitor, parameters []model.ParameterAnnotationInfo, visible bool) {
+	v.VisitAnnotableParameterCount(len(parameters), visible)
+	for i := range parameters {
+		annotations := parameters[i].Annotations
+		for j := range annotations {
+			r.annotation(v.VisitParameterAnnotation(i, r.file.Utf8(annotations[j].TypeIndex), visible), &annotations[j])
+		}
+	}
+}
+
+// typeAnnotations visits type annotations with label giving the labels of
+// code offsets, or nil outside code. With a nil visit it only creates the
+// labels.
+func (r *ClassReader) typeAnnotations(attributes model.Attributes, label func(int) *Label,
+	visit func(ref TypeReference, path []TypePathStep, descriptor string, visible bool) AnnotationVisitor) {
+	if visible, ok := attributes.Get("RuntimeVisibleTypeAnnotations").(*model.RuntimeVisibleTypeAnnotationsAttributeInfo); ok {
+		r.typeAnnotationList(visible.Annotations, true, label, visit)
+	}
+	if invisible, ok := attributes.Get("RuntimeInvisibleTypeAnnotations").(*model.RuntimeInvisibleTypeAnnotationsAttributeInfo); ok {
+		r.typeAnnotationList(invisible.Annotations, false, label, visit)
+	}
+}
+
+func (r *ClassReader) typeAnnotationList(annotations []model.TypeAnnotationInfo, visible bool, label func(int) *Label,
+	visit func(ref TypeReference, path []TypePathStep, descriptor string, visible bool) AnnotationVisitor) {
+	for i := range annotations {
+		a := &annotations[i]
+		ref, ok := r.typeReference(a.TargetType, &a.TargetInfo, label)
+		if !ok || visit == nil {
+			continue
+		}
+		path := make([]TypePathStep, len(a.TargetPath))
+		for j, entry := range a.TargetPath {
+			path[j] = TypePathStep{Kind: entry.TypePathKind, TypeArgument: entry.TypeArgumentIndex}
+		}
+		r.annotation(visit(ref, path, r.file.Utf8(a.TypeIndex), visible),
+			&model.AnnotationInfo{TypeIndex: a.TypeIndex, ElementValuePairs: a.ElementValuePairs})
+	}
+}
+
+func (r *ClassReader) typeReference(sort uint8, info *model.TargetInfo, label func(int) *Label) (TypeReference, bool) {
+	ref := TypeReference{
+		Sort:            sort,
+		TypeParameter:   info.TypeParameterIndex,
+		Bound:           info.BoundIndex,
+		Supertype:       info.SupertypeIndex,
+		FormalParameter: info.FormalParameterIndex,
+		Throws:          info.ThrowsTypeIndex,
+		TryCatchBlock:   info.ExceptionTableIndex,
+		TypeArgument:    info.TypeArgumentIndex,
+	}
+	if sort < constant.TargetLocalVariable {
+		return ref, true
+	}
+	if label == nil {
+		r.fail("type annotation target %#x outside code", sort)
+		return ref, false
+	}
+	for _, local := range info.Table {
+		ref.Ranges = append(ref.Ranges, LocalVariableRange{
+			Start: label(int(local.StartPC)),
+			End:   label(int(local.StartPC) + int(local.Length)),
+			Index: int(local.Index),
+		})
+	}
+	if sort >= constant.TargetInstanceof {
+		ref.Label = label(int(info.Offset))
+	}
+	return ref, true
+}
+
+func (r *ClassReader) annotation(v AnnotationVisitor, annotation *model.AnnotationInfo) {
+	if v == nil {
+		return
+	}
+	for i := range annotation.ElementValuePairs {
+		pair := &annotation.ElementValuePairs[i]
+		r.elementValue(v, r.file.Utf8(pair.ElementNameIndex), &pair.Value)
+	}
+	v.VisitEnd()
+}
+
+func (r *ClassReader) elementValue(v AnnotationVisitor, name string, value *model.ElementValue) {
+	switch value.Tag {
+	case 'B':
+		v.Visit(name, int8(r.integer(value.ConstValueIndex)))
+	case 'C':
+		v.Visit(name, uint16(r.integer(value.ConstValueIndex)))
+	case 'S':
+		v.Visit(name, int16(r.integer(value.ConstValueIndex)))
+	case 'Z':
+		v.Visit(name, r.integer(value.ConstValueIndex) != 0)
+	case 'I', 'D', 'F', 'J':
+		v.Visit(name, r.constant(value.ConstValueIndex))
+	case 's':
+		v.Visit(name, r.file.Utf8(value.ConstValueIndex))
+	case 'e':
+		v.VisitEnum(name, r.file.Utf8(value.TypeNameIndex), r.file.Utf8(value.ConstNameIndex))
+	case 'c':
+		v.Visit(name, ClassValue(r.file.Utf8(value.ClassInfoIndex)))
+	case '@':
+		r.annotation(v.VisitAnnotation(name, r.file.Utf8(value.AnnotationValue.TypeIndex)), value.AnnotationValue)
+	case '[':
+		if av := v.VisitArray(name); av != nil {
+			for i := range value.ArrayValue {
+				r.elementValue(av, "", &value.ArrayValue[i])
+			}
+			av.VisitEnd()
+		}
+	default:
+		r.fail("invalid element value tag %c", value.Tag)
+	}
+}
+
+func (r *ClassReader) integer(index uint16) int32 {
+	return int32(binary.BigEndian.Uint32(r.entry(index, constant.ConstantInteger).Info))
+}
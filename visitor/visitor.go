@@ -0,0 +1,253 @@
+// Package visitor reads and writes class files as a stream of events, in
+// the style of ASM's visitor API. A ClassReader parses a class file into
+// calls on a ClassVisitor, a ClassWriter turns the calls it receives back
+// into a class file, and transformations sit in between as visitors that
+// pass on, drop, change or add events:
+//
+//	reader.Accept(&renamer{ClassVisitor: writer})
+//
+// A visitor embedding the next visitor in the chain passes on every event
+// it does not override. Returning nil from VisitField, VisitMethod,
+// VisitRecordComponent, VisitModule or one of the annotation events skips
+// what would have been visited.
+//
+// Events carry names, descriptors and constant values rather than constant
+// pool indexes, so a writer builds its own constant pool. An attribute
+// without events of its own is visited with VisitAttribute as it was read.
+// The writer ignores VisitMaxs and computes max_stack again, as the code may
+// have changed, and computes the stack map frames too if asked to.
+package visitor
+
+import (
+	"outro/builder"
+	"outro/constant"
+	"outro/interpreter"
+)
+
+// ClassVisitor receives the events of a class: Visit first, then
+// VisitSource, VisitModule, VisitOuterClass, VisitNestHost,
+// VisitAnnotation, VisitTypeAnnotation, VisitAttribute, VisitInnerClass,
+// VisitNestMember, VisitPermittedSubclass, VisitRecordComponent,
+// VisitField and VisitMethod, and VisitEnd last.
+type ClassVisitor interface {
+	// Visit starts the class. superName is "" for java/lang/Object.
+	Visit(major, minor uint16, access uint16, name, signature, superName string, interfaces []string)
+	VisitSource(source string)
+	// VisitModule starts the Module attribute of a module-info class;
+	// version is "" if the module has none.
+	VisitModule(name string, access uint16, version string) ModuleVisitor
+	// VisitOuterClass names the class and, for a class declared inside
+	// one, the method that encloses a local or anonymous class.
+	VisitOuterClass(owner, name, descriptor string)
+	VisitNestHost(host string)
+	VisitAnnotation(descriptor string, visible bool) AnnotationVisitor
+	VisitTypeAnnotation(ref TypeReference, path []TypePathStep, descriptor string, visible bool) AnnotationVisitor
+	VisitAttribute(attribute Attribute)
+	// VisitInnerClass describes an entry of the InnerClasses attribute;
+	// outerName and innerName are "" for local and anonymous classes.
+	VisitInnerClass(name, outerName, innerName string, access uint16)
+	VisitNestMember(member string)
+	VisitPermittedSubclass(subclass string)
+	// VisitRecordComponent declares a component of the Record attribute.
+	VisitRecordComponent(name, descriptor, signature string) RecordComponentVisitor
+	// VisitField declares a field; value is the ConstantValue of a static
+	// field, as for builder.FieldBuilder.ConstantValue, or nil.
+	VisitField(access uint16, name, descriptor, signature string, value interface{}) FieldVisitor
+	VisitMethod(access uint16, name, descriptor, signature string, exceptions []string) MethodVisitor
+	VisitEnd()
+}
+
+// ModuleVisitor receives the directives of a module in this order, then
+// VisitEnd. Classes and packages are named in internal form, such as
+// "java/util".
+type ModuleVisitor interface {
+	VisitMainClass(mainClass string)
+	VisitPackage(packageName string)
+	VisitRequire(module string, access uint16, version string)
+	// VisitExport exports a package to every module, or only to modules.
+	VisitExport(packageName string, access uint16, modules ...string)
+	VisitOpen(packageName string, access uint16, modules ...string)
+	VisitUse(service string)
+	VisitProvide(service string, providers ...string)
+	VisitEnd()
+}
+
+// RecordComponentVisitor receives the annotations and attributes of a
+// record component, then VisitEnd.
+type RecordComponentVisitor interface {
+	VisitAnnotation(descriptor string, visible bool) AnnotationVisitor
+	VisitTypeAnnotation(ref TypeReference, path []TypePathStep, descriptor string, visible bool) AnnotationVisitor
+	VisitAttribute(attribute Attribute)
+	VisitEnd()
+}
+
+// FieldVisitor receives the annotations and attributes of a field, then
+// VisitEnd.
+type FieldVisitor interface {
+	VisitAnnotation(descriptor string, visible bool) AnnotationVisitor
+	VisitTypeAnnotation(ref TypeReference, path []TypePathStep, descriptor string, visible bool) AnnotationVisitor
+	VisitAttribute(attribute Attribute)
+	VisitEnd()
+}
+
+// MethodVisitor receives the events of a method: its parameters,
+// annotations and attributes first, then for a method with code VisitCode,
+// the try-catch blocks, the instructions and labels in code order with line
+// numbers and the frame of an instruction after the label it is at, the
+// type annotations of the code, the attributes of the Code attribute, local
+// variables and VisitMaxs, and VisitEnd last.
+//
+// Instruction events follow the builder.MethodBuilder methods: loads and
+// stores are visited in their general form, such as ILOAD 1 for ILOAD_1,
+// and WIDE prefixes are implied by their operands.
+type MethodVisitor interface {
+	// VisitParameter gives the name, or "", and access flags of the next
+	// parameter, from the MethodParameters attribute.
+	VisitParameter(name string, access uint16)
+	VisitAnnotation(descriptor string, visible bool) AnnotationVisitor
+	// VisitAnnotationDefault visits the default value of an annotation
+	// interface element as a single unnamed value.
+	VisitAnnotationDefault() AnnotationVisitor
+	// VisitAnnotableParameterCount gives the number of parameters the
+	// visible or invisible parameter annotations are counted against,
+	// before the annotations of parameter 0 and up are visited.
+	VisitAnnotableParameterCount(count int, visible bool)
+	VisitParameterAnnotation(parameter int, descriptor string, visible bool) AnnotationVisitor
+	// VisitTypeAnnotation annotates a type in the method's signature, or
+	// in its code once VisitCode has been visited.
+	VisitTypeAnnotation(ref TypeReference, path []TypePathStep, descriptor string, visible bool) AnnotationVisitor
+	// VisitAttribute adds an attribute to the method, or to its Code
+	// attribute once VisitCode has been visited.
+	VisitAttribute(attribute Attribute)
+	VisitCode()
+	// VisitFrame gives the stack map frame of the next instruction in
+	// expanded form: the type of every local variable and operand stack
+	// entry, a long or double taking one entry. A type is a FrameType, the
+	// internal name of a class or array, or the label of the new
+	// instruction that created an uninitialized object.
+	VisitFrame(locals, stack []interface{})
+	VisitInsn(opcode interpreter.Instruct)
+	VisitIntInsn(opcode interpreter.Instruct, operand int)
+	VisitVarInsn(opcode interpreter.Instruct, index int)
+	VisitTypeInsn(opcode interpreter.Instruct, className string)
+	VisitFieldInsn(opcode interpreter.Instruct, owner, name, descriptor string)
+	VisitMethodInsn(opcode interpreter.Instruct, owner, name, descriptor string, isInterface bool)
+	VisitInvokeDynamicInsn(name, descriptor string, bootstrap Handle, arguments ...interface{})
+	VisitJumpInsn(opcode interpreter.Instruct, label *Label)
+	VisitLabel(label *Label)
+	// VisitLdcInsn loads an int32, float32, int64, float64, string,
+	// ClassConstant, MethodTypeConstant, Handle or ConstantDynamic.
+	VisitLdcInsn(value interface{})
+	VisitIincInsn(index, delta int)
+	VisitTableSwitchInsn(low, high int32, defaultTarget *Label, targets ...*Label)
+	VisitLookupSwitchInsn(defaultTarget *Label, keys []int32, targets []*Label)
+	VisitMultiANewArrayInsn(descriptor string, dimensions int)
+	// VisitTryCatchBlock adds a handler; catchType "" catches everything.
+	VisitTryCatchBlock(start, end, handler *Label, catchType string)
+	// VisitLocalVariable describes a local variable with its descriptor
+	// and generic signature, either of which may be "" if only the
+	// LocalVariableTable or the LocalVariableTypeTable has the variable.
+	VisitLocalVariable(name, descriptor, signature string, start, end *Label, index int)
+	VisitLineNumber(line int, start *Label)
+	VisitMaxs(maxStack, maxLocals int)
+	VisitEnd()
+}
+
+// AnnotationVisitor receives the elements of an annotation, or the values
+// of an array element with name "". Values are int8 ('B'), uint16 ('C'),
+// float64, float32, int32, int64, int16 ('S'), bool, string or
+// ClassValue.
+type AnnotationVisitor interface {
+	Visit(name string, value interface{})
+	VisitEnum(name, descriptor, value string)
+	VisitAnnotation(name, descriptor string) AnnotationVisitor
+	VisitArray(name string) AnnotationVisitor
+	VisitEnd()
+}
+
+// Label is a position in the code of a method. The reader creates one for
+// each offset that is referred to; other visitors may create their own.
+type Label struct {
+	// Offset is the position in the code that was read, or -1 for a label
+	// created by a visitor.
+	Offset int
+}
+
+// NewLabel returns a label for a visitor to place with VisitLabel.
+func NewLabel() *Label {
+	return &Label{Offset: -1}
+}
+
+// FrameType is a type of a stack map frame other than a class or an
+// uninitialized object.
+type FrameType uint8
+
+const (
+	Top               = FrameType(constant.ItemTop)
+	Integer           = FrameType(constant.ItemInteger)
+	Float             = FrameType(constant.ItemFloat)
+	Double            = FrameType(constant.ItemDouble)
+	Long              = FrameType(constant.ItemLong)
+	Null              = FrameType(constant.ItemNull)
+	UninitializedThis = FrameType(constant.ItemUninitializedThis)
+)
+
+// TypeReference is the type a type annotation is on: Sort is one of the
+// constant.Target values, and the fields of its target_info are set. Types
+// in code are given by labels rather than offsets.
+type TypeReference struct {
+	Sort            uint8
+	TypeParameter   uint8
+	Bound           uint8
+	Supertype       uint16
+	FormalParameter uint8
+	Throws          uint16
+	// Ranges are the live ranges of a local or resource variable.
+	Ranges []LocalVariableRange
+	// TryCatchBlock is the index of the try-catch block of an exception
+	// parameter, in the order they were visited.
+	TryCatchBlock uint16
+	// Label is the instruction of an instanceof, new, method reference,
+	// cast or type argument.
+	Label        *Label
+	TypeArgument uint8
+}
+
+type LocalVariableRange struct {
+	Start, End *Label
+	Index      int
+}
+
+// TypePathStep is an entry of the type_path of a type annotation.
+type TypePathStep struct {
+	Kind         uint8
+	TypeArgument uint8
+}
+
+// Attribute is an attribute that has no events of its own, such as one
+// outro does not know. Data is its content as read, which may refer to the
+// constant pool of the class read; see ClassWriter.CopyPool.
+type Attribute struct {
+	Name string
+	Data []byte
+}
+
+// The constants a visitor loads are those the builder loads.
+type (
+	Handle             = builder.Handle
+	ClassConstant      = builder.ClassConstant
+	MethodTypeConstant = builder.MethodTypeConstant
+)
+
+// ClassValue is a class literal in an annotation, given by its return
+// descriptor, such as "Ljava/lang/String;" or "V".
+type ClassValue string
+
+// ConstantDynamic is a dynamically-computed constant with its bootstrap
+// method, which the writer adds to the BootstrapMethods attribute.
+type ConstantDynamic struct {
+	Name       string
+	Descriptor string
+	Bootstrap  Handle
+	Arguments  []interface{}
+}
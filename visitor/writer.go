@@ -0,0 +1,589 @@
+package visitor
+
+import (
+	"fmt"
+	"outro/builder"
+	"outro/constant"
+	"outro/interpreter"
+	"outro/model"
+	"outro/verifier"
+	"outro/writer"
+)
+
+// ClassWriter is the ClassVisitor at the end of a chain: it builds the
+// class it visits with a builder.ClassBuilder. Errors are reported by
+// Bytes.
+type ClassWriter struct {
+	class      *builder.ClassBuilder
+	pool       []model.ConstantInfo
+	frames     *verifier.Verifier
+	inner      []model.InnerClassInfo
+	members    []uint16
+	permitted  []uint16
+	components []model.RecordComponentInfo
+	annotations
+	err error
+}
+
+// NewClassWriter returns a writer for one class.
+func NewClassWriter() *ClassWriter {
+	return &ClassWriter{}
+}
+
+// ComputeFrames makes Bytes compute the StackMapTable of each method with
+// v, loading the classes it needs to merge types, instead of writing the
+// frames visited. Those are only right if the code around them has not
+// changed.
+func (w *ClassWriter) ComputeFrames(v *verifier.Verifier) *ClassWriter {
+	w.frames = v
+	return w
+}
+
+// CopyPool makes the class written start with the constant pool of the
+// class r reads, so that the Data of the attributes visited still refers
+// to the right constants.
+func (w *ClassWriter) CopyPool(r *ClassReader) *ClassWriter {
+	w.pool = r.file.ConstantPool
+	return w
+}
+
+// Bytes returns the class file written.
+func (w *ClassWriter) Bytes() ([]byte, error) {
+	if w.err != nil {
+		return nil, w.err
+	}
+	if w.class == nil {
+		return nil, fmt.Errorf("no class visited")
+	}
+	if w.frames == nil {
+		return w.class.Bytes()
+	}
+	file, err := w.class.Build()
+	if err != nil {
+		return nil, err
+	}
+	if err := w.frames.ComputeAllFrames(file); err != nil {
+		return nil, err
+	}
+	return writer.Write(file)
+}
+
+func (w *ClassWriter) fail(format string, args ...interface{}) {
+	if w.err == nil {
+		w.err = fmt.Errorf(format, args...)
+	}
+}
+
+func (w *ClassWriter) Visit(major, minor uint16, access uint16, name, signature, superName string, interfaces []string) {
+	pool := builder.NewConstantPool()
+	if w.pool != nil {
+		pool = builder.ExtendConstantPool(w.pool)
+	}
+	w.class = builder.NewClassIn(pool, name).Version(major, minor).Access(access).Super(superName).Implements(interfaces...)
+	if signature != "" {
+		w.class.Attribute("Signature", w.signature(signature))
+	}
+}
+
+func (w *ClassWriter) signature(signature string) *model.SignatureAttributeInfo {
+	return &model.SignatureAttributeInfo{SignatureIndex: w.class.Pool().Utf8(signature)}
+}
+
+func (w *ClassWriter) VisitSource(source string) {
+	w.class.SourceFile(source)
+}
+
+func (w *ClassWriter) VisitModule(name string, access uint16, version string) ModuleVisitor {
+	pool := w.class.Pool()
+	m := &moduleWriter{class: w}
+	m.module.ModuleNameIndex = pool.Module(name)
+	m.module.ModuleFlags = access
+	if version != "" {
+		m.module.ModuleVersionIndex = pool.Utf8(version)
+	}
+	return m
+}
+
+func (w *ClassWriter) VisitOuterClass(owner, name, descriptor string) {
+	pool := w.class.Pool()
+	enclosing := &model.EnclosingMethodAttributeInfo{ClassIndex: pool.Class(owner)}
+	if name != "" {
+		enclosing.MethodIndex = pool.NameAndType(name, descriptor)
+	}
+	w.class.Attribute("EnclosingMethod", enclosing)
+}
+
+func (w *ClassWriter) VisitNestHost(host string) {
+	w.class.Attribute("NestHost", &model.NestHostAttributeInfo{ClassIndex: w.class.Pool().Class(host)})
+}
+
+func (w *ClassWriter) VisitAnnotation(descriptor string, visible bool) AnnotationVisitor {
+	return w.annotations.visit(w, descriptor, visible)
+}
+
+func (w *ClassWriter) VisitTypeAnnotation(ref TypeReference, path []TypePathStep, descriptor string, visible bool) AnnotationVisitor {
+	return w.annotations.visitType(w, ref, path, descriptor, visible)
+}
+
+func (w *ClassWriter) VisitAttribute(attribute Attribute) {
+	w.class.Attribute(attribute.Name, attribute.Data)
+}
+
+func (w *ClassWriter) VisitInnerClass(name, outerName, innerName string, access uint16) {
+	pool := w.class.Pool()
+	class := model.InnerClassInfo{InnerClassInfoIndex: pool.Class(name), InnerClassAccessFlagsInfo: access}
+	if outerName != "" {
+		class.OuterClassInfoIndex = pool.Class(outerName)
+	}
+	if innerName != "" {
+		class.InnerNameIndex = pool.Utf8(innerName)
+	}
+	w.inner = append(w.inner, class)
+}
+
+func (w *ClassWriter) VisitNestMember(member string) {
+	w.members = append(w.members, w.class.Pool().Class(member))
+}
+
+func (w *ClassWriter) VisitPermittedSubclass(subclass string) {
+	w.permitted = append(w.permitted, w.class.Pool().Class(subclass))
+}
+
+func (w *ClassWriter) VisitRecordComponent(name, descriptor, signature string) RecordComponentVisitor {
+	pool := w.class.Pool()
+	r := &recordComponentWriter{class: w, component: model.RecordComponentInfo{
+		ComponentNameIndex:       pool.Utf8(name),
+		ComponentDescriptorIndex: pool.Utf8(descriptor),
+	}}
+	if signature != "" {
+		r.attribute("Signature", w.signature(signature))
+	}
+	return r
+}
+
+func (w *ClassWriter) VisitField(access uint16, name, descriptor, signature string, value interface{}) FieldVisitor {
+	field := w.class.Field(access, name, descriptor)
+	if value != nil {
+		field.ConstantValue(value)
+	}
+	if signature != "" {
+		field.Attribute("Signature", w.signature(signature))
+	}
+	return &fieldWriter{class: w, field: field}
+}
+
+func (w *ClassWriter) VisitMethod(access uint16, name, descriptor, signature string, exceptions []string) MethodVisitor {
+	method := w.class.Method(access, name, descriptor)
+	if len(exceptions) > 0 {
+		method.Throws(exceptions...)
+	}
+	if signature != "" {
+		method.Attribute("Signature", w.signature(signature))
+	}
+	return &methodWriter{class: w, method: method, labels: map[*Label]*builder.Label{}}
+}
+
+func (w *ClassWriter) VisitEnd() {
+	if len(w.inner) > 0 {
+		w.class.Attribute("InnerClasses", &model.InnerClassesAttributeInfo{
+			NumberOfClasses: uint16(len(w.inner)),
+			Classes:         w.inner,
+		})
+	}
+	if len(w.members) > 0 {
+		w.class.Attribute("NestMembers", &model.NestMembersAttributeInfo{
+			NumberOfClasses: uint16(len(w.members)),
+			Classes:         w.members,
+		})
+	}
+	if len(w.permitted) > 0 {
+		w.class.Attribute("PermittedSubclasses", &model.PermittedSubclassesAttributeInfo{
+			NumberOfClasses: uint16(len(w.permitted)),
+			Classes:         w.permitted,
+		})
+	}
+	if len(w.components) > 0 {
+		w.class.Attribute("Record", &model.RecordAttributeInfo{
+			NumberOfComponents: uint16(len(w.components)),
+			Components:         w.components,
+		})
+	}
+	w.annotations.add(func(name string, value interface{}) { w.class.Attribute(name, value) })
+}
+
+// loadable turns a constant of VisitLdcInsn into one the builder loads,
+// adding the bootstrap methods of dynamic constants.
+func (w *ClassWriter) loadable(value interface{}) interface{} {
+	if d, ok := value.(ConstantDynamic); ok {
+		return builder.ConstantDynamic{
+			Name:            d.Name,
+			Descriptor:      d.Descriptor,
+			BootstrapMethod: w.bootstrapMethod(d.Bootstrap, d.Arguments),
+		}
+	}
+	return value
+}
+
+func (w *ClassWriter) bootstrapMethod(bootstrap Handle, arguments []interface{}) uint16 {
+	pool := w.class.Pool()
+	handle, err := pool.Loadable(bootstrap)
+	if err != nil {
+		w.fail("%v", err)
+	}
+	indexes := make([]uint16, len(arguments))
+	for i, argument := range arguments {
+		if indexes[i], err = pool.Loadable(w.loadable(argument)); err != nil {
+			w.fail("%v", err)
+		}
+	}
+	return w.class.BootstrapMethod(handle, indexes...)
+}
+
+type fieldWriter struct {
+	class *ClassWriter
+	field *builder.FieldBuilder
+	annotations
+}
+
+func (f *fieldWriter) VisitAnnotation(descriptor string, visible bool) AnnotationVisitor {
+	return f.annotations.visit(f.class, descriptor, visible)
+}
+
+func (f *fieldWriter) VisitTypeAnnotation(ref TypeReference, path []TypePathStep, descriptor string, visible bool) AnnotationVisitor {
+	return f.annotations.visitType(f.class, ref, path, descriptor, visible)
+}
+
+func (f *fieldWriter) VisitAttribute(attribute Attribute) {
+	f.field.Attribute(attribute.Name, attribute.Data)
+}
+
+func (f *fieldWriter) VisitEnd() {
+	f.annotations.add(func(name string, value interface{}) { f.field.Attribute(name, value) })
+}
+
+type recordComponentWriter struct {
+	class     *ClassWriter
+	component model.RecordComponentInfo
+	annotations
+}
+
+func (r *recordComponentWriter) attribute(name string, value interface{}) {
+	r.component.Attributes = append(r.component.Attributes, r.class.class.NewAttribute(name, value))
+	r.component.ComponentAttributesCount = uint16(len(r.component.Attributes))
+}
+
+func (r *recordComponentWriter) VisitAnnotation(descriptor string, visible bool) AnnotationVisitor {
+	return r.annotations.visit(r.class, descriptor, visible)
+}
+
+func (r *recordComponentWriter) VisitTypeAnnotation(ref TypeReference, path []TypePathStep, descriptor string, visible bool) AnnotationVisitor {
+	return r.annotations.visitType(r.class, ref, path, descriptor, visible)
+}
+
+func (r *recordComponentWriter) VisitAttribute(attribute Attribute) {
+	r.attribute(attribute.Name, attribute.Data)
+}
+
+func (r *recordComponentWriter) VisitEnd() {
+	r.annotations.add(r.attribute)
+	r.class.components = append(r.class.components, r.component)
+}
+
+// methodWriter emits the instructions it visits with a
+// builder.MethodBuilder, which lays out the code and computes max_stack
+// and max_locals. What refers to code offsets, the frames and the type
+// annotations of the code, is added to the Code attribute once the code is
+// laid out.
+type methodWriter struct {
+	class  *ClassWriter
+	method *builder.MethodBuilder
+	labels map[*Label]*builder.Label
+	// code is set once VisitCode has been visited.
+	code       bool
+	parameters []model.ParameterInfo
+	// visibleParameters and invisibleParameters are nil unless visited.
+	visibleParameters, invisibleParameters *parameterAnnotations
+	frames                                 []frame
+	visibleCodeTypes, invisibleCodeTypes   []codeTypeAnnotation
+	annotations
+}
+
+// frame is a visited stack map frame whose types are a FrameType, a class
+// name or the *builder.Label of an uninitialized object's new instruction.
+type frame struct {
+	at            *builder.Label
+	locals, stack []interface{}
+}
+
+type codeTypeAnnotation struct {
+	ref        TypeReference
+	annotation model.TypeAnnotationInfo
+}
+
+func (m *methodWriter) label(label *Label) *builder.Label {
+	if m.labels[label] == nil {
+		m.labels[label] = m.method.NewLabel()
+	}
+	return m.labels[label]
+}
+
+func (m *methodWriter) VisitAnnotation(descriptor string, visible bool) AnnotationVisitor {
+	return m.annotations.visit(m.class, descriptor, visible)
+}
+
+func (m *methodWriter) VisitAnnotationDefault() AnnotationVisitor {
+	return &annotationWriter{class: m.class, element: func(_ string, value model.ElementValue) {
+		m.method.Attribute("AnnotationDefault", &model.AnnotationDefaultAttributeInfo{Default: value})
+	}}
+}
+
+func (m *methodWriter) VisitParameter(name string, access uint16) {
+	parameter := model.ParameterInfo{AccessFlags: access}
+	if name != "" {
+		parameter.NameIndex = m.class.class.Pool().Utf8(name)
+	}
+	m.parameters = append(m.parameters, parameter)
+}
+
+func (m *methodWriter) parameterAnnotations(visible bool) *parameterAnnotations {
+	p := &m.invisibleParameters
+	if visible {
+		p = &m.visibleParameters
+	}
+	if *p == nil {
+		*p = &parameterAnnotations{}
+	}
+	return *p
+}
+
+func (m *methodWriter) VisitAnnotableParameterCount(count int, visible bool) {
+	m.parameterAnnotations(visible).count = count
+}
+
+func (m *methodWriter) VisitParameterAnnotation(parameter int, descriptor string, visible bool) AnnotationVisitor {
+	if parameter < 0 || parameter > 0xFF {
+		m.class.fail("invalid annotated parameter %d", parameter)
+		return nil
+	}
+	return m.parameterAnnotations(visible).visit(m.class, parameter, descriptor)
+}
+
+func (m *methodWriter) VisitTypeAnnotation(ref TypeReference, path []TypePathStep, descriptor string, visible bool) AnnotationVisitor {
+	if !m.code {
+		return m.annotations.visitType(m.class, ref, path, descriptor, visible)
+	}
+	// Map the labels now, so that the builder fails if one is never placed.
+	for _, r := range ref.Ranges {
+		m.label(r.Start)
+		m.label(r.End)
+	}
+	if ref.Label != nil {
+		m.label(ref.Label)
+	}
+	return typeAnnotation(m.class, ref, path, descriptor, func(annotation model.TypeAnnotationInfo) {
+		if visible {
+			m.visibleCodeTypes = append(m.visibleCodeTypes, codeTypeAnnotation{ref: ref, annotation: annotation})
+		} else {
+			m.invisibleCodeTypes = append(m.invisibleCodeTypes, codeTypeAnnotation{ref: ref, annotation: annotation})
+		}
+	})
+}
+
+// codeTypeAnnotations returns the type annotations of the code with their
+// targets, once the code is laid out.
+func (m *methodWriter) codeTypeAnnotations(annotations []codeTypeAnnotation) []model.TypeAnnotationInfo {
+	offset := func(label *Label) int { return m.label(label).Offset() }
+	table := make([]model.TypeAnnotationInfo, len(annotations))
+	for i, a := range annotations {
+		table[i] = a.annotation
+		table[i].TargetInfo = targetInfo(a.ref, offset)
+	}
+	return table
+}
+
+func (m *methodWriter) VisitAttribute(attribute Attribute) {
+	if m.code {
+		m.method.CodeAttribute(attribute.Name, func() interface{} { return attribute.Data })
+	} else {
+		m.method.Attribute(attribute.Name, attribute.Data)
+	}
+}
+
+func (m *methodWriter) VisitCode() {
+	m.code = true
+}
+
+// VisitFrame is ignored when the writer computes the frames.
+func (m *methodWriter) VisitFrame(locals, stack []interface{}) {
+	if m.class.frames != nil {
+		return
+	}
+	at := m.method.NewLabel()
+	m.method.Mark(at)
+	m.frames = append(m.frames, frame{at: at, locals: m.frameTypes(locals), stack: m.frameTypes(stack)})
+}
+
+func (m *methodWriter) frameTypes(types []interface{}) []interface{} {
+	mapped := make([]interface{}, len(types))
+	for i, t := range types {
+		switch t := t.(type) {
+		case FrameType, string:
+			mapped[i] = t
+		case *Label:
+			mapped[i] = m.label(t)
+		default:
+			m.class.fail("stack map frame cannot have a type of type %T", t)
+		}
+	}
+	return mapped
+}
+
+// stackMapTable writes the frames visited as full frames.
+func (m *methodWriter) stackMapTable() interface{} {
+	pool := m.class.class.Pool()
+	table := &model.StackMapTableAttributeInfo{NumberOfEntries: uint16(len(m.frames))}
+	previous := -1
+	for _, f := range m.frames {
+		offset := f.at.Offset()
+		table.Entries = append(table.Entries, model.StackMapFrame{
+			FrameType:   constant.FullFrame,
+			OffsetDelta: uint16(offset - previous - 1),
+			Locals:      verificationTypes(pool, f.locals),
+			Stack:       verificationTypes(pool, f.stack),
+		})
+		previous = offset
+	}
+	return table
+}
+
+func verificationTypes(pool *builder.ConstantPool, types []interface{}) []model.VerificationTypeInfo {
+	infos := make([]model.VerificationTypeInfo, len(types))
+	for i, t := range types {
+		switch t := t.(type) {
+		case FrameType:
+			infos[i] = model.VerificationTypeInfo{Tag: uint8(t)}
+		case string:
+			infos[i] = model.VerificationTypeInfo{Tag: constant.ItemObject, CpoolIndex: pool.Class(t), ClassName: t}
+		case *builder.Label:
+			infos[i] = model.VerificationTypeInfo{Tag: constant.ItemUninitialized, Offset: uint16(t.Offset())}
+		}
+	}
+	return infos
+}
+
+func (m *methodWriter) VisitInsn(opcode interpreter.Instruct) {
+	m.method.Insn(opcode)
+}
+
+func (m *methodWriter) VisitIntInsn(opcode interpreter.Instruct, operand int) {
+	m.method.IntInsn(opcode, operand)
+}
+
+func (m *methodWriter) VisitVarInsn(opcode interpreter.Instruct, index int) {
+	m.method.VarInsn(opcode, index)
+}
+
+func (m *methodWriter) VisitTypeInsn(opcode interpreter.Instruct, className string) {
+	m.method.TypeInsn(opcode, className)
+}
+
+func (m *methodWriter) VisitFieldInsn(opcode interpreter.Instruct, owner, name, descriptor string) {
+	m.method.FieldInsn(opcode, owner, name, descriptor)
+}
+
+func (m *methodWriter) VisitMethodInsn(opcode interpreter.Instruct, owner, name, descriptor string, isInterface bool) {
+	m.method.MethodInsn(opcode, owner, name, descriptor, isInterface)
+}
+
+func (m *methodWriter) VisitInvokeDynamicInsn(name, descriptor string, bootstrap Handle, arguments ...interface{}) {
+	m.method.InvokeDynamicInsn(m.class.bootstrapMethod(bootstrap, arguments), name, descriptor)
+}
+
+func (m *methodWriter) VisitJumpInsn(opcode interpreter.Instruct, label *Label) {
+	m.method.JumpInsn(opcode, m.label(label))
+}
+
+func (m *methodWriter) VisitLabel(label *Label) {
+	m.method.Mark(m.label(label))
+}
+
+func (m *methodWriter) VisitLdcInsn(value interface{}) {
+	m.method.LdcInsn(m.class.loadable(value))
+}
+
+func (m *methodWriter) VisitIincInsn(index, delta int) {
+	m.method.IincInsn(index, delta)
+}
+
+func (m *methodWriter) VisitTableSwitchInsn(low, high int32, defaultTarget *Label, targets ...*Label) {
+	if int64(high)-int64(low)+1 != int64(len(targets)) {
+		m.class.fail("tableswitch from %d to %d has %d targets", low, high, len(targets))
+		return
+	}
+	labels := make([]*builder.Label, len(targets))
+	for i, target := range targets {
+		labels[i] = m.label(target)
+	}
+	m.method.TableSwitchInsn(low, m.label(defaultTarget), labels...)
+}
+
+func (m *methodWriter) VisitLookupSwitchInsn(defaultTarget *Label, keys []int32, targets []*Label) {
+	labels := make([]*builder.Label, len(targets))
+	for i, target := range targets {
+		labels[i] = m.label(target)
+	}
+	m.method.LookupSwitchInsn(m.label(defaultTarget), keys, labels)
+}
+
+func (m *methodWriter) VisitMultiANewArrayInsn(descriptor string, dimensions int) {
+	m.method.MultiANewArrayInsn(descriptor, dimensions)
+}
+
+func (m *methodWriter) VisitTryCatchBlock(start, end, handler *Label, catchType string) {
+	m.method.TryCatchBlock(m.label(start), m.label(end), m.label(handler), catchType)
+}
+
+func (m *methodWriter) VisitLocalVariable(name, descriptor, signature string, start, end *Label, index int) {
+	if descriptor != "" {
+		m.method.LocalVariable(index, name, descriptor, m.label(start), m.label(end))
+	}
+	if signature != "" {
+		m.method.LocalVariableType(index, name, signature, m.label(start), m.label(end))
+	}
+}
+
+func (m *methodWriter) VisitLineNumber(line int, start *Label) {
+	m.method.LineNumber(line, m.label(start))
+}
+
+// VisitMaxs is ignored: the builder computes the limits of the code as
+// written, which may differ from the code read.
+func (m *methodWriter) VisitMaxs(maxStack, maxLocals int) {}
+
+func (m *methodWriter) VisitEnd() {
+	if len(m.parameters) > 0 {
+		m.method.Attribute("MethodParameters", &model.MethodParametersAttributeInfo{Parameters: m.parameters})
+	}
+	m.annotations.add(func(name string, value interface{}) { m.method.Attribute(name, value) })
+	if p := m.visibleParameters; p != nil {
+		m.method.Attribute("RuntimeVisibleParameterAnnotations",
+			&model.RuntimeVisibleParameterAnnotationsAttributeInfo{ParameterAnnotations: p.table()})
+	}
+	if p := m.invisibleParameters; p != nil {
+		m.method.Attribute("RuntimeInvisibleParameterAnnotations",
+			&model.RuntimeInvisibleParameterAnnotationsAttributeInfo{ParameterAnnotations: p.table()})
+	}
+	if len(m.frames) > 0 {
+		m.method.CodeAttribute("StackMapTable", m.stackMapTable)
+	}
+	if len(m.visibleCodeTypes) > 0 {
+		m.method.CodeAttribute("RuntimeVisibleTypeAnnotations", func() interface{} {
+			return &model.RuntimeVisibleTypeAnnotationsAttributeInfo{Annotations: m.codeTypeAnnotations(m.visibleCodeTypes)}
+		})
+	}
+	if len(m.invisibleCodeTypes) > 0 {
+		m.method.CodeAttribute("RuntimeInvisibleTypeAnnotations", func() interface{} {
+			return &model.RuntimeInvisibleTypeAnnotationsAttributeInfo{Annotations: m.codeTypeAnnotations(m.invisibleCodeTypes)}
+		})
+	}
+}
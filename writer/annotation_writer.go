@@ -0,0 +1,115 @@
+package writer
+
+import (
+	"outro/constant"
+	"outro/model"
+)
+
+// https://docs.oracle.com/javase/specs/jvms/se8/html/jvms-4.html#jvms-4.7.16
+
+func (w *ClassFileWriter) writeAnnotations(annotations []model.AnnotationInfo) {
+	w.writeCount("annotations", len(annotations))
+	for i := range annotations {
+		w.writeAnnotation(&annotations[i])
+	}
+}
+
+func (w *ClassFileWriter) writeParameterAnnotations(parameters []model.ParameterAnnotationInfo) {
+	w.writeCount8("annotated parameters", len(parameters))
+	for _, parameter := range parameters {
+		w.writeAnnotations(parameter.Annotations)
+	}
+}
+
+func (w *ClassFileWriter) writeAnnotation(annotation *model.AnnotationInfo) {
+	w.writer.WriteUint16(annotation.TypeIndex)
+	w.writeElementValuePairs(annotation.ElementValuePairs)
+}
+
+func (w *ClassFileWriter) writeElementValuePairs(pairs []model.ElementValuePair) {
+	w.writeCount("element value pairs", len(pairs))
+	for i := range pairs {
+		w.writer.WriteUint16(pairs[i].ElementNameIndex)
+		w.writeElementValue(&pairs[i].Value)
+	}
+}
+
+func (w *ClassFileWriter) writeElementValue(value *model.ElementValue) {
+	w.writer.WriteUint8(value.Tag)
+	switch value.Tag {
+	case 'B', 'C', 'D', 'F', 'I', 'J', 'S', 'Z', 's':
+		w.writer.WriteUint16(value.ConstValueIndex)
+	case 'e':
+		w.writer.WriteUint16(value.TypeNameIndex)
+		w.writer.WriteUint16(value.ConstNameIndex)
+	case 'c':
+		w.writer.WriteUint16(value.ClassInfoIndex)
+	case '@':
+		if value.AnnotationValue == nil {
+			w.fail("annotation element value without an annotation")
+			return
+		}
+		w.writeAnnotation(value.AnnotationValue)
+	case '[':
+		w.writeCount("array element values", len(value.ArrayValue))
+		for i := range value.ArrayValue {
+			w.writeElementValue(&value.ArrayValue[i])
+		}
+	default:
+		w.fail("invalid element value tag %q", value.Tag)
+	}
+}
+
+// https://docs.oracle.com/javase/specs/jvms/se8/html/jvms-4.html#jvms-4.7.20
+
+func (w *ClassFileWriter) writeTypeAnnotations(annotations []model.TypeAnnotationInfo) {
+	w.writeCount("type annotations", len(annotations))
+	for i := range annotations {
+		annotation := &annotations[i]
+		w.writer.WriteUint8(annotation.TargetType)
+		w.writeTargetInfo(annotation.TargetType, &annotation.TargetInfo)
+		w.writeCount8("type path entries", len(annotation.TargetPath))
+		for _, entry := range annotation.TargetPath {
+			w.writer.WriteUint8(entry.TypePathKind)
+			w.writer.WriteUint8(entry.TypeArgumentIndex)
+		}
+		w.writer.WriteUint16(annotation.TypeIndex)
+		w.writeElementValuePairs(annotation.ElementValuePairs)
+	}
+}
+
+func (w *ClassFileWriter) writeTargetInfo(targetType uint8, info *model.TargetInfo) {
+	switch targetType {
+	case constant.TargetClassTypeParameter, constant.TargetMethodTypeParameter:
+		w.writer.WriteUint8(info.TypeParameterIndex)
+	case constant.TargetClassExtends:
+		w.writer.WriteUint16(info.SupertypeIndex)
+	case constant.TargetClassTypeParameterBound, constant.TargetMethodTypeParameterBound:
+		w.writer.WriteUint8(info.TypeParameterIndex)
+		w.writer.WriteUint8(info.BoundIndex)
+	case constant.TargetField, constant.TargetMethodReturn, constant.TargetMethodReceiver:
+	case constant.TargetMethodFormalParameter:
+		w.writer.WriteUint8(info.FormalParameterIndex)
+	case constant.TargetThrows:
+		w.writer.WriteUint16(info.ThrowsTypeIndex)
+	case constant.TargetLocalVariable, constant.TargetResourceVariable:
+		w.writeCount("local variable targets", len(info.Table))
+		for _, local := range info.Table {
+			w.writer.WriteUint16(local.StartPC)
+			w.writer.WriteUint16(local.Length)
+			w.writer.WriteUint16(local.Index)
+		}
+	case constant.TargetExceptionParameter:
+		w.writer.WriteUint16(info.ExceptionTableIndex)
+	case constant.TargetInstanceof, constant.TargetNew,
+		constant.TargetConstructorReference, constant.TargetMethodReference:
+		w.writer.WriteUint16(info.Offset)
+	case constant.TargetCast,
+		constant.TargetConstructorInvocationTypeArgument, constant.TargetMethodInvocationTypeArgument,
+		constant.TargetConstructorReferenceTypeArgument, constant.TargetMethodReferenceTypeArgument:
+		w.writer.WriteUint16(info.Offset)
+		w.writer.WriteUint8(info.TypeArgumentIndex)
+	default:
+		w.fail("invalid type annotation target type %#x", targetType)
+	}
+}
@@ -0,0 +1,231 @@
+package writer
+
+import (
+	"outro/constant"
+	"outro/model"
+)
+
+// https://docs.oracle.com/javase/specs/jvms/se8/html/jvms-4.html#jvms-4.7
+
+// writeAttributeValue encodes the body of a decoded attribute, the inverse
+// of parser's parseAttributeValue.
+func (w *ClassFileWriter) writeAttributeValue(name string, value interface{}) {
+	switch v := value.(type) {
+	case *model.ConstantValueAttributeInfo:
+		w.writer.WriteUint16(v.ConstantValueIndex)
+	case *model.CodeAttributeInfo:
+		w.writeCodeAttributeInfo(v)
+	case *model.ExceptionsAttributeInfo:
+		w.writeIndexes("exceptions", v.ExceptionIndexTable)
+	case *model.InnerClassesAttributeInfo:
+		w.writeCount("inner classes", len(v.Classes))
+		for _, class := range v.Classes {
+			w.writer.WriteUint16(class.InnerClassInfoIndex)
+			w.writer.WriteUint16(class.OuterClassInfoIndex)
+			w.writer.WriteUint16(class.InnerNameIndex)
+			w.writer.WriteUint16(class.InnerClassAccessFlagsInfo)
+		}
+	case *model.EnclosingMethodAttributeInfo:
+		w.writer.WriteUint16(v.ClassIndex)
+		w.writer.WriteUint16(v.MethodIndex)
+	case *model.SyntheticAttributeInfo, *model.DeprecatedAttributeInfo:
+	case *model.SignatureAttributeInfo:
+		w.writer.WriteUint16(v.SignatureIndex)
+	case *model.SourceFileAttributeInfo:
+		w.writer.WriteUint16(v.SourceFileIndex)
+	case *model.SourceDebugExtensionAttributeInfo:
+		w.writer.WriteBytes(v.DebugExtension)
+	case *model.LineNumberTableAttributeInfo:
+		w.writeCount("line numbers", len(v.LineNumberTable))
+		for _, line := range v.LineNumberTable {
+			w.writer.WriteUint16(line.StartPC)
+			w.writer.WriteUint16(line.LineNumber)
+		}
+	case *model.LocalVariableTableAttributeInfo:
+		w.writeCount("local variables", len(v.LocalVariableTable))
+		for _, local := range v.LocalVariableTable {
+			w.writer.WriteUint16(local.StartPC)
+			w.writer.WriteUint16(local.Length)
+			w.writer.WriteUint16(local.NameIndex)
+			w.writer.WriteUint16(local.DescriptorIndex)
+			w.writer.WriteUint16(local.Index)
+		}
+	case *model.LocalVariableTypeTableAttributeInfo:
+		w.writeCount("local variable types", len(v.LocalVariableTable))
+		for _, local := range v.LocalVariableTable {
+			w.writer.WriteUint16(local.StartPc)
+			w.writer.WriteUint16(local.Length)
+			w.writer.WriteUint16(local.NameIndex)
+			w.writer.WriteUint16(local.SignatureIndex)
+			w.writer.WriteUint16(local.Index)
+		}
+	case *model.BootstrapMethodsAttributeInfo:
+		w.writeCount("bootstrap methods", len(v.BootstrapMethods))
+		for _, method := range v.BootstrapMethods {
+			w.writer.WriteUint16(method.BootstrapMethodRef)
+			w.writeIndexes("bootstrap arguments", method.BootstrapArguments)
+		}
+	case *model.MethodParametersAttributeInfo:
+		w.writeCount8("parameters", len(v.Parameters))
+		for _, parameter := range v.Parameters {
+			w.writer.WriteUint16(parameter.NameIndex)
+			w.writer.WriteUint16(parameter.AccessFlags)
+		}
+	case *model.ModuleAttributeInfo:
+		w.writeModuleInfo(&v.ModuleInfo)
+	case *model.ModulePackagesAttributeInfo:
+		w.writeIndexes("packages", v.PackageIndex)
+	case *model.ModuleMainClassAttributeInfo:
+		w.writer.WriteUint16(v.MainClassIndex)
+	case *model.NestHostAttributeInfo:
+		w.writer.WriteUint16(v.ClassIndex)
+	case *model.NestMembersAttributeInfo:
+		w.writeIndexes("nest members", v.Classes)
+	case *model.PermittedSubclassesAttributeInfo:
+		w.writeIndexes("permitted subclasses", v.Classes)
+	case *model.RecordAttributeInfo:
+		w.writeCount("record components", len(v.Components))
+		for _, component := range v.Components {
+			w.writer.WriteUint16(component.ComponentNameIndex)
+			w.writer.WriteUint16(component.ComponentDescriptorIndex)
+			w.writeAttributes(component.Attributes)
+		}
+	case *model.StackMapTableAttributeInfo:
+		w.writeCount("stack map frames", len(v.Entries))
+		for _, frame := range v.Entries {
+			w.writeStackMapFrame(frame)
+		}
+	case *model.RuntimeVisibleAnnotationsAttributeInfo:
+		w.writeAnnotations(v.Annotations)
+	case *model.RuntimeInvisibleAnnotationsAttributeInfo:
+		w.writeAnnotations(v.Annotations)
+	case *model.RuntimeVisibleParameterAnnotationsAttributeInfo:
+		w.writeParameterAnnotations(v.ParameterAnnotations)
+	case *model.RuntimeInvisibleParameterAnnotationsAttributeInfo:
+		w.writeParameterAnnotations(v.ParameterAnnotations)
+	case *model.RuntimeVisibleTypeAnnotationsAttributeInfo:
+		w.writeTypeAnnotations(v.Annotations)
+	case *model.RuntimeInvisibleTypeAnnotationsAttributeInfo:
+		w.writeTypeAnnotations(v.Annotations)
+	case *model.AnnotationDefaultAttributeInfo:
+		w.writeElementValue(&v.Default)
+	default:
+		w.fail("cannot encode %s attribute of type %T", name, value)
+	}
+}
+
+func (w *ClassFileWriter) writeIndexes(what string, indexes []uint16) {
+	w.writeCount(what, len(indexes))
+	for _, index := range indexes {
+		w.writer.WriteUint16(index)
+	}
+}
+
+// writeCount8 writes a u1 item count, failing if it does not fit.
+func (w *ClassFileWriter) writeCount8(what string, count int) {
+	if count > 0xFF {
+		w.fail("too many %s: %d", what, count)
+	}
+	w.writer.WriteUint8(uint8(count))
+}
+
+func (w *ClassFileWriter) writeCodeAttributeInfo(code *model.CodeAttributeInfo) {
+	w.writer.WriteUint16(code.MaxStack)
+	w.writer.WriteUint16(code.MaxLocals)
+	if len(code.Code) == 0 || len(code.Code) > 65535 {
+		w.fail("invalid code length %d", len(code.Code))
+	}
+	w.writer.WriteUint32(uint32(len(code.Code)))
+	w.writer.WriteBytes(code.Code)
+	w.writeCount("exception handlers", len(code.ExceptionTable))
+	for _, handler := range code.ExceptionTable {
+		w.writer.WriteUint16(handler.StartPC)
+		w.writer.WriteUint16(handler.EndPC)
+		w.writer.WriteUint16(handler.HandlerPC)
+		w.writer.WriteUint16(handler.CatchType)
+	}
+	w.writeAttributes(code.Attributes)
+}
+
+func (w *ClassFileWriter) writeModuleInfo(module *model.ModuleInfo) {
+	w.writer.WriteUint16(module.ModuleNameIndex)
+	w.writer.WriteUint16(module.ModuleFlags)
+	w.writer.WriteUint16(module.ModuleVersionIndex)
+	w.writeCount("requires", len(module.Requires))
+	for _, requires := range module.Requires {
+		w.writer.WriteUint16(requires.RequiresIndex)
+		w.writer.WriteUint16(requires.RequiresFlags)
+		w.writer.WriteUint16(requires.RequiresVersion)
+	}
+	w.writeCount("exports", len(module.Exports))
+	for _, exports := range module.Exports {
+		w.writer.WriteUint16(exports.ExportsIndex)
+		w.writer.WriteUint16(exports.ExportsFlags)
+		w.writeIndexes("exports targets", exports.ExportsToIndex)
+	}
+	w.writeCount("opens", len(module.Opens))
+	for _, opens := range module.Opens {
+		w.writer.WriteUint16(opens.OpensIndex)
+		w.writer.WriteUint16(opens.OpensFlags)
+		w.writeIndexes("opens targets", opens.OpensToIndex)
+	}
+	w.writeCount("uses", len(module.Uses))
+	for _, uses := range module.Uses {
+		w.writer.WriteUint16(uses.UsesIndex)
+	}
+	w.writeCount("provides", len(module.Provides))
+	for _, provides := range module.Provides {
+		w.writer.WriteUint16(provides.ProvidesIndex)
+		w.writeIndexes("providers", provides.ProvidesWithIndex)
+	}
+}
+
+// writeStackMapFrame writes a frame. Same and same_locals_1_stack_item
+// frames take their type from OffsetDelta, in the extended form when the
+// delta does not fit the type.
+func (w *ClassFileWriter) writeStackMapFrame(frame model.StackMapFrame) {
+	switch {
+	case frame.FrameType < constant.SameLocals1StackItemFrame && frame.OffsetDelta < 64:
+		frame.FrameType = uint8(frame.OffsetDelta)
+	case frame.FrameType < constant.SameLocals1StackItemFrame:
+		frame.FrameType = constant.SameFrameExtended
+	case frame.FrameType < 128 && frame.OffsetDelta < 64:
+		frame.FrameType = constant.SameLocals1StackItemFrame + uint8(frame.OffsetDelta)
+	case frame.FrameType < 128:
+		frame.FrameType = constant.SameLocals1StackItemFrameExtended
+	}
+	w.writer.WriteUint8(frame.FrameType)
+	switch {
+	case frame.FrameType < constant.SameLocals1StackItemFrame:
+	case frame.FrameType < 128:
+		w.writeVerificationTypeInfos(frame.Stack)
+	case frame.FrameType < constant.SameLocals1StackItemFrameExtended:
+		w.fail("reserved stack map frame type %d", frame.FrameType)
+	case frame.FrameType == constant.SameLocals1StackItemFrameExtended:
+		w.writer.WriteUint16(frame.OffsetDelta)
+		w.writeVerificationTypeInfos(frame.Stack)
+	case frame.FrameType <= constant.SameFrameExtended:
+		w.writer.WriteUint16(frame.OffsetDelta)
+	case frame.FrameType < constant.FullFrame:
+		w.writer.WriteUint16(frame.OffsetDelta)
+		w.writeVerificationTypeInfos(frame.Locals)
+	default:
+		w.writer.WriteUint16(frame.OffsetDelta)
+		w.writeCount("stack map locals", len(frame.Locals))
+		w.writeVerificationTypeInfos(frame.Locals)
+		w.writeCount("stack map stack items", len(frame.Stack))
+		w.writeVerificationTypeInfos(frame.Stack)
+	}
+}
+
+func (w *ClassFileWriter) writeVerificationTypeInfos(infos []model.VerificationTypeInfo) {
+	for _, info := range infos {
+		w.writer.WriteUint8(info.Tag)
+		switch info.Tag {
+		case constant.ItemObject:
+			w.writer.WriteUint16(info.CpoolIndex)
+		case constant.ItemUninitialized:
+			w.writer.WriteUint16(info.Offset)
+		}
+	}
+}
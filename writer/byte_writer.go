@@ -0,0 +1,45 @@
+package writer
+
+import (
+	"encoding/binary"
+)
+
+// ByteWriter appends big-endian values to a growing class file.
+type ByteWriter struct {
+	data []byte
+}
+
+func NewByteWriter() *ByteWriter {
+	return &ByteWriter{}
+}
+
+func (w *ByteWriter) WriteUint8(v uint8) {
+	w.data = append(w.data, v)
+}
+
+func (w *ByteWriter) WriteUint16(v uint16) {
+	w.data = binary.BigEndian.AppendUint16(w.data, v)
+}
+
+func (w *ByteWriter) WriteUint32(v uint32) {
+	w.data = binary.BigEndian.AppendUint32(w.data, v)
+}
+
+func (w *ByteWriter) WriteBytes(b []byte) {
+	w.data = append(w.data, b...)
+}
+
+// Len returns the number of bytes written so far.
+func (w *ByteWriter) Len() int {
+	return len(w.data)
+}
+
+// PutUint32 overwrites the four bytes at offset, to patch a length once the
+// structure it prefixes is complete.
+func (w *ByteWriter) PutUint32(offset int, v uint32) {
+	binary.BigEndian.PutUint32(w.data[offset:], v)
+}
+
+func (w *ByteWriter) Bytes() []byte {
+	return w.data
+}
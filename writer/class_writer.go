@@ -0,0 +1,133 @@
+// Package writer serializes a model.ClassFile back into class file bytes.
+// A class file parsed by the parser package and written unmodified comes
+// out byte for byte identical.
+package writer
+
+import (
+	"fmt"
+	"outro/constant"
+	"outro/model"
+	"outro/parser"
+)
+
+// ClassFileWriter encodes a class file. Counts and attribute lengths are
+// taken from the slices and encoded bodies rather than the count fields of
+// the model, so an edited model is always written consistently.
+type ClassFileWriter struct {
+	writer *ByteWriter
+	err    error
+}
+
+func NewClassFileWriter(writer *ByteWriter) *ClassFileWriter {
+	return &ClassFileWriter{writer: writer}
+}
+
+// Write serializes class into a new byte slice.
+func Write(class *model.ClassFile) ([]byte, error) {
+	writer := NewByteWriter()
+	if err := NewClassFileWriter(writer).Write(class); err != nil {
+		return nil, err
+	}
+	return writer.Bytes(), nil
+}
+
+// Write appends class to the underlying ByteWriter.
+func (w *ClassFileWriter) Write(class *model.ClassFile) error {
+	w.writer.WriteUint32(class.Magic)
+	w.writer.WriteUint16(class.MinorVersion)
+	w.writer.WriteUint16(class.MajorVersion)
+	w.writeConstantPool(class.ConstantPool)
+	w.writer.WriteUint16(class.AccessFlags)
+	w.writer.WriteUint16(class.ThisClass)
+	w.writer.WriteUint16(class.SuperClass)
+	w.writeCount("interfaces", len(class.Interfaces))
+	for _, index := range class.Interfaces {
+		w.writer.WriteUint16(index)
+	}
+	w.writeCount("fields", len(class.Fields))
+	for _, field := range class.Fields {
+		w.writeMember(field.AccessFlags, field.NameIndex, field.DescriptorIndex, field.Attributes)
+	}
+	w.writeCount("methods", len(class.Methods))
+	for _, method := range class.Methods {
+		w.writeMember(method.AccessFlags, method.NameIndex, method.DescriptorIndex, method.Attributes)
+	}
+	w.writeAttributes(class.Attributes)
+	return w.err
+}
+
+func (w *ClassFileWriter) fail(format string, args ...interface{}) {
+	if w.err == nil {
+		w.err = fmt.Errorf(format, args...)
+	}
+}
+
+// writeCount writes a u2 item count, failing if it does not fit.
+func (w *ClassFileWriter) writeCount(what string, count int) {
+	if count > 0xFFFF {
+		w.fail("too many %s: %d", what, count)
+	}
+	w.writer.WriteUint16(uint16(count))
+}
+
+func (w *ClassFileWriter) writeConstantPool(pool []model.ConstantInfo) {
+	if len(pool) == 0 {
+		w.fail("constant pool count must be at least 1")
+	}
+	w.writeCount("constant pool entries", len(pool))
+	for i := 1; i < len(pool); i++ {
+		info := pool[i]
+		w.writer.WriteUint8(info.Tag)
+		switch info.Tag {
+		case constant.ConstantUtf8:
+			w.writeUtf8(info)
+		case constant.ConstantLong, constant.ConstantDouble:
+			w.writer.WriteBytes(info.Info)
+			i++
+		case 0:
+			w.fail("empty constant pool entry at index %d", i)
+		default:
+			w.writer.WriteBytes(info.Info)
+		}
+	}
+}
+
+// writeUtf8 keeps the original bytes of an entry whose text is unchanged
+// and re-encodes it otherwise.
+func (w *ClassFileWriter) writeUtf8(info model.ConstantInfo) {
+	bytes := info.Info
+	if decoded, err := parser.DecodeMUTF8(bytes); err != nil || decoded != info.Utf8 {
+		bytes = parser.EncodeMUTF8(info.Utf8)
+	}
+	w.writeCount("bytes in CONSTANT_Utf8", len(bytes))
+	w.writer.WriteBytes(bytes)
+}
+
+func (w *ClassFileWriter) writeMember(accessFlags, nameIndex, descriptorIndex uint16, attributes model.Attributes) {
+	w.writer.WriteUint16(accessFlags)
+	w.writer.WriteUint16(nameIndex)
+	w.writer.WriteUint16(descriptorIndex)
+	w.writeAttributes(attributes)
+}
+
+func (w *ClassFileWriter) writeAttributes(attributes model.Attributes) {
+	w.writeCount("attributes", len(attributes))
+	for _, attribute := range attributes {
+		w.writeAttributeInfo(attribute)
+	}
+}
+
+// writeAttributeInfo encodes the decoded Value of an attribute, or copies
+// Info for an attribute outro does not decode.
+func (w *ClassFileWriter) writeAttributeInfo(attribute model.AttributeInfo) {
+	w.writer.WriteUint16(attribute.AttributeNameIndex)
+	if attribute.Value == nil {
+		w.writer.WriteUint32(uint32(len(attribute.Info)))
+		w.writer.WriteBytes(attribute.Info)
+		return
+	}
+	lengthOffset := w.writer.Len()
+	w.writer.WriteUint32(0)
+	w.writeAttributeValue(attribute.Name, attribute.Value)
+	w.writer.PutUint32(lengthOffset, uint32(w.writer.Len()-lengthOffset-4))
+}